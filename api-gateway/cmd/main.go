@@ -1,23 +1,246 @@
 package main
 
 import (
-	"fmt"
+	"context"
+	"errors"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/kaleabAlemayehu/eagle-commerce/api-gateway/docs"
+	"github.com/kaleabAlemayehu/eagle-commerce/api-gateway/internal/apikey"
+	"github.com/kaleabAlemayehu/eagle-commerce/api-gateway/internal/cache"
+	gatewayConfig "github.com/kaleabAlemayehu/eagle-commerce/api-gateway/internal/config"
+	"github.com/kaleabAlemayehu/eagle-commerce/api-gateway/internal/graph"
 	handler "github.com/kaleabAlemayehu/eagle-commerce/api-gateway/internal/handler"
+	gatewayMiddleware "github.com/kaleabAlemayehu/eagle-commerce/api-gateway/internal/middleware"
+	"github.com/kaleabAlemayehu/eagle-commerce/api-gateway/internal/openapi"
+	"github.com/kaleabAlemayehu/eagle-commerce/api-gateway/internal/ratelimit"
+	"github.com/kaleabAlemayehu/eagle-commerce/api-gateway/internal/registry"
+	"github.com/kaleabAlemayehu/eagle-commerce/api-gateway/internal/release"
+	"github.com/kaleabAlemayehu/eagle-commerce/api-gateway/internal/resilience"
 	router "github.com/kaleabAlemayehu/eagle-commerce/api-gateway/internal/router"
+	"github.com/kaleabAlemayehu/eagle-commerce/api-gateway/internal/routing"
+	"github.com/kaleabAlemayehu/eagle-commerce/api-gateway/internal/stream"
+	"github.com/kaleabAlemayehu/eagle-commerce/api-gateway/internal/upstream"
 	"github.com/kaleabAlemayehu/eagle-commerce/shared/config"
+	"github.com/kaleabAlemayehu/eagle-commerce/shared/database"
+	sharedMessaging "github.com/kaleabAlemayehu/eagle-commerce/shared/messaging"
 	sharedMiddleware "github.com/kaleabAlemayehu/eagle-commerce/shared/middleware"
 )
 
+// @title Eagle Commerce API
+// @version 1.0
+// @description Every service of the eCommerce application, as routed by the API Gateway
+// @BasePath /
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description A user JWT, as "Bearer <token>"
+// @securityDefinitions.apikey ApiKeyAuth
+// @in header
+// @name X-API-Key
+// @description An API key issued through the admin API
 func main() {
 	cfg := config.Load()
-	proxyHandler := handler.NewProxyHandler()
-	secret := config.Load().JWTSecret
-	auth := sharedMiddleware.NewAuth(secret)
-	r := router.NewRouter(proxyHandler, auth, cfg.AllowedOrigins)
+	gwCfg := gatewayConfig.Load()
+
+	// Connect to NATS
+	natsClient, err := sharedMessaging.NewNATSClient(cfg.NATS.URL)
+	if err != nil {
+		log.Fatal("Failed to connect to NATS:", err)
+	}
+
+	// Routes and upstreams, from the routing config file when there's one
+	routes := routing.FromEnv(gwCfg, cfg.AllowedOrigins)
+	var watcher *routing.Watcher
+	if gwCfg.Routes.File != "" {
+		watcher = routing.NewWatcher(gwCfg.Routes.File, gwCfg.Routes.ReloadInterval, routes)
+		if routes, err = watcher.Load(); err != nil {
+			log.Fatalf("Invalid routing config %s: %v", gwCfg.Routes.File, err)
+		}
+	} else if err := routes.Validate(); err != nil {
+		log.Fatal("Invalid routing config:", err)
+	}
+
+	// Service registry with the statically configured instances
+	reg := registry.NewRegistry(gwCfg.Discovery.HeartbeatTTL)
+	policies := resilience.NewPolicies()
+	breakers := resilience.NewBreakers()
+	releases := release.NewReleases()
+	shedder := resilience.NewShedder()
+	upstreams := routing.NewUpstreams(reg, policies, breakers, releases, shedder)
+	if err := upstreams.Apply(routes.Upstreams); err != nil {
+		log.Fatal("Invalid upstreams:", err)
+	}
+
+	// Instances announcing themselves over NATS
+	identitySigner := sharedMiddleware.NewIdentitySigner(cfg.InternalSecret)
+	if err := registry.NewDiscovery(reg, natsClient, identitySigner).StartListening(); err != nil {
+		log.Fatal("Failed to listen NATS events:", err)
+	}
+
+	ctx, stopChecks := context.WithCancel(context.Background())
+	defer stopChecks()
+	registry.NewHealthChecker(
+		reg,
+		gwCfg.Discovery.HealthCheckPath,
+		gwCfg.Discovery.HealthCheckInterval,
+		gwCfg.Discovery.HealthCheckTimeout,
+		gwCfg.Discovery.HealthyThreshold,
+		gwCfg.Discovery.UnhealthyThreshold,
+	).Start(ctx)
+
+	// Catalog response cache, evicted by product events
+	var responseCache *cache.Cache
+	if gwCfg.Cache.Enabled {
+		store := cache.NewMemoryStore(gwCfg.Cache.MaxEntries, gwCfg.Cache.MaxBytes)
+		responseCache = cache.NewCache(store, gwCfg.Cache.TTL, gwCfg.Cache.MaxEntryBytes)
+		if err := cache.NewProductInvalidator(responseCache, natsClient, "/api/v1/products").StartListening(); err != nil {
+			log.Fatal("Failed to listen NATS events:", err)
+		}
+	}
+
+	// Order events pushed to their owners
+	hub := stream.NewHub(gwCfg.Stream.Backlog, gwCfg.Stream.Retention)
+	if err := hub.StartListening(natsClient); err != nil {
+		log.Fatal("Failed to listen NATS events:", err)
+	}
+
+	// Rate limiting
+	proxies, err := gatewayMiddleware.ParseTrustedProxies(gwCfg.RateLimit.TrustedProxies)
+	if err != nil {
+		log.Fatal("Invalid trusted proxies:", err)
+	}
+	var mongoDB *database.MongoDB
+	if gwCfg.RateLimit.Store == "mongo" || gwCfg.APIKeys.Enabled {
+		mongoDB, err = database.NewMongoDB(cfg.MongoDB.URI, cfg.MongoDB.Database)
+		if err != nil {
+			log.Fatal("Failed to connect to MongoDB:", err)
+		}
+	}
+
+	var limitStore ratelimit.Store
+	switch gwCfg.RateLimit.Store {
+	case "memory":
+		limitStore = ratelimit.NewMemoryStore(5 * time.Minute)
+	case "mongo":
+		if limitStore, err = ratelimit.NewMongoStore(ctx, mongoDB.Database); err != nil {
+			log.Fatal("Failed to create rate limit store:", err)
+		}
+	case "nats":
+		// Reloaded routes may lengthen the windows up to the maximum
+		kv, err := natsClient.KeyValue(gwCfg.RateLimit.KVBucket, gwCfg.RateLimit.MaxWindow)
+		if err != nil {
+			log.Fatal("Failed to create rate limit bucket:", err)
+		}
+		limitStore = ratelimit.NewNATSStore(kv)
+	default:
+		log.Fatalf("Unknown rate limit store %q", gwCfg.RateLimit.Store)
+	}
+
+	var keys *apikey.Manager
+	if gwCfg.APIKeys.Enabled {
+		keyStore, err := apikey.NewMongoStore(ctx, mongoDB.Database)
+		if err != nil {
+			log.Fatal("Failed to create API key store:", err)
+		}
+		keys = apikey.NewManager(keyStore)
+	}
+
+	// Access tokens revoked by the user service are rejected here too
+	denylistKV, err := natsClient.KeyValue(cfg.Tokens.DenylistBucket, cfg.Tokens.AccessTTL)
+	if err != nil {
+		log.Fatal("Failed to open token denylist:", err)
+	}
+	denylist := sharedMiddleware.NewDenylist(denylistKV)
+	if err := denylist.Start(ctx); err != nil {
+		log.Fatal("Failed to load token denylist:", err)
+	}
+	auth := sharedMiddleware.NewAuth(sharedMiddleware.NewRemoteKeySet(cfg.Tokens.JWKSURL)).WithDenylist(denylist)
+
+	transport := upstream.NewTransport(reg, policies, breakers, releases, identitySigner, http.DefaultTransport)
+	upstreamClient := upstream.NewClient(transport)
+	proxyHandler := handler.NewProxyHandler(reg, transport, breakers, upstream.NewMirror(transport, releases))
+	aggregateHandler := handler.NewAggregateHandler(upstreamClient)
+	graphHandler, err := graph.NewHandler(upstreamClient, auth)
+	if err != nil {
+		log.Fatal("Failed to build GraphQL schema:", err)
+	}
+	streamHandler := handler.NewStreamHandler(hub, upstreamClient, gwCfg.Stream.Heartbeat)
+	docsHandler := openapi.NewHandler(upstreamClient, docs.SwaggerInfo.ReadDoc(), router.DocumentedServices)
+	limitStats := gatewayMiddleware.NewRateLimitStats()
+	routeStats := gatewayMiddleware.NewRouteStats()
+	adminHandler := handler.NewAdminHandler(reg, breakers, responseCache, limitStats, routeStats, shedder)
+	apiKeyHandler := handler.NewAPIKeyHandler(keys)
+	r := router.NewRouter(
+		proxyHandler,
+		aggregateHandler,
+		graphHandler,
+		docsHandler,
+		streamHandler,
+		adminHandler,
+		apiKeyHandler,
+		auth,
+		keys,
+		proxies,
+		responseCache,
+		limitStore,
+		limitStats,
+		routeStats,
+		shedder,
+		gwCfg.AdminToken,
+	)
+	if err := r.Load(routes); err != nil {
+		log.Fatal("Invalid routing config:", err)
+	}
+
+	// Reloads build the new routes before touching anything, so a config
+	// chi refuses leaves the running one untouched
+	if watcher != nil {
+		watcher.Start(ctx, func(routes *routing.Config) error {
+			mux, err := r.Build(routes)
+			if err != nil {
+				return err
+			}
+			if err := upstreams.Apply(routes.Upstreams); err != nil {
+				return err
+			}
+			r.Swap(mux)
+			return nil
+		})
+	}
+
 	port := "8080"
-	fmt.Printf("API Gateway starting on port %s\n", port)
-	log.Fatal(http.ListenAndServe(":"+port, r))
+	server := http.Server{
+		Addr:    ":" + port,
+		Handler: r,
+	}
+	// Event streams never end on their own
+	server.RegisterOnShutdown(hub.Close)
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		log.Printf("API Gateway starting on port %s\n", port)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("ListenAndServe Error: %v ", err)
+		}
+	}()
+	<-stop
+
+	log.Println("Shutting down gracefully...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("HTTP server Shutdown error: %v", err)
+	}
+	natsClient.Close()
+	if mongoDB != nil {
+		mongoDB.Close()
+	}
+
+	log.Println("Server stopped")
 }
@@ -0,0 +1,107 @@
+package apikey
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// touchInterval bounds how often the last use of a key is written
+const touchInterval = time.Minute
+
+// Manager issues, authenticates and revokes API keys
+type Manager struct {
+	store *MongoStore
+
+	mu      sync.Mutex
+	touched map[primitive.ObjectID]time.Time
+}
+
+func NewManager(store *MongoStore) *Manager {
+	return &Manager{
+		store:   store,
+		touched: make(map[primitive.ObjectID]time.Time),
+	}
+}
+
+// Create issues a key, the returned string is the only time it's visible
+func (m *Manager) Create(ctx context.Context, name string, scopes []string, expiresAt *time.Time) (string, *APIKey, error) {
+	if err := ValidateScopes(scopes); err != nil {
+		return "", nil, err
+	}
+
+	raw, hashed, err := generate()
+	if err != nil {
+		return "", nil, err
+	}
+	key := &APIKey{
+		Name:      name,
+		Prefix:    raw[:len(keyPrefix)+6],
+		Hash:      hashed,
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	}
+	if err := m.store.Create(ctx, key); err != nil {
+		return "", nil, err
+	}
+	return raw, key, nil
+}
+
+func (m *Manager) Get(ctx context.Context, id string) (*APIKey, error) {
+	return m.store.GetByID(ctx, id)
+}
+
+func (m *Manager) List(ctx context.Context) ([]*APIKey, error) {
+	return m.store.List(ctx)
+}
+
+func (m *Manager) Revoke(ctx context.Context, id string) (*APIKey, error) {
+	return m.store.Revoke(ctx, id, time.Now())
+}
+
+// Authenticate returns the key matching raw when it's still usable, and
+// records that it was used
+func (m *Manager) Authenticate(ctx context.Context, raw string) (*APIKey, error) {
+	if !strings.HasPrefix(raw, keyPrefix) {
+		return nil, ErrInvalidKey
+	}
+
+	key, err := m.store.GetByHash(ctx, hash(raw))
+	if errors.Is(err, ErrKeyNotFound) {
+		return nil, ErrInvalidKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if err := key.Check(now); err != nil {
+		return nil, err
+	}
+	m.touch(key.ID, now)
+	return key, nil
+}
+
+// touch writes the last use in the background, at most once per interval
+func (m *Manager) touch(id primitive.ObjectID, now time.Time) {
+	m.mu.Lock()
+	if now.Sub(m.touched[id]) < touchInterval {
+		m.mu.Unlock()
+		return
+	}
+	m.touched[id] = now
+	m.mu.Unlock()
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := m.store.Touch(ctx, id, now); err != nil {
+			log.Printf("Failed to record use of API key %s: %v", id.Hex(), err)
+		}
+	}()
+}
@@ -0,0 +1,94 @@
+package apikey
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore keeps the API keys in the api_keys collection
+type MongoStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoStore(ctx context.Context, db *mongo.Database) (*MongoStore, error) {
+	collection := db.Collection("api_keys")
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "hash", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &MongoStore{collection: collection}, nil
+}
+
+func (s *MongoStore) Create(ctx context.Context, key *APIKey) error {
+	key.ID = primitive.NewObjectID()
+	key.CreatedAt = time.Now()
+	_, err := s.collection.InsertOne(ctx, key)
+	return err
+}
+
+func (s *MongoStore) GetByID(ctx context.Context, id string) (*APIKey, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrKeyNotFound
+	}
+	return s.findOne(ctx, bson.M{"_id": objectID})
+}
+
+func (s *MongoStore) GetByHash(ctx context.Context, hash string) (*APIKey, error) {
+	return s.findOne(ctx, bson.M{"hash": hash})
+}
+
+func (s *MongoStore) List(ctx context.Context) ([]*APIKey, error) {
+	cursor, err := s.collection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	keys := []*APIKey{}
+	if err := cursor.All(ctx, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// Revoke marks the key revoked, revoking it again keeps the first time
+func (s *MongoStore) Revoke(ctx context.Context, id string, at time.Time) (*APIKey, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrKeyNotFound
+	}
+	_, err = s.collection.UpdateOne(ctx,
+		bson.M{"_id": objectID, "revoked_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revoked_at": at}},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetByID(ctx, id)
+}
+
+func (s *MongoStore) Touch(ctx context.Context, id primitive.ObjectID, at time.Time) error {
+	_, err := s.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"last_used_at": at}})
+	return err
+}
+
+func (s *MongoStore) findOne(ctx context.Context, filter bson.M) (*APIKey, error) {
+	var key APIKey
+	if err := s.collection.FindOne(ctx, filter).Decode(&key); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrKeyNotFound
+		}
+		return nil, err
+	}
+	return &key, nil
+}
@@ -0,0 +1,240 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Cache serves GET responses from a Store, revalidating with ETags and
+// honouring Cache-Control on both the request and the upstream response.
+type Cache struct {
+	store         Store
+	ttl           time.Duration
+	maxEntryBytes int64
+	// generation is bumped on every invalidation so responses that were in
+	// flight while it happened are not stored
+	generation atomic.Uint64
+}
+
+func NewCache(store Store, ttl time.Duration, maxEntryBytes int64) *Cache {
+	return &Cache{
+		store:         store,
+		ttl:           ttl,
+		maxEntryBytes: maxEntryBytes,
+	}
+}
+
+// Key builds the cache key of a request from its path and sorted query string
+func Key(r *http.Request) string {
+	query := r.URL.Query().Encode()
+	if query == "" {
+		return r.URL.Path
+	}
+	return r.URL.Path + "?" + query
+}
+
+// Invalidate removes every entry whose key matches
+func (c *Cache) Invalidate(match func(key string) bool) int {
+	c.generation.Add(1)
+	return c.store.DeleteFunc(match)
+}
+
+func (c *Cache) Stats() Stats {
+	return c.store.Stats()
+}
+
+func (c *Cache) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		directives := parseCacheControl(r.Header.Get("Cache-Control"))
+		if _, noStore := directives["no-store"]; noStore {
+			w.Header().Set("X-Cache", "BYPASS")
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := Key(r)
+		_, noCache := directives["no-cache"]
+		if !noCache && directives["max-age"] != "0" {
+			if entry, hit := c.store.Get(key); hit {
+				c.serveEntry(w, r, entry)
+				return
+			}
+		}
+
+		generation := c.generation.Load()
+		rec := &recorder{ResponseWriter: w, header: make(http.Header), limit: c.maxEntryBytes}
+		next.ServeHTTP(rec, r)
+
+		if rec.passthrough {
+			return
+		}
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		entry := &Entry{
+			Status: rec.status,
+			Header: rec.header,
+			Body:   rec.body.Bytes(),
+		}
+		if ttl, cacheable := c.cacheTTL(entry); cacheable && c.generation.Load() == generation {
+			if entry.Header.Get("ETag") == "" {
+				entry.Header.Set("ETag", computeETag(entry.Body))
+			}
+			entry.ETag = entry.Header.Get("ETag")
+			entry.StoredAt = time.Now()
+			entry.ExpiresAt = entry.StoredAt.Add(ttl)
+			c.store.Set(key, entry)
+		}
+
+		copyHeader(w.Header(), entry.Header)
+		w.Header().Set("X-Cache", "MISS")
+		if etag := entry.Header.Get("ETag"); etag != "" && entry.Status == http.StatusOK && etagMatches(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.WriteHeader(entry.Status)
+		w.Write(entry.Body)
+	})
+}
+
+func (c *Cache) serveEntry(w http.ResponseWriter, r *http.Request, entry *Entry) {
+	copyHeader(w.Header(), entry.Header)
+	w.Header().Set("X-Cache", "HIT")
+	w.Header().Set("Age", strconv.Itoa(int(time.Since(entry.StoredAt).Seconds())))
+
+	if etagMatches(r.Header.Get("If-None-Match"), entry.ETag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.WriteHeader(entry.Status)
+	w.Write(entry.Body)
+}
+
+// cacheTTL decides whether a response may be stored and for how long
+func (c *Cache) cacheTTL(entry *Entry) (time.Duration, bool) {
+	if entry.Status != http.StatusOK {
+		return 0, false
+	}
+	if entry.Header.Get("Set-Cookie") != "" || entry.Header.Get("Vary") == "*" {
+		return 0, false
+	}
+
+	directives := parseCacheControl(entry.Header.Get("Cache-Control"))
+	for _, directive := range []string{"no-store", "no-cache", "private"} {
+		if _, exists := directives[directive]; exists {
+			return 0, false
+		}
+	}
+
+	ttl := c.ttl
+	for _, directive := range []string{"s-maxage", "max-age"} {
+		if value, exists := directives[directive]; exists {
+			seconds, err := strconv.Atoi(value)
+			if err != nil || seconds <= 0 {
+				return 0, false
+			}
+			ttl = min(ttl, time.Duration(seconds)*time.Second)
+			break
+		}
+	}
+	return ttl, ttl > 0
+}
+
+// recorder buffers the upstream response so it can be stored, falling back to
+// streaming it once it grows beyond the entry size limit
+type recorder struct {
+	http.ResponseWriter
+	header      http.Header
+	status      int
+	body        bytes.Buffer
+	limit       int64
+	passthrough bool
+}
+
+func (r *recorder) Header() http.Header {
+	if r.passthrough {
+		return r.ResponseWriter.Header()
+	}
+	return r.header
+}
+
+func (r *recorder) WriteHeader(status int) {
+	if r.passthrough || r.status != 0 {
+		return
+	}
+	r.status = status
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	if r.passthrough {
+		return r.ResponseWriter.Write(b)
+	}
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	if r.limit > 0 && int64(r.body.Len()+len(b)) > r.limit {
+		r.startPassthrough()
+		return r.ResponseWriter.Write(b)
+	}
+	return r.body.Write(b)
+}
+
+func (r *recorder) startPassthrough() {
+	r.passthrough = true
+	copyHeader(r.ResponseWriter.Header(), r.header)
+	r.ResponseWriter.Header().Set("X-Cache", "MISS")
+	r.ResponseWriter.WriteHeader(r.status)
+	r.ResponseWriter.Write(r.body.Bytes())
+	r.body = bytes.Buffer{}
+}
+
+func copyHeader(dst, src http.Header) {
+	for key, values := range src {
+		dst[key] = append([]string(nil), values...)
+	}
+}
+
+func computeETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches applies the weak comparison If-None-Match calls for
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" || etag == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func parseCacheControl(value string) map[string]string {
+	directives := make(map[string]string)
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, arg, _ := strings.Cut(part, "=")
+		directives[strings.ToLower(strings.TrimSpace(name))] = strings.Trim(strings.TrimSpace(arg), `"`)
+	}
+	return directives
+}
@@ -0,0 +1,74 @@
+package cache
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+
+	"github.com/kaleabAlemayehu/eagle-commerce/shared/messaging"
+	"github.com/kaleabAlemayehu/eagle-commerce/shared/models"
+)
+
+// ProductInvalidator evicts cached catalog responses when products change.
+// Listings and searches are always purged, product detail responses only for
+// the product named in the event.
+type ProductInvalidator struct {
+	cache      *Cache
+	natsClient *messaging.NATSClient
+	basePath   string
+}
+
+func NewProductInvalidator(cache *Cache, natsClient *messaging.NATSClient, basePath string) *ProductInvalidator {
+	return &ProductInvalidator{
+		cache:      cache,
+		natsClient: natsClient,
+		basePath:   strings.TrimSuffix(basePath, "/"),
+	}
+}
+
+func (i *ProductInvalidator) StartListening() error {
+	for _, subject := range []string{
+		models.ProductCreatedEvent,
+		models.ProductUpdatedEvent,
+		models.ProductStockUpdatedEvent,
+		models.ProductDeletedEvent,
+	} {
+		if _, err := i.natsClient.Subscribe(subject, i.handleProductEvent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (i *ProductInvalidator) handleProductEvent(data []byte) {
+	var event models.Event
+	if err := json.Unmarshal(data, &event); err != nil {
+		log.Printf("Error unmarshaling product event: %v", err)
+		return
+	}
+
+	productID, _ := event.Data["product_id"].(string)
+	detailPath := i.basePath + "/" + productID
+	deleted := i.cache.Invalidate(func(key string) bool {
+		path, _, _ := strings.Cut(key, "?")
+		if !strings.HasPrefix(path, i.basePath) {
+			return false
+		}
+		// Without a product id there is no telling which details went stale
+		if productID == "" || path == detailPath {
+			return true
+		}
+		return !i.isDetailPath(path)
+	})
+
+	if deleted > 0 {
+		log.Printf("Invalidated %d cached responses on %s for product %s", deleted, event.Type, productID)
+	}
+}
+
+// isDetailPath reports whether path names a single product rather than a
+// listing such as the collection itself or a search
+func (i *ProductInvalidator) isDetailPath(path string) bool {
+	rest := strings.Trim(strings.TrimPrefix(path, i.basePath), "/")
+	return rest != "" && rest != "search" && !strings.Contains(rest, "/")
+}
@@ -0,0 +1,151 @@
+package cache
+
+import (
+	"container/list"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Entry is a cached upstream response
+type Entry struct {
+	Status    int
+	Header    http.Header
+	Body      []byte
+	ETag      string
+	StoredAt  time.Time
+	ExpiresAt time.Time
+}
+
+func (e *Entry) size() int64 {
+	size := int64(len(e.Body))
+	for key, values := range e.Header {
+		size += int64(len(key))
+		for _, value := range values {
+			size += int64(len(value))
+		}
+	}
+	return size
+}
+
+// Store is a backend holding cached responses
+type Store interface {
+	Get(key string) (*Entry, bool)
+	Set(key string, entry *Entry)
+	Delete(key string)
+	// DeleteFunc removes every entry whose key matches
+	DeleteFunc(match func(key string) bool) int
+	Stats() Stats
+}
+
+type Stats struct {
+	Entries    int   `json:"entries"`
+	Bytes      int64 `json:"bytes"`
+	MaxEntries int   `json:"max_entries"`
+	MaxBytes   int64 `json:"max_bytes"`
+	Evictions  int64 `json:"evictions"`
+}
+
+type memoryItem struct {
+	key   string
+	entry *Entry
+	size  int64
+}
+
+// MemoryStore is an in-process LRU store bounded by entry count and bytes
+type MemoryStore struct {
+	mu         sync.Mutex
+	items      map[string]*list.Element
+	lru        *list.List
+	bytes      int64
+	maxEntries int
+	maxBytes   int64
+	evictions  int64
+}
+
+func NewMemoryStore(maxEntries int, maxBytes int64) *MemoryStore {
+	return &MemoryStore{
+		items:      make(map[string]*list.Element),
+		lru:        list.New(),
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+	}
+}
+
+func (s *MemoryStore) Get(key string) (*Entry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, exists := s.items[key]
+	if !exists {
+		return nil, false
+	}
+	item := elem.Value.(*memoryItem)
+	if time.Now().After(item.entry.ExpiresAt) {
+		s.remove(elem)
+		return nil, false
+	}
+	s.lru.MoveToFront(elem)
+	return item.entry, true
+}
+
+func (s *MemoryStore) Set(key string, entry *Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	size := entry.size()
+	if s.maxBytes > 0 && size > s.maxBytes {
+		return
+	}
+
+	if elem, exists := s.items[key]; exists {
+		s.remove(elem)
+	}
+	s.items[key] = s.lru.PushFront(&memoryItem{key: key, entry: entry, size: size})
+	s.bytes += size
+
+	for (s.maxEntries > 0 && s.lru.Len() > s.maxEntries) || (s.maxBytes > 0 && s.bytes > s.maxBytes) {
+		s.remove(s.lru.Back())
+		s.evictions++
+	}
+}
+
+func (s *MemoryStore) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if elem, exists := s.items[key]; exists {
+		s.remove(elem)
+	}
+}
+
+func (s *MemoryStore) DeleteFunc(match func(key string) bool) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted := 0
+	for key, elem := range s.items {
+		if match(key) {
+			s.remove(elem)
+			deleted++
+		}
+	}
+	return deleted
+}
+
+func (s *MemoryStore) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return Stats{
+		Entries:    s.lru.Len(),
+		Bytes:      s.bytes,
+		MaxEntries: s.maxEntries,
+		MaxBytes:   s.maxBytes,
+		Evictions:  s.evictions,
+	}
+}
+
+func (s *MemoryStore) remove(elem *list.Element) {
+	item := s.lru.Remove(elem).(*memoryItem)
+	delete(s.items, item.key)
+	s.bytes -= item.size
+}
@@ -0,0 +1,201 @@
+package config
+
+import (
+	"log"
+	"time"
+
+	"github.com/caarlos0/env/v11"
+)
+
+// Config holds api-gateway specific configuration
+type Config struct {
+	Upstreams UpstreamsConfig
+	Discovery DiscoveryConfig `envPrefix:"DISCOVERY_"`
+	Cache     CacheConfig     `envPrefix:"CACHE_"`
+	RateLimit RateLimitConfig `envPrefix:"RATE_LIMIT_"`
+	APIKeys   APIKeyConfig    `envPrefix:"API_KEYS_"`
+	Stream    StreamConfig    `envPrefix:"ORDER_EVENTS_"`
+	Routes    RoutesConfig    `envPrefix:"GATEWAY_ROUTES_"`
+	// MaxBodyBytes bounds request bodies, unless the routing config says otherwise
+	MaxBodyBytes int64 `env:"GATEWAY_MAX_BODY_BYTES" envDefault:"1048576"`
+	// AdminToken guards the /admin endpoints, they are disabled when empty
+	AdminToken string `env:"GATEWAY_ADMIN_TOKEN"`
+}
+
+// UpstreamsConfig holds the settings of every service behind the gateway
+type UpstreamsConfig struct {
+	User    UpstreamConfig `envPrefix:"USER_SERVICE_"`
+	Product UpstreamConfig `envPrefix:"PRODUCT_SERVICE_"`
+	Order   UpstreamConfig `envPrefix:"ORDER_SERVICE_"`
+	Payment UpstreamConfig `envPrefix:"PAYMENT_SERVICE_"`
+}
+
+// UpstreamConfig holds the instances, balancing strategy and resilience
+// policy of a service
+type UpstreamConfig struct {
+	URLs         []string      `env:"URL" envSeparator:"," yaml:"urls"`
+	Balancer     string        `env:"BALANCER" envDefault:"round_robin" yaml:"balancer"`
+	Timeout      time.Duration `env:"TIMEOUT" envDefault:"10s" yaml:"timeout"`
+	MaxRetries   int           `env:"MAX_RETRIES" envDefault:"2" yaml:"max_retries"`
+	RetryBackoff time.Duration `env:"RETRY_BACKOFF" envDefault:"100ms" yaml:"retry_backoff"`
+	MaxBackoff   time.Duration `env:"RETRY_MAX_BACKOFF" envDefault:"2s" yaml:"retry_max_backoff"`
+	Breaker      BreakerConfig `envPrefix:"BREAKER_" yaml:"breaker"`
+	Canary       CanaryConfig  `envPrefix:"CANARY_" yaml:"canary"`
+	Shadow       ShadowConfig  `envPrefix:"SHADOW_" yaml:"shadow"`
+	Shedding     ShedConfig    `envPrefix:"SHEDDING_" yaml:"shedding"`
+}
+
+// BreakerConfig holds the circuit breaker settings of a service
+type BreakerConfig struct {
+	FailureThreshold int           `env:"FAILURE_THRESHOLD" envDefault:"5" yaml:"failure_threshold"`
+	OpenTimeout      time.Duration `env:"OPEN_TIMEOUT" envDefault:"30s" yaml:"open_timeout"`
+	HalfOpenRequests int           `env:"HALF_OPEN_REQUESTS" envDefault:"1" yaml:"half_open_requests"`
+}
+
+// CanaryConfig holds the candidate version taking a share of a service's
+// traffic. Its instances are the static URLs and the discovered instances
+// announcing the version.
+type CanaryConfig struct {
+	URLs    []string `env:"URL" envSeparator:"," yaml:"urls"`
+	Version string   `env:"VERSION" envDefault:"canary" yaml:"version"`
+	// Weight is the percentage of callers sent to the canary
+	Weight int `env:"WEIGHT" yaml:"weight"`
+	// StickyHeader names a header whose value keeps a caller on the same
+	// version instead of its user ID
+	StickyHeader string `env:"STICKY_HEADER" yaml:"sticky_header"`
+}
+
+// ShadowConfig holds the candidate version receiving copies of a service's
+// requests
+type ShadowConfig struct {
+	URLs    []string `env:"URL" envSeparator:"," yaml:"urls"`
+	Version string   `env:"VERSION" envDefault:"shadow" yaml:"version"`
+	// Percent is the percentage of requests mirrored
+	Percent int `env:"PERCENT" yaml:"percent"`
+	// Writes mirrors unsafe methods too, only GET and HEAD are by default
+	Writes bool `env:"WRITES" yaml:"writes"`
+}
+
+// ShedConfig holds the capacity of a service, low priority requests are shed
+// as it's approached. Zero disables a limit.
+type ShedConfig struct {
+	// MaxInFlight is the number of requests the service is sent concurrently
+	MaxInFlight int `env:"MAX_IN_FLIGHT" envDefault:"500" yaml:"max_in_flight"`
+	// TargetLatency is the response time the service can't keep up beyond
+	TargetLatency time.Duration `env:"TARGET_LATENCY" envDefault:"2s" yaml:"target_latency"`
+}
+
+// DiscoveryConfig holds heartbeat and active health check settings
+type DiscoveryConfig struct {
+	HeartbeatTTL        time.Duration `env:"HEARTBEAT_TTL" envDefault:"30s"`
+	HealthCheckPath     string        `env:"HEALTH_CHECK_PATH" envDefault:"/health"`
+	HealthCheckInterval time.Duration `env:"HEALTH_CHECK_INTERVAL" envDefault:"10s"`
+	HealthCheckTimeout  time.Duration `env:"HEALTH_CHECK_TIMEOUT" envDefault:"2s"`
+	UnhealthyThreshold  int           `env:"UNHEALTHY_THRESHOLD" envDefault:"3"`
+	HealthyThreshold    int           `env:"HEALTHY_THRESHOLD" envDefault:"2"`
+}
+
+// CacheConfig holds the catalog response cache settings
+type CacheConfig struct {
+	Enabled       bool          `env:"ENABLED" envDefault:"true"`
+	TTL           time.Duration `env:"TTL" envDefault:"60s"`
+	MaxEntries    int           `env:"MAX_ENTRIES" envDefault:"1000"`
+	MaxBytes      int64         `env:"MAX_BYTES" envDefault:"33554432"`
+	MaxEntryBytes int64         `env:"MAX_ENTRY_BYTES" envDefault:"1048576"`
+}
+
+// RateLimitConfig holds where rate limit counters live and the limits applied
+type RateLimitConfig struct {
+	// Store is one of memory, mongo or nats
+	Store string `env:"STORE" envDefault:"memory"`
+	// TrustedProxies lists the CIDRs allowed to set X-Forwarded-For
+	TrustedProxies []string      `env:"TRUSTED_PROXIES" envSeparator:","`
+	KVBucket       string        `env:"KV_BUCKET" envDefault:"rate_limits"`
+	Anonymous      RateLimitTier `envPrefix:"IP_"`
+	User           RateLimitTier `envPrefix:"USER_"`
+	Auth           RateLimitTier `envPrefix:"AUTH_"`
+	// MaxWindow bounds the window of every tier, routing configs with a
+	// longer one are rejected. The NATS bucket keeps counters that long.
+	MaxWindow time.Duration `env:"MAX_WINDOW" envDefault:"24h"`
+}
+
+// APIKeyConfig holds the API key settings, keys are stored in MongoDB
+type APIKeyConfig struct {
+	Enabled bool `env:"ENABLED" envDefault:"true"`
+}
+
+// StreamConfig holds the order event stream settings
+type StreamConfig struct {
+	Heartbeat time.Duration `env:"HEARTBEAT" envDefault:"15s"`
+	// Backlog is how many events are kept per order for clients to resume
+	Backlog   int           `env:"BACKLOG" envDefault:"50"`
+	Retention time.Duration `env:"RETENTION" envDefault:"1h"`
+}
+
+// RoutesConfig points to the routing config file. Routes, upstreams, rate
+// limit tiers and CORS origins come from the environment when it's not set.
+type RoutesConfig struct {
+	File string `env:"FILE"`
+	// ReloadInterval is how often the file is checked for changes
+	ReloadInterval time.Duration `env:"RELOAD_INTERVAL" envDefault:"5s"`
+}
+
+// RateLimitTier is a number of requests allowed per window
+type RateLimitTier struct {
+	Requests int           `env:"REQUESTS" yaml:"requests"`
+	Window   time.Duration `env:"WINDOW" envDefault:"1m" yaml:"window"`
+}
+
+var defaultURLs = map[string]string{
+	"user":    "http://localhost:8081",
+	"product": "http://localhost:8082",
+	"order":   "http://localhost:8083",
+	"payment": "http://localhost:8084",
+}
+
+// ByService returns the upstream settings keyed by the service name used in routes
+func (u UpstreamsConfig) ByService() map[string]UpstreamConfig {
+	return map[string]UpstreamConfig{
+		"user":    u.User,
+		"product": u.Product,
+		"order":   u.Order,
+		"payment": u.Payment,
+	}
+}
+
+func (u *UpstreamsConfig) pointers() map[string]*UpstreamConfig {
+	return map[string]*UpstreamConfig{
+		"user":    &u.User,
+		"product": &u.Product,
+		"order":   &u.Order,
+		"payment": &u.Payment,
+	}
+}
+
+// Load reads the gateway environment variables into Config
+func Load() *Config {
+	var cfg Config
+	if err := env.Parse(&cfg); err != nil {
+		log.Fatalf("Failed to parse gateway environment variables: %v", err)
+	}
+
+	// Fall back to the local development ports when nothing is configured
+	for name, upstream := range cfg.Upstreams.pointers() {
+		if len(upstream.URLs) == 0 {
+			upstream.URLs = []string{defaultURLs[name]}
+		}
+	}
+
+	// Tiers share their field names, so defaults differ per tier here
+	for tier, requests := range map[*RateLimitTier]int{
+		&cfg.RateLimit.Anonymous: 100,
+		&cfg.RateLimit.User:      300,
+		&cfg.RateLimit.Auth:      10,
+	} {
+		if tier.Requests == 0 {
+			tier.Requests = requests
+		}
+	}
+
+	return &cfg
+}
@@ -0,0 +1,230 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+
+	"github.com/kaleabAlemayehu/eagle-commerce/api-gateway/internal/upstream"
+	sharedMiddleware "github.com/kaleabAlemayehu/eagle-commerce/shared/middleware"
+)
+
+// maxQueryBytes bounds the size of a GraphQL request body
+const maxQueryBytes = 1 << 20
+
+type request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// credentialFields are the mutations taking passwords and second factors,
+// rate limited like the login endpoints they call
+var credentialFields = map[string]bool{
+	"signup":          true,
+	"login":           true,
+	"verifyTwoFactor": true,
+}
+
+// CredentialLimit counts a credential mutation against the rate limit of the
+// credential endpoints, reporting whether it may run
+type CredentialLimit func(w http.ResponseWriter, r *http.Request) bool
+
+// Handler serves GraphQL queries over HTTP. A bearer token is optional at
+// this level, resolvers that need a user reject the field without one.
+type Handler struct {
+	schema          graphql.Schema
+	resolver        *resolver
+	auth            *sharedMiddleware.Auth
+	credentialLimit CredentialLimit
+}
+
+func NewHandler(client *upstream.Client, auth *sharedMiddleware.Auth) (*Handler, error) {
+	schema, err := NewSchema(client)
+	if err != nil {
+		return nil, err
+	}
+	return &Handler{
+		schema:   schema,
+		resolver: &resolver{client: client},
+		auth:     auth,
+	}, nil
+}
+
+// WithCredentialLimit returns a handler sharing the schema of h that counts
+// credential mutations with limit
+func (h *Handler) WithCredentialLimit(limit CredentialLimit) *Handler {
+	limited := *h
+	limited.credentialLimit = limit
+	return &limited
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req request
+	switch r.Method {
+	case http.MethodGet:
+		// Only queries are allowed over GET, see below
+		req.Query = r.URL.Query().Get("query")
+		req.OperationName = r.URL.Query().Get("operationName")
+		if variables := r.URL.Query().Get("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &req.Variables); err != nil {
+				sendErrors(w, http.StatusBadRequest, "Invalid variables")
+				return
+			}
+		}
+	case http.MethodPost:
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxQueryBytes)).Decode(&req); err != nil {
+			sendErrors(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		sendErrors(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	if strings.TrimSpace(req.Query) == "" {
+		sendErrors(w, http.StatusBadRequest, "Query is required")
+		return
+	}
+
+	// Documents that don't parse are left for graphql.Do to report
+	document, _ := parser.Parse(parser.ParseParams{Source: req.Query})
+	operations := selectedOperations(document, req.OperationName)
+	// GET requests may be replayed by caches and prefetchers, they must not mutate
+	if r.Method == http.MethodGet && isMutation(operations) {
+		sendErrors(w, http.StatusMethodNotAllowed, "Mutations must use POST")
+		return
+	}
+	// Aliases would let one request try many passwords or codes for a single
+	// hit on the rate limit
+	switch credentials := credentialSelections(document, operations); {
+	case credentials > 1:
+		sendErrors(w, http.StatusBadRequest, "Only one signup, login or verifyTwoFactor per operation")
+		return
+	case credentials == 1 && h.credentialLimit != nil:
+		if !h.credentialLimit(w, r) {
+			sendErrors(w, http.StatusTooManyRequests, "Rate limit exceeded")
+			return
+		}
+	}
+
+	var claims *sharedMiddleware.Claims
+	if token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); found {
+		validated, err := h.auth.ValidateJWT(token)
+		if err != nil {
+			sendErrors(w, http.StatusUnauthorized, "Invalid token")
+			return
+		}
+		claims = validated
+	}
+
+	state := h.resolver.newRequestState(r, claims)
+	ctx := context.WithValue(r.Context(), stateContextKey{}, state)
+
+	params := graphql.Params{
+		Schema:         h.schema,
+		RequestString:  req.Query,
+		VariableValues: req.Variables,
+		OperationName:  req.OperationName,
+		Context:        ctx,
+	}
+
+	result := graphql.Do(params)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// selectedOperations returns the operations of document that may run, every
+// one of them when no operation name is given
+func selectedOperations(document *ast.Document, operationName string) []*ast.OperationDefinition {
+	if document == nil {
+		return nil
+	}
+	var operations []*ast.OperationDefinition
+	for _, definition := range document.Definitions {
+		operation, ok := definition.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		if operationName != "" && (operation.Name == nil || operation.Name.Value != operationName) {
+			continue
+		}
+		operations = append(operations, operation)
+	}
+	return operations
+}
+
+// isMutation reports whether the operation that would run is a mutation
+func isMutation(operations []*ast.OperationDefinition) bool {
+	for _, operation := range operations {
+		if operation.Operation == ast.OperationTypeMutation {
+			return true
+		}
+	}
+	return false
+}
+
+// credentialSelections counts the credential mutations selected by the
+// mutations among operations, aliases and fragments included
+func credentialSelections(document *ast.Document, operations []*ast.OperationDefinition) int {
+	fragments := make(map[string]*ast.FragmentDefinition)
+	if document != nil {
+		for _, definition := range document.Definitions {
+			if fragment, ok := definition.(*ast.FragmentDefinition); ok && fragment.Name != nil {
+				fragments[fragment.Name.Value] = fragment
+			}
+		}
+	}
+
+	var count func(selectionSet *ast.SelectionSet, visited map[string]bool) int
+	count = func(selectionSet *ast.SelectionSet, visited map[string]bool) int {
+		if selectionSet == nil {
+			return 0
+		}
+		n := 0
+		for _, selection := range selectionSet.Selections {
+			switch selection := selection.(type) {
+			case *ast.Field:
+				if selection.Name != nil && credentialFields[selection.Name.Value] {
+					n++
+				}
+			case *ast.InlineFragment:
+				n += count(selection.SelectionSet, visited)
+			case *ast.FragmentSpread:
+				// Spreads of a fragment are all counted, cycles only once
+				if selection.Name == nil {
+					continue
+				}
+				name := selection.Name.Value
+				if fragment, ok := fragments[name]; ok && !visited[name] {
+					visited[name] = true
+					n += count(fragment.SelectionSet, visited)
+					delete(visited, name)
+				}
+			}
+		}
+		return n
+	}
+
+	n := 0
+	for _, operation := range operations {
+		if operation.Operation == ast.OperationTypeMutation {
+			n += count(operation.SelectionSet, map[string]bool{})
+		}
+	}
+	return n
+}
+
+func sendErrors(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"errors": []map[string]string{{"message": message}},
+	})
+}
@@ -0,0 +1,84 @@
+package graph
+
+import (
+	"sync"
+)
+
+// BatchFunc fetches many keys in one call, keys missing from the result
+// resolve to null
+type BatchFunc func(keys []string) (map[string]any, error)
+
+// Loader collects the keys requested by resolvers and fetches them in a single
+// batch. Load returns a thunk, graphql-go resolves every thunk of a level only
+// after all the resolvers of that level ran, so sibling lookups end up in the
+// same batch. A loader lives for one request and caches what it fetched.
+type Loader struct {
+	fetch    BatchFunc
+	maxBatch int
+
+	mu      sync.Mutex
+	pending []string
+	queued  map[string]bool
+	results map[string]any
+	errors  map[string]error
+}
+
+func NewLoader(fetch BatchFunc, maxBatch int) *Loader {
+	return &Loader{
+		fetch:    fetch,
+		maxBatch: maxBatch,
+		queued:   make(map[string]bool),
+		results:  make(map[string]any),
+		errors:   make(map[string]error),
+	}
+}
+
+func (l *Loader) Load(key string) func() (interface{}, error) {
+	l.mu.Lock()
+	_, loaded := l.results[key]
+	_, failed := l.errors[key]
+	if !loaded && !failed && !l.queued[key] {
+		l.queued[key] = true
+		l.pending = append(l.pending, key)
+	}
+	l.mu.Unlock()
+
+	return func() (interface{}, error) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		l.dispatch()
+		if err, failed := l.errors[key]; failed {
+			return nil, err
+		}
+		return l.results[key], nil
+	}
+}
+
+// dispatch fetches every pending key, l.mu must be held
+func (l *Loader) dispatch() {
+	if len(l.pending) == 0 {
+		return
+	}
+	pending := l.pending
+	l.pending = nil
+
+	size := l.maxBatch
+	if size <= 0 {
+		size = len(pending)
+	}
+	for len(pending) > 0 {
+		keys := pending[:min(len(pending), size)]
+		pending = pending[len(keys):]
+
+		results, err := l.fetch(keys)
+		for _, key := range keys {
+			delete(l.queued, key)
+			if err != nil {
+				l.errors[key] = err
+				continue
+			}
+			l.results[key] = results[key]
+		}
+	}
+}
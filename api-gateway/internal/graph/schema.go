@@ -0,0 +1,421 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+
+	"github.com/kaleabAlemayehu/eagle-commerce/api-gateway/internal/upstream"
+	sharedMiddleware "github.com/kaleabAlemayehu/eagle-commerce/shared/middleware"
+)
+
+// maxBatchSize matches the largest batch the services accept
+const maxBatchSize = 100
+
+var errUnauthenticated = errors.New("authentication required")
+
+// requestState is what resolvers need from the HTTP request being served
+type requestState struct {
+	r        *http.Request
+	claims   *sharedMiddleware.Claims
+	products *Loader
+	payments *Loader
+}
+
+type stateContextKey struct{}
+
+func stateFrom(ctx context.Context) *requestState {
+	state, _ := ctx.Value(stateContextKey{}).(*requestState)
+	return state
+}
+
+type resolver struct {
+	client *upstream.Client
+}
+
+// newRequestState creates the per request loaders
+func (res *resolver) newRequestState(r *http.Request, claims *sharedMiddleware.Claims) *requestState {
+	state := &requestState{r: r, claims: claims}
+	state.products = NewLoader(func(ids []string) (map[string]any, error) {
+		var body struct {
+			Products []map[string]any `json:"products"`
+		}
+		path := "/api/v1/products?ids=" + url.QueryEscape(strings.Join(ids, ","))
+		if err := res.client.Get(state.r, "product", path, &body); err != nil {
+			return nil, err
+		}
+		return indexBy(body.Products, "id"), nil
+	}, maxBatchSize)
+	state.payments = NewLoader(func(orderIDs []string) (map[string]any, error) {
+		var payments []map[string]any
+		path := "/api/v1/payments?order_ids=" + url.QueryEscape(strings.Join(orderIDs, ","))
+		if err := res.client.Get(state.r, "payment", path, &payments); err != nil {
+			return nil, err
+		}
+		return indexBy(payments, "order_id"), nil
+	}, maxBatchSize)
+	return state
+}
+
+func indexBy(items []map[string]any, name string) map[string]any {
+	index := make(map[string]any, len(items))
+	for _, item := range items {
+		if id, ok := item[name].(string); ok {
+			index[id] = item
+		}
+	}
+	return index
+}
+
+func requireAuth(p graphql.ResolveParams) (*requestState, error) {
+	state := stateFrom(p.Context)
+	if state == nil || state.claims == nil {
+		return nil, errUnauthenticated
+	}
+	return state, nil
+}
+
+// get fetches a single resource, a missing one resolves to null
+func (res *resolver) get(state *requestState, service, path string) (interface{}, error) {
+	var out map[string]any
+	if err := res.client.Get(state.r, service, path, &out); err != nil {
+		if upstream.StatusOf(err) == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return out, nil
+}
+
+// list fetches a collection, unwrapping it from the named field when the
+// service nests it
+func (res *resolver) list(state *requestState, service, path, name string) (interface{}, error) {
+	if name == "" {
+		var out []map[string]any
+		err := res.client.Get(state.r, service, path, &out)
+		return out, err
+	}
+	var out map[string][]map[string]any
+	err := res.client.Get(state.r, service, path, &out)
+	return out[name], err
+}
+
+func (res *resolver) send(state *requestState, service, method, path string, body any) (interface{}, error) {
+	var out map[string]any
+	if err := res.client.Do(state.r, service, method, path, body, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func pagination(p graphql.ResolveParams) string {
+	limit, _ := p.Args["limit"].(int)
+	offset, _ := p.Args["offset"].(int)
+	return fmt.Sprintf("limit=%d&offset=%d", limit, offset)
+}
+
+func sourceString(p graphql.ResolveParams, name string) string {
+	source, _ := p.Source.(map[string]any)
+	value, _ := source[name].(string)
+	return value
+}
+
+// NewSchema builds the GraphQL schema over the user, product, order and
+// payment services
+func NewSchema(client *upstream.Client) (graphql.Schema, error) {
+	res := &resolver{client: client}
+
+	orderItemType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "OrderItem",
+		Fields: graphql.Fields{
+			"productId": field(graphql.ID, "product_id"),
+			"name":      field(graphql.String, "name"),
+			"price":     field(graphql.Float, "price"),
+			"quantity":  field(graphql.Int, "quantity"),
+			"subtotal":  field(graphql.Float, "subtotal"),
+			"product": &graphql.Field{
+				Type: productType,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					state, err := requireAuth(p)
+					if err != nil {
+						return nil, err
+					}
+					return state.products.Load(sourceString(p, "product_id")), nil
+				},
+			},
+		},
+	})
+
+	orderType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Order",
+		Fields: graphql.Fields{
+			"id":        field(graphql.NewNonNull(graphql.ID), "id"),
+			"userId":    field(graphql.ID, "user_id"),
+			"items":     field(graphql.NewList(orderItemType), "items"),
+			"total":     field(graphql.Float, "total"),
+			"status":    field(graphql.String, "status"),
+			"address":   field(addressType, "address"),
+			"addressId": field(graphql.ID, "address_id"),
+			"createdAt": field(graphql.String, "created_at"),
+			"updatedAt": field(graphql.String, "updated_at"),
+			"payment": &graphql.Field{
+				Type: paymentType,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					state, err := requireAuth(p)
+					if err != nil {
+						return nil, err
+					}
+					return state.payments.Load(sourceString(p, "id")), nil
+				},
+			},
+		},
+	})
+
+	userType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "User",
+		Fields: graphql.Fields{
+			"id":        field(graphql.NewNonNull(graphql.ID), "id"),
+			"email":     field(graphql.String, "email"),
+			"firstName": field(graphql.String, "first_name"),
+			"lastName":  field(graphql.String, "last_name"),
+			"address":   field(addressType, "address"),
+			"createdAt": field(graphql.String, "created_at"),
+			"updatedAt": field(graphql.String, "updated_at"),
+			// Orders need a verified email
+			"emailVerified": field(graphql.Boolean, "email_verified"),
+			"orders": &graphql.Field{
+				Type: graphql.NewList(orderType),
+				Args: pageArgs(),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					state, err := requireAuth(p)
+					if err != nil {
+						return nil, err
+					}
+					path := "/api/v1/orders/user/" + url.PathEscape(sourceString(p, "id")) + "?" + pagination(p)
+					return res.list(state, "order", path, "")
+				},
+			},
+		},
+	})
+
+	authPayloadType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "AuthPayload",
+		Fields: graphql.Fields{
+			"token":        field(graphql.String, "token"),
+			"refreshToken": field(graphql.String, "refresh_token"),
+			"expiresAt":    field(graphql.String, "expires_at"),
+			"user":         field(userType, "user"),
+			// A login needing a second factor only carries a challenge,
+			// traded for tokens by verifyTwoFactor
+			"twoFactorRequired":  field(graphql.Boolean, "two_factor_required"),
+			"enrollmentRequired": field(graphql.Boolean, "enrollment_required"),
+			"challengeToken":     field(graphql.String, "challenge_token"),
+			"recoveryCodes":      field(graphql.NewList(graphql.String), "recovery_codes"),
+		},
+	})
+
+	idArgs := graphql.FieldConfigArgument{
+		"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+	}
+
+	productsArgs := pageArgs()
+	productsArgs["category"] = &graphql.ArgumentConfig{Type: graphql.String}
+	productsArgs["search"] = &graphql.ArgumentConfig{Type: graphql.String}
+
+	ordersArgs := pageArgs()
+	ordersArgs["userId"] = &graphql.ArgumentConfig{Type: graphql.ID}
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"me": &graphql.Field{
+				Type: userType,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					state, err := requireAuth(p)
+					if err != nil {
+						return nil, err
+					}
+					return res.get(state, "user", "/api/v1/users/me")
+				},
+			},
+			"user": &graphql.Field{
+				Type: userType,
+				Args: idArgs,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					state, err := requireAuth(p)
+					if err != nil {
+						return nil, err
+					}
+					return res.get(state, "user", "/api/v1/users/"+url.PathEscape(p.Args["id"].(string)))
+				},
+			},
+			"product": &graphql.Field{
+				Type: productType,
+				Args: idArgs,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					state, err := requireAuth(p)
+					if err != nil {
+						return nil, err
+					}
+					return state.products.Load(p.Args["id"].(string)), nil
+				},
+			},
+			"products": &graphql.Field{
+				Type: graphql.NewList(productType),
+				Args: productsArgs,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					state, err := requireAuth(p)
+					if err != nil {
+						return nil, err
+					}
+					if search, _ := p.Args["search"].(string); search != "" {
+						return res.list(state, "product", "/api/v1/products/search?q="+url.QueryEscape(search)+"&"+pagination(p), "products")
+					}
+					path := "/api/v1/products?" + pagination(p)
+					if category, _ := p.Args["category"].(string); category != "" {
+						path += "&category=" + url.QueryEscape(category)
+					}
+					return res.list(state, "product", path, "products")
+				},
+			},
+			"order": &graphql.Field{
+				Type: orderType,
+				Args: idArgs,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					state, err := requireAuth(p)
+					if err != nil {
+						return nil, err
+					}
+					return res.get(state, "order", "/api/v1/orders/"+url.PathEscape(p.Args["id"].(string)))
+				},
+			},
+			"orders": &graphql.Field{
+				Type: graphql.NewList(orderType),
+				Args: ordersArgs,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					state, err := requireAuth(p)
+					if err != nil {
+						return nil, err
+					}
+					if userID, _ := p.Args["userId"].(string); userID != "" {
+						return res.list(state, "order", "/api/v1/orders/user/"+url.PathEscape(userID)+"?"+pagination(p), "")
+					}
+					return res.list(state, "order", "/api/v1/orders?"+pagination(p), "")
+				},
+			},
+		},
+	})
+
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"signup": &graphql.Field{
+				Type: authPayloadType,
+				Args: graphql.FieldConfigArgument{
+					"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(signupInputType)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					input := p.Args["input"].(map[string]interface{})
+					return res.send(stateFrom(p.Context), "user", http.MethodPost, "/api/v1/users/signup", map[string]any{
+						"email":      input["email"],
+						"password":   input["password"],
+						"first_name": input["firstName"],
+						"last_name":  input["lastName"],
+					})
+				},
+			},
+			"login": &graphql.Field{
+				Type: authPayloadType,
+				Args: graphql.FieldConfigArgument{
+					"email":    &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					"password": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return res.send(stateFrom(p.Context), "user", http.MethodPost, "/api/v1/users/login", map[string]any{
+						"email":    p.Args["email"],
+						"password": p.Args["password"],
+					})
+				},
+			},
+			"verifyTwoFactor": &graphql.Field{
+				Type: authPayloadType,
+				Args: graphql.FieldConfigArgument{
+					"challengeToken": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					"code":           &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return res.send(stateFrom(p.Context), "user", http.MethodPost, "/api/v1/users/login/two-factor", map[string]any{
+						"challenge_token": p.Args["challengeToken"],
+						"code":            p.Args["code"],
+					})
+				},
+			},
+			"createOrder": &graphql.Field{
+				Type: orderType,
+				Args: graphql.FieldConfigArgument{
+					"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(createOrderInputType)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					state, err := requireAuth(p)
+					if err != nil {
+						return nil, err
+					}
+					input := p.Args["input"].(map[string]interface{})
+					return res.send(state, "order", http.MethodPost, "/api/v1/orders", orderRequest(input))
+				},
+			},
+			"cancelOrder": &graphql.Field{
+				Type: orderType,
+				Args: idArgs,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					state, err := requireAuth(p)
+					if err != nil {
+						return nil, err
+					}
+					return res.send(state, "order", http.MethodPut, "/api/v1/orders/"+url.PathEscape(p.Args["id"].(string))+"/cancel", nil)
+				},
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{
+		Query:    query,
+		Mutation: mutation,
+	})
+}
+
+// orderRequest maps the createOrder input to the order service's request body
+func orderRequest(input map[string]interface{}) map[string]any {
+	items := []map[string]any{}
+	rawItems, _ := input["items"].([]interface{})
+	for _, rawItem := range rawItems {
+		item, _ := rawItem.(map[string]interface{})
+		items = append(items, map[string]any{
+			"product_id": item["productId"],
+			"name":       item["name"],
+			"price":      item["price"],
+			"quantity":   item["quantity"],
+		})
+	}
+
+	req := map[string]any{
+		"user_id":    input["userId"],
+		"items":      items,
+		"address_id": input["addressId"],
+	}
+	if address, ok := input["address"].(map[string]interface{}); ok {
+		req["address"] = map[string]any{
+			"street":   address["street"],
+			"city":     address["city"],
+			"state":    address["state"],
+			"zip_code": address["zipCode"],
+			"country":  address["country"],
+		}
+	}
+	return req
+}
@@ -0,0 +1,113 @@
+package graph
+
+import (
+	"github.com/graphql-go/graphql"
+)
+
+// key resolves a field from the JSON object a service returned
+func key(name string) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		if source, ok := p.Source.(map[string]any); ok {
+			return source[name], nil
+		}
+		return nil, nil
+	}
+}
+
+func field(typ graphql.Output, name string) *graphql.Field {
+	return &graphql.Field{Type: typ, Resolve: key(name)}
+}
+
+var addressType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Address",
+	Fields: graphql.Fields{
+		"street":  field(graphql.String, "street"),
+		"city":    field(graphql.String, "city"),
+		"state":   field(graphql.String, "state"),
+		"zipCode": field(graphql.String, "zip_code"),
+		"country": field(graphql.String, "country"),
+	},
+})
+
+var productType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Product",
+	Fields: graphql.Fields{
+		"id":          field(graphql.NewNonNull(graphql.ID), "id"),
+		"name":        field(graphql.String, "name"),
+		"description": field(graphql.String, "description"),
+		"price":       field(graphql.Float, "price"),
+		"stock":       field(graphql.Int, "stock"),
+		"category":    field(graphql.String, "category"),
+		"images":      field(graphql.NewList(graphql.String), "images"),
+		"active":      field(graphql.Boolean, "active"),
+		"createdAt":   field(graphql.String, "created_at"),
+		"updatedAt":   field(graphql.String, "updated_at"),
+	},
+})
+
+var paymentType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Payment",
+	Fields: graphql.Fields{
+		"id":            field(graphql.NewNonNull(graphql.ID), "id"),
+		"orderId":       field(graphql.ID, "order_id"),
+		"userId":        field(graphql.ID, "user_id"),
+		"amount":        field(graphql.Float, "amount"),
+		"currency":      field(graphql.String, "currency"),
+		"status":        field(graphql.String, "status"),
+		"method":        field(graphql.String, "method"),
+		"transactionId": field(graphql.String, "transaction_id"),
+		"createdAt":     field(graphql.String, "created_at"),
+		"updatedAt":     field(graphql.String, "updated_at"),
+	},
+})
+
+var addressInputType = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "AddressInput",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"street":  &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+		"city":    &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+		"state":   &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+		"zipCode": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+		"country": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+	},
+})
+
+var orderItemInputType = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "OrderItemInput",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"productId": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.ID)},
+		"name":      &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+		"price":     &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.Float)},
+		"quantity":  &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.Int)},
+	},
+})
+
+var createOrderInputType = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "CreateOrderInput",
+	Fields: graphql.InputObjectConfigFieldMap{
+		// Defaults to the authenticated user, only staff may name another
+		"userId":  &graphql.InputObjectFieldConfig{Type: graphql.ID},
+		"items":   &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(orderItemInputType)))},
+		"address": &graphql.InputObjectFieldConfig{Type: addressInputType},
+		// Picks an address from the address book instead, without either the
+		// default shipping address is used
+		"addressId": &graphql.InputObjectFieldConfig{Type: graphql.ID},
+	},
+})
+
+var signupInputType = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "SignupInput",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"email":     &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+		"password":  &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+		"firstName": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+		"lastName":  &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+	},
+})
+
+func pageArgs() graphql.FieldConfigArgument {
+	return graphql.FieldConfigArgument{
+		"limit":  &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 10},
+		"offset": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 0},
+	}
+}
@@ -0,0 +1,153 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/kaleabAlemayehu/eagle-commerce/api-gateway/internal/cache"
+	gatewayMiddleware "github.com/kaleabAlemayehu/eagle-commerce/api-gateway/internal/middleware"
+	"github.com/kaleabAlemayehu/eagle-commerce/api-gateway/internal/registry"
+	"github.com/kaleabAlemayehu/eagle-commerce/api-gateway/internal/resilience"
+	"github.com/kaleabAlemayehu/eagle-commerce/api-gateway/internal/routing"
+	"github.com/kaleabAlemayehu/eagle-commerce/shared/utils"
+)
+
+// defaultTopClients is how many rate limited clients are listed by default
+const defaultTopClients = 20
+
+type AdminHandler struct {
+	registry   *registry.Registry
+	breakers   *resilience.Breakers
+	cache      *cache.Cache
+	limitStats *gatewayMiddleware.RateLimitStats
+	routeStats *gatewayMiddleware.RouteStats
+	shedder    *resilience.Shedder
+}
+
+func NewAdminHandler(reg *registry.Registry, breakers *resilience.Breakers, responseCache *cache.Cache, limitStats *gatewayMiddleware.RateLimitStats, routeStats *gatewayMiddleware.RouteStats, shedder *resilience.Shedder) *AdminHandler {
+	return &AdminHandler{
+		registry:   reg,
+		breakers:   breakers,
+		cache:      responseCache,
+		limitStats: limitStats,
+		routeStats: routeStats,
+		shedder:    shedder,
+	}
+}
+
+// UpstreamStatus lists the instances of a service
+type UpstreamStatus struct {
+	Service   string                    `json:"service"`
+	Instances []registry.InstanceStatus `json:"instances"`
+}
+
+// SetUpstreamStateRequest changes the state of one instance, identified by
+// its ID or URL, or of every instance of the service when Instance is empty
+type SetUpstreamStateRequest struct {
+	Instance string `json:"instance"`
+	State    string `json:"state"`
+}
+
+// ListRoutes returns the routes of the routing config being served
+func (h *AdminHandler) ListRoutes(routes []routing.Route) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		utils.SendSuccessResponse(w, http.StatusOK, routes)
+	}
+}
+
+// ListUpstreams returns every instance of every service with its health,
+// state and requests in flight
+func (h *AdminHandler) ListUpstreams(w http.ResponseWriter, r *http.Request) {
+	upstreams := make([]UpstreamStatus, 0)
+	for _, service := range h.registry.Services() {
+		status := UpstreamStatus{Service: service, Instances: make([]registry.InstanceStatus, 0)}
+		for _, inst := range h.registry.Instances(service) {
+			status.Instances = append(status.Instances, inst.Status())
+		}
+		upstreams = append(upstreams, status)
+	}
+	utils.SendSuccessResponse(w, http.StatusOK, upstreams)
+}
+
+// SetUpstreamState drains, disables or reactivates instances of a service.
+// Draining instances finish their requests in flight without getting new
+// ones, disabled ones aren't health checked either.
+func (h *AdminHandler) SetUpstreamState(w http.ResponseWriter, r *http.Request) {
+	var req SetUpstreamStateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.SendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	state, err := registry.ParseState(req.State)
+	if err != nil {
+		utils.SendErrorResponse(w, http.StatusBadRequest, "State must be active, draining or disabled")
+		return
+	}
+
+	service := chi.URLParam(r, "service")
+	if err := h.registry.SetState(service, req.Instance, state); err != nil {
+		switch {
+		case errors.Is(err, registry.ErrServiceNotFound):
+			utils.SendErrorResponse(w, http.StatusNotFound, "Service not found")
+		case errors.Is(err, registry.ErrInstanceNotFound):
+			utils.SendErrorResponse(w, http.StatusNotFound, "Instance not found")
+		default:
+			utils.SendErrorResponse(w, http.StatusInternalServerError, "Failed to change instance state")
+		}
+		return
+	}
+
+	status := UpstreamStatus{Service: service, Instances: make([]registry.InstanceStatus, 0)}
+	for _, inst := range h.registry.Instances(service) {
+		status.Instances = append(status.Instances, inst.Status())
+	}
+	utils.SendSuccessResponse(w, http.StatusOK, status)
+}
+
+// ListBreakers returns the circuit breaker state of every upstream service
+func (h *AdminHandler) ListBreakers(w http.ResponseWriter, r *http.Request) {
+	utils.SendSuccessResponse(w, http.StatusOK, h.breakers.States())
+}
+
+// ListRateLimited returns the clients with the most rate limited requests,
+// limit of them
+func (h *AdminHandler) ListRateLimited(w http.ResponseWriter, r *http.Request) {
+	limit := defaultTopClients
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			utils.SendErrorResponse(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		limit = parsed
+	}
+	utils.SendSuccessResponse(w, http.StatusOK, h.limitStats.Top(limit))
+}
+
+// ListRouteErrors returns the requests and errors of every route over the
+// last minutes
+func (h *AdminHandler) ListRouteErrors(w http.ResponseWriter, r *http.Request) {
+	utils.SendSuccessResponse(w, http.StatusOK, map[string]any{
+		"window": gatewayMiddleware.RouteStatsWindow.String(),
+		"routes": h.routeStats.Recent(),
+	})
+}
+
+// ListLoad returns the requests in flight, latency and shed requests of
+// every upstream service
+func (h *AdminHandler) ListLoad(w http.ResponseWriter, r *http.Request) {
+	utils.SendSuccessResponse(w, http.StatusOK, h.shedder.States())
+}
+
+// CacheStats returns the size of the response cache
+func (h *AdminHandler) CacheStats(w http.ResponseWriter, r *http.Request) {
+	if h.cache == nil {
+		utils.SendErrorResponse(w, http.StatusNotFound, "Response cache is disabled")
+		return
+	}
+	utils.SendSuccessResponse(w, http.StatusOK, h.cache.Stats())
+}
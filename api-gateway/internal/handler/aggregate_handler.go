@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/kaleabAlemayehu/eagle-commerce/api-gateway/internal/upstream"
+	"github.com/kaleabAlemayehu/eagle-commerce/shared/utils"
+)
+
+// AggregateHandler serves composite endpoints that fan out to several
+// services and merge their responses, sparing clients the round trips
+type AggregateHandler struct {
+	client *upstream.Client
+}
+
+func NewAggregateHandler(client *upstream.Client) *AggregateHandler {
+	return &AggregateHandler{
+		client: client,
+	}
+}
+
+// unavailable replaces the part of a composite response a service failed to provide
+type unavailable struct {
+	Unavailable bool   `json:"unavailable"`
+	Reason      string `json:"reason"`
+}
+
+type OrderDetailsResponse struct {
+	Order    json.RawMessage `json:"order"`
+	Payment  any             `json:"payment"`
+	Products map[string]any  `json:"products"`
+}
+
+// GetOrderDetails returns an order together with its payment and products.
+// The order is required, the payment and products degrade to an unavailable
+// marker when their services fail.
+//
+// @Summary Get order details
+// @Description Get an order with its payment and products, the parts whose service failed are marked unavailable
+// @Tags orders
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path string true "Order ID"
+// @Success 200 {object} utils.APIResponse
+// @Failure 401 {object} utils.APIResponse
+// @Failure 404 {object} utils.APIResponse
+// @Failure 502 {object} utils.APIResponse
+// @Router /api/v1/orders/{id}/details [get]
+func (h *AggregateHandler) GetOrderDetails(w http.ResponseWriter, r *http.Request) {
+	orderID := chi.URLParam(r, "id")
+
+	var order json.RawMessage
+	if err := h.client.Get(r, "order", "/api/v1/orders/"+url.PathEscape(orderID), &order); err != nil {
+		status := upstream.StatusOf(err)
+		if status == http.StatusNotFound {
+			utils.SendErrorResponse(w, http.StatusNotFound, "Order not found")
+			return
+		}
+		if status == http.StatusUnauthorized || status == http.StatusForbidden {
+			utils.SendErrorResponse(w, status, err.Error())
+			return
+		}
+		utils.SendErrorResponse(w, http.StatusBadGateway, "Order service unavailable")
+		return
+	}
+
+	var items struct {
+		Items []struct {
+			ProductID string `json:"product_id"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(order, &items); err != nil {
+		utils.SendErrorResponse(w, http.StatusBadGateway, "Invalid order service response")
+		return
+	}
+
+	res := OrderDetailsResponse{
+		Order:    order,
+		Products: make(map[string]any),
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		var payment json.RawMessage
+		err := h.client.Get(r, "payment", "/api/v1/payments/order/"+url.PathEscape(orderID), &payment)
+		switch {
+		case err == nil:
+			res.Payment = payment
+		case upstream.StatusOf(err) == http.StatusNotFound:
+			// Not paid yet, the payment stays null
+		default:
+			res.Payment = unavailable{Unavailable: true, Reason: err.Error()}
+		}
+	}()
+
+	productIDs := make(map[string]struct{})
+	for _, item := range items.Items {
+		if item.ProductID != "" {
+			productIDs[item.ProductID] = struct{}{}
+		}
+	}
+	for productID := range productIDs {
+		wg.Add(1)
+		go func(productID string) {
+			defer wg.Done()
+			var value any
+			var product json.RawMessage
+			if err := h.client.Get(r, "product", "/api/v1/products/"+url.PathEscape(productID), &product); err != nil {
+				value = unavailable{Unavailable: true, Reason: err.Error()}
+			} else {
+				value = product
+			}
+			mu.Lock()
+			res.Products[productID] = value
+			mu.Unlock()
+		}(productID)
+	}
+
+	wg.Wait()
+	utils.SendSuccessResponse(w, http.StatusOK, res)
+}
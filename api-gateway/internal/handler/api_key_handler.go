@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/kaleabAlemayehu/eagle-commerce/api-gateway/internal/apikey"
+	"github.com/kaleabAlemayehu/eagle-commerce/shared/utils"
+)
+
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name" validate:"required,min=2,max=100"`
+	Scopes    []string   `json:"scopes" validate:"required,min=1"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// CreateAPIKeyResponse holds the key in clear, it can't be retrieved again
+type CreateAPIKeyResponse struct {
+	Key    string         `json:"key"`
+	APIKey *apikey.APIKey `json:"api_key"`
+}
+
+// APIKeyHandler manages API keys through the admin API
+type APIKeyHandler struct {
+	keys *apikey.Manager
+}
+
+func NewAPIKeyHandler(keys *apikey.Manager) *APIKeyHandler {
+	return &APIKeyHandler{keys: keys}
+}
+
+func (h *APIKeyHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	if !h.enabled(w) {
+		return
+	}
+
+	var req CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.SendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := utils.ValidateStruct(req); err != nil {
+		utils.SendValidationErrorResponse(w, utils.GetValidationErrors(err))
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		utils.SendErrorResponse(w, http.StatusBadRequest, "expires_at must be in the future")
+		return
+	}
+
+	key, created, err := h.keys.Create(r.Context(), req.Name, req.Scopes, req.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, apikey.ErrInvalidScope) {
+			utils.SendErrorResponse(w, http.StatusBadRequest, "Scopes must be read or write scopes of: "+strings.Join(apikey.Resources, ", "))
+			return
+		}
+		log.Printf("Failed to create API key: %v", err)
+		utils.SendErrorResponse(w, http.StatusInternalServerError, "Failed to create API key")
+		return
+	}
+
+	utils.SendSuccessResponse(w, http.StatusCreated, CreateAPIKeyResponse{Key: key, APIKey: created})
+}
+
+func (h *APIKeyHandler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	if !h.enabled(w) {
+		return
+	}
+
+	keys, err := h.keys.List(r.Context())
+	if err != nil {
+		log.Printf("Failed to list API keys: %v", err)
+		utils.SendErrorResponse(w, http.StatusInternalServerError, "Failed to list API keys")
+		return
+	}
+	utils.SendSuccessResponse(w, http.StatusOK, keys)
+}
+
+func (h *APIKeyHandler) GetAPIKey(w http.ResponseWriter, r *http.Request) {
+	if !h.enabled(w) {
+		return
+	}
+
+	key, err := h.keys.Get(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		h.sendError(w, err, "Failed to get API key")
+		return
+	}
+	utils.SendSuccessResponse(w, http.StatusOK, key)
+}
+
+// RevokeAPIKey revokes a key for good, it stays listed for auditing
+func (h *APIKeyHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	if !h.enabled(w) {
+		return
+	}
+
+	key, err := h.keys.Revoke(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		h.sendError(w, err, "Failed to revoke API key")
+		return
+	}
+	utils.SendSuccessResponse(w, http.StatusOK, key)
+}
+
+func (h *APIKeyHandler) enabled(w http.ResponseWriter) bool {
+	if h.keys == nil {
+		utils.SendErrorResponse(w, http.StatusNotFound, "API keys are disabled")
+		return false
+	}
+	return true
+}
+
+func (h *APIKeyHandler) sendError(w http.ResponseWriter, err error, message string) {
+	if errors.Is(err, apikey.ErrKeyNotFound) {
+		utils.SendErrorResponse(w, http.StatusNotFound, "API key not found")
+		return
+	}
+	log.Printf("%s: %v", message, err)
+	utils.SendErrorResponse(w, http.StatusInternalServerError, message)
+}
@@ -1,45 +1,84 @@
 package handler
 
 import (
+	"context"
+	"errors"
+	"log"
+	"math"
 	"net/http"
 	"net/http/httputil"
-	"net/url"
+	"strconv"
+
+	"github.com/kaleabAlemayehu/eagle-commerce/api-gateway/internal/registry"
+	"github.com/kaleabAlemayehu/eagle-commerce/api-gateway/internal/resilience"
+	"github.com/kaleabAlemayehu/eagle-commerce/api-gateway/internal/upstream"
+	"github.com/kaleabAlemayehu/eagle-commerce/shared/utils"
 )
 
 type ProxyHandler struct {
-	services map[string]*httputil.ReverseProxy
+	registry *registry.Registry
+	breakers *resilience.Breakers
+	mirror   *upstream.Mirror
+	proxy    *httputil.ReverseProxy
 }
 
-func NewProxyHandler() *ProxyHandler {
-	services := make(map[string]*httputil.ReverseProxy)
-
-	// Initialize service proxies
-	userServiceURL, _ := url.Parse("http://localhost:8081")
-	productServiceURL, _ := url.Parse("http://localhost:8082")
-	orderServiceURL, _ := url.Parse("http://localhost:8083")
-	paymentServiceURL, _ := url.Parse("http://localhost:8084")
-
-	services["user"] = httputil.NewSingleHostReverseProxy(userServiceURL)
-	services["product"] = httputil.NewSingleHostReverseProxy(productServiceURL)
-	services["order"] = httputil.NewSingleHostReverseProxy(orderServiceURL)
-	services["payment"] = httputil.NewSingleHostReverseProxy(paymentServiceURL)
-
-	return &ProxyHandler{
-		services: services,
+func NewProxyHandler(reg *registry.Registry, transport *upstream.Transport, breakers *resilience.Breakers, mirror *upstream.Mirror) *ProxyHandler {
+	h := &ProxyHandler{
+		registry: reg,
+		breakers: breakers,
+		mirror:   mirror,
+	}
+	h.proxy = &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetXForwarded()
+		},
+		Transport:    transport,
+		ErrorHandler: h.handleError,
 	}
+	return h
 }
 
 func (h *ProxyHandler) ProxyRequest(service string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		proxy, exists := h.services[service]
-		if !exists {
-			http.Error(w, "Service not found", http.StatusNotFound)
+		if !h.registry.HasService(service) {
+			utils.SendErrorResponse(w, http.StatusNotFound, "Service not found")
 			return
 		}
 
 		// Add service identification header
 		r.Header.Set("X-Service", service)
 
-		proxy.ServeHTTP(w, r)
+		r = r.WithContext(upstream.WithService(r.Context(), service))
+		w, r, mirrored := h.mirror.Tee(service, w, r)
+		defer mirrored()
+
+		h.proxy.ServeHTTP(w, r)
+	}
+}
+
+func (h *ProxyHandler) handleError(w http.ResponseWriter, r *http.Request, err error) {
+	service := upstream.ServiceFromContext(r.Context())
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		// The client went away, nobody is left to answer
+		return
+	case errors.Is(err, resilience.ErrCircuitOpen):
+		if breaker, exists := h.breakers.Get(service); exists {
+			retryAfter := int(math.Ceil(breaker.RetryAfter().Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(max(retryAfter, 1)))
+		}
+		utils.SendErrorResponse(w, http.StatusServiceUnavailable, "The "+service+" service is unavailable, please try again later")
+	case errors.Is(err, registry.ErrNoHealthyInstances):
+		log.Printf("No healthy %s instances for %s %s", service, r.Method, r.URL.Path)
+		utils.SendErrorResponse(w, http.StatusServiceUnavailable, "Service temporarily unavailable")
+	case errors.As(err, new(*http.MaxBytesError)):
+		utils.SendErrorResponse(w, http.StatusRequestEntityTooLarge, "Request body too large")
+	case errors.Is(err, upstream.ErrTimeout):
+		log.Printf("Timeout for %s %s on %s service", r.Method, r.URL.Path, service)
+		utils.SendErrorResponse(w, http.StatusGatewayTimeout, "The "+service+" service took too long to respond")
+	default:
+		log.Printf("Proxy error for %s %s on %s service: %v", r.Method, r.URL.Path, service, err)
+		utils.SendErrorResponse(w, http.StatusBadGateway, "Bad gateway")
 	}
 }
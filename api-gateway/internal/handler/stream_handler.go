@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/kaleabAlemayehu/eagle-commerce/api-gateway/internal/stream"
+	"github.com/kaleabAlemayehu/eagle-commerce/api-gateway/internal/upstream"
+	sharedMiddleware "github.com/kaleabAlemayehu/eagle-commerce/shared/middleware"
+	"github.com/kaleabAlemayehu/eagle-commerce/shared/models"
+	"github.com/kaleabAlemayehu/eagle-commerce/shared/utils"
+)
+
+const (
+	// retryMillis is how long EventSource clients wait before reconnecting
+	retryMillis = 3000
+
+	// writeTimeout bounds each write, so a stalled client doesn't hold its
+	// stream open forever
+	writeTimeout = 10 * time.Second
+)
+
+// StreamHandler pushes order events to clients with Server-Sent Events
+type StreamHandler struct {
+	hub       *stream.Hub
+	client    *upstream.Client
+	heartbeat time.Duration
+}
+
+func NewStreamHandler(hub *stream.Hub, client *upstream.Client, heartbeat time.Duration) *StreamHandler {
+	return &StreamHandler{
+		hub:       hub,
+		client:    client,
+		heartbeat: heartbeat,
+	}
+}
+
+// StreamOrderEvents streams the status changes and payment of an order to
+// its owner. Clients resume after the last event they saw with the
+// Last-Event-ID header, which EventSource sends on its own when reconnecting.
+//
+// @Summary Stream order events
+// @Description Server-Sent Events for the updates, shipping, cancellation and payment of an order, only for its owner
+// @Tags orders
+// @Produce text/event-stream
+// @Security BearerAuth
+// @Param id path string true "Order ID"
+// @Param Last-Event-ID header string false "Resume after this event"
+// @Success 200 {string} string "Event stream"
+// @Failure 401 {object} utils.APIResponse
+// @Failure 403 {object} utils.APIResponse
+// @Failure 404 {object} utils.APIResponse
+// @Failure 502 {object} utils.APIResponse
+// @Router /api/v1/orders/{id}/events [get]
+func (h *StreamHandler) StreamOrderEvents(w http.ResponseWriter, r *http.Request) {
+	identity, ok := sharedMiddleware.GetIdentityFromContext(r.Context())
+	if !ok || identity.UserID == "" {
+		utils.SendErrorResponse(w, http.StatusForbidden, "Order events are only available to the order's owner")
+		return
+	}
+
+	orderID := chi.URLParam(r, "id")
+	var order struct {
+		UserID string `json:"user_id"`
+	}
+	if err := h.client.Get(r, "order", "/api/v1/orders/"+url.PathEscape(orderID), &order); err != nil {
+		status := upstream.StatusOf(err)
+		if status == http.StatusNotFound {
+			utils.SendErrorResponse(w, http.StatusNotFound, "Order not found")
+			return
+		}
+		if status == http.StatusUnauthorized || status == http.StatusForbidden {
+			utils.SendErrorResponse(w, status, err.Error())
+			return
+		}
+		utils.SendErrorResponse(w, http.StatusBadGateway, "Order service unavailable")
+		return
+	}
+	// Other users' orders look missing rather than forbidden
+	if order.UserID != identity.UserID {
+		utils.SendErrorResponse(w, http.StatusNotFound, "Order not found")
+		return
+	}
+
+	backlog, sub := h.hub.Subscribe(orderID, identity.UserID, r.Header.Get("Last-Event-ID"))
+	defer sub.Close()
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// Keep reverse proxies in front of the gateway from buffering the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if err := h.write(w, rc, fmt.Sprintf("retry: %d\n\n", retryMillis)); err != nil {
+		return
+	}
+	for _, event := range backlog {
+		if err := h.writeEvent(w, rc, event); err != nil {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(h.heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-sub.Events():
+			if !ok {
+				// Dropped for falling behind, the client resumes on reconnect
+				return
+			}
+			if err := h.writeEvent(w, rc, event); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if err := h.write(w, rc, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (h *StreamHandler) writeEvent(w http.ResponseWriter, rc *http.ResponseController, event models.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return h.write(w, rc, fmt.Sprintf("id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data))
+}
+
+func (h *StreamHandler) write(w http.ResponseWriter, rc *http.ResponseController, message string) error {
+	if err := rc.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	if _, err := w.Write([]byte(message)); err != nil {
+		return err
+	}
+	return rc.Flush()
+}
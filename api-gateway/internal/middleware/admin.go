@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/kaleabAlemayehu/eagle-commerce/shared/utils"
+)
+
+// AdminAuth only lets requests carrying the configured admin token through.
+// The admin surface is disabled altogether when no token is configured.
+func AdminAuth(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if token == "" {
+				utils.SendErrorResponse(w, http.StatusNotFound, "Admin API is disabled")
+				return
+			}
+
+			provided := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+				utils.SendErrorResponse(w, http.StatusUnauthorized, "Invalid admin token")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
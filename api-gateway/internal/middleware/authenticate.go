@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/kaleabAlemayehu/eagle-commerce/api-gateway/internal/apikey"
+	sharedMiddleware "github.com/kaleabAlemayehu/eagle-commerce/shared/middleware"
+	"github.com/kaleabAlemayehu/eagle-commerce/shared/utils"
+)
+
+// Authenticate protects the routes of resource, relying on the identity set
+// by Identify. Users get through, API keys need the read scope of resource
+// for safe methods and its write scope for the others.
+func Authenticate(resource string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			identity, ok := sharedMiddleware.GetIdentityFromContext(r.Context())
+			switch {
+			case ok && identity.UserID != "":
+			case ok && identity.APIKeyID != "":
+				if scope := apikey.Scope(resource, r.Method); !slices.Contains(identity.Scopes, scope) {
+					utils.SendErrorResponse(w, http.StatusForbidden, "API key is missing the "+scope+" scope")
+					return
+				}
+			case r.Header.Get("Authorization") != "":
+				utils.SendErrorResponse(w, http.StatusUnauthorized, "Invalid token")
+				return
+			case r.Header.Get(apikey.Header) != "":
+				utils.SendErrorResponse(w, http.StatusUnauthorized, "Invalid API key")
+				return
+			default:
+				utils.SendErrorResponse(w, http.StatusUnauthorized, "Authorization header or API key required")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireUser protects routes only users may call, relying on the identity
+// set by Identify
+func RequireUser() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			identity, ok := sharedMiddleware.GetIdentityFromContext(r.Context())
+			switch {
+			case ok && identity.UserID != "":
+			case ok && identity.APIKeyID != "":
+				utils.SendErrorResponse(w, http.StatusForbidden, "API keys can't access this resource")
+				return
+			case r.Header.Get("Authorization") != "":
+				utils.SendErrorResponse(w, http.StatusUnauthorized, "Invalid token")
+				return
+			default:
+				utils.SendErrorResponse(w, http.StatusUnauthorized, "Authorization header required")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/kaleabAlemayehu/eagle-commerce/shared/utils"
+)
+
+// LimitBody rejects request bodies larger than limit bytes, zero means no limit
+func LimitBody(limit int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if limit <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > limit {
+				utils.SendErrorResponse(w, http.StatusRequestEntityTooLarge, "Request body too large")
+				return
+			}
+			// Bodies of unknown length fail once they go past the limit
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.0/8", " 192.0.2.10 ", "2001:db8::/32", ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		realIP       string
+		want         string
+	}{
+		{
+			name:       "direct client",
+			remoteAddr: "203.0.113.7:52100",
+			want:       "203.0.113.7",
+		},
+		{
+			name:         "untrusted peer can't forward",
+			remoteAddr:   "203.0.113.7:52100",
+			forwardedFor: []string{"198.51.100.1"},
+			realIP:       "198.51.100.2",
+			want:         "203.0.113.7",
+		},
+		{
+			name:         "trusted proxy",
+			remoteAddr:   "10.0.0.5:443",
+			forwardedFor: []string{"203.0.113.7"},
+			want:         "203.0.113.7",
+		},
+		{
+			name:         "spoofed hops left of the client are ignored",
+			remoteAddr:   "10.0.0.5:443",
+			forwardedFor: []string{"198.51.100.1, 203.0.113.7"},
+			want:         "203.0.113.7",
+		},
+		{
+			name:         "chain of trusted proxies",
+			remoteAddr:   "10.0.0.5:443",
+			forwardedFor: []string{"198.51.100.1, 203.0.113.7, 192.0.2.10, 10.1.2.3"},
+			want:         "203.0.113.7",
+		},
+		{
+			name:         "hops across several headers",
+			remoteAddr:   "10.0.0.5:443",
+			forwardedFor: []string{"198.51.100.1", "203.0.113.7, 10.1.2.3"},
+			want:         "203.0.113.7",
+		},
+		{
+			name:         "a client claiming to be a trusted proxy",
+			remoteAddr:   "10.0.0.5:443",
+			forwardedFor: []string{"203.0.113.7, 10.9.9.9"},
+			want:         "203.0.113.7",
+		},
+		{
+			name:         "garbage stops the walk",
+			remoteAddr:   "10.0.0.5:443",
+			forwardedFor: []string{"203.0.113.7, not-an-ip"},
+			realIP:       "198.51.100.3",
+			want:         "198.51.100.3",
+		},
+		{
+			name:       "X-Real-IP from a trusted proxy",
+			remoteAddr: "10.0.0.5:443",
+			realIP:     "203.0.113.7",
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "trusted proxy without forwarding headers",
+			remoteAddr: "10.0.0.5:443",
+			want:       "10.0.0.5",
+		},
+		{
+			name:         "IPv6",
+			remoteAddr:   "[2001:db8::1]:443",
+			forwardedFor: []string{"2001:db9::7"},
+			want:         "2001:db9::7",
+		},
+		{
+			name:       "unparsable remote address",
+			remoteAddr: "pipe",
+			want:       "pipe",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/products", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwardedFor {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+			if got := proxies.ClientIP(r); got != tt.want {
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxiesRejectsInvalid(t *testing.T) {
+	for _, value := range []string{"10.0.0.0/33", "not-an-ip", "10.0.0"} {
+		if _, err := ParseTrustedProxies([]string{value}); err == nil {
+			t.Errorf("%q: no error", value)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/kaleabAlemayehu/eagle-commerce/api-gateway/internal/apikey"
+	sharedMiddleware "github.com/kaleabAlemayehu/eagle-commerce/shared/middleware"
+)
+
+// Identify establishes who is calling before anything else looks at the
+// request. Identity headers sent by the client are dropped, the gateway is
+// the only one allowed to set them. A bearer token or API key is optional
+// here, an invalid one leaves the request anonymous and protected routes
+// reject it. API keys are only accepted when keys isn't nil.
+func Identify(auth *sharedMiddleware.Auth, keys *apikey.Manager, proxies *TrustedProxies) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sharedMiddleware.StripIdentity(r.Header)
+
+			identity := &sharedMiddleware.Identity{
+				RequestID: middleware.GetReqID(r.Context()),
+				ClientIP:  proxies.ClientIP(r),
+			}
+			ctx := r.Context()
+			if token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); found {
+				if claims, err := auth.ValidateJWT(token); err == nil && claims.UserID != "" {
+					identity.UserID = claims.UserID
+					identity.Email = claims.Email
+					identity.Roles = claims.Roles
+					identity.Verified = claims.EmailVerified
+					ctx = context.WithValue(ctx, sharedMiddleware.UserContextKey, claims)
+				}
+			} else if raw := r.Header.Get(apikey.Header); raw != "" && keys != nil {
+				key, err := keys.Authenticate(r.Context(), raw)
+				if err == nil {
+					identity.APIKeyID = key.ID.Hex()
+					identity.Scopes = key.Scopes
+				} else if !errors.Is(err, apikey.ErrInvalidKey) && !errors.Is(err, apikey.ErrKeyExpired) && !errors.Is(err, apikey.ErrKeyRevoked) {
+					log.Printf("Failed to authenticate API key: %v", err)
+				}
+			}
+
+			next.ServeHTTP(w, r.WithContext(sharedMiddleware.WithIdentity(ctx, identity)))
+		})
+	}
+}
@@ -1,92 +1,142 @@
 package middleware
 
 import (
+	"context"
+	"log"
 	"net/http"
-	"sync"
+	"strconv"
 	"time"
 
-	"golang.org/x/time/rate"
+	"github.com/kaleabAlemayehu/eagle-commerce/api-gateway/internal/ratelimit"
+	sharedMiddleware "github.com/kaleabAlemayehu/eagle-commerce/shared/middleware"
+	"github.com/kaleabAlemayehu/eagle-commerce/shared/utils"
 )
 
-type visitor struct {
-	limiter  *rate.Limiter
-	lastSeen time.Time
+// RateLimitTier is a number of requests allowed per window
+type RateLimitTier struct {
+	Name     string
+	Requests int
+	Window   time.Duration
 }
 
-type RateLimiterConfig struct {
-	RequestsPerMinute int
-	Burst             int
-	CleanupInterval   time.Duration
-	Timeout           time.Duration
+// RateLimiter limits requests per client. Requests identified as a user or
+// API key are counted against it, anonymous ones against the client IP.
+type RateLimiter struct {
+	store     ratelimit.Store
+	proxies   *TrustedProxies
+	stats     *RateLimitStats
+	anonymous RateLimitTier
+	user      RateLimitTier
 }
 
-func NewRateLimit(config RateLimiterConfig) func(http.Handler) http.Handler {
-	limiter := &rateLimiter{
-		visitors: make(map[string]*visitor),
-		rate:     rate.Every(time.Minute / time.Duration(config.RequestsPerMinute)),
-		burst:    config.Burst,
+func NewRateLimiter(store ratelimit.Store, proxies *TrustedProxies, stats *RateLimitStats, anonymous, user RateLimitTier) *RateLimiter {
+	return &RateLimiter{
+		store:     store,
+		proxies:   proxies,
+		stats:     stats,
+		anonymous: anonymous,
+		user:      user,
 	}
+}
 
-	// Start cleanup goroutine
-	go limiter.cleanup(config.CleanupInterval, config.Timeout)
-
+// Middleware applies the user or anonymous tier to every request
+func (l *RateLimiter) Middleware() func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			ip := getIP(r)
+			identity, isUser := l.identify(r)
+			tier := l.anonymous
+			if isUser {
+				tier = l.user
+			}
 
-			if !limiter.allow(ip) {
-				http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+			if !l.allow(w, r, tier, identity) {
 				return
 			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
 
+// Route applies an additional tier to the routes it wraps, counted
+// separately from the global one under the tier name
+func (l *RateLimiter) Route(tier RateLimitTier) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			identity, _ := l.identify(r)
+			if !l.allow(w, r, tier, identity) {
+				return
+			}
 			next.ServeHTTP(w, r)
 		})
 	}
 }
 
-type rateLimiter struct {
-	visitors map[string]*visitor
-	mu       sync.RWMutex
-	rate     rate.Limit
-	burst    int
+// Count counts a request against an additional tier like Route does, for
+// handlers that answer in their own format. It reports whether the request is
+// within the tier, the RateLimit headers are set either way.
+func (l *RateLimiter) Count(w http.ResponseWriter, r *http.Request, tier RateLimitTier) bool {
+	identity, _ := l.identify(r)
+	return l.count(w, r, tier, identity)
+}
+
+// identify relies on the identity set by Identify, falling back to the
+// client IP when the limiter runs without it
+func (l *RateLimiter) identify(r *http.Request) (string, bool) {
+	identity, ok := sharedMiddleware.GetIdentityFromContext(r.Context())
+	if !ok {
+		return "ip:" + l.proxies.ClientIP(r), false
+	}
+	if identity.UserID != "" {
+		return "user:" + identity.UserID, true
+	}
+	if identity.APIKeyID != "" {
+		return "key:" + identity.APIKeyID, true
+	}
+	return "ip:" + identity.ClientIP, false
 }
 
-func (rl *rateLimiter) allow(ip string) bool {
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
-	v, exists := rl.visitors[ip]
-	if !exists {
-		limiter := rate.NewLimiter(rl.rate, rl.burst)
-		rl.visitors[ip] = &visitor{limiter: limiter, lastSeen: time.Now()}
-		return limiter.Allow()
+// allow counts the request, answering 429 once the tier is exhausted
+func (l *RateLimiter) allow(w http.ResponseWriter, r *http.Request, tier RateLimitTier, key string) bool {
+	if !l.count(w, r, tier, key) {
+		utils.SendErrorResponse(w, http.StatusTooManyRequests, "Rate limit exceeded")
+		return false
 	}
-	v.lastSeen = time.Now()
-	return v.limiter.Allow()
+	return true
 }
 
-func (rl *rateLimiter) cleanup(interval, timeout time.Duration) {
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
+// count counts the request and writes the RateLimit headers, reporting
+// whether the tier still allows it
+func (l *RateLimiter) count(w http.ResponseWriter, r *http.Request, tier RateLimitTier, key string) bool {
+	if tier.Requests <= 0 {
+		return true
+	}
 
-	for range ticker.C {
-		rl.mu.Lock()
-		for ip, v := range rl.visitors {
-			if time.Since(v.lastSeen) > timeout {
-				delete(rl.visitors, ip)
-			}
-		}
-		rl.mu.Unlock()
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second)
+	defer cancel()
+
+	result, err := l.store.Hit(ctx, tier.Name+":"+key, tier.Window)
+	if err != nil {
+		// Fail open, an unavailable store shouldn't take the gateway down
+		log.Printf("Rate limit store error for %s: %v", key, err)
+		return true
 	}
-}
 
-func getIP(r *http.Request) string {
-	// Check X-Forwarded-For header first
-	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
-		return forwarded
+	remaining := max(tier.Requests-result.Count, 0)
+	reset := max(int(time.Until(result.Reset).Seconds()+0.5), 1)
+
+	// When several tiers apply, report the one closest to its limit
+	if current, err := strconv.Atoi(w.Header().Get("RateLimit-Remaining")); err != nil || remaining <= current {
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(tier.Requests))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(remaining))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(reset))
 	}
-	// Check X-Real-IP header
-	if realIP := r.Header.Get("X-Real-IP"); realIP != "" {
-		return realIP
+
+	if result.Count > tier.Requests {
+		if l.stats != nil {
+			l.stats.record(tier.Name, key)
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(reset))
+		return false
 	}
-	return r.RemoteAddr
+	return true
 }
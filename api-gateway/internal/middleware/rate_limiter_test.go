@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/kaleabAlemayehu/eagle-commerce/api-gateway/internal/ratelimit"
+	sharedMiddleware "github.com/kaleabAlemayehu/eagle-commerce/shared/middleware"
+)
+
+func TestRateLimiterMiddleware(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	limiter := NewRateLimiter(
+		ratelimit.NewMemoryStore(time.Minute),
+		proxies,
+		nil,
+		RateLimitTier{Name: "ip", Requests: 2, Window: time.Hour},
+		RateLimitTier{Name: "user", Requests: 3, Window: time.Hour},
+	)
+	handler := limiter.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	send := func(remoteAddr, forwardedFor string, identity *sharedMiddleware.Identity) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/products", nil)
+		r.RemoteAddr = remoteAddr
+		if forwardedFor != "" {
+			r.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		if identity != nil {
+			r = r.WithContext(sharedMiddleware.WithIdentity(r.Context(), identity))
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		return rec
+	}
+
+	t.Run("anonymous clients are limited per IP", func(t *testing.T) {
+		for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+			rec := send("203.0.113.7:5000", "", nil)
+			if rec.Code != want {
+				t.Fatalf("request %d: status %d, want %d", i+1, rec.Code, want)
+			}
+			if remaining := rec.Header().Get("RateLimit-Remaining"); remaining != strconv.Itoa(max(1-i, 0)) {
+				t.Fatalf("request %d: RateLimit-Remaining %s", i+1, remaining)
+			}
+		}
+	})
+
+	t.Run("spoofed X-Forwarded-For doesn't get a new limit", func(t *testing.T) {
+		rec := send("203.0.113.7:5000", "198.51.100.99", nil)
+		if rec.Code != http.StatusTooManyRequests {
+			t.Fatalf("status %d, want %d", rec.Code, http.StatusTooManyRequests)
+		}
+		if rec.Header().Get("Retry-After") == "" {
+			t.Fatal("no Retry-After")
+		}
+	})
+
+	t.Run("clients behind a trusted proxy are limited apart", func(t *testing.T) {
+		if rec := send("10.0.0.5:443", "198.51.100.1", nil); rec.Code != http.StatusOK {
+			t.Fatalf("status %d, want %d", rec.Code, http.StatusOK)
+		}
+	})
+
+	t.Run("users get their own tier", func(t *testing.T) {
+		user := &sharedMiddleware.Identity{UserID: "user-1", ClientIP: "203.0.113.7"}
+		for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+			if rec := send("203.0.113.7:5000", "", user); rec.Code != want {
+				t.Fatalf("request %d: status %d, want %d", i+1, rec.Code, want)
+			}
+		}
+	})
+}
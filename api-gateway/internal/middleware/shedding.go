@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kaleabAlemayehu/eagle-commerce/api-gateway/internal/resilience"
+	"github.com/kaleabAlemayehu/eagle-commerce/shared/utils"
+)
+
+// shedRetryAfter is how long shed clients are told to wait, in seconds
+const shedRetryAfter = 2
+
+// Shed turns requests to service away when it's too loaded for their
+// priority. The time to the first byte of the response is recorded as the
+// latency of the service.
+func Shed(shedder *resilience.Shedder, service string, priority resilience.Priority) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			done, ok := shedder.Admit(service, priority)
+			if !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(shedRetryAfter))
+				utils.SendErrorResponse(w, http.StatusServiceUnavailable, "The "+service+" service is overloaded, please try again later")
+				return
+			}
+
+			tw := &timingWriter{ResponseWriter: w, start: time.Now()}
+			defer func() { done(tw.latency()) }()
+			next.ServeHTTP(tw, r)
+		})
+	}
+}
+
+// timingWriter notes when the response starts
+type timingWriter struct {
+	http.ResponseWriter
+	start      time.Time
+	firstWrite time.Time
+}
+
+func (tw *timingWriter) WriteHeader(code int) {
+	if tw.firstWrite.IsZero() {
+		tw.firstWrite = time.Now()
+	}
+	tw.ResponseWriter.WriteHeader(code)
+}
+
+func (tw *timingWriter) Write(b []byte) (int, error) {
+	if tw.firstWrite.IsZero() {
+		tw.firstWrite = time.Now()
+	}
+	return tw.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the flusher of the writer
+func (tw *timingWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
+
+func (tw *timingWriter) latency() time.Duration {
+	if tw.firstWrite.IsZero() {
+		return time.Since(tw.start)
+	}
+	return tw.firstWrite.Sub(tw.start)
+}
@@ -0,0 +1,202 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+const (
+	// maxLimitedClients bounds the clients tracked by RateLimitStats, the
+	// least recently limited one is forgotten to make room
+	maxLimitedClients = 10000
+
+	// RouteStatsWindow is how far back RouteStats counts, by the minute
+	RouteStatsWindow  = 15 * time.Minute
+	routeStatsBuckets = int64(RouteStatsWindow / time.Minute)
+)
+
+// LimitedClient is a client that hit a rate limit tier
+type LimitedClient struct {
+	Client         string    `json:"client"`
+	Tier           string    `json:"tier"`
+	Rejected       int64     `json:"rejected"`
+	LastRejectedAt time.Time `json:"last_rejected_at"`
+}
+
+// RateLimitStats counts the requests rejected per client and tier
+type RateLimitStats struct {
+	mu      sync.Mutex
+	clients map[string]*LimitedClient
+}
+
+func NewRateLimitStats() *RateLimitStats {
+	return &RateLimitStats{
+		clients: make(map[string]*LimitedClient),
+	}
+}
+
+func (s *RateLimitStats) record(tier, client string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := tier + ":" + client
+	limited, exists := s.clients[key]
+	if !exists {
+		if len(s.clients) >= maxLimitedClients {
+			s.evict()
+		}
+		limited = &LimitedClient{Client: client, Tier: tier}
+		s.clients[key] = limited
+	}
+	limited.Rejected++
+	limited.LastRejectedAt = time.Now()
+}
+
+// evict forgets the least recently limited client. The lock must be held.
+func (s *RateLimitStats) evict() {
+	var oldest string
+	for key, limited := range s.clients {
+		if oldest == "" || limited.LastRejectedAt.Before(s.clients[oldest].LastRejectedAt) {
+			oldest = key
+		}
+	}
+	delete(s.clients, oldest)
+}
+
+// Top returns the n clients with the most rejected requests
+func (s *RateLimitStats) Top(n int) []LimitedClient {
+	s.mu.Lock()
+	clients := make([]LimitedClient, 0, len(s.clients))
+	for _, limited := range s.clients {
+		clients = append(clients, *limited)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(clients, func(i, j int) bool {
+		if clients[i].Rejected != clients[j].Rejected {
+			return clients[i].Rejected > clients[j].Rejected
+		}
+		return clients[i].LastRejectedAt.After(clients[j].LastRejectedAt)
+	})
+	return clients[:min(n, len(clients))]
+}
+
+// RouteErrors counts the responses of a route over the RouteStatsWindow
+type RouteErrors struct {
+	Route        string `json:"route"`
+	Requests     int64  `json:"requests"`
+	ClientErrors int64  `json:"client_errors"`
+	ServerErrors int64  `json:"server_errors"`
+}
+
+// RouteStats counts the requests and errors of every route by the minute
+type RouteStats struct {
+	mu     sync.Mutex
+	routes map[string]*[routeStatsBuckets]routeBucket
+}
+
+type routeBucket struct {
+	minute       int64
+	requests     int64
+	clientErrors int64
+	serverErrors int64
+}
+
+var knownMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+	http.MethodPatch, http.MethodDelete, http.MethodOptions,
+}
+
+func NewRouteStats() *RouteStats {
+	return &RouteStats{
+		routes: make(map[string]*[routeStatsBuckets]routeBucket),
+	}
+}
+
+// Middleware has to wrap the chi router, routes are known once it has run
+func (s *RouteStats) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		defer func() {
+			rctx := chi.RouteContext(r.Context())
+			if rctx == nil || rctx.RoutePattern() == "" {
+				return
+			}
+			method := r.Method
+			// Keep arbitrary methods from growing the map
+			if !slices.Contains(knownMethods, method) {
+				method = "OTHER"
+			}
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			s.record(method+" "+rctx.RoutePattern(), status)
+		}()
+		next.ServeHTTP(ww, r)
+	})
+}
+
+func (s *RouteStats) record(route string, status int) {
+	minute := time.Now().Unix() / 60
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	buckets, exists := s.routes[route]
+	if !exists {
+		buckets = new([routeStatsBuckets]routeBucket)
+		s.routes[route] = buckets
+	}
+	bucket := &buckets[minute%routeStatsBuckets]
+	if bucket.minute != minute {
+		*bucket = routeBucket{minute: minute}
+	}
+	bucket.requests++
+	switch {
+	case status >= http.StatusInternalServerError:
+		bucket.serverErrors++
+	case status >= http.StatusBadRequest:
+		bucket.clientErrors++
+	}
+}
+
+// Recent returns the counts of every route that served requests within the
+// window, the ones with the most errors first
+func (s *RouteStats) Recent() []RouteErrors {
+	since := time.Now().Unix()/60 - routeStatsBuckets
+
+	s.mu.Lock()
+	routes := make([]RouteErrors, 0, len(s.routes))
+	for route, buckets := range s.routes {
+		counts := RouteErrors{Route: route}
+		for _, bucket := range buckets {
+			if bucket.minute > since {
+				counts.Requests += bucket.requests
+				counts.ClientErrors += bucket.clientErrors
+				counts.ServerErrors += bucket.serverErrors
+			}
+		}
+		if counts.Requests > 0 {
+			routes = append(routes, counts)
+		}
+	}
+	s.mu.Unlock()
+
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].ServerErrors != routes[j].ServerErrors {
+			return routes[i].ServerErrors > routes[j].ServerErrors
+		}
+		if routes[i].ClientErrors != routes[j].ClientErrors {
+			return routes[i].ClientErrors > routes[j].ClientErrors
+		}
+		return routes[i].Route < routes[j].Route
+	})
+	return routes
+}
@@ -0,0 +1,105 @@
+package openapi
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/kaleabAlemayehu/eagle-commerce/api-gateway/internal/upstream"
+	"github.com/kaleabAlemayehu/eagle-commerce/shared/utils"
+)
+
+const (
+	// docPath is where every service serves its Swagger document
+	docPath = "/swagger/doc.json"
+
+	// A merged document is kept for ttl, or retryAfter when a service
+	// couldn't be reached so its routes show up soon after it's back
+	ttl        = 5 * time.Minute
+	retryAfter = 15 * time.Second
+
+	fetchTimeout = 5 * time.Second
+)
+
+// Handler serves the gateway's document merged with the documents the
+// services serve themselves
+type Handler struct {
+	client   *upstream.Client
+	base     []byte
+	services []Service
+
+	mu       sync.Mutex
+	document []byte
+	expires  time.Time
+}
+
+func NewHandler(client *upstream.Client, base string, services []Service) *Handler {
+	return &Handler{
+		client:   client,
+		base:     []byte(base),
+		services: services,
+	}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	document, err := h.Document(r.Context())
+	if err != nil {
+		log.Printf("Failed to merge API documentation: %v", err)
+		utils.SendErrorResponse(w, http.StatusInternalServerError, "Failed to load API documentation")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(document)
+}
+
+// Document returns the merged document, services that can't be reached are
+// left out
+func (h *Handler) Document(ctx context.Context) ([]byte, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.document != nil && time.Now().Before(h.expires) {
+		return h.document, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var specsMu sync.Mutex
+	specs := make(map[string][]byte, len(h.services))
+	for _, service := range h.services {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			spec, err := h.client.Fetch(ctx, service.Name, docPath)
+			if err != nil {
+				log.Printf("Failed to fetch %s service documentation: %v", service.Name, err)
+				return
+			}
+			if !json.Valid(spec) {
+				log.Printf("Invalid %s service documentation", service.Name)
+				return
+			}
+			specsMu.Lock()
+			specs[service.Name] = spec
+			specsMu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	document, err := Merge(h.base, h.services, specs)
+	if err != nil {
+		return nil, err
+	}
+
+	h.document = document
+	h.expires = time.Now().Add(ttl)
+	if len(specs) < len(h.services) {
+		h.expires = time.Now().Add(retryAfter)
+	}
+	return document, nil
+}
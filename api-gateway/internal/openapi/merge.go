@@ -0,0 +1,121 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Service is a service whose Swagger document is merged into the gateway's
+type Service struct {
+	Name string
+	// Security lists the schemes the gateway accepts on the service's
+	// routes, any one of them is enough
+	Security []string
+	// Public lists the routes that need no authentication, as "METHOD /path"
+	// with the path as seen on the gateway
+	Public []string
+}
+
+type document = map[string]any
+
+// Merge adds the paths and definitions of every service document to the
+// gateway's own. Paths are prefixed with their basePath so they match the
+// gateway's routes, definitions are prefixed with the service name so
+// services can't clash with each other.
+func Merge(base []byte, services []Service, specs map[string][]byte) ([]byte, error) {
+	var merged document
+	if err := json.Unmarshal(base, &merged); err != nil {
+		return nil, fmt.Errorf("invalid gateway document: %w", err)
+	}
+
+	paths := document{}
+	for path, item := range object(merged, "paths") {
+		paths[basePath(merged)+path] = item
+	}
+	merged["paths"] = paths
+	merged["basePath"] = "/"
+	// Without a host, clients call the gateway the document was loaded from
+	delete(merged, "host")
+	definitions := object(merged, "definitions")
+
+	for _, service := range services {
+		raw, ok := specs[service.Name]
+		if !ok {
+			continue
+		}
+		var spec document
+		if err := json.Unmarshal(raw, &spec); err != nil {
+			return nil, fmt.Errorf("invalid %s service document: %w", service.Name, err)
+		}
+		prefixRefs(spec, service.Name+".")
+
+		for name, definition := range object(spec, "definitions") {
+			definitions[service.Name+"."+name] = definition
+		}
+		for path, item := range object(spec, "paths") {
+			path = basePath(spec) + path
+			operations, _ := item.(document)
+			for method, operation := range operations {
+				operation, ok := operation.(document)
+				if !ok {
+					continue
+				}
+				if _, set := operation["security"]; set || slices.Contains(service.Public, strings.ToUpper(method)+" "+path) {
+					continue
+				}
+				operation["security"] = requirements(service.Security)
+			}
+			paths[path] = item
+		}
+	}
+
+	return json.Marshal(merged)
+}
+
+// basePath returns the basePath of a document without its trailing slash
+func basePath(spec document) string {
+	path, _ := spec["basePath"].(string)
+	return strings.TrimSuffix(path, "/")
+}
+
+// object returns the object under key, creating it when it's missing
+func object(spec document, key string) document {
+	value, ok := spec[key].(document)
+	if !ok {
+		value = document{}
+		spec[key] = value
+	}
+	return value
+}
+
+// requirements lists schemes as alternatives, a security requirement object
+// holding several schemes would require all of them
+func requirements(schemes []string) []any {
+	alternatives := make([]any, 0, len(schemes))
+	for _, scheme := range schemes {
+		alternatives = append(alternatives, document{scheme: []any{}})
+	}
+	return alternatives
+}
+
+// prefixRefs renames every reference to a definition of the document
+func prefixRefs(value any, prefix string) {
+	switch value := value.(type) {
+	case document:
+		for key, child := range value {
+			if ref, ok := child.(string); ok && key == "$ref" {
+				if name, found := strings.CutPrefix(ref, "#/definitions/"); found {
+					value[key] = "#/definitions/" + prefix + name
+				}
+				continue
+			}
+			prefixRefs(child, prefix)
+		}
+	case []any:
+		for _, child := range value {
+			prefixRefs(child, prefix)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type visitor struct {
+	windowStart time.Time
+	window      time.Duration
+	count       int
+}
+
+// MemoryStore keeps the counters in process, limits are per gateway instance
+type MemoryStore struct {
+	visitors map[string]*visitor
+	mu       sync.Mutex
+}
+
+func NewMemoryStore(cleanupInterval time.Duration) *MemoryStore {
+	store := &MemoryStore{
+		visitors: make(map[string]*visitor),
+	}
+
+	// Start cleanup goroutine
+	go store.cleanup(cleanupInterval)
+
+	return store
+}
+
+func (s *MemoryStore) Hit(ctx context.Context, key string, window time.Duration) (Result, error) {
+	start := windowStart(time.Now(), window)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, exists := s.visitors[key]
+	if !exists || !v.windowStart.Equal(start) {
+		v = &visitor{windowStart: start, window: window}
+		s.visitors[key] = v
+	}
+	v.count++
+
+	return Result{Count: v.count, Reset: start.Add(window)}, nil
+}
+
+func (s *MemoryStore) cleanup(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.mu.Lock()
+		for key, v := range s.visitors {
+			if time.Since(v.windowStart) > v.window {
+				delete(s.visitors, key)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
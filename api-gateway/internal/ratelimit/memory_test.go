@@ -0,0 +1,55 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreCountsFixedWindows(t *testing.T) {
+	store := NewMemoryStore(time.Minute)
+	ctx := context.Background()
+
+	for want := 1; want <= 3; want++ {
+		result, err := store.Hit(ctx, "ip:203.0.113.7", time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Count != want {
+			t.Fatalf("hit %d: count %d", want, result.Count)
+		}
+		if wantReset := time.Now().Truncate(time.Hour).Add(time.Hour); !result.Reset.Equal(wantReset) {
+			t.Fatalf("reset %s, want the end of the window %s", result.Reset, wantReset)
+		}
+	}
+
+	// Keys count separately
+	if result, _ := store.Hit(ctx, "ip:203.0.113.8", time.Hour); result.Count != 1 {
+		t.Fatalf("other key: count %d, want 1", result.Count)
+	}
+}
+
+func TestMemoryStoreRollsOver(t *testing.T) {
+	store := NewMemoryStore(time.Minute)
+	ctx := context.Background()
+	const window = 100 * time.Millisecond
+
+	first, err := store.Hit(ctx, "user:1", window)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := store.Hit(ctx, "user:1", window)
+	if !second.Reset.Equal(first.Reset) {
+		// The window ended between the two hits, start from the next one
+		first = second
+	}
+
+	time.Sleep(time.Until(first.Reset) + 10*time.Millisecond)
+	next, _ := store.Hit(ctx, "user:1", window)
+	if next.Count != 1 {
+		t.Fatalf("count %d in the next window, want 1", next.Count)
+	}
+	if !next.Reset.After(first.Reset) {
+		t.Fatalf("reset %s, want after %s", next.Reset, first.Reset)
+	}
+}
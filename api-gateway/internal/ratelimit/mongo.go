@@ -0,0 +1,57 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore shares the counters through a MongoDB collection, expired
+// windows are removed by a TTL index
+type MongoStore struct {
+	collection *mongo.Collection
+}
+
+type mongoCounter struct {
+	Count int `bson:"count"`
+}
+
+func NewMongoStore(ctx context.Context, db *mongo.Database) (*MongoStore, error) {
+	collection := db.Collection("rate_limits")
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &MongoStore{collection: collection}, nil
+}
+
+func (s *MongoStore) Hit(ctx context.Context, key string, window time.Duration) (Result, error) {
+	start := windowStart(time.Now(), window)
+	reset := start.Add(window)
+
+	filter := bson.M{"_id": key + ":" + strconv.FormatInt(start.Unix(), 10)}
+	update := bson.M{
+		"$inc":         bson.M{"count": 1},
+		"$setOnInsert": bson.M{"expires_at": reset},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var counter mongoCounter
+	err := s.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&counter)
+	if mongo.IsDuplicateKeyError(err) {
+		// Another gateway created the window first, the retry increments it
+		err = s.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&counter)
+	}
+	if err != nil {
+		return Result{}, err
+	}
+
+	return Result{Count: counter.Count, Reset: reset}, nil
+}
@@ -0,0 +1,64 @@
+package ratelimit
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+const maxKVAttempts = 10
+
+var errKVContention = errors.New("too much contention on rate limit counter")
+
+// NATSStore shares the counters through a JetStream key-value bucket, using
+// compare-and-set on the entry revision. The bucket TTL has to be at least
+// the longest window.
+type NATSStore struct {
+	kv nats.KeyValue
+}
+
+func NewNATSStore(kv nats.KeyValue) *NATSStore {
+	return &NATSStore{kv: kv}
+}
+
+func (s *NATSStore) Hit(ctx context.Context, key string, window time.Duration) (Result, error) {
+	start := windowStart(time.Now(), window)
+	reset := start.Add(window)
+
+	// Keys may only hold a restricted set of characters, IPv6 addresses don't fit
+	kvKey := base64.RawURLEncoding.EncodeToString([]byte(key)) + "." + strconv.FormatInt(start.Unix(), 10)
+
+	for range maxKVAttempts {
+		if err := ctx.Err(); err != nil {
+			return Result{}, err
+		}
+
+		entry, err := s.kv.Get(kvKey)
+		if errors.Is(err, nats.ErrKeyNotFound) {
+			if _, err := s.kv.Create(kvKey, []byte("1")); err == nil {
+				return Result{Count: 1, Reset: reset}, nil
+			} else if !errors.Is(err, nats.ErrKeyExists) {
+				return Result{}, err
+			}
+			continue
+		}
+		if err != nil {
+			return Result{}, err
+		}
+
+		count, err := strconv.Atoi(string(entry.Value()))
+		if err != nil {
+			return Result{}, err
+		}
+		count++
+		if _, err := s.kv.Update(kvKey, []byte(strconv.Itoa(count)), entry.Revision()); err == nil {
+			return Result{Count: count, Reset: reset}, nil
+		}
+	}
+
+	return Result{}, errKVContention
+}
@@ -0,0 +1,182 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// fakeKV keeps the entries of a bucket in memory with the compare-and-set
+// semantics of JetStream. beforeUpdate runs ahead of every Update, so a test
+// can slip in a write of another gateway.
+type fakeKV struct {
+	nats.KeyValue
+
+	mu           sync.Mutex
+	entries      map[string]*fakeEntry
+	revision     uint64
+	beforeUpdate func(kv *fakeKV, key string)
+	updates      int
+}
+
+type fakeEntry struct {
+	nats.KeyValueEntry
+	value    []byte
+	revision uint64
+}
+
+func (e *fakeEntry) Value() []byte    { return e.value }
+func (e *fakeEntry) Revision() uint64 { return e.revision }
+
+func newFakeKV() *fakeKV {
+	return &fakeKV{entries: make(map[string]*fakeEntry)}
+}
+
+func (kv *fakeKV) Get(key string) (nats.KeyValueEntry, error) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	entry, ok := kv.entries[key]
+	if !ok {
+		return nil, nats.ErrKeyNotFound
+	}
+	return &fakeEntry{value: entry.value, revision: entry.revision}, nil
+}
+
+func (kv *fakeKV) Create(key string, value []byte) (uint64, error) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	if _, ok := kv.entries[key]; ok {
+		return 0, nats.ErrKeyExists
+	}
+	return kv.put(key, value), nil
+}
+
+func (kv *fakeKV) Update(key string, value []byte, last uint64) (uint64, error) {
+	if kv.beforeUpdate != nil {
+		kv.beforeUpdate(kv, key)
+	}
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	kv.updates++
+	if entry, ok := kv.entries[key]; !ok || entry.revision != last {
+		return 0, errors.New("wrong last sequence")
+	}
+	return kv.put(key, value), nil
+}
+
+// bump increments a counter the way another gateway would
+func (kv *fakeKV) bump(key string) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	count, _ := strconv.Atoi(string(kv.entries[key].value))
+	kv.put(key, []byte(strconv.Itoa(count+1)))
+}
+
+func (kv *fakeKV) put(key string, value []byte) uint64 {
+	kv.revision++
+	kv.entries[key] = &fakeEntry{value: value, revision: kv.revision}
+	return kv.revision
+}
+
+func TestNATSStoreCounts(t *testing.T) {
+	store := NewNATSStore(newFakeKV())
+	for want := 1; want <= 3; want++ {
+		result, err := store.Hit(context.Background(), "ip:2001:db8::1", time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Count != want {
+			t.Fatalf("hit %d: count %d", want, result.Count)
+		}
+	}
+}
+
+func TestNATSStoreRetriesLostUpdates(t *testing.T) {
+	kv := newFakeKV()
+	store := NewNATSStore(kv)
+	ctx := context.Background()
+	if _, err := store.Hit(ctx, "user:1", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	// Two other gateways win the race before this one gets through
+	lost := 2
+	kv.beforeUpdate = func(kv *fakeKV, key string) {
+		if lost > 0 {
+			lost--
+			kv.bump(key)
+		}
+	}
+	result, err := store.Hit(ctx, "user:1", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Count != 4 {
+		t.Fatalf("count %d, want 4 counting the hits of the other gateways", result.Count)
+	}
+	if kv.updates != 3 {
+		t.Fatalf("%d updates, want 3", kv.updates)
+	}
+}
+
+func TestNATSStoreGivesUpUnderContention(t *testing.T) {
+	kv := newFakeKV()
+	store := NewNATSStore(kv)
+	ctx := context.Background()
+	if _, err := store.Hit(ctx, "user:1", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	kv.beforeUpdate = func(kv *fakeKV, key string) { kv.bump(key) }
+	if _, err := store.Hit(ctx, "user:1", time.Hour); !errors.Is(err, errKVContention) {
+		t.Fatalf("got %v, want %v", err, errKVContention)
+	}
+	if kv.updates != maxKVAttempts {
+		t.Fatalf("%d updates, want %d", kv.updates, maxKVAttempts)
+	}
+}
+
+func TestNATSStoreConcurrentHits(t *testing.T) {
+	store := NewNATSStore(newFakeKV())
+	const hits = 50
+
+	var wg sync.WaitGroup
+	counts := make(chan int, hits)
+	for range hits {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				result, err := store.Hit(context.Background(), "user:1", time.Hour)
+				if errors.Is(err, errKVContention) {
+					continue
+				}
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				counts <- result.Count
+				return
+			}
+		}()
+	}
+	wg.Wait()
+	close(counts)
+
+	// Every hit got a count of its own
+	seen := make(map[int]bool)
+	for count := range counts {
+		if seen[count] {
+			t.Fatalf("count %d handed out twice", count)
+		}
+		seen[count] = true
+	}
+	if len(seen) != hits {
+		t.Fatalf("%d counts, want %d", len(seen), hits)
+	}
+}
@@ -0,0 +1,26 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Result is the state of a fixed window counter after a hit
+type Result struct {
+	// Count is the number of hits in the current window, this one included
+	Count int
+	// Reset is when the current window ends
+	Reset time.Time
+}
+
+// Store counts hits per key in fixed windows. Shared stores let several
+// gateway instances enforce the same limits.
+type Store interface {
+	Hit(ctx context.Context, key string, window time.Duration) (Result, error)
+}
+
+// windowStart aligns now to the beginning of its window so every gateway
+// instance agrees on the boundaries
+func windowStart(now time.Time, window time.Duration) time.Time {
+	return now.Truncate(window)
+}
@@ -0,0 +1,60 @@
+package registry
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+const (
+	RoundRobin       = "round_robin"
+	LeastConnections = "least_connections"
+)
+
+// Balancer picks one instance out of the healthy ones
+type Balancer interface {
+	Pick(instances []*Instance) *Instance
+}
+
+func NewBalancer(strategy string) (Balancer, error) {
+	switch strategy {
+	case "", RoundRobin:
+		return &roundRobinBalancer{}, nil
+	case LeastConnections:
+		return &leastConnectionsBalancer{}, nil
+	default:
+		return nil, fmt.Errorf("unknown balancing strategy: %s", strategy)
+	}
+}
+
+type roundRobinBalancer struct {
+	next atomic.Uint64
+}
+
+func (b *roundRobinBalancer) Pick(instances []*Instance) *Instance {
+	if len(instances) == 0 {
+		return nil
+	}
+	n := b.next.Add(1) - 1
+	return instances[n%uint64(len(instances))]
+}
+
+type leastConnectionsBalancer struct {
+	// offset rotates the starting point so ties are spread out
+	offset atomic.Uint64
+}
+
+func (b *leastConnectionsBalancer) Pick(instances []*Instance) *Instance {
+	if len(instances) == 0 {
+		return nil
+	}
+	start := int((b.offset.Add(1) - 1) % uint64(len(instances)))
+
+	var picked *Instance
+	for i := range instances {
+		candidate := instances[(start+i)%len(instances)]
+		if picked == nil || candidate.ActiveRequests() < picked.ActiveRequests() {
+			picked = candidate
+		}
+	}
+	return picked
+}
@@ -0,0 +1,92 @@
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/kaleabAlemayehu/eagle-commerce/shared/messaging"
+	sharedMiddleware "github.com/kaleabAlemayehu/eagle-commerce/shared/middleware"
+	"github.com/kaleabAlemayehu/eagle-commerce/shared/models"
+)
+
+// Discovery registers the instances announced over NATS heartbeats. Only
+// heartbeats signed with the internal secret count, so other NATS clients
+// can't route traffic to themselves.
+type Discovery struct {
+	registry   *Registry
+	natsClient *messaging.NATSClient
+	signer     *sharedMiddleware.IdentitySigner
+}
+
+func NewDiscovery(registry *Registry, natsClient *messaging.NATSClient, signer *sharedMiddleware.IdentitySigner) *Discovery {
+	return &Discovery{
+		registry:   registry,
+		natsClient: natsClient,
+		signer:     signer,
+	}
+}
+
+func (d *Discovery) StartListening() error {
+	_, err := d.natsClient.SubscribeMsg(models.ServiceHeartbeatEvent, d.verified(d.handleHeartbeat))
+	if err != nil {
+		return err
+	}
+
+	_, err = d.natsClient.SubscribeMsg(models.ServiceDeregisteredEvent, d.verified(d.handleDeregistered))
+	return err
+}
+
+// verified drops the messages that aren't signed with the internal secret
+func (d *Discovery) verified(handler func([]byte)) func(*nats.Msg) {
+	return func(msg *nats.Msg) {
+		if _, err := d.signer.VerifyMessage(msg); err != nil {
+			log.Printf("Rejected %s event: %v", msg.Subject, err)
+			return
+		}
+		handler(msg.Data)
+	}
+}
+
+func (d *Discovery) handleHeartbeat(data []byte) {
+	var event models.Event
+	if err := json.Unmarshal(data, &event); err != nil {
+		log.Printf("Error unmarshaling service.heartbeat event: %v", err)
+		return
+	}
+
+	serviceName, _ := event.Data["service"].(string)
+	instanceID, _ := event.Data["instance_id"].(string)
+	instanceURL, _ := event.Data["url"].(string)
+	version, _ := event.Data["version"].(string)
+	if serviceName == "" || instanceID == "" || instanceURL == "" {
+		log.Printf("Invalid service.heartbeat event from %s", event.Source)
+		return
+	}
+
+	if _, err := d.registry.Register(serviceName, instanceID, instanceURL, version, false); err != nil {
+		if errors.Is(err, ErrServiceNotFound) {
+			return
+		}
+		log.Printf("Error registering %s instance %s: %v", serviceName, instanceID, err)
+	}
+}
+
+func (d *Discovery) handleDeregistered(data []byte) {
+	var event models.Event
+	if err := json.Unmarshal(data, &event); err != nil {
+		log.Printf("Error unmarshaling service.deregistered event: %v", err)
+		return
+	}
+
+	serviceName, _ := event.Data["service"].(string)
+	instanceID, _ := event.Data["instance_id"].(string)
+	if serviceName == "" || instanceID == "" {
+		log.Printf("Invalid service.deregistered event from %s", event.Source)
+		return
+	}
+
+	d.registry.Deregister(serviceName, instanceID)
+}
@@ -0,0 +1,86 @@
+package registry
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// HealthChecker actively probes every instance and ejects the ones that
+// stop answering until they recover.
+type HealthChecker struct {
+	registry           *Registry
+	client             *http.Client
+	path               string
+	interval           time.Duration
+	healthyThreshold   int
+	unhealthyThreshold int
+}
+
+func NewHealthChecker(registry *Registry, path string, interval, timeout time.Duration, healthyThreshold, unhealthyThreshold int) *HealthChecker {
+	return &HealthChecker{
+		registry:           registry,
+		client:             &http.Client{Timeout: timeout},
+		path:               path,
+		interval:           interval,
+		healthyThreshold:   healthyThreshold,
+		unhealthyThreshold: unhealthyThreshold,
+	}
+}
+
+// Start runs the checks until the context is cancelled
+func (h *HealthChecker) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(h.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				h.registry.expire()
+				h.checkAll(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func (h *HealthChecker) checkAll(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, name := range h.registry.Services() {
+		for _, inst := range h.registry.Instances(name) {
+			if inst.State() == StateDisabled {
+				continue
+			}
+			wg.Add(1)
+			go func(inst *Instance) {
+				defer wg.Done()
+				ok := h.check(ctx, inst)
+				if changed := inst.recordCheck(ok, h.healthyThreshold, h.unhealthyThreshold); changed {
+					if ok {
+						log.Printf("%s instance %s is healthy again", inst.Service, inst.URL)
+					} else {
+						log.Printf("%s instance %s failed health checks, ejecting", inst.Service, inst.URL)
+					}
+				}
+			}(inst)
+		}
+	}
+	wg.Wait()
+}
+
+func (h *HealthChecker) check(ctx context.Context, inst *Instance) bool {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, inst.URL.JoinPath(h.path).String(), nil)
+	if err != nil {
+		return false
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+	return resp.StatusCode >= 200 && resp.StatusCode < 300
+}
@@ -0,0 +1,159 @@
+package registry
+
+import (
+	"fmt"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// State is what an operator wants of an instance, only active instances get
+// new requests
+type State string
+
+const (
+	StateActive State = "active"
+	// StateDraining instances finish their requests without getting new ones
+	StateDraining State = "draining"
+	// StateDisabled instances get no requests and aren't health checked
+	StateDisabled State = "disabled"
+)
+
+func ParseState(value string) (State, error) {
+	switch state := State(value); state {
+	case StateActive, StateDraining, StateDisabled:
+		return state, nil
+	default:
+		return "", fmt.Errorf("unknown instance state: %s", value)
+	}
+}
+
+// InstanceStatus is a point in time view of an instance
+type InstanceStatus struct {
+	ID             string    `json:"id"`
+	URL            string    `json:"url"`
+	Version        string    `json:"version,omitempty"`
+	Static         bool      `json:"static"`
+	Healthy        bool      `json:"healthy"`
+	State          State     `json:"state"`
+	ActiveRequests int64     `json:"active_requests"`
+	LastSeen       time.Time `json:"last_seen"`
+}
+
+// Instance is a single upstream address of a service
+type Instance struct {
+	ID      string
+	Service string
+	URL     *url.URL
+	Version string
+	// Static instances come from configuration and never expire
+	Static bool
+
+	active atomic.Int64
+
+	mu        sync.RWMutex
+	healthy   bool
+	state     State
+	failures  int
+	successes int
+	lastSeen  time.Time
+}
+
+func (i *Instance) Healthy() bool {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.healthy
+}
+
+// Available reports whether the instance may get new requests
+func (i *Instance) Available() bool {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.healthy && (i.state == "" || i.state == StateActive)
+}
+
+func (i *Instance) State() State {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	if i.state == "" {
+		return StateActive
+	}
+	return i.state
+}
+
+func (i *Instance) SetState(state State) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.state = state
+}
+
+func (i *Instance) Status() InstanceStatus {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	status := InstanceStatus{
+		ID:             i.ID,
+		URL:            i.URL.String(),
+		Version:        i.Version,
+		Static:         i.Static,
+		Healthy:        i.healthy,
+		State:          i.state,
+		ActiveRequests: i.ActiveRequests(),
+		LastSeen:       i.lastSeen,
+	}
+	if status.State == "" {
+		status.State = StateActive
+	}
+	return status
+}
+
+func (i *Instance) LastSeen() time.Time {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.lastSeen
+}
+
+// ActiveRequests returns the number of requests currently in flight
+func (i *Instance) ActiveRequests() int64 {
+	return i.active.Load()
+}
+
+// Acquire marks a request as started and returns the function that ends it
+func (i *Instance) Acquire() func() {
+	i.active.Add(1)
+	var once sync.Once
+	return func() {
+		once.Do(func() { i.active.Add(-1) })
+	}
+}
+
+func (i *Instance) touch() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.lastSeen = time.Now()
+}
+
+// recordCheck applies a health check result and reports whether the
+// instance changed state.
+func (i *Instance) recordCheck(ok bool, healthyThreshold, unhealthyThreshold int) bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if ok {
+		i.failures = 0
+		i.successes++
+		if !i.healthy && i.successes >= healthyThreshold {
+			i.healthy = true
+			return true
+		}
+		return false
+	}
+
+	i.successes = 0
+	i.failures++
+	if i.healthy && i.failures >= unhealthyThreshold {
+		i.healthy = false
+		return true
+	}
+	return false
+}
@@ -0,0 +1,265 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrServiceNotFound    = errors.New("service not found")
+	ErrNoHealthyInstances = errors.New("no healthy instances available")
+	ErrInstanceNotFound   = errors.New("instance not found")
+)
+
+type service struct {
+	balancer  Balancer
+	instances map[string]*Instance // keyed by URL so duplicates collapse
+}
+
+// Registry keeps track of the instances of every upstream service
+type Registry struct {
+	mu           sync.RWMutex
+	services     map[string]*service
+	heartbeatTTL time.Duration
+}
+
+func NewRegistry(heartbeatTTL time.Duration) *Registry {
+	return &Registry{
+		services:     make(map[string]*service),
+		heartbeatTTL: heartbeatTTL,
+	}
+}
+
+// AddService declares a service the gateway is allowed to route to
+func (r *Registry) AddService(name string, balancer Balancer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if svc, exists := r.services[name]; exists {
+		svc.balancer = balancer
+		return
+	}
+	r.services[name] = &service{
+		balancer:  balancer,
+		instances: make(map[string]*Instance),
+	}
+}
+
+func (r *Registry) HasService(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, exists := r.services[name]
+	return exists
+}
+
+// Register adds an instance or refreshes the heartbeat of a known one
+func (r *Registry) Register(serviceName, id, rawURL, version string, static bool) (*Instance, error) {
+	target, err := url.Parse(rawURL)
+	if err != nil || target.Scheme == "" || target.Host == "" {
+		return nil, fmt.Errorf("invalid instance url %q", rawURL)
+	}
+	if id == "" {
+		id = target.String()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	svc, exists := r.services[serviceName]
+	if !exists {
+		return nil, ErrServiceNotFound
+	}
+
+	key := target.String()
+	// A restarted process reuses its address with a new instance ID, in which
+	// case the old entry is replaced below
+	if inst, exists := svc.instances[key]; exists && (inst.Static || inst.ID == id) {
+		inst.touch()
+		return inst, nil
+	}
+
+	inst := &Instance{
+		ID:       id,
+		Service:  serviceName,
+		URL:      target,
+		Version:  version,
+		Static:   static,
+		healthy:  true,
+		lastSeen: time.Now(),
+	}
+	svc.instances[key] = inst
+	log.Printf("Registered %s instance %s at %s", serviceName, id, key)
+	return inst, nil
+}
+
+// SyncStatic makes the static instances of a service the ones given, as
+// URLs mapped to their version. Instances that are kept keep their health.
+func (r *Registry) SyncStatic(serviceName string, instances map[string]string) error {
+	targets := make(map[string]*url.URL, len(instances))
+	for rawURL := range instances {
+		target, err := url.Parse(rawURL)
+		if err != nil || target.Scheme == "" || target.Host == "" {
+			return fmt.Errorf("invalid instance url %q", rawURL)
+		}
+		targets[rawURL] = target
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	svc, exists := r.services[serviceName]
+	if !exists {
+		return ErrServiceNotFound
+	}
+
+	wanted := make(map[string]string, len(instances))
+	for rawURL, version := range instances {
+		wanted[targets[rawURL].String()] = version
+	}
+	for key, inst := range svc.instances {
+		if version, keep := wanted[key]; inst.Static && (!keep || inst.Version != version) {
+			delete(svc.instances, key)
+			log.Printf("Removed static %s instance at %s", serviceName, key)
+		}
+	}
+	for rawURL, version := range instances {
+		target := targets[rawURL]
+		if inst, exists := svc.instances[target.String()]; exists && inst.Static {
+			continue
+		}
+		svc.instances[target.String()] = &Instance{
+			ID:       target.String(),
+			Service:  serviceName,
+			URL:      target,
+			Version:  version,
+			Static:   true,
+			healthy:  true,
+			lastSeen: time.Now(),
+		}
+		log.Printf("Registered %s instance %s at %s", serviceName, target.String(), target.String())
+	}
+	return nil
+}
+
+// Deregister removes a dynamically registered instance
+func (r *Registry) Deregister(serviceName, id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	svc, exists := r.services[serviceName]
+	if !exists {
+		return
+	}
+	for key, inst := range svc.instances {
+		if inst.ID == id && !inst.Static {
+			delete(svc.instances, key)
+			log.Printf("Deregistered %s instance %s at %s", serviceName, id, key)
+		}
+	}
+}
+
+// Next picks the instance that should serve the next request
+func (r *Registry) Next(serviceName string) (*Instance, error) {
+	return r.Select(serviceName, nil)
+}
+
+// Select picks the instance that should serve the next request among the
+// ones accepted by filter, every instance is accepted when filter is nil
+func (r *Registry) Select(serviceName string, filter func(*Instance) bool) (*Instance, error) {
+	r.mu.RLock()
+	svc, exists := r.services[serviceName]
+	if !exists {
+		r.mu.RUnlock()
+		return nil, ErrServiceNotFound
+	}
+	healthy := make([]*Instance, 0, len(svc.instances))
+	for _, inst := range svc.instances {
+		if inst.Available() && (filter == nil || filter(inst)) {
+			healthy = append(healthy, inst)
+		}
+	}
+	balancer := svc.balancer
+	r.mu.RUnlock()
+
+	if len(healthy) == 0 {
+		return nil, ErrNoHealthyInstances
+	}
+	// Map iteration is random, keep a stable order for the balancer
+	sort.Slice(healthy, func(i, j int) bool { return healthy[i].URL.String() < healthy[j].URL.String() })
+	return balancer.Pick(healthy), nil
+}
+
+// SetState changes the state of the instance of a service whose ID or URL
+// is instance, or of all its instances when instance is empty
+func (r *Registry) SetState(serviceName, instance string, state State) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	svc, exists := r.services[serviceName]
+	if !exists {
+		return ErrServiceNotFound
+	}
+	found := false
+	for key, inst := range svc.instances {
+		if instance == "" || inst.ID == instance || key == instance {
+			inst.SetState(state)
+			found = true
+			log.Printf("%s instance %s is now %s", serviceName, key, state)
+		}
+	}
+	if !found && instance != "" {
+		return ErrInstanceNotFound
+	}
+	return nil
+}
+
+// Instances returns every known instance of a service
+func (r *Registry) Instances(serviceName string) []*Instance {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	svc, exists := r.services[serviceName]
+	if !exists {
+		return nil
+	}
+	instances := make([]*Instance, 0, len(svc.instances))
+	for _, inst := range svc.instances {
+		instances = append(instances, inst)
+	}
+	sort.Slice(instances, func(i, j int) bool { return instances[i].URL.String() < instances[j].URL.String() })
+	return instances
+}
+
+func (r *Registry) Services() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.services))
+	for name := range r.services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// expire drops dynamic instances that stopped sending heartbeats
+func (r *Registry) expire() {
+	if r.heartbeatTTL <= 0 {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for name, svc := range r.services {
+		for key, inst := range svc.instances {
+			if !inst.Static && time.Since(inst.LastSeen()) > r.heartbeatTTL {
+				delete(svc.instances, key)
+				log.Printf("Expired %s instance %s at %s", name, inst.ID, key)
+			}
+		}
+	}
+}
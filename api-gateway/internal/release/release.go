@@ -0,0 +1,151 @@
+package release
+
+import (
+	"errors"
+	"hash/fnv"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+
+	"github.com/kaleabAlemayehu/eagle-commerce/api-gateway/internal/registry"
+	sharedMiddleware "github.com/kaleabAlemayehu/eagle-commerce/shared/middleware"
+)
+
+// Release describes how the traffic of a service is shared between its
+// stable instances and the instances of candidate versions. Instances are
+// told apart by the version they were registered with.
+type Release struct {
+	// Canary is the version receiving Weight percent of the callers
+	Canary string
+	Weight int
+	// StickyHeader names a header whose value keeps a caller on the same
+	// version, the caller's user, API key or IP is used when it's missing
+	StickyHeader string
+
+	// Shadow is the version receiving a copy of ShadowPercent percent of the
+	// requests, its responses are only compared with the real ones
+	Shadow        string
+	ShadowPercent int
+	// ShadowWrites mirrors unsafe methods too, only for candidates that
+	// don't share their database with the stable version
+	ShadowWrites bool
+}
+
+func (r Release) Validate() error {
+	if r.Weight < 0 || r.Weight > 100 {
+		return errors.New("canary weight must be between 0 and 100")
+	}
+	if r.ShadowPercent < 0 || r.ShadowPercent > 100 {
+		return errors.New("shadow percent must be between 0 and 100")
+	}
+	if r.Weight > 0 && r.Canary == "" {
+		return errors.New("canary version is required")
+	}
+	if r.ShadowPercent > 0 && r.Shadow == "" {
+		return errors.New("shadow version is required")
+	}
+	if r.Canary != "" && r.Canary == r.Shadow {
+		return errors.New("canary and shadow versions must differ")
+	}
+	return nil
+}
+
+// Releases holds the release of every service, services without one only
+// have stable instances
+type Releases struct {
+	mu       sync.RWMutex
+	releases map[string]Release
+}
+
+func NewReleases() *Releases {
+	return &Releases{releases: make(map[string]Release)}
+}
+
+func (rs *Releases) Set(service string, release Release) error {
+	if err := release.Validate(); err != nil {
+		return err
+	}
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.releases[service] = release
+	return nil
+}
+
+func (rs *Releases) Get(service string) (Release, bool) {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	release, exists := rs.releases[service]
+	return release, exists
+}
+
+// Assign returns the version a request should be served by, an empty
+// version stands for the stable instances. The same caller is always
+// assigned the same version as long as the weight doesn't change.
+func (rs *Releases) Assign(service string, r *http.Request) string {
+	release, exists := rs.Get(service)
+	if !exists || release.Weight == 0 {
+		return ""
+	}
+
+	bucket := rand.IntN(100)
+	if key := stickyKey(r, release.StickyHeader); key != "" {
+		hash := fnv.New32a()
+		hash.Write([]byte(service + ":" + key))
+		bucket = int(hash.Sum32() % 100)
+	}
+	if bucket < release.Weight {
+		return release.Canary
+	}
+	return ""
+}
+
+// Mirror reports whether a copy of the request should be sent to the
+// shadow version of the service, and which version that is
+func (rs *Releases) Mirror(service string, r *http.Request) (string, bool) {
+	release, exists := rs.Get(service)
+	if !exists || release.ShadowPercent == 0 {
+		return "", false
+	}
+	if !release.ShadowWrites && r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return "", false
+	}
+	if rand.IntN(100) >= release.ShadowPercent {
+		return "", false
+	}
+	return release.Shadow, true
+}
+
+// Filter returns the instances serving a version of the service. Stable
+// instances are the ones that aren't of the canary or shadow version.
+func (rs *Releases) Filter(service, version string) func(*registry.Instance) bool {
+	if version != "" {
+		return func(inst *registry.Instance) bool { return inst.Version == version }
+	}
+	release, exists := rs.Get(service)
+	if !exists {
+		return nil
+	}
+	return func(inst *registry.Instance) bool {
+		return inst.Version == "" || (inst.Version != release.Canary && inst.Version != release.Shadow)
+	}
+}
+
+func stickyKey(r *http.Request, header string) string {
+	if header != "" {
+		if value := r.Header.Get(header); value != "" {
+			return value
+		}
+	}
+	identity, ok := sharedMiddleware.GetIdentityFromContext(r.Context())
+	if !ok {
+		return ""
+	}
+	switch {
+	case identity.UserID != "":
+		return "user:" + identity.UserID
+	case identity.APIKeyID != "":
+		return "key:" + identity.APIKeyID
+	default:
+		return identity.ClientIP
+	}
+}
@@ -0,0 +1,277 @@
+package resilience
+
+import (
+	"errors"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+type State string
+
+const (
+	StateClosed   State = "closed"
+	StateOpen     State = "open"
+	StateHalfOpen State = "half_open"
+)
+
+// Outcome is the result of a request guarded by a breaker
+type Outcome int
+
+const (
+	Success Outcome = iota
+	Failure
+	// Ignored releases the slot without counting, e.g. when the client gave up
+	Ignored
+)
+
+// BreakerConfig controls when a breaker opens and how it recovers
+type BreakerConfig struct {
+	// FailureThreshold is the number of consecutive failures that opens the breaker
+	FailureThreshold int
+	// OpenTimeout is how long the breaker stays open before letting trial requests through
+	OpenTimeout time.Duration
+	// HalfOpenRequests is the number of concurrent trial requests while half open
+	HalfOpenRequests int
+}
+
+// BreakerState is a point in time view of a breaker
+type BreakerState struct {
+	Service string `json:"service"`
+	// Version is the canary version the breaker guards, empty for the stable
+	// instances
+	Version             string     `json:"version,omitempty"`
+	State               State      `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	TotalFailures       int64      `json:"total_failures"`
+	TotalSuccesses      int64      `json:"total_successes"`
+	Rejected            int64      `json:"rejected"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+	RetryAt             *time.Time `json:"retry_at,omitempty"`
+}
+
+// CircuitBreaker fails fast once an upstream keeps failing, then lets a few
+// trial requests through after a cool down to find out if it recovered.
+type CircuitBreaker struct {
+	service string
+	version string
+	config  BreakerConfig
+
+	mu             sync.Mutex
+	state          State
+	failures       int
+	halfOpenActive int
+	openedAt       time.Time
+	totalFailures  int64
+	totalSuccesses int64
+	rejected       int64
+}
+
+func NewCircuitBreaker(service string, config BreakerConfig) *CircuitBreaker {
+	if config.FailureThreshold <= 0 {
+		config.FailureThreshold = 5
+	}
+	if config.OpenTimeout <= 0 {
+		config.OpenTimeout = 30 * time.Second
+	}
+	if config.HalfOpenRequests <= 0 {
+		config.HalfOpenRequests = 1
+	}
+	return &CircuitBreaker{
+		service: service,
+		config:  config,
+		state:   StateClosed,
+	}
+}
+
+// Allow reports whether a request may go through. The returned function must
+// be called with the outcome of the request.
+func (b *CircuitBreaker) Allow() (func(Outcome), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == StateOpen {
+		if time.Since(b.openedAt) < b.config.OpenTimeout {
+			b.rejected++
+			return nil, ErrCircuitOpen
+		}
+		b.state = StateHalfOpen
+		b.halfOpenActive = 0
+	}
+
+	trial := b.state == StateHalfOpen
+	if trial {
+		if b.halfOpenActive >= b.config.HalfOpenRequests {
+			b.rejected++
+			return nil, ErrCircuitOpen
+		}
+		b.halfOpenActive++
+	}
+
+	var once sync.Once
+	return func(outcome Outcome) {
+		once.Do(func() { b.record(outcome, trial) })
+	}, nil
+}
+
+// RetryAfter returns how long until an open breaker lets requests through again
+func (b *CircuitBreaker) RetryAfter() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state != StateOpen {
+		return 0
+	}
+	return max(b.config.OpenTimeout-time.Since(b.openedAt), 0)
+}
+
+func (b *CircuitBreaker) record(outcome Outcome, trial bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if trial && b.halfOpenActive > 0 {
+		b.halfOpenActive--
+	}
+
+	switch outcome {
+	case Ignored:
+		return
+	case Success:
+		b.totalSuccesses++
+		b.failures = 0
+		if b.state == StateHalfOpen {
+			b.state = StateClosed
+		}
+		return
+	}
+
+	b.totalFailures++
+	b.failures++
+	if b.state == StateHalfOpen || b.failures >= b.config.FailureThreshold {
+		b.state = StateOpen
+		b.openedAt = time.Now()
+	}
+}
+
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state := BreakerState{
+		Service:             b.service,
+		Version:             b.version,
+		State:               b.state,
+		ConsecutiveFailures: b.failures,
+		TotalFailures:       b.totalFailures,
+		TotalSuccesses:      b.totalSuccesses,
+		Rejected:            b.rejected,
+	}
+	if b.state != StateClosed {
+		openedAt := b.openedAt
+		retryAt := b.openedAt.Add(b.config.OpenTimeout)
+		state.OpenedAt = &openedAt
+		state.RetryAt = &retryAt
+	}
+	return state
+}
+
+// Breakers holds one breaker per upstream service, and one per canary
+// version of a service so that a failing canary can't open the breaker of
+// the stable instances
+type Breakers struct {
+	mu       sync.RWMutex
+	breakers map[string]*CircuitBreaker
+	versions map[string]map[string]*CircuitBreaker
+}
+
+func NewBreakers() *Breakers {
+	return &Breakers{
+		breakers: make(map[string]*CircuitBreaker),
+		versions: make(map[string]map[string]*CircuitBreaker),
+	}
+}
+
+// Add sets the breaker of a service, an existing breaker with the same
+// settings is kept along with its state and the breakers of its versions
+func (b *Breakers) Add(service string, config BreakerConfig) {
+	breaker := NewCircuitBreaker(service, config)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if existing, exists := b.breakers[service]; exists && existing.config == breaker.config {
+		return
+	}
+	b.breakers[service] = breaker
+	delete(b.versions, service)
+}
+
+func (b *Breakers) Get(service string) (*CircuitBreaker, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	breaker, exists := b.breakers[service]
+	return breaker, exists
+}
+
+// GetVersion returns the breaker of a version of a service, created with
+// the settings of the service's breaker on first use
+func (b *Breakers) GetVersion(service, version string) (*CircuitBreaker, bool) {
+	b.mu.RLock()
+	breaker, exists := b.versions[service][version]
+	b.mu.RUnlock()
+	if exists {
+		return breaker, true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stable, exists := b.breakers[service]
+	if !exists {
+		return nil, false
+	}
+	if breaker, exists := b.versions[service][version]; exists {
+		return breaker, true
+	}
+	breaker = NewCircuitBreaker(service, stable.config)
+	breaker.version = version
+	if b.versions[service] == nil {
+		b.versions[service] = make(map[string]*CircuitBreaker)
+	}
+	b.versions[service][version] = breaker
+	return breaker, true
+}
+
+// RemoveVersions drops the breakers of the versions of a service that
+// aren't in keep, once they no longer take traffic
+func (b *Breakers) RemoveVersions(service string, keep ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for version := range b.versions[service] {
+		if !slices.Contains(keep, version) {
+			delete(b.versions[service], version)
+		}
+	}
+}
+
+func (b *Breakers) States() []BreakerState {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	states := make([]BreakerState, 0, len(b.breakers))
+	for _, breaker := range b.breakers {
+		states = append(states, breaker.State())
+	}
+	for _, versions := range b.versions {
+		for _, breaker := range versions {
+			states = append(states, breaker.State())
+		}
+	}
+	sort.Slice(states, func(i, j int) bool {
+		if states[i].Service != states[j].Service {
+			return states[i].Service < states[j].Service
+		}
+		return states[i].Version < states[j].Version
+	})
+	return states
+}
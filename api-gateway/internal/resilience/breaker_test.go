@@ -0,0 +1,197 @@
+package resilience
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// step is something that happens to a breaker, along with the state it
+// should be in afterwards
+type step struct {
+	outcome Outcome
+	// wait lets the open timeout pass before the request
+	wait      bool
+	rejected  bool
+	wantState State
+}
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "failures below the threshold keep it closed",
+			steps: []step{
+				{outcome: Failure, wantState: StateClosed},
+				{outcome: Failure, wantState: StateClosed},
+			},
+		},
+		{
+			name: "a success resets the consecutive failures",
+			steps: []step{
+				{outcome: Failure, wantState: StateClosed},
+				{outcome: Failure, wantState: StateClosed},
+				{outcome: Success, wantState: StateClosed},
+				{outcome: Failure, wantState: StateClosed},
+				{outcome: Failure, wantState: StateClosed},
+			},
+		},
+		{
+			name: "the threshold opens it and it rejects until the timeout",
+			steps: []step{
+				{outcome: Failure, wantState: StateClosed},
+				{outcome: Failure, wantState: StateClosed},
+				{outcome: Failure, wantState: StateOpen},
+				{rejected: true, wantState: StateOpen},
+			},
+		},
+		{
+			name: "a successful trial closes it",
+			steps: []step{
+				{outcome: Failure, wantState: StateClosed},
+				{outcome: Failure, wantState: StateClosed},
+				{outcome: Failure, wantState: StateOpen},
+				{wait: true, outcome: Success, wantState: StateClosed},
+				{outcome: Success, wantState: StateClosed},
+			},
+		},
+		{
+			name: "a failed trial opens it again",
+			steps: []step{
+				{outcome: Failure, wantState: StateClosed},
+				{outcome: Failure, wantState: StateClosed},
+				{outcome: Failure, wantState: StateOpen},
+				{wait: true, outcome: Failure, wantState: StateOpen},
+				{rejected: true, wantState: StateOpen},
+			},
+		},
+		{
+			name: "ignored outcomes don't count",
+			steps: []step{
+				{outcome: Failure, wantState: StateClosed},
+				{outcome: Failure, wantState: StateClosed},
+				{outcome: Ignored, wantState: StateClosed},
+				{outcome: Ignored, wantState: StateClosed},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			breaker := NewCircuitBreaker("product", BreakerConfig{
+				FailureThreshold: 3,
+				OpenTimeout:      20 * time.Millisecond,
+				HalfOpenRequests: 1,
+			})
+			for i, step := range tt.steps {
+				if step.wait {
+					time.Sleep(30 * time.Millisecond)
+				}
+				done, err := breaker.Allow()
+				if step.rejected {
+					if !errors.Is(err, ErrCircuitOpen) {
+						t.Fatalf("step %d: got %v, want %v", i, err, ErrCircuitOpen)
+					}
+				} else {
+					if err != nil {
+						t.Fatalf("step %d: %v", i, err)
+					}
+					done(step.outcome)
+				}
+				if state := breaker.State().State; state != step.wantState {
+					t.Fatalf("step %d: state %s, want %s", i, state, step.wantState)
+				}
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerHalfOpenLimitsTrials(t *testing.T) {
+	breaker := NewCircuitBreaker("product", BreakerConfig{
+		FailureThreshold: 1,
+		OpenTimeout:      20 * time.Millisecond,
+		HalfOpenRequests: 2,
+	})
+	done, err := breaker.Allow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	done(Failure)
+	if retryAfter := breaker.RetryAfter(); retryAfter <= 0 || retryAfter > 20*time.Millisecond {
+		t.Fatalf("RetryAfter %s, want within the open timeout", retryAfter)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	first, err := breaker.Allow()
+	if err != nil {
+		t.Fatalf("first trial: %v", err)
+	}
+	if state := breaker.State().State; state != StateHalfOpen {
+		t.Fatalf("state %s, want %s", state, StateHalfOpen)
+	}
+	second, err := breaker.Allow()
+	if err != nil {
+		t.Fatalf("second trial: %v", err)
+	}
+	if _, err := breaker.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("third trial: got %v, want %v", err, ErrCircuitOpen)
+	}
+
+	// A trial the client gave up on frees its slot
+	first(Ignored)
+	third, err := breaker.Allow()
+	if err != nil {
+		t.Fatalf("trial after a released slot: %v", err)
+	}
+	second(Success)
+	third(Success)
+	if state := breaker.State(); state.State != StateClosed || state.Rejected != 1 {
+		t.Fatalf("got %s with %d rejected, want %s with 1", state.State, state.Rejected, StateClosed)
+	}
+}
+
+func TestCircuitBreakerDoneCountsOnce(t *testing.T) {
+	breaker := NewCircuitBreaker("product", BreakerConfig{FailureThreshold: 2})
+	done, err := breaker.Allow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	done(Failure)
+	done(Failure)
+	if state := breaker.State(); state.State != StateClosed || state.TotalFailures != 1 {
+		t.Fatalf("got %s with %d failures, want %s with 1", state.State, state.TotalFailures, StateClosed)
+	}
+}
+
+func TestBreakersVersionsAreSeparate(t *testing.T) {
+	breakers := NewBreakers()
+	breakers.Add("product", BreakerConfig{FailureThreshold: 1, OpenTimeout: time.Minute})
+
+	canary, ok := breakers.GetVersion("product", "2.0.0")
+	if !ok {
+		t.Fatal("no breaker for the canary version")
+	}
+	done, err := canary.Allow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	done(Failure)
+
+	stable, _ := breakers.Get("product")
+	if state := stable.State().State; state != StateClosed {
+		t.Fatalf("stable breaker %s after a canary failure, want %s", state, StateClosed)
+	}
+	if again, _ := breakers.GetVersion("product", "2.0.0"); again != canary {
+		t.Fatal("GetVersion created a second breaker for the same version")
+	}
+	if _, ok := breakers.GetVersion("order", "2.0.0"); ok {
+		t.Fatal("GetVersion returned a breaker for a service without one")
+	}
+
+	breakers.RemoveVersions("product")
+	if again, _ := breakers.GetVersion("product", "2.0.0"); again == canary {
+		t.Fatal("RemoveVersions kept the breaker of a dropped version")
+	}
+}
@@ -0,0 +1,79 @@
+package resilience
+
+import (
+	"math/bits"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Policy controls how the gateway talks to one upstream service
+type Policy struct {
+	// Timeout bounds each attempt, zero means no timeout
+	Timeout time.Duration
+	// MaxRetries is the number of extra attempts for idempotent requests
+	MaxRetries int
+	// BaseBackoff is the delay before the first retry, doubled on every attempt
+	BaseBackoff time.Duration
+	// MaxBackoff caps the delay between two attempts
+	MaxBackoff time.Duration
+}
+
+// Policies holds the policy of every upstream service
+type Policies struct {
+	mu       sync.RWMutex
+	policies map[string]Policy
+}
+
+func NewPolicies() *Policies {
+	return &Policies{
+		policies: make(map[string]Policy),
+	}
+}
+
+func (p *Policies) Set(service string, policy Policy) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.policies[service] = policy
+}
+
+// Get returns the policy of a service, the zero policy when it has none
+func (p *Policies) Get(service string) Policy {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.policies[service]
+}
+
+// Backoff returns the delay before the given retry attempt (starting at 1)
+// using exponential backoff with full jitter.
+func (p Policy) Backoff(attempt int) time.Duration {
+	if p.BaseBackoff <= 0 {
+		return 0
+	}
+	// The shift stops short of overflowing, later attempts wait as long
+	// as the last one that fits
+	shift := min(max(attempt-1, 0), bits.LeadingZeros64(uint64(p.BaseBackoff))-1)
+	backoff := p.BaseBackoff << shift
+	if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+	return time.Duration(rand.Int64N(int64(backoff)) + 1)
+}
+
+// IsIdempotent reports whether a request with the given method can safely be sent twice
+func IsIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsRetryableStatus reports whether an upstream answer is worth another attempt
+func IsRetryableStatus(code int) bool {
+	return code == http.StatusBadGateway ||
+		code == http.StatusServiceUnavailable ||
+		code == http.StatusGatewayTimeout
+}
@@ -0,0 +1,86 @@
+package resilience
+
+import (
+	"math"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestPolicyBackoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  Policy
+		attempt int
+		max     time.Duration
+	}{
+		{name: "no base backoff", policy: Policy{}, attempt: 3, max: 0},
+		{name: "first attempt", policy: Policy{BaseBackoff: 100 * time.Millisecond}, attempt: 1, max: 100 * time.Millisecond},
+		{name: "doubles every attempt", policy: Policy{BaseBackoff: 100 * time.Millisecond}, attempt: 4, max: 800 * time.Millisecond},
+		{name: "capped", policy: Policy{BaseBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}, attempt: 10, max: time.Second},
+		{name: "capped past overflow", policy: Policy{BaseBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}, attempt: 200, max: time.Second},
+		{name: "uncapped past overflow", policy: Policy{BaseBackoff: 100 * time.Millisecond}, attempt: 200, max: math.MaxInt64},
+		{name: "uncapped at the largest shift", policy: Policy{BaseBackoff: 1}, attempt: 64, max: math.MaxInt64},
+		{name: "attempt below one", policy: Policy{BaseBackoff: 100 * time.Millisecond}, attempt: 0, max: 100 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for range 100 {
+				backoff := tt.policy.Backoff(tt.attempt)
+				if tt.max == 0 {
+					if backoff != 0 {
+						t.Fatalf("got %s, want 0", backoff)
+					}
+					continue
+				}
+				if backoff <= 0 || backoff > tt.max {
+					t.Fatalf("got %s, want within (0, %s]", backoff, tt.max)
+				}
+			}
+		})
+	}
+}
+
+func TestIsIdempotent(t *testing.T) {
+	tests := []struct {
+		method string
+		want   bool
+	}{
+		{http.MethodGet, true},
+		{http.MethodHead, true},
+		{http.MethodOptions, true},
+		{http.MethodPut, true},
+		{http.MethodDelete, true},
+		{http.MethodPost, false},
+		{http.MethodPatch, false},
+		{http.MethodConnect, false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsIdempotent(tt.method); got != tt.want {
+			t.Errorf("IsIdempotent(%q) = %v, want %v", tt.method, got, tt.want)
+		}
+	}
+}
+
+func TestIsRetryableStatus(t *testing.T) {
+	tests := []struct {
+		code int
+		want bool
+	}{
+		{http.StatusOK, false},
+		{http.StatusInternalServerError, false},
+		{http.StatusBadGateway, true},
+		{http.StatusServiceUnavailable, true},
+		{http.StatusGatewayTimeout, true},
+		{http.StatusTooManyRequests, false},
+	}
+
+	for _, tt := range tests {
+		if got := IsRetryableStatus(tt.code); got != tt.want {
+			t.Errorf("IsRetryableStatus(%d) = %v, want %v", tt.code, got, tt.want)
+		}
+	}
+}
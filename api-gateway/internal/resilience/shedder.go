@@ -0,0 +1,207 @@
+package resilience
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Priority orders requests by how much they matter when a service is
+// overloaded, the lowest ones are turned away first
+type Priority int
+
+const (
+	PriorityLow Priority = iota
+	PriorityNormal
+	PriorityHigh
+	// PriorityCritical requests are never shed
+	PriorityCritical
+)
+
+var priorityNames = map[Priority]string{
+	PriorityLow:      "low",
+	PriorityNormal:   "normal",
+	PriorityHigh:     "high",
+	PriorityCritical: "critical",
+}
+
+// shedThresholds is the load from which requests of each priority are shed
+var shedThresholds = map[Priority]float64{
+	PriorityLow:    0.5,
+	PriorityNormal: 0.75,
+	PriorityHigh:   0.9,
+}
+
+const (
+	// latencyWeight is the weight of a new sample in the latency average
+	latencyWeight = 0.2
+	// latencyHalfLife is how fast the latency average fades without samples,
+	// so a service whose traffic is all shed gets traffic again
+	latencyHalfLife = 5 * time.Second
+)
+
+// ParsePriority parses a priority name, an empty name is normal
+func ParsePriority(name string) (Priority, error) {
+	if name == "" {
+		return PriorityNormal, nil
+	}
+	for priority, priorityName := range priorityNames {
+		if name == priorityName {
+			return priority, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown priority: %s", name)
+}
+
+func (p Priority) String() string {
+	return priorityNames[p]
+}
+
+// ShedderConfig is the capacity of a service, zero values disable a limit
+type ShedderConfig struct {
+	// MaxInFlight is the number of concurrent requests the service handles
+	MaxInFlight int
+	// TargetLatency is the time to first byte of a healthy service
+	TargetLatency time.Duration
+}
+
+// LoadState is a point in time view of the load of a service
+type LoadState struct {
+	Service       string  `json:"service"`
+	InFlight      int64   `json:"in_flight"`
+	MaxInFlight   int     `json:"max_in_flight"`
+	LatencyMs     float64 `json:"latency_ms"`
+	TargetLatency string  `json:"target_latency"`
+	Load          float64 `json:"load"`
+	Shed          int64   `json:"shed"`
+}
+
+// Shedder tracks the requests in flight and the latency of every service to
+// shed low priority requests before the service degrades for all of them.
+// The load of a service is the highest of its concurrency and latency
+// relative to its capacity.
+type Shedder struct {
+	mu       sync.RWMutex
+	services map[string]*serviceLoad
+}
+
+type serviceLoad struct {
+	inFlight atomic.Int64
+	shed     atomic.Int64
+
+	mu      sync.Mutex
+	config  ShedderConfig
+	latency float64
+	sampled time.Time
+}
+
+func NewShedder() *Shedder {
+	return &Shedder{
+		services: make(map[string]*serviceLoad),
+	}
+}
+
+// Set changes the capacity of a service, keeping its current load
+func (s *Shedder) Set(service string, config ShedderConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	load, exists := s.services[service]
+	if !exists {
+		load = &serviceLoad{}
+		s.services[service] = load
+	}
+	load.mu.Lock()
+	load.config = config
+	load.mu.Unlock()
+}
+
+// Admit reports whether a request of the given priority may go to service.
+// An admitted request must call done with its latency once it's served.
+func (s *Shedder) Admit(service string, priority Priority) (func(time.Duration), bool) {
+	s.mu.RLock()
+	load, exists := s.services[service]
+	s.mu.RUnlock()
+	if !exists {
+		return func(time.Duration) {}, true
+	}
+
+	if threshold, sheddable := shedThresholds[priority]; sheddable && load.load(time.Now()) >= threshold {
+		load.shed.Add(1)
+		return nil, false
+	}
+
+	load.inFlight.Add(1)
+	var once sync.Once
+	return func(latency time.Duration) {
+		once.Do(func() {
+			load.inFlight.Add(-1)
+			load.observe(latency, time.Now())
+		})
+	}, true
+}
+
+// States returns the load of every service
+func (s *Shedder) States() []LoadState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	states := make([]LoadState, 0, len(s.services))
+	for service, load := range s.services {
+		load.mu.Lock()
+		config := load.config
+		latency := load.decayed(now)
+		load.mu.Unlock()
+
+		states = append(states, LoadState{
+			Service:       service,
+			InFlight:      load.inFlight.Load(),
+			MaxInFlight:   config.MaxInFlight,
+			LatencyMs:     math.Round(latency / float64(time.Millisecond)),
+			TargetLatency: config.TargetLatency.String(),
+			Load:          math.Round(load.load(now)*100) / 100,
+			Shed:          load.shed.Load(),
+		})
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Service < states[j].Service })
+	return states
+}
+
+func (l *serviceLoad) load(now time.Time) float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var load float64
+	if l.config.MaxInFlight > 0 {
+		load = float64(l.inFlight.Load()) / float64(l.config.MaxInFlight)
+	}
+	if l.config.TargetLatency > 0 {
+		load = max(load, l.decayed(now)/float64(l.config.TargetLatency))
+	}
+	return load
+}
+
+func (l *serviceLoad) observe(latency time.Duration, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.sampled.IsZero() {
+		l.latency = float64(latency)
+	} else {
+		l.latency = latencyWeight*float64(latency) + (1-latencyWeight)*l.decayed(now)
+	}
+	l.sampled = now
+}
+
+// decayed returns the latency average faded by the time since the last
+// sample. The lock must be held.
+func (l *serviceLoad) decayed(now time.Time) float64 {
+	if l.sampled.IsZero() {
+		return 0
+	}
+	return l.latency * math.Exp2(-float64(now.Sub(l.sampled))/float64(latencyHalfLife))
+}
@@ -1,32 +1,131 @@
 package router
 
 import (
+	"cmp"
+	"fmt"
 	"net/http"
-	"time"
+	"slices"
+	"strings"
+	"sync/atomic"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	httpSwagger "github.com/swaggo/http-swagger"
 
+	"github.com/kaleabAlemayehu/eagle-commerce/api-gateway/internal/apikey"
+	"github.com/kaleabAlemayehu/eagle-commerce/api-gateway/internal/cache"
+	"github.com/kaleabAlemayehu/eagle-commerce/api-gateway/internal/graph"
 	"github.com/kaleabAlemayehu/eagle-commerce/api-gateway/internal/handler"
 	gatewayMiddleware "github.com/kaleabAlemayehu/eagle-commerce/api-gateway/internal/middleware"
+	"github.com/kaleabAlemayehu/eagle-commerce/api-gateway/internal/openapi"
+	"github.com/kaleabAlemayehu/eagle-commerce/api-gateway/internal/ratelimit"
+	"github.com/kaleabAlemayehu/eagle-commerce/api-gateway/internal/resilience"
+	"github.com/kaleabAlemayehu/eagle-commerce/api-gateway/internal/routing"
 	authMiddleware "github.com/kaleabAlemayehu/eagle-commerce/shared/middleware"
 )
 
-func NewRouter(proxyHandler *handler.ProxyHandler, auth *authMiddleware.Auth, allowedOrigins []string) *chi.Mux {
+// DocumentedServices describes how the default routes protect each service,
+// for the merged API documentation
+var DocumentedServices = []openapi.Service{
+	{Name: "user", Security: []string{"BearerAuth"}, Public: []string{"POST /api/v1/users/login", "POST /api/v1/users/signup"}},
+	{Name: "product", Security: []string{"BearerAuth", "ApiKeyAuth"}},
+	{Name: "order", Security: []string{"BearerAuth", "ApiKeyAuth"}},
+	{Name: "payment", Security: []string{"BearerAuth"}, Public: []string{"POST /api/v1/payments/webhook"}},
+}
+
+// Router serves the endpoints of the gateway itself and the routes of the
+// routing config. The config can be replaced while the gateway runs,
+// requests already being served finish on the routes they started with.
+type Router struct {
+	proxyHandler     *handler.ProxyHandler
+	aggregateHandler *handler.AggregateHandler
+	graphHandler     *graph.Handler
+	docsHandler      *openapi.Handler
+	streamHandler    *handler.StreamHandler
+	adminHandler     *handler.AdminHandler
+	apiKeyHandler    *handler.APIKeyHandler
+	auth             *authMiddleware.Auth
+	keys             *apikey.Manager
+	proxies          *gatewayMiddleware.TrustedProxies
+	responseCache    *cache.Cache
+	limitStore       ratelimit.Store
+	limitStats       *gatewayMiddleware.RateLimitStats
+	routeStats       *gatewayMiddleware.RouteStats
+	shedder          *resilience.Shedder
+	adminToken       string
+
+	mux atomic.Pointer[chi.Mux]
+}
+
+func NewRouter(proxyHandler *handler.ProxyHandler, aggregateHandler *handler.AggregateHandler, graphHandler *graph.Handler, docsHandler *openapi.Handler, streamHandler *handler.StreamHandler, adminHandler *handler.AdminHandler, apiKeyHandler *handler.APIKeyHandler, auth *authMiddleware.Auth, keys *apikey.Manager, proxies *gatewayMiddleware.TrustedProxies, responseCache *cache.Cache, limitStore ratelimit.Store, limitStats *gatewayMiddleware.RateLimitStats, routeStats *gatewayMiddleware.RouteStats, shedder *resilience.Shedder, adminToken string) *Router {
+	return &Router{
+		proxyHandler:     proxyHandler,
+		aggregateHandler: aggregateHandler,
+		graphHandler:     graphHandler,
+		docsHandler:      docsHandler,
+		streamHandler:    streamHandler,
+		adminHandler:     adminHandler,
+		apiKeyHandler:    apiKeyHandler,
+		auth:             auth,
+		keys:             keys,
+		proxies:          proxies,
+		responseCache:    responseCache,
+		limitStore:       limitStore,
+		limitStats:       limitStats,
+		routeStats:       routeStats,
+		shedder:          shedder,
+		adminToken:       adminToken,
+	}
+}
+
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rt.mux.Load().ServeHTTP(w, r)
+}
+
+// Load builds the routes of cfg and swaps them in
+func (rt *Router) Load(cfg *routing.Config) error {
+	mux, err := rt.Build(cfg)
+	if err != nil {
+		return err
+	}
+	rt.Swap(mux)
+	return nil
+}
+
+// Swap replaces the routes served with a mux returned by Build
+func (rt *Router) Swap(mux *chi.Mux) {
+	rt.mux.Store(mux)
+}
+
+// Build returns the routes of cfg without serving them
+func (rt *Router) Build(cfg *routing.Config) (mux *chi.Mux, err error) {
+	// chi panics on patterns it can't route
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			mux, err = nil, fmt.Errorf("invalid route: %v", recovered)
+		}
+	}()
+
+	rateLimiter := gatewayMiddleware.NewRateLimiter(
+		rt.limitStore,
+		rt.proxies,
+		rt.limitStats,
+		rateLimitTier(cfg, routing.TierAnonymous),
+		rateLimitTier(cfg, routing.TierUser),
+	)
+
 	r := chi.NewRouter()
 
 	// Middleware
 	r.Use(middleware.Logger)
+	// Outside of Recoverer so that panics count as server errors
+	r.Use(rt.routeStats.Middleware)
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.RequestID)
-	r.Use(gatewayMiddleware.CORS(allowedOrigins))
+	r.Use(gatewayMiddleware.Identify(rt.auth, rt.keys, rt.proxies))
+	r.Use(gatewayMiddleware.CORS(cfg.CORS.AllowedOrigins))
 
-	r.Use(gatewayMiddleware.NewRateLimit(gatewayMiddleware.RateLimiterConfig{
-		RequestsPerMinute: 100,
-		Burst:             10,
-		CleanupInterval:   5 * time.Minute,
-		Timeout:           15 * time.Minute,
-	}))
+	r.Use(rateLimiter.Middleware())
 
 	// Health check
 	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
@@ -34,30 +133,115 @@ func NewRouter(proxyHandler *handler.ProxyHandler, auth *authMiddleware.Auth, al
 		w.Write([]byte("API Gateway is healthy"))
 	})
 
-	// Service routing
-	r.Route("/api/v1", func(r chi.Router) {
-		// User service routes
-		r.Route("/users", func(r chi.Router) {
-			r.HandleFunc("/*", proxyHandler.ProxyRequest("user"))
-		})
+	// API documentation of every service
+	r.Get("/swagger/doc.json", rt.docsHandler.ServeHTTP)
+	r.Get("/swagger/*", httpSwagger.Handler(
+		httpSwagger.URL("/swagger/doc.json"),
+	))
 
-		// Product service routes (protected)
-		r.Route("/products", func(r chi.Router) {
-			r.Use(auth.AuthMiddleware())
-			r.HandleFunc("/*", proxyHandler.ProxyRequest("product"))
+	// Gateway administration
+	r.Route("/admin", func(r chi.Router) {
+		r.Use(gatewayMiddleware.AdminAuth(rt.adminToken))
+		r.Use(gatewayMiddleware.LimitBody(cfg.MaxBodyBytes))
+		r.Get("/routes", rt.adminHandler.ListRoutes(cfg.Routes))
+		r.Get("/upstreams", rt.adminHandler.ListUpstreams)
+		r.Put("/upstreams/{service}/state", rt.adminHandler.SetUpstreamState)
+		r.Get("/breakers", rt.adminHandler.ListBreakers)
+		r.Get("/rate-limits", rt.adminHandler.ListRateLimited)
+		r.Get("/errors", rt.adminHandler.ListRouteErrors)
+		r.Get("/load", rt.adminHandler.ListLoad)
+		r.Get("/cache", rt.adminHandler.CacheStats)
+		r.Route("/api-keys", func(r chi.Router) {
+			r.Post("/", rt.apiKeyHandler.CreateAPIKey)
+			r.Get("/", rt.apiKeyHandler.ListAPIKeys)
+			r.Get("/{id}", rt.apiKeyHandler.GetAPIKey)
+			r.Delete("/{id}", rt.apiKeyHandler.RevokeAPIKey)
 		})
+	})
 
-		// Order service routes (protected)
-		r.Route("/orders", func(r chi.Router) {
-			r.Use(auth.AuthMiddleware())
-			r.HandleFunc("/*", proxyHandler.ProxyRequest("order"))
-		})
+	// GraphQL over every service, signup and login work without a token and
+	// count against the tier of the credential endpoints
+	authTier := rateLimitTier(cfg, routing.TierAuth)
+	graphHandler := rt.graphHandler.WithCredentialLimit(func(w http.ResponseWriter, r *http.Request) bool {
+		return rateLimiter.Count(w, r, authTier)
+	})
+	r.With(gatewayMiddleware.LimitBody(cfg.MaxBodyBytes)).Handle("/graphql", graphHandler)
 
-		// Payment service routes (protected)
-		r.Route("/payments", func(r chi.Router) {
-			r.HandleFunc("/*", proxyHandler.ProxyRequest("payment"))
-		})
+	// Service routing
+	routed := make(map[string]bool, len(cfg.Routes))
+	for _, route := range cfg.Routes {
+		routed[route.Path] = true
+	}
+	// Routes for some methods take over those methods from a route for all
+	// of them on the same path, chi keeps the last handler registered
+	routes := slices.Clone(cfg.Routes)
+	slices.SortStableFunc(routes, func(a, b routing.Route) int {
+		return cmp.Compare(min(len(a.Methods), 1), min(len(b.Methods), 1))
 	})
+	for _, route := range routes {
+		h := rt.route(cfg, rateLimiter, route)
+		patterns := []string{route.Path}
+		// A prefix route also serves the prefix itself
+		if prefix, ok := strings.CutSuffix(route.Path, "/*"); ok && prefix != "" && !routed[prefix] {
+			patterns = append(patterns, prefix)
+		}
+		for _, pattern := range patterns {
+			if len(route.Methods) == 0 {
+				r.Handle(pattern, h)
+				continue
+			}
+			for _, method := range route.Methods {
+				r.Method(strings.ToUpper(method), pattern, h)
+			}
+		}
+	}
+
+	return r, nil
+}
+
+// route returns the handler of a route wrapped in the middleware it asks for
+func (rt *Router) route(cfg *routing.Config, rateLimiter *gatewayMiddleware.RateLimiter, route routing.Route) http.Handler {
+	var h http.Handler
+	switch route.Handler {
+	case routing.HandlerOrderDetails:
+		h = http.HandlerFunc(rt.aggregateHandler.GetOrderDetails)
+	case routing.HandlerOrderEvents:
+		h = http.HandlerFunc(rt.streamHandler.StreamOrderEvents)
+	default:
+		h = rt.proxyHandler.ProxyRequest(route.Service)
+	}
+
+	var middlewares chi.Middlewares
+	switch route.Auth {
+	case routing.AuthUser:
+		middlewares = append(middlewares, gatewayMiddleware.RequireUser())
+	case routing.AuthUserOrAPIKey:
+		middlewares = append(middlewares, gatewayMiddleware.Authenticate(route.Scope))
+	}
+	if route.RateLimit != "" {
+		middlewares = append(middlewares, rateLimiter.Route(rateLimitTier(cfg, route.RateLimit)))
+	}
+	limit := cfg.MaxBodyBytes
+	if route.MaxBodyBytes > 0 {
+		limit = route.MaxBodyBytes
+	}
+	middlewares = append(middlewares, gatewayMiddleware.LimitBody(limit))
+	if route.Cache && rt.responseCache != nil {
+		middlewares = append(middlewares, rt.responseCache.Middleware)
+	}
+	// Inside of the cache, cached responses don't load the service
+	if route.Service != "" {
+		priority, _ := resilience.ParsePriority(route.Priority)
+		middlewares = append(middlewares, gatewayMiddleware.Shed(rt.shedder, route.Service, priority))
+	}
+	return middlewares.Handler(h)
+}
 
-	return r
+func rateLimitTier(cfg *routing.Config, name string) gatewayMiddleware.RateLimitTier {
+	tier := cfg.RateLimits[name]
+	return gatewayMiddleware.RateLimitTier{
+		Name:     name,
+		Requests: tier.Requests,
+		Window:   tier.Window,
+	}
 }
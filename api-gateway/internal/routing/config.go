@@ -0,0 +1,307 @@
+package routing
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/caarlos0/env/v11"
+	"gopkg.in/yaml.v3"
+
+	"github.com/kaleabAlemayehu/eagle-commerce/api-gateway/internal/apikey"
+	gatewayConfig "github.com/kaleabAlemayehu/eagle-commerce/api-gateway/internal/config"
+	"github.com/kaleabAlemayehu/eagle-commerce/api-gateway/internal/registry"
+	"github.com/kaleabAlemayehu/eagle-commerce/api-gateway/internal/resilience"
+)
+
+// Who may call a route
+const (
+	AuthPublic = "public"
+	AuthUser   = "user"
+	// AuthUserOrAPIKey also accepts API keys holding the scope of the route
+	AuthUserOrAPIKey = "user_or_api_key"
+)
+
+// Handlers of the gateway itself that routes can point to
+const (
+	HandlerOrderDetails = "order_details"
+	HandlerOrderEvents  = "order_events"
+)
+
+// Tiers applied to every request, to anonymous callers and to users or API
+// keys. Other tiers only apply to the routes naming them.
+const (
+	TierAnonymous = "ip"
+	TierUser      = "user"
+	// TierAuth is the stricter tier of the credential endpoints, GraphQL
+	// counts its credential mutations against it too
+	TierAuth = "auth"
+)
+
+var handlers = []string{HandlerOrderDetails, HandlerOrderEvents}
+
+// Config is the declarative part of the gateway: its routes and the
+// upstreams, rate limit tiers, CORS origins and body size limit they use
+type Config struct {
+	// MaxBodyBytes bounds request bodies on routes without their own limit,
+	// zero means unbounded
+	MaxBodyBytes int64                                   `yaml:"max_body_bytes"`
+	CORS         CORSConfig                              `yaml:"cors"`
+	RateLimits   map[string]gatewayConfig.RateLimitTier  `yaml:"rate_limits"`
+	Upstreams    map[string]gatewayConfig.UpstreamConfig `yaml:"upstreams"`
+	Routes       []Route                                 `yaml:"routes"`
+	// MaxRateLimitWindow bounds the window of the tiers, it comes from the
+	// environment and reloads can't change it
+	MaxRateLimitWindow time.Duration `yaml:"-"`
+}
+
+type CORSConfig struct {
+	AllowedOrigins []string `yaml:"allowed_origins"`
+}
+
+// Route sends the requests matching a path to a service or to a handler of
+// the gateway
+type Route struct {
+	// Path is a chi pattern, a trailing /* also matches the path without it
+	Path string `json:"path" yaml:"path"`
+	// Methods restricts the route to some methods, it matches all when empty
+	Methods []string `json:"methods,omitempty" yaml:"methods"`
+	Service string   `json:"service,omitempty" yaml:"service"`
+	Handler string   `json:"handler,omitempty" yaml:"handler"`
+	// Auth is public, user or user_or_api_key, public when empty
+	Auth string `json:"auth,omitempty" yaml:"auth"`
+	// Scope is the resource whose scopes API keys need
+	Scope string `json:"scope,omitempty" yaml:"scope"`
+	// RateLimit names an additional tier counted for the route
+	RateLimit string `json:"rate_limit,omitempty" yaml:"rate_limit"`
+	// Cache serves the responses from the catalog cache when it's enabled
+	Cache        bool  `json:"cache,omitempty" yaml:"cache"`
+	MaxBodyBytes int64 `json:"max_body_bytes,omitempty" yaml:"max_body_bytes"`
+	// Priority is low, normal, high or critical, normal when empty. Lower
+	// priorities are shed first when the service is overloaded, critical
+	// routes never are.
+	Priority string `json:"priority,omitempty" yaml:"priority"`
+}
+
+// DefaultRoutes are the routes used without a routing config file
+var DefaultRoutes = []Route{
+	// Credential endpoints get a stricter tier against brute forcing
+	{Path: "/api/v1/users/login", Methods: []string{http.MethodPost}, Service: "user", RateLimit: TierAuth, Priority: "high"},
+	{Path: "/api/v1/users/login/*", Methods: []string{http.MethodPost}, Service: "user", RateLimit: TierAuth, Priority: "high"},
+	{Path: "/api/v1/users/signup", Methods: []string{http.MethodPost}, Service: "user", RateLimit: TierAuth},
+	{Path: "/api/v1/users/password/*", Methods: []string{http.MethodPost}, Service: "user", RateLimit: TierAuth},
+	{Path: "/api/v1/users/verify", Methods: []string{http.MethodPost}, Service: "user", RateLimit: TierAuth},
+	{Path: "/api/v1/users/*", Service: "user"},
+	// Public keys of the access tokens, for verifiers outside the platform
+	{Path: "/.well-known/jwks.json", Methods: []string{http.MethodGet}, Service: "user"},
+	// Browsing is shed first so that checkout keeps working under load
+	{Path: "/api/v1/products/*", Methods: []string{http.MethodGet, http.MethodHead}, Service: "product", Auth: AuthUserOrAPIKey, Scope: "products", Cache: true, Priority: "low"},
+	{Path: "/api/v1/products/*", Service: "product", Auth: AuthUserOrAPIKey, Scope: "products", Cache: true},
+	{Path: "/api/v1/orders/{id}/details", Methods: []string{http.MethodGet}, Handler: HandlerOrderDetails, Auth: AuthUserOrAPIKey, Scope: "orders"},
+	{Path: "/api/v1/orders/{id}/events", Methods: []string{http.MethodGet}, Handler: HandlerOrderEvents, Auth: AuthUserOrAPIKey, Scope: "orders"},
+	{Path: "/api/v1/orders/*", Methods: []string{http.MethodPost}, Service: "order", Auth: AuthUserOrAPIKey, Scope: "orders", Priority: "critical"},
+	{Path: "/api/v1/orders/*", Service: "order", Auth: AuthUserOrAPIKey, Scope: "orders", Priority: "high"},
+	// Payment providers can't authenticate, the payment service checks the
+	// signature of their webhooks
+	{Path: "/api/v1/payments/webhook", Methods: []string{http.MethodPost}, Service: "payment"},
+	{Path: "/api/v1/payments/*", Service: "payment", Auth: AuthUser, Priority: "critical"},
+}
+
+// FromEnv returns the config described by the environment variables
+func FromEnv(cfg *gatewayConfig.Config, allowedOrigins []string) *Config {
+	return &Config{
+		MaxBodyBytes: cfg.MaxBodyBytes,
+		CORS:         CORSConfig{AllowedOrigins: allowedOrigins},
+		RateLimits: map[string]gatewayConfig.RateLimitTier{
+			TierAnonymous: cfg.RateLimit.Anonymous,
+			TierUser:      cfg.RateLimit.User,
+			TierAuth:      cfg.RateLimit.Auth,
+		},
+		Upstreams:          cfg.Upstreams.ByService(),
+		Routes:             DefaultRoutes,
+		MaxRateLimitWindow: cfg.RateLimit.MaxWindow,
+	}
+}
+
+// document is a config file as written, sections it leaves out are taken
+// from the defaults
+type document struct {
+	MaxBodyBytes *int64                                 `yaml:"max_body_bytes"`
+	CORS         *CORSConfig                            `yaml:"cors"`
+	RateLimits   map[string]gatewayConfig.RateLimitTier `yaml:"rate_limits"`
+	Upstreams    map[string]yaml.Node                   `yaml:"upstreams"`
+	Routes       []Route                                `yaml:"routes"`
+}
+
+// Parse reads a YAML or JSON config, sections it doesn't have are taken from
+// defaults. The result is validated.
+func Parse(data []byte, defaults *Config) (*Config, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	var doc document
+	if err := decoder.Decode(&doc); err != nil {
+		// An empty file is more likely caught halfway through a write than
+		// meant to reset every section
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("config is empty")
+		}
+		return nil, err
+	}
+
+	cfg := *defaults
+	if doc.MaxBodyBytes != nil {
+		cfg.MaxBodyBytes = *doc.MaxBodyBytes
+	}
+	if doc.CORS != nil {
+		cfg.CORS = *doc.CORS
+	}
+	if doc.RateLimits != nil {
+		cfg.RateLimits = doc.RateLimits
+	}
+	if doc.Routes != nil {
+		cfg.Routes = doc.Routes
+	}
+	if doc.Upstreams != nil {
+		cfg.Upstreams = make(map[string]gatewayConfig.UpstreamConfig, len(doc.Upstreams))
+		for name, node := range doc.Upstreams {
+			// Settings left out keep their usual defaults
+			var upstream gatewayConfig.UpstreamConfig
+			if err := env.ParseWithOptions(&upstream, env.Options{Environment: map[string]string{}}); err != nil {
+				return nil, err
+			}
+			if err := node.Decode(&upstream); err != nil {
+				return nil, fmt.Errorf("upstream %s: %w", name, err)
+			}
+			cfg.Upstreams[name] = upstream
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// Validate checks the whole config, so that applying it can't fail halfway
+func (c *Config) Validate() error {
+	if c.MaxBodyBytes < 0 {
+		return errors.New("max_body_bytes can't be negative")
+	}
+
+	for name, tier := range c.RateLimits {
+		if tier.Requests > 0 && tier.Window <= 0 {
+			return fmt.Errorf("rate limit %s: window is required", name)
+		}
+		if c.MaxRateLimitWindow > 0 && tier.Window > c.MaxRateLimitWindow {
+			return fmt.Errorf("rate limit %s: window is longer than %s", name, c.MaxRateLimitWindow)
+		}
+	}
+
+	for name, upstream := range c.Upstreams {
+		if err := validateUpstream(upstream); err != nil {
+			return fmt.Errorf("upstream %s: %w", name, err)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for i, route := range c.Routes {
+		if err := c.validateRoute(route); err != nil {
+			return fmt.Errorf("route %d (%s): %w", i+1, route.Path, err)
+		}
+		keys := []string{route.Path}
+		if len(route.Methods) > 0 {
+			keys = keys[:0]
+			for _, method := range route.Methods {
+				keys = append(keys, strings.ToUpper(method)+" "+route.Path)
+			}
+		}
+		for _, key := range keys {
+			if seen[key] {
+				return fmt.Errorf("route %d (%s): %s is already routed", i+1, route.Path, key)
+			}
+			seen[key] = true
+		}
+	}
+	return nil
+}
+
+func (c *Config) validateRoute(route Route) error {
+	if !strings.HasPrefix(route.Path, "/") {
+		return errors.New("path must start with /")
+	}
+	switch {
+	case route.Service != "" && route.Handler != "":
+		return errors.New("service and handler are exclusive")
+	case route.Service != "":
+		if _, exists := c.Upstreams[route.Service]; !exists {
+			return fmt.Errorf("unknown service %q", route.Service)
+		}
+	case route.Handler != "":
+		if !slices.Contains(handlers, route.Handler) {
+			return fmt.Errorf("unknown handler %q", route.Handler)
+		}
+	default:
+		return errors.New("service or handler is required")
+	}
+
+	for _, method := range route.Methods {
+		if !slices.Contains(methods, strings.ToUpper(method)) {
+			return fmt.Errorf("unknown method %q", method)
+		}
+	}
+
+	switch route.Auth {
+	case "", AuthPublic, AuthUser:
+		if route.Scope != "" {
+			return errors.New("scope only applies to user_or_api_key routes")
+		}
+	case AuthUserOrAPIKey:
+		if !slices.Contains(apikey.Resources, route.Scope) {
+			return fmt.Errorf("scope must be one of %s", strings.Join(apikey.Resources, ", "))
+		}
+	default:
+		return fmt.Errorf("unknown auth %q", route.Auth)
+	}
+
+	if route.RateLimit != "" {
+		if _, exists := c.RateLimits[route.RateLimit]; !exists {
+			return fmt.Errorf("unknown rate limit %q", route.RateLimit)
+		}
+	}
+	if route.MaxBodyBytes < 0 {
+		return errors.New("max_body_bytes can't be negative")
+	}
+	if _, err := resilience.ParsePriority(route.Priority); err != nil {
+		return err
+	}
+	return nil
+}
+
+var methods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+	http.MethodPatch, http.MethodDelete, http.MethodOptions,
+}
+
+func validateUpstream(upstream gatewayConfig.UpstreamConfig) error {
+	if _, err := registry.NewBalancer(upstream.Balancer); err != nil {
+		return err
+	}
+	if upstream.Shedding.MaxInFlight < 0 || upstream.Shedding.TargetLatency < 0 {
+		return errors.New("shedding limits can't be negative")
+	}
+	for _, urls := range [][]string{upstream.URLs, upstream.Canary.URLs, upstream.Shadow.URLs} {
+		for _, rawURL := range urls {
+			if target, err := url.Parse(rawURL); err != nil || target.Scheme == "" || target.Host == "" {
+				return fmt.Errorf("invalid url %q", rawURL)
+			}
+		}
+	}
+	return toRelease(upstream).Validate()
+}
@@ -0,0 +1,93 @@
+package routing
+
+import (
+	"fmt"
+
+	gatewayConfig "github.com/kaleabAlemayehu/eagle-commerce/api-gateway/internal/config"
+	"github.com/kaleabAlemayehu/eagle-commerce/api-gateway/internal/registry"
+	"github.com/kaleabAlemayehu/eagle-commerce/api-gateway/internal/release"
+	"github.com/kaleabAlemayehu/eagle-commerce/api-gateway/internal/resilience"
+)
+
+// Upstreams applies the upstream settings of a config to the components
+// resolving and calling the services
+type Upstreams struct {
+	registry *registry.Registry
+	policies *resilience.Policies
+	breakers *resilience.Breakers
+	releases *release.Releases
+	shedder  *resilience.Shedder
+}
+
+func NewUpstreams(reg *registry.Registry, policies *resilience.Policies, breakers *resilience.Breakers, releases *release.Releases, shedder *resilience.Shedder) *Upstreams {
+	return &Upstreams{
+		registry: reg,
+		policies: policies,
+		breakers: breakers,
+		releases: releases,
+		shedder:  shedder,
+	}
+}
+
+// Apply declares every upstream, replacing the static instances and
+// settings of the ones already known. Services left out of upstreams stay
+// registered, no route leads to them anymore.
+func (u *Upstreams) Apply(upstreams map[string]gatewayConfig.UpstreamConfig) error {
+	for name, upstream := range upstreams {
+		if err := validateUpstream(upstream); err != nil {
+			return fmt.Errorf("upstream %s: %w", name, err)
+		}
+	}
+
+	for name, upstream := range upstreams {
+		balancer, _ := registry.NewBalancer(upstream.Balancer)
+		u.registry.AddService(name, balancer)
+
+		instances := make(map[string]string)
+		for _, url := range upstream.URLs {
+			instances[url] = ""
+		}
+		for _, url := range upstream.Canary.URLs {
+			instances[url] = upstream.Canary.Version
+		}
+		for _, url := range upstream.Shadow.URLs {
+			instances[url] = upstream.Shadow.Version
+		}
+		if err := u.registry.SyncStatic(name, instances); err != nil {
+			return err
+		}
+
+		u.policies.Set(name, resilience.Policy{
+			Timeout:     upstream.Timeout,
+			MaxRetries:  upstream.MaxRetries,
+			BaseBackoff: upstream.RetryBackoff,
+			MaxBackoff:  upstream.MaxBackoff,
+		})
+		u.breakers.Add(name, resilience.BreakerConfig{
+			FailureThreshold: upstream.Breaker.FailureThreshold,
+			OpenTimeout:      upstream.Breaker.OpenTimeout,
+			HalfOpenRequests: upstream.Breaker.HalfOpenRequests,
+		})
+		u.shedder.Set(name, resilience.ShedderConfig{
+			MaxInFlight:   upstream.Shedding.MaxInFlight,
+			TargetLatency: upstream.Shedding.TargetLatency,
+		})
+		release := toRelease(upstream)
+		if err := u.releases.Set(name, release); err != nil {
+			return err
+		}
+		u.breakers.RemoveVersions(name, release.Canary)
+	}
+	return nil
+}
+
+func toRelease(upstream gatewayConfig.UpstreamConfig) release.Release {
+	return release.Release{
+		Canary:        upstream.Canary.Version,
+		Weight:        upstream.Canary.Weight,
+		StickyHeader:  upstream.Canary.StickyHeader,
+		Shadow:        upstream.Shadow.Version,
+		ShadowPercent: upstream.Shadow.Percent,
+		ShadowWrites:  upstream.Shadow.Writes,
+	}
+}
@@ -0,0 +1,90 @@
+package routing
+
+import (
+	"context"
+	"crypto/sha256"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// Watcher reloads the config file when the gateway gets SIGHUP or when the
+// file changes. A file that fails to load leaves the current config in place.
+type Watcher struct {
+	path     string
+	interval time.Duration
+	defaults *Config
+	checksum [sha256.Size]byte
+}
+
+func NewWatcher(path string, interval time.Duration, defaults *Config) *Watcher {
+	return &Watcher{
+		path:     path,
+		interval: interval,
+		defaults: defaults,
+	}
+}
+
+// Load reads the file, for the config the gateway starts with
+func (w *Watcher) Load() (*Config, error) {
+	data, err := os.ReadFile(w.path)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := Parse(data, w.defaults)
+	if err != nil {
+		return nil, err
+	}
+	w.checksum = sha256.Sum256(data)
+	return cfg, nil
+}
+
+// Start calls apply with every new version of the file until ctx is done
+func (w *Watcher) Start(ctx context.Context, apply func(*Config) error) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	go func() {
+		defer signal.Stop(hangup)
+
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hangup:
+				w.reload(apply, true)
+			case <-ticker.C:
+				w.reload(apply, false)
+			}
+		}
+	}()
+}
+
+func (w *Watcher) reload(apply func(*Config) error, force bool) {
+	data, err := os.ReadFile(w.path)
+	if err != nil {
+		log.Printf("Failed to read routing config %s: %v", w.path, err)
+		return
+	}
+	checksum := sha256.Sum256(data)
+	if !force && checksum == w.checksum {
+		return
+	}
+	// An invalid file is reported once, not on every check
+	w.checksum = checksum
+
+	cfg, err := Parse(data, w.defaults)
+	if err == nil {
+		err = apply(cfg)
+	}
+	if err != nil {
+		log.Printf("Keeping the current routing config, %s is invalid: %v", w.path, err)
+		return
+	}
+	log.Printf("Reloaded routing config from %s", w.path)
+}
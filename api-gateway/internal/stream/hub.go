@@ -0,0 +1,219 @@
+package stream
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/kaleabAlemayehu/eagle-commerce/shared/messaging"
+	"github.com/kaleabAlemayehu/eagle-commerce/shared/models"
+)
+
+// subscriberBuffer is how many events a subscriber may fall behind before
+// it's dropped
+const subscriberBuffer = 16
+
+// Subjects are the events pushed to the owner of an order
+var Subjects = []string{
+	models.OrderUpdatedEvent,
+	models.OrderShippedEvent,
+	models.OrderCancelledEvent,
+	models.PaymentProcessedEvent,
+}
+
+// Hub fans order events out to the clients following each order. The last
+// events of every order are kept so a reconnecting client can resume after
+// the last one it saw. Every gateway instance receives every event, so a
+// client may resume on any of them.
+type Hub struct {
+	backlog   int
+	retention time.Duration
+
+	mu     sync.Mutex
+	orders map[string]*order
+}
+
+type order struct {
+	events      []models.Event
+	updated     time.Time
+	subscribers map[*Subscription]struct{}
+}
+
+// Subscription receives the events of one order for one user. Its channel
+// is closed when the subscriber falls too far behind, the client is
+// expected to reconnect and resume from the last event it received.
+type Subscription struct {
+	hub     *Hub
+	orderID string
+	userID  string
+	events  chan models.Event
+}
+
+func NewHub(backlog int, retention time.Duration) *Hub {
+	hub := &Hub{
+		backlog:   backlog,
+		retention: retention,
+		orders:    make(map[string]*order),
+	}
+
+	go hub.cleanup(time.Minute)
+
+	return hub
+}
+
+// StartListening subscribes to the order and payment events
+func (h *Hub) StartListening(natsClient *messaging.NATSClient) error {
+	for _, subject := range Subjects {
+		if _, err := natsClient.Subscribe(subject, h.handleEvent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *Hub) handleEvent(data []byte) {
+	var event models.Event
+	if err := json.Unmarshal(data, &event); err != nil {
+		log.Printf("Error unmarshaling order stream event: %v", err)
+		return
+	}
+	if _, ok := event.Data["order_id"].(string); !ok {
+		log.Printf("Invalid order_id in %s event", event.Type)
+		return
+	}
+	// Clients resume on any gateway instance by the ID, so only the
+	// publisher can pick it
+	if event.ID == "" {
+		log.Printf("Missing id in %s event", event.Type)
+		return
+	}
+	h.Publish(event)
+}
+
+// Publish records the event and sends it to the subscribers of its order
+func (h *Hub) Publish(event models.Event) {
+	orderID, _ := event.Data["order_id"].(string)
+	userID, _ := event.Data["user_id"].(string)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	o := h.order(orderID)
+	o.events = append(o.events, event)
+	if len(o.events) > h.backlog {
+		o.events = o.events[len(o.events)-h.backlog:]
+	}
+	o.updated = time.Now()
+
+	for sub := range o.subscribers {
+		if userID != "" && userID != sub.userID {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			// Too slow, it will catch up from the backlog when it reconnects
+			delete(o.subscribers, sub)
+			close(sub.events)
+		}
+	}
+}
+
+// Subscribe follows an order on behalf of userID. It returns the events
+// after lastEventID, or every kept event when lastEventID is unknown, and
+// the subscription receiving the following ones.
+func (h *Hub) Subscribe(orderID, userID, lastEventID string) ([]models.Event, *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	o := h.order(orderID)
+	sub := &Subscription{
+		hub:     h,
+		orderID: orderID,
+		userID:  userID,
+		events:  make(chan models.Event, subscriberBuffer),
+	}
+	o.subscribers[sub] = struct{}{}
+
+	start := 0
+	if lastEventID != "" {
+		for i, event := range o.events {
+			if event.ID == lastEventID {
+				start = i + 1
+				break
+			}
+		}
+	}
+
+	var backlog []models.Event
+	for _, event := range o.events[start:] {
+		if owner, _ := event.Data["user_id"].(string); owner == "" || owner == userID {
+			backlog = append(backlog, event)
+		}
+	}
+	return backlog, sub
+}
+
+// Events delivers the events of the order as they happen
+func (s *Subscription) Events() <-chan models.Event {
+	return s.events
+}
+
+// Close stops the subscription
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+
+	if o, ok := s.hub.orders[s.orderID]; ok {
+		if _, subscribed := o.subscribers[s]; subscribed {
+			delete(o.subscribers, s)
+			close(s.events)
+		}
+	}
+}
+
+// Close ends every subscription, for the gateway to shut down without
+// waiting for clients to disconnect
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, o := range h.orders {
+		for sub := range o.subscribers {
+			delete(o.subscribers, sub)
+			close(sub.events)
+		}
+	}
+}
+
+// order returns the state of an order, creating it when missing. The hub
+// lock must be held.
+func (h *Hub) order(orderID string) *order {
+	o, ok := h.orders[orderID]
+	if !ok {
+		o = &order{
+			updated:     time.Now(),
+			subscribers: make(map[*Subscription]struct{}),
+		}
+		h.orders[orderID] = o
+	}
+	return o
+}
+
+// cleanup forgets the orders nobody follows that had no event for longer
+// than the retention
+func (h *Hub) cleanup(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		h.mu.Lock()
+		for orderID, o := range h.orders {
+			if len(o.subscribers) == 0 && time.Since(o.updated) > h.retention {
+				delete(h.orders, orderID)
+			}
+		}
+		h.mu.Unlock()
+	}
+}
@@ -0,0 +1,58 @@
+package stream
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/kaleabAlemayehu/eagle-commerce/shared/messaging"
+	"github.com/kaleabAlemayehu/eagle-commerce/shared/models"
+)
+
+func orderEvent(t *testing.T, id, status string) []byte {
+	t.Helper()
+	data, err := json.Marshal(models.Event{
+		ID:   id,
+		Type: models.OrderUpdatedEvent,
+		Data: map[string]interface{}{"order_id": "order-1", "user_id": "user-1", "status": status},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// Every gateway instance receives the same events, a client resumes on
+// whichever one it reconnects to
+func TestHubResumesAcrossInstances(t *testing.T) {
+	first, second := NewHub(10, time.Hour), NewHub(10, time.Hour)
+	ids := []string{messaging.GenerateEventID(), messaging.GenerateEventID(), messaging.GenerateEventID()}
+	for i, status := range []string{"confirmed", "paid", "shipped"} {
+		data := orderEvent(t, ids[i], status)
+		first.handleEvent(data)
+		second.handleEvent(data)
+	}
+
+	seen, sub := first.Subscribe("order-1", "user-1", "")
+	sub.Close()
+	if len(seen) != 3 {
+		t.Fatalf("got %d events, want 3", len(seen))
+	}
+
+	resumed, sub := second.Subscribe("order-1", "user-1", seen[0].ID)
+	sub.Close()
+	if len(resumed) != 2 || resumed[0].ID != ids[1] || resumed[1].ID != ids[2] {
+		t.Fatalf("resumed with %+v, want the events after %s", resumed, seen[0].ID)
+	}
+}
+
+func TestHubDropsEventsWithoutID(t *testing.T) {
+	hub := NewHub(10, time.Hour)
+	hub.handleEvent(orderEvent(t, "", "confirmed"))
+
+	events, sub := hub.Subscribe("order-1", "user-1", "")
+	sub.Close()
+	if len(events) != 0 {
+		t.Fatalf("got %d events, want none", len(events))
+	}
+}
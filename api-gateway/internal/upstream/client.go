@@ -0,0 +1,137 @@
+package upstream
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// maxResponseBytes bounds how much of a service response the client decodes
+const maxResponseBytes = 4 << 20
+
+// Error is a non successful answer from a service
+type Error struct {
+	Service string
+	Status  int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// StatusOf returns the status a service answered with, or 0 when it could
+// not be reached
+func StatusOf(err error) int {
+	var upstreamErr *Error
+	if errors.As(err, &upstreamErr) {
+		return upstreamErr.Status
+	}
+	return 0
+}
+
+// Client calls the services from within the gateway, for endpoints that
+// compose several of them. It unwraps their APIResponse envelope.
+type Client struct {
+	http *http.Client
+}
+
+func NewClient(transport *Transport) *Client {
+	return &Client{
+		http: &http.Client{Transport: transport},
+	}
+}
+
+// Do sends a request to service on behalf of the incoming request r, whose
+// Authorization is forwarded, and decodes the data of the response into out
+// when it isn't nil. The caller's identity is signed by the Transport.
+func (c *Client) Do(r *http.Request, service, method, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	ctx := WithService(r.Context(), service)
+	req, err := http.NewRequestWithContext(ctx, method, "http://"+service+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("X-Service", service)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if authorization := r.Header.Get("Authorization"); authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return err
+		}
+		return fmt.Errorf("%s service unavailable", service)
+	}
+	defer resp.Body.Close()
+
+	var envelope struct {
+		Success bool            `json:"success"`
+		Data    json.RawMessage `json:"data"`
+		Error   string          `json:"error"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseBytes)).Decode(&envelope); err != nil {
+		return &Error{Service: service, Status: resp.StatusCode, Message: fmt.Sprintf("invalid %s service response", service)}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 || !envelope.Success {
+		message := envelope.Error
+		if message == "" {
+			message = fmt.Sprintf("%s service responded %d", service, resp.StatusCode)
+		}
+		return &Error{Service: service, Status: resp.StatusCode, Message: message}
+	}
+
+	if out == nil || len(envelope.Data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(envelope.Data, out); err != nil {
+		return &Error{Service: service, Status: resp.StatusCode, Message: fmt.Sprintf("invalid %s service response", service)}
+	}
+	return nil
+}
+
+// Get is a shorthand for Do with a GET request
+func (c *Client) Get(r *http.Request, service, path string, out any) error {
+	return c.Do(r, service, http.MethodGet, path, nil, out)
+}
+
+// Fetch returns the raw body a service answers to a GET on path, for
+// resources that aren't wrapped in the APIResponse envelope
+func (c *Client) Fetch(ctx context.Context, service, path string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(WithService(ctx, service), http.MethodGet, "http://"+service+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Service", service)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%s service unavailable", service)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, &Error{Service: service, Status: resp.StatusCode, Message: fmt.Sprintf("%s service responded %d", service, resp.StatusCode)}
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+}
@@ -0,0 +1,160 @@
+package upstream
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"reflect"
+
+	"github.com/kaleabAlemayehu/eagle-commerce/api-gateway/internal/release"
+)
+
+const (
+	// maxMirroredBytes bounds the request and response bodies kept for a
+	// mirrored request, larger requests aren't mirrored and larger
+	// responses only have their status compared
+	maxMirroredBytes = 1 << 20
+
+	// maxMirrored bounds the shadow requests in flight, requests aren't
+	// mirrored while the candidate is that far behind
+	maxMirrored = 64
+)
+
+// Mirror sends copies of live requests to the shadow version of their
+// service. Shadow responses are discarded, differences with the response
+// the caller got are logged.
+type Mirror struct {
+	transport *Transport
+	releases  *release.Releases
+	pending   chan struct{}
+}
+
+func NewMirror(transport *Transport, releases *release.Releases) *Mirror {
+	return &Mirror{
+		transport: transport,
+		releases:  releases,
+		pending:   make(chan struct{}, maxMirrored),
+	}
+}
+
+// Tee prepares the mirroring of a request to service. The live request has
+// to be served with the returned writer and request, then done is called to
+// send the copy once the live response is complete.
+func (m *Mirror) Tee(service string, w http.ResponseWriter, r *http.Request) (http.ResponseWriter, *http.Request, func()) {
+	version, ok := m.releases.Mirror(service, r)
+	if !ok || r.Header.Get("Upgrade") != "" {
+		return w, r, func() {}
+	}
+	select {
+	case m.pending <- struct{}{}:
+	default:
+		return w, r, func() {}
+	}
+	release := func() { <-m.pending }
+
+	var body []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		buffered, err := io.ReadAll(io.LimitReader(r.Body, maxMirroredBytes+1))
+		// The live request still gets the whole body
+		r.Body = &replayedBody{Reader: io.MultiReader(bytes.NewReader(buffered), r.Body), Closer: r.Body}
+		if err != nil || len(buffered) > maxMirroredBytes {
+			release()
+			return w, r, func() {}
+		}
+		body = buffered
+	}
+
+	shadow := r.Clone(withShadow(context.WithoutCancel(r.Context()), version))
+	shadow.Body = http.NoBody
+	if body != nil {
+		shadow.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	recorder := &teeWriter{ResponseWriter: w, statusCode: http.StatusOK}
+	return recorder, r, func() {
+		go func() {
+			defer release()
+			m.compare(service, version, shadow, recorder)
+		}()
+	}
+}
+
+func (m *Mirror) compare(service, version string, req *http.Request, live *teeWriter) {
+	resp, err := m.transport.RoundTrip(req)
+	if err != nil {
+		log.Printf("Shadow %s %s on %s service %s failed: %v", req.Method, req.URL.Path, service, version, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxMirroredBytes+1))
+	if err != nil {
+		log.Printf("Shadow %s %s on %s service %s failed: %v", req.Method, req.URL.Path, service, version, err)
+		return
+	}
+
+	switch {
+	case resp.StatusCode != live.statusCode:
+		log.Printf("Shadow mismatch for %s %s on %s service %s: status %d, shadow answered %d",
+			req.Method, req.URL.Path, service, version, live.statusCode, resp.StatusCode)
+	case live.truncated || len(body) > maxMirroredBytes:
+		// Too large to be compared
+	case !sameBody(live.body.Bytes(), body):
+		log.Printf("Shadow mismatch for %s %s on %s service %s: response bodies differ",
+			req.Method, req.URL.Path, service, version)
+	}
+}
+
+// sameBody compares JSON bodies by value, so key order and whitespace don't
+// count as differences
+func sameBody(live, shadow []byte) bool {
+	if bytes.Equal(live, shadow) {
+		return true
+	}
+	var a, b any
+	if json.Unmarshal(live, &a) != nil || json.Unmarshal(shadow, &b) != nil {
+		return false
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+type replayedBody struct {
+	io.Reader
+	io.Closer
+}
+
+// teeWriter keeps the status and the beginning of the live response
+type teeWriter struct {
+	http.ResponseWriter
+	statusCode  int
+	wroteHeader bool
+	body        bytes.Buffer
+	truncated   bool
+}
+
+func (tw *teeWriter) WriteHeader(code int) {
+	if !tw.wroteHeader {
+		tw.statusCode = code
+		tw.wroteHeader = true
+	}
+	tw.ResponseWriter.WriteHeader(code)
+}
+
+func (tw *teeWriter) Write(b []byte) (int, error) {
+	tw.wroteHeader = true
+	if room := maxMirroredBytes - tw.body.Len(); len(b) > room {
+		tw.body.Write(b[:max(room, 0)])
+		tw.truncated = true
+	} else {
+		tw.body.Write(b)
+	}
+	return tw.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the flusher of the live writer
+func (tw *teeWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
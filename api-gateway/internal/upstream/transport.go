@@ -0,0 +1,226 @@
+package upstream
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/kaleabAlemayehu/eagle-commerce/api-gateway/internal/registry"
+	"github.com/kaleabAlemayehu/eagle-commerce/api-gateway/internal/release"
+	"github.com/kaleabAlemayehu/eagle-commerce/api-gateway/internal/resilience"
+	sharedMiddleware "github.com/kaleabAlemayehu/eagle-commerce/shared/middleware"
+)
+
+type contextKey string
+
+const (
+	serviceContextKey contextKey = "service"
+	shadowContextKey  contextKey = "shadow"
+)
+
+var ErrTimeout = errors.New("upstream request timed out")
+
+// WithService tags a request context with the service the request is meant for
+func WithService(ctx context.Context, service string) context.Context {
+	return context.WithValue(ctx, serviceContextKey, service)
+}
+
+// ServiceFromContext returns the service a request was tagged with
+func ServiceFromContext(ctx context.Context) string {
+	service, _ := ctx.Value(serviceContextKey).(string)
+	return service
+}
+
+// withShadow sends a request to the shadow version of its service
+func withShadow(ctx context.Context, version string) context.Context {
+	return context.WithValue(ctx, shadowContextKey, version)
+}
+
+// Transport resolves the service of an outgoing request to one of its
+// registered instances right before sending it, applying the service's
+// timeout, retry and circuit breaker policy. The instances are those of the
+// version the caller is assigned to by the service's release. Every attempt
+// carries freshly signed identity headers for the caller of the incoming
+// request.
+type Transport struct {
+	registry *registry.Registry
+	policies *resilience.Policies
+	breakers *resilience.Breakers
+	releases *release.Releases
+	signer   *sharedMiddleware.IdentitySigner
+	base     http.RoundTripper
+}
+
+func NewTransport(reg *registry.Registry, policies *resilience.Policies, breakers *resilience.Breakers, releases *release.Releases, signer *sharedMiddleware.IdentitySigner, base http.RoundTripper) *Transport {
+	return &Transport{
+		registry: reg,
+		policies: policies,
+		breakers: breakers,
+		releases: releases,
+		signer:   signer,
+		base:     base,
+	}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	service := ServiceFromContext(req.Context())
+	policy := t.policies.Get(service)
+
+	// Shadow requests are sent once and never count against the breaker, the
+	// candidate failing must not affect the live traffic
+	version, shadow := req.Context().Value(shadowContextKey).(string)
+	if !shadow {
+		version = t.releases.Assign(service, req)
+	}
+
+	maxRetries := 0
+	if resilience.IsIdempotent(req.Method) && !shadow {
+		maxRetries = policy.MaxRetries
+	}
+
+	// The body has to be replayable when the request may be sent again
+	var body []byte
+	if maxRetries > 0 && req.Body != nil && req.Body != http.NoBody {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+
+	for attempt := 0; ; attempt++ {
+		if body != nil {
+			req.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		resp, err := t.attempt(req, service, version, shadow, policy)
+
+		retryable := (err != nil && !errors.Is(err, resilience.ErrCircuitOpen)) ||
+			(err == nil && resilience.IsRetryableStatus(resp.StatusCode))
+		if !retryable || attempt >= maxRetries || req.Context().Err() != nil {
+			return resp, err
+		}
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		select {
+		case <-time.After(policy.Backoff(attempt + 1)):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+func (t *Transport) attempt(req *http.Request, service, version string, shadow bool, policy resilience.Policy) (*http.Response, error) {
+	var done func(resilience.Outcome)
+	if !shadow {
+		var err error
+		if version, done, err = t.allow(service, version); err != nil {
+			return nil, err
+		}
+	}
+
+	inst, err := t.registry.Select(service, t.releases.Filter(service, version))
+	if errors.Is(err, registry.ErrNoHealthyInstances) && version != "" && !shadow {
+		// Callers of a canary that's down are served by the stable version
+		if done != nil {
+			done(resilience.Ignored)
+		}
+		if version, done, err = t.allow(service, ""); err != nil {
+			return nil, err
+		}
+		inst, err = t.registry.Select(service, t.releases.Filter(service, version))
+	}
+	if err != nil {
+		if done != nil {
+			done(resilience.Failure)
+		}
+		return nil, err
+	}
+
+	ctx, cancel := req.Context(), context.CancelFunc(func() {})
+	if policy.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, policy.Timeout)
+	}
+
+	out := req.Clone(ctx)
+	out.URL.Scheme = inst.URL.Scheme
+	out.URL.Host = inst.URL.Host
+	out.Host = ""
+	if t.signer != nil {
+		identity, ok := sharedMiddleware.GetIdentityFromContext(ctx)
+		if !ok {
+			identity = &sharedMiddleware.Identity{}
+		}
+		t.signer.Sign(out, identity)
+	}
+
+	release := inst.Acquire()
+	resp, err := t.base.RoundTrip(out)
+	if done != nil {
+		switch {
+		case err != nil && errors.Is(req.Context().Err(), context.Canceled):
+			// The client gave up, that says nothing about the upstream
+			done(resilience.Ignored)
+		case err != nil || resp.StatusCode >= http.StatusInternalServerError:
+			done(resilience.Failure)
+		default:
+			done(resilience.Success)
+		}
+	}
+	if err != nil {
+		release()
+		cancel()
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, ErrTimeout
+		}
+		return nil, err
+	}
+
+	resp.Body = &onCloseBody{ReadCloser: resp.Body, onClose: func() {
+		release()
+		cancel()
+	}}
+	return resp, nil
+}
+
+// allow takes a slot from the breaker of the version a request is for. Each
+// canary version has its own breaker, callers of a canary whose breaker is
+// open are served by the stable version.
+func (t *Transport) allow(service, version string) (string, func(resilience.Outcome), error) {
+	if version != "" {
+		breaker, exists := t.breakers.GetVersion(service, version)
+		if !exists {
+			return version, nil, nil
+		}
+		done, err := breaker.Allow()
+		if !errors.Is(err, resilience.ErrCircuitOpen) {
+			return version, done, err
+		}
+		version = ""
+	}
+
+	breaker, exists := t.breakers.Get(service)
+	if !exists {
+		return version, nil, nil
+	}
+	done, err := breaker.Allow()
+	return version, done, err
+}
+
+// onCloseBody keeps the instance marked busy and the attempt's context alive
+// until the body is consumed
+type onCloseBody struct {
+	io.ReadCloser
+	onClose func()
+}
+
+func (b *onCloseBody) Close() error {
+	defer b.onClose()
+	return b.ReadCloser.Close()
+}
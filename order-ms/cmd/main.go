@@ -11,6 +11,7 @@ import (
 	"syscall"
 	"time"
 
+	_ "github.com/kaleabAlemayehu/eagle-commerce/order-ms/docs"
 	"github.com/kaleabAlemayehu/eagle-commerce/order-ms/internal/application/service"
 	"github.com/kaleabAlemayehu/eagle-commerce/order-ms/internal/infrastructure/messaging"
 	"github.com/kaleabAlemayehu/eagle-commerce/order-ms/internal/infrastructure/repository"
@@ -18,8 +19,10 @@ import (
 	"github.com/kaleabAlemayehu/eagle-commerce/order-ms/internal/interfaces/http/router"
 	"github.com/kaleabAlemayehu/eagle-commerce/shared/config"
 	"github.com/kaleabAlemayehu/eagle-commerce/shared/database"
+	"github.com/kaleabAlemayehu/eagle-commerce/shared/discovery"
 	sharedLogger "github.com/kaleabAlemayehu/eagle-commerce/shared/logger"
 	sharedMessaging "github.com/kaleabAlemayehu/eagle-commerce/shared/messaging"
+	sharedMiddleware "github.com/kaleabAlemayehu/eagle-commerce/shared/middleware"
 )
 
 // @title Order Service API
@@ -44,19 +47,24 @@ func main() {
 	if err != nil {
 		log.Fatal("Failed to connect to NATS:", err)
 	}
-	nats := messaging.NewOrderEventPublisher(natsClient)
+	signer := sharedMiddleware.NewIdentitySigner(cfg.InternalSecret)
+	nats := messaging.NewOrderEventPublisher(natsClient, signer)
 
 	// Initialize dependencies
 	orderRepo := repository.NewMongoOrderRepository(db.Database)
 	orderService := service.NewOrderService(orderRepo, nats)
 	orderHandler := handler.NewOrderHandler(orderService)
-	if err := messaging.NewOrderEventHandler(orderService, natsClient).StartListening(); err != nil {
+	if err := messaging.NewOrderEventHandler(orderService, natsClient, signer).StartListening(); err != nil {
 		log.Fatal("Failed to listen NATS events:", err)
 	}
 	mode := cfg.Environment
 
 	// Setup router
-	r := router.NewRouter(orderHandler, logger, mode)
+	idempotency, err := sharedMiddleware.NewIdempotency(context.Background(), db.Database, cfg.IdempotencyTTL)
+	if err != nil {
+		log.Fatal("Failed to create idempotency store:", err)
+	}
+	r := router.NewRouter(orderHandler, signer, idempotency, logger, mode)
 
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
@@ -67,14 +75,24 @@ func main() {
 		Addr:    ":" + port,
 		Handler: r,
 	}
+
+	// Announce this instance to the api-gateway
+	announcer := discovery.NewAnnouncer(natsClient, signer, discovery.Instance{
+		Service: "order",
+		URL:     discovery.AdvertiseURL(cfg, port),
+		Version: cfg.Service.Version,
+	}, discovery.DefaultHeartbeatInterval)
+	announcer.Start()
+
 	go func() {
-		if err := server.ListenAndServe(); err != nil && errors.Is(err, http.ErrServerClosed) {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			log.Fatalf("ListenAndServer error err: %v", err)
 		}
 	}()
 	<-stop
 
 	log.Println("Shutting down gracefully...")
+	announcer.Stop()
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 	defer cancel()
 	if err := server.Shutdown(ctx); err != nil {
@@ -17,7 +17,7 @@ const docTemplate = `{
     "paths": {
         "/orders": {
             "get": {
-                "description": "Get orders as list",
+                "description": "Get the orders of every user",
                 "produces": [
                     "application/json"
                 ],
@@ -32,6 +32,12 @@ const docTemplate = `{
                             "$ref": "#/definitions/dto.Response"
                         }
                     },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/dto.Response"
+                        }
+                    },
                     "404": {
                         "description": "Not Found",
                         "schema": {
@@ -41,7 +47,7 @@ const docTemplate = `{
                 }
             },
             "post": {
-                "description": "Create a new order with items and address",
+                "description": "Create a new order with items and address for the authenticated user, staff and API keys may name another user. Users need a verified email. Instead of an address, an address_id from the address book of the user may be sent, without either the default shipping address is used.",
                 "consumes": [
                     "application/json"
                 ],
@@ -75,13 +81,67 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/dto.Response"
                         }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/dto.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/orders/me": {
+            "get": {
+                "description": "Get the orders of the authenticated user",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "orders"
+                ],
+                "summary": "Get my orders",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "default": 10,
+                        "description": "Limit",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 0,
+                        "description": "Offset",
+                        "name": "offset",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/dto.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/dto.Response"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.Response"
+                        }
                     }
                 }
             }
         },
         "/orders/user/{user_id}": {
             "get": {
-                "description": "Get orders for a specific user",
+                "description": "Get orders for a specific user, only staff may get those of other users",
                 "produces": [
                     "application/json"
                 ],
@@ -118,13 +178,19 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/dto.Response"
                         }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/dto.Response"
+                        }
                     }
                 }
             }
         },
         "/orders/{id}": {
             "get": {
-                "description": "Get order details by ID",
+                "description": "Get order details by ID, orders of other users are only found by staff",
                 "produces": [
                     "application/json"
                 ],
@@ -159,7 +225,7 @@ const docTemplate = `{
         },
         "/orders/{id}/cancel": {
             "put": {
-                "description": "Cancel an order",
+                "description": "Cancel an order, only staff may cancel those of other users",
                 "produces": [
                     "application/json"
                 ],
@@ -235,6 +301,12 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/dto.Response"
                         }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/dto.Response"
+                        }
                     }
                 }
             }
@@ -292,14 +364,16 @@ const docTemplate = `{
         "dto.CreateOrderRequest": {
             "type": "object",
             "required": [
-                "address",
-                "items",
-                "user_id"
+                "items"
             ],
             "properties": {
                 "address": {
                     "$ref": "#/definitions/dto.AddressRequest"
                 },
+                "address_id": {
+                    "description": "AddressID picks an address from the address book of the user instead,\nwithout either the default shipping address is used",
+                    "type": "string"
+                },
                 "items": {
                     "type": "array",
                     "items": {
@@ -307,6 +381,7 @@ const docTemplate = `{
                     }
                 },
                 "user_id": {
+                    "description": "UserID defaults to the authenticated user",
                     "type": "string"
                 }
             }
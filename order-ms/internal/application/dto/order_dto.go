@@ -10,9 +10,13 @@ type Response struct {
 }
 
 type CreateOrderRequest struct {
-	UserID  string                   `json:"user_id" validate:"required"`
+	// UserID defaults to the authenticated user
+	UserID  string                   `json:"user_id,omitempty"`
 	Items   []CreateOrderItemRequest `json:"items" validate:"required,dive"`
-	Address AddressRequest           `json:"address" validate:"required"`
+	Address *AddressRequest          `json:"address,omitempty"`
+	// AddressID picks an address from the address book of the user instead,
+	// without either the default shipping address is used
+	AddressID string `json:"address_id,omitempty"`
 }
 
 type CreateOrderItemRequest struct {
@@ -37,6 +41,7 @@ type OrderResponse struct {
 	Total     float64             `json:"total"`
 	Status    string              `json:"status"`
 	Address   AddressResponse     `json:"address"`
+	AddressID string              `json:"address_id,omitempty"`
 	CreatedAt time.Time           `json:"created_at"`
 	UpdatedAt time.Time           `json:"updated_at"`
 }
@@ -17,6 +17,7 @@ var (
 	ErrOrderStateChanged            = errors.New("Order status has changed, please try again")
 	ErrOrderCannotBeCancelled       = errors.New("Order cannot be cancled, it is too late...")
 	ErrOrderOutOfStock              = errors.New("Order out of stock.")
+	ErrAddressNotFound              = errors.New("Address not found")
 )
 
 type OrderServiceImpl struct {
@@ -35,6 +36,19 @@ func NewOrderService(repo domain.OrderRepository, nats *messaging.OrderEventPubl
 
 func (s *OrderServiceImpl) CreateOrder(ctx context.Context, order *domain.Order) (*domain.Order, error) {
 	logger := logger.FromContext(ctx).With("Layer", "service", "method", "CreateOrder", "user_id", order.UserID)
+	if order.Address == (domain.Address{}) {
+		// Snapshot the address from the address book of the user
+		address, err := s.nats.RequestAddress(ctx, order.UserID, order.AddressID)
+		if err != nil {
+			if errors.Is(err, messaging.ErrAddressNotFound) {
+				logger.Warn("address not found in address book", "address_id", order.AddressID)
+				return nil, ErrAddressNotFound
+			}
+			logger.Error("failed to resolve address", "address_id", order.AddressID, "error", err)
+			return nil, err
+		}
+		order.Address = *address
+	}
 	if err := utils.ValidateStruct(order); err != nil {
 		return nil, err
 	}
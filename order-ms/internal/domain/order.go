@@ -14,6 +14,7 @@ type Order struct {
 	Total     float64            `json:"total" bson:"total"`
 	Status    OrderStatus        `json:"status" bson:"status"`
 	Address   Address            `json:"address" bson:"address" validate:"required"`
+	AddressID string             `json:"address_id,omitempty" bson:"address_id,omitempty"`
 	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
 	UpdatedAt time.Time          `json:"updated_at" bson:"updated_at"`
 }
@@ -8,6 +8,7 @@ import (
 
 	"github.com/kaleabAlemayehu/eagle-commerce/order-ms/internal/domain"
 	"github.com/kaleabAlemayehu/eagle-commerce/shared/messaging"
+	sharedMiddleware "github.com/kaleabAlemayehu/eagle-commerce/shared/middleware"
 	"github.com/kaleabAlemayehu/eagle-commerce/shared/models"
 )
 
@@ -17,11 +18,11 @@ type OrderEventHandler struct {
 	publisher    *OrderEventPublisher
 }
 
-func NewOrderEventHandler(orderService domain.OrderService, natsClient *messaging.NATSClient) *OrderEventHandler {
+func NewOrderEventHandler(orderService domain.OrderService, natsClient *messaging.NATSClient, signer *sharedMiddleware.IdentitySigner) *OrderEventHandler {
 	return &OrderEventHandler{
 		orderService: orderService,
 		natsClient:   natsClient,
-		publisher:    NewOrderEventPublisher(natsClient),
+		publisher:    NewOrderEventPublisher(natsClient, signer),
 	}
 }
 
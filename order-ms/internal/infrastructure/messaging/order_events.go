@@ -1,23 +1,32 @@
 package messaging
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"time"
 
+	"github.com/nats-io/nats.go"
+
 	"github.com/kaleabAlemayehu/eagle-commerce/order-ms/internal/domain"
 	"github.com/kaleabAlemayehu/eagle-commerce/shared/messaging"
+	sharedMiddleware "github.com/kaleabAlemayehu/eagle-commerce/shared/middleware"
 
 	"github.com/kaleabAlemayehu/eagle-commerce/shared/models"
 )
 
+// ErrAddressNotFound is returned when user-ms has no such address for the user
+var ErrAddressNotFound = errors.New("address not found")
+
 type OrderEventPublisher struct {
 	natsClient *messaging.NATSClient
+	signer     *sharedMiddleware.IdentitySigner
 }
 
-func NewOrderEventPublisher(natsClient *messaging.NATSClient) *OrderEventPublisher {
+func NewOrderEventPublisher(natsClient *messaging.NATSClient, signer *sharedMiddleware.IdentitySigner) *OrderEventPublisher {
 	return &OrderEventPublisher{
 		natsClient: natsClient,
+		signer:     signer,
 	}
 }
 
@@ -153,3 +162,49 @@ func (p *OrderEventPublisher) RequestStockCheck(item *domain.OrderItem) (bool, e
 	return response.Available, nil
 
 }
+
+// RequestAddress asks user-ms for an address from the address book of a user,
+// their default shipping address when addressID is empty. The request is
+// signed with the identity of the caller, user-ms only answers when that
+// identity may place orders for the user.
+func (p *OrderEventPublisher) RequestAddress(ctx context.Context, userID, addressID string) (*domain.Address, error) {
+	requestData, err := json.Marshal(map[string]interface{}{
+		"user_id":    userID,
+		"address_id": addressID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	request := nats.NewMsg(models.UserAddressResolveEvent)
+	request.Data = requestData
+	identity, ok := sharedMiddleware.GetIdentityFromContext(ctx)
+	if !ok {
+		identity = &sharedMiddleware.Identity{}
+	}
+	p.signer.SignMessage(request, identity)
+
+	msg, err := p.natsClient.RequestMsg(request, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		Address  *domain.Address `json:"address,omitempty"`
+		Error    string          `json:"error,omitempty"`
+		NotFound bool            `json:"not_found,omitempty"`
+	}
+	if err := json.Unmarshal(msg.Data, &response); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case response.NotFound:
+		return nil, ErrAddressNotFound
+	case response.Error != "":
+		return nil, errors.New(response.Error)
+	case response.Address == nil:
+		return nil, errors.New("no address in user.address.resolve response")
+	}
+	return response.Address, nil
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/kaleabAlemayehu/eagle-commerce/order-ms/internal/application/service"
 	"github.com/kaleabAlemayehu/eagle-commerce/order-ms/internal/domain"
 	"github.com/kaleabAlemayehu/eagle-commerce/shared/logger"
+	sharedMiddleware "github.com/kaleabAlemayehu/eagle-commerce/shared/middleware"
 	"github.com/kaleabAlemayehu/eagle-commerce/shared/utils"
 )
 
@@ -25,13 +26,14 @@ func NewOrderHandler(orderService domain.OrderService) *OrderHandler {
 }
 
 // @Summary Create a new order
-// @Description Create a new order with items and address
+// @Description Create a new order with items and address for the authenticated user, staff and API keys may name another user. Users need a verified email. Instead of an address, an address_id from the address book of the user may be sent, without either the default shipping address is used.
 // @Tags orders
 // @Accept json
 // @Produce json
 // @Param order body dto.CreateOrderRequest true "Order data"
 // @Success 201 {object} dto.Response
 // @Failure 400 {object} dto.Response
+// @Failure 403 {object} dto.Response
 // @Failure 500 {object} dto.Response
 // @Router /orders [post]
 func (h *OrderHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
@@ -43,6 +45,21 @@ func (h *OrderHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	userID, err := sharedMiddleware.ResolveOwner(r.Context(), req.UserID, sharedMiddleware.PermissionOrdersWrite)
+	if err != nil {
+		if errors.Is(err, sharedMiddleware.ErrOwnerRequired) {
+			utils.SendErrorResponse(w, http.StatusBadRequest, "user_id is required")
+			return
+		}
+		logger.Warn("Order creation for another user denied", "user_id", req.UserID)
+		utils.SendErrorResponse(w, http.StatusForbidden, "Not allowed to create orders for other users")
+		return
+	}
+	if req.Address != nil && req.AddressID != "" {
+		utils.SendErrorResponse(w, http.StatusBadRequest, "Send either address or address_id")
+		return
+	}
+
 	items := make([]domain.OrderItem, len(req.Items))
 	for i, item := range req.Items {
 		items[i] = domain.OrderItem{
@@ -54,15 +71,18 @@ func (h *OrderHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
 	}
 
 	order := &domain.Order{
-		UserID: req.UserID,
-		Items:  items,
-		Address: domain.Address{
+		UserID:    userID,
+		Items:     items,
+		AddressID: req.AddressID,
+	}
+	if req.Address != nil {
+		order.Address = domain.Address{
 			Street:  req.Address.Street,
 			City:    req.Address.City,
 			State:   req.Address.State,
 			ZipCode: req.Address.ZipCode,
 			Country: req.Address.Country,
-		},
+		}
 	}
 
 	createdOrder, err := h.orderService.CreateOrder(r.Context(), order)
@@ -72,6 +92,11 @@ func (h *OrderHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
 			utils.SendValidationErrorResponse(w, validationErrors)
 			return
 		}
+		if errors.Is(err, service.ErrAddressNotFound) {
+			logger.Warn("Order address not found", "address_id", req.AddressID)
+			utils.SendErrorResponse(w, http.StatusBadRequest, "Address not found")
+			return
+		}
 		logger.Error("Failed to create order", "error", err)
 		utils.SendErrorResponse(w, http.StatusInternalServerError, "Failed to create order")
 		return
@@ -82,10 +107,11 @@ func (h *OrderHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
 }
 
 // @Summary Get order list
-// @Description Get orders as list
+// @Description Get the orders of every user
 // @Tags orders
 // @Produce json
 // @Success 200 {object} dto.Response
+// @Failure 403 {object} dto.Response
 // @Failure 500 {object} dto.Response
 // @Router /orders [get]
 func (h *OrderHandler) ListOrders(w http.ResponseWriter, r *http.Request) {
@@ -108,7 +134,7 @@ func (h *OrderHandler) ListOrders(w http.ResponseWriter, r *http.Request) {
 }
 
 // @Summary Get order by ID
-// @Description Get order details by ID
+// @Description Get order details by ID, orders of other users are only found by staff
 // @Tags orders
 // @Produce json
 // @Param id path string true "Order ID"
@@ -131,25 +157,59 @@ func (h *OrderHandler) GetOrder(w http.ResponseWriter, r *http.Request) {
 		utils.SendErrorResponse(w, http.StatusInternalServerError, "Failed to retrieve order")
 		return
 	}
+	// Orders of other users aren't revealed to exist
+	if !sharedMiddleware.CanAccess(r.Context(), order.UserID, sharedMiddleware.PermissionOrdersRead) {
+		logger.Warn("Order access denied", "order_id", id)
+		utils.SendErrorResponse(w, http.StatusNotFound, "Order not found")
+		return
+	}
 	orderRes := h.toOrderResponse(order)
 
 	utils.SendSuccessResponse(w, http.StatusOK, orderRes)
 }
 
+// @Summary Get my orders
+// @Description Get the orders of the authenticated user
+// @Tags orders
+// @Produce json
+// @Param limit query int false "Limit" default(10)
+// @Param offset query int false "Offset" default(0)
+// @Success 200 {object} dto.Response
+// @Failure 401 {object} dto.Response
+// @Failure 500 {object} dto.Response
+// @Router /orders/me [get]
+func (h *OrderHandler) GetMyOrders(w http.ResponseWriter, r *http.Request) {
+	claims, ok := sharedMiddleware.GetUserFromContext(r.Context())
+	if !ok {
+		utils.SendErrorResponse(w, http.StatusUnauthorized, "User authentication required")
+		return
+	}
+	h.listUserOrders(w, r, claims.UserID)
+}
+
 // @Summary Get user orders
-// @Description Get orders for a specific user
+// @Description Get orders for a specific user, only staff may get those of other users
 // @Tags orders
 // @Produce json
 // @Param user_id path string true "User ID"
 // @Param limit query int false "Limit" default(10)
 // @Param offset query int false "Offset" default(0)
 // @Success 200 {object} dto.Response
+// @Failure 403 {object} dto.Response
 // @Failure 500 {object} dto.Response
 // @Router /orders/user/{user_id} [get]
 func (h *OrderHandler) GetUserOrders(w http.ResponseWriter, r *http.Request) {
-	logger := logger.FromContext(r.Context())
 	userID := chi.URLParam(r, "user_id")
+	if !sharedMiddleware.CanAccess(r.Context(), userID, sharedMiddleware.PermissionOrdersRead) {
+		logger.FromContext(r.Context()).Warn("User orders access denied", "user_id", userID)
+		utils.SendErrorResponse(w, http.StatusForbidden, "Not allowed to view orders of other users")
+		return
+	}
+	h.listUserOrders(w, r, userID)
+}
 
+func (h *OrderHandler) listUserOrders(w http.ResponseWriter, r *http.Request, userID string) {
+	logger := logger.FromContext(r.Context())
 	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
 	if limit == 0 {
 		limit = 10
@@ -176,6 +236,7 @@ func (h *OrderHandler) GetUserOrders(w http.ResponseWriter, r *http.Request) {
 // @Param status body dto.UpdateOrderStatusRequest true "Status update"
 // @Success 200 {object} dto.Response
 // @Failure 400 {object} dto.Response
+// @Failure 403 {object} dto.Response
 // @Failure 404 {object} dto.Response
 // @Failure 500 {object} dto.Response
 // @Router /orders/{id}/status [put]
@@ -213,7 +274,7 @@ func (h *OrderHandler) UpdateOrderStatus(w http.ResponseWriter, r *http.Request)
 }
 
 // @Summary Cancel order
-// @Description Cancel an order
+// @Description Cancel an order, only staff may cancel those of other users
 // @Tags orders
 // @Produce json
 // @Param id path string true "Order ID"
@@ -226,6 +287,23 @@ func (h *OrderHandler) CancelOrder(w http.ResponseWriter, r *http.Request) {
 	logger := logger.FromContext(r.Context())
 	id := chi.URLParam(r, "id")
 
+	order, err := h.orderService.GetOrder(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, service.ErrOrderNotFound) {
+			logger.Warn("Order not found for cancellation", "order_id", id)
+			utils.SendErrorResponse(w, http.StatusNotFound, "Order not found")
+			return
+		}
+		logger.Error("Failed to get order for cancellation", "error", err, "order_id", id)
+		utils.SendErrorResponse(w, http.StatusInternalServerError, "Failed to cancel order")
+		return
+	}
+	if !sharedMiddleware.CanAccess(r.Context(), order.UserID, sharedMiddleware.PermissionOrdersWrite) {
+		logger.Warn("Order cancellation denied", "order_id", id)
+		utils.SendErrorResponse(w, http.StatusNotFound, "Order not found")
+		return
+	}
+
 	updatedOrder, err := h.orderService.CancelOrder(r.Context(), id)
 	if err != nil {
 		if errors.Is(err, service.ErrOrderNotFound) {
@@ -259,12 +337,13 @@ func (h *OrderHandler) toOrderListResponse(orders []*domain.Order) []*dto.OrderR
 
 func (h *OrderHandler) toOrderResponse(order *domain.Order) *dto.OrderResponse {
 	return &dto.OrderResponse{
-		ID:        order.ID.String(),
+		ID:        order.ID.Hex(),
 		UserID:    order.UserID,
 		Items:     h.toOrderItemListResponse(order.Items),
 		Total:     order.Total,
 		Status:    string(order.Status),
 		Address:   h.toAddressResponse(order.Address),
+		AddressID: order.AddressID,
 		CreatedAt: order.CreatedAt,
 		UpdatedAt: order.UpdatedAt,
 	}
@@ -13,7 +13,7 @@ import (
 
 // TODO: there is a lot of handlers to be impliment here
 
-func NewRouter(orderHandler *handler.OrderHandler, logger *slog.Logger, mode string) *chi.Mux {
+func NewRouter(orderHandler *handler.OrderHandler, identity *sharedMiddleware.IdentitySigner, idempotency *sharedMiddleware.Idempotency, logger *slog.Logger, mode string) *chi.Mux {
 	r := chi.NewRouter()
 
 	// Middleware
@@ -30,13 +30,18 @@ func NewRouter(orderHandler *handler.OrderHandler, logger *slog.Logger, mode str
 
 	// Routes
 	r.Route("/api/v1", func(r chi.Router) {
+		// Only requests signed by the gateway carry a user
+		r.Use(identity.Middleware())
+
 		r.Route("/orders", func(r chi.Router) {
 			// Public routes (with auth)
 			r.Group(func(r chi.Router) {
-				r.Post("/", orderHandler.CreateOrder)
-				r.Get("/", orderHandler.ListOrders)
+				r.Use(sharedMiddleware.RequireAuth)
+				r.With(sharedMiddleware.RequireVerifiedEmail, idempotency.Middleware).Post("/", orderHandler.CreateOrder)
+				r.With(sharedMiddleware.RequirePermission(sharedMiddleware.PermissionOrdersRead)).Get("/", orderHandler.ListOrders)
+				r.Get("/me", orderHandler.GetMyOrders)
 				r.Get("/{id}", orderHandler.GetOrder)
-				r.Put("/{id}/status", orderHandler.UpdateOrderStatus)
+				r.With(sharedMiddleware.RequirePermission(sharedMiddleware.PermissionOrdersManage)).Put("/{id}/status", orderHandler.UpdateOrderStatus)
 				r.Put("/{id}/cancel", orderHandler.CancelOrder)
 				// User-specific routes
 				r.Get("/user/{user_id}", orderHandler.GetUserOrders)
@@ -1,9 +1,16 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	_ "github.com/kaleabAlemayehu/eagle-commerce/payment-ms/docs"
 	"github.com/kaleabAlemayehu/eagle-commerce/payment-ms/internal/application/service"
 	"github.com/kaleabAlemayehu/eagle-commerce/payment-ms/internal/infrastructure/external"
 	"github.com/kaleabAlemayehu/eagle-commerce/payment-ms/internal/infrastructure/messaging"
@@ -12,12 +19,18 @@ import (
 	"github.com/kaleabAlemayehu/eagle-commerce/payment-ms/internal/interfaces/http/router"
 	"github.com/kaleabAlemayehu/eagle-commerce/shared/config"
 	"github.com/kaleabAlemayehu/eagle-commerce/shared/database"
+	"github.com/kaleabAlemayehu/eagle-commerce/shared/discovery"
 
 	sharedLogger "github.com/kaleabAlemayehu/eagle-commerce/shared/logger"
 	sharedMessaging "github.com/kaleabAlemayehu/eagle-commerce/shared/messaging"
 	sharedMiddleware "github.com/kaleabAlemayehu/eagle-commerce/shared/middleware"
 )
 
+// @title Payment Service API
+// @version 1.0
+// @description This is a payment service API for eCommerce application
+// @host localhost:8084
+// @BasePath /api/v1
 func main() {
 	cfg := config.Load()
 
@@ -27,13 +40,11 @@ func main() {
 	if err != nil {
 		log.Fatal("Failed to connect to MongoDB:", err)
 	}
-	defer db.Close()
 
 	natsClient, err := sharedMessaging.NewNATSClient(cfg.NATS.URL)
 	if err != nil {
 		log.Fatal("Failed to connect to NATS:", err)
 	}
-	defer natsClient.Close()
 	paymentPublisher := messaging.NewPaymentEventPublisher(natsClient)
 
 	paymentRepo := repository.NewMongoPaymentRepository(db.Database)
@@ -44,10 +55,49 @@ func main() {
 		log.Fatal("Failed to listen events from NATS:", err)
 	}
 
-	auth := sharedMiddleware.NewAuth(cfg.JWTSecret)
-	r := router.NewRouter(paymentHandler, auth, logger)
+	idempotency, err := sharedMiddleware.NewIdempotency(context.Background(), db.Database, cfg.IdempotencyTTL)
+	if err != nil {
+		log.Fatal("Failed to create idempotency store:", err)
+	}
+	identitySigner := sharedMiddleware.NewIdentitySigner(cfg.InternalSecret)
+	r := router.NewRouter(paymentHandler, identitySigner, idempotency, logger)
 	port := "8084"
-	log.Printf("Product service starting on port %s\n", port)
-	log.Fatal(http.ListenAndServe(":"+port, r))
+	server := http.Server{
+		Addr:    ":" + port,
+		Handler: r,
+	}
+
+	// Announce this instance to the api-gateway
+	announcer := discovery.NewAnnouncer(natsClient, identitySigner, discovery.Instance{
+		Service: "payment",
+		URL:     discovery.AdvertiseURL(cfg, port),
+		Version: cfg.Service.Version,
+	}, discovery.DefaultHeartbeatInterval)
+	announcer.Start()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
 
+	// Start server
+	go func() {
+		log.Printf("Payment service starting on port %s\n", port)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("ListenAndServe error: %v", err)
+		}
+	}()
+	<-stop
+
+	log.Println("Shutting down gracefully...")
+	announcer.Stop()
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("HTTP server Shutdown error: %v", err)
+	}
+	natsClient.Close()
+
+	if err := db.Close(); err != nil {
+		log.Printf("Error closing MongoDB connection: %v", err)
+	}
+	log.Println("Server stopped")
 }
@@ -17,7 +17,7 @@ const docTemplate = `{
     "paths": {
         "/payments": {
             "get": {
-                "description": "Get paginated list of payments",
+                "description": "Get paginated list of payments of every user, or the payments of the given orders the caller may see",
                 "produces": [
                     "application/json"
                 ],
@@ -47,11 +47,17 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/dto.Response"
                         }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/dto.Response"
+                        }
                     }
                 }
             },
             "post": {
-                "description": "Process payment for an order",
+                "description": "Process payment for an order of the authenticated user, staff may name another user",
                 "consumes": [
                     "application/json"
                 ],
@@ -85,13 +91,61 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/dto.Response"
                         }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/dto.Response"
+                        }
+                    }
+                }
+            }
+        },
+        "/payments/me": {
+            "get": {
+                "description": "Get paginated list of the payments of the authenticated user",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "payments"
+                ],
+                "summary": "Get my payments",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "default": 10,
+                        "description": "Limit",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 0,
+                        "description": "Offset",
+                        "name": "offset",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/dto.Response"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/dto.Response"
+                        }
                     }
                 }
             }
         },
         "/payments/order/{order_id}": {
             "get": {
-                "description": "Get payment details by order ID",
+                "description": "Get payment details by order ID, payments of other users are only found by staff",
                 "produces": [
                     "application/json"
                 ],
@@ -126,7 +180,7 @@ const docTemplate = `{
         },
         "/payments/{id}": {
             "get": {
-                "description": "Get payment details by ID",
+                "description": "Get payment details by ID, payments of other users are only found by staff",
                 "produces": [
                     "application/json"
                 ],
@@ -201,6 +255,12 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/dto.Response"
                         }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/dto.Response"
+                        }
                     }
                 }
             }
@@ -241,8 +301,7 @@ const docTemplate = `{
             "required": [
                 "currency",
                 "method",
-                "order_id",
-                "user_id"
+                "order_id"
             ],
             "properties": {
                 "amount": {
@@ -266,6 +325,7 @@ const docTemplate = `{
                     "type": "string"
                 },
                 "user_id": {
+                    "description": "UserID defaults to the authenticated user",
                     "type": "string"
                 }
             }
@@ -300,12 +360,12 @@ const docTemplate = `{
 
 // SwaggerInfo holds exported Swagger Info so clients can modify it
 var SwaggerInfo = &swag.Spec{
-	Version:          "",
-	Host:             "",
-	BasePath:         "",
+	Version:          "1.0",
+	Host:             "localhost:8084",
+	BasePath:         "/api/v1",
 	Schemes:          []string{},
-	Title:            "",
-	Description:      "",
+	Title:            "Payment Service API",
+	Description:      "This is a payment service API for eCommerce application",
 	InfoInstanceName: "swagger",
 	SwaggerTemplate:  docTemplate,
 	LeftDelim:        "{{",
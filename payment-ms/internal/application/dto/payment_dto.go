@@ -10,8 +10,9 @@ type Response struct {
 }
 
 type ProcessPaymentRequest struct {
-	OrderID     string       `json:"order_id" validate:"required"`
-	UserID      string       `json:"user_id" validate:"required"`
+	OrderID string `json:"order_id" validate:"required"`
+	// UserID defaults to the authenticated user
+	UserID      string       `json:"user_id,omitempty"`
 	Amount      float64      `json:"amount" validate:"gt=0"`
 	Currency    string       `json:"currency" validate:"required"`
 	Method      string       `json:"method" validate:"required,oneof=card paypal bank"`
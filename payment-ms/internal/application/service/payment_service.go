@@ -91,6 +91,14 @@ func (s *PaymentServiceImpl) RefundPayment(id string) error {
 	return nil
 }
 
+func (s *PaymentServiceImpl) GetPaymentsByOrders(orderIDs []string) ([]*domain.Payment, error) {
+	return s.repo.GetByOrderIDs(orderIDs)
+}
+
+func (s *PaymentServiceImpl) GetPaymentsByUser(userID string, limit, offset int) ([]*domain.Payment, error) {
+	return s.repo.GetByUserID(userID, limit, offset)
+}
+
 func (s *PaymentServiceImpl) ListPayments(limit, offset int) ([]*domain.Payment, error) {
 	return s.repo.List(limit, offset)
 }
@@ -39,6 +39,8 @@ type PaymentRepository interface {
 	Create(payment *Payment) error
 	GetByID(id string) (*Payment, error)
 	GetByOrderID(orderID string) (*Payment, error)
+	GetByOrderIDs(orderIDs []string) ([]*Payment, error)
+	GetByUserID(userID string, limit, offset int) ([]*Payment, error)
 	Update(id string, payment *Payment) error
 	UpdateStatus(id string, status PaymentStatus) error
 	List(limit, offset int) ([]*Payment, error)
@@ -48,6 +50,8 @@ type PaymentService interface {
 	ProcessPayment(payment *Payment) error
 	GetPayment(id string) (*Payment, error)
 	GetPaymentByOrder(orderID string) (*Payment, error)
+	GetPaymentsByOrders(orderIDs []string) ([]*Payment, error)
+	GetPaymentsByUser(userID string, limit, offset int) ([]*Payment, error)
 	RefundPayment(id string) error
 	ListPayments(limit, offset int) ([]*Payment, error)
 }
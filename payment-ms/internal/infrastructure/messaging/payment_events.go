@@ -43,7 +43,7 @@ func (p *PaymentEventPublisher) PublishPaymentProcessed(payment *domain.Payment,
 	}
 
 	event := models.Event{
-		ID:        generateEventID(),
+		ID:        messaging.GenerateEventID(),
 		Type:      models.PaymentProcessedEvent,
 		Source:    "payment-service",
 		Data:      eventData,
@@ -55,7 +55,7 @@ func (p *PaymentEventPublisher) PublishPaymentProcessed(payment *domain.Payment,
 
 func (p *PaymentEventPublisher) PublishPaymentRefunded(payment *domain.Payment, refundAmount float64) error {
 	event := models.Event{
-		ID:     generateEventID(),
+		ID:     messaging.GenerateEventID(),
 		Type:   "payment.refunded",
 		Source: "payment-service",
 		Data: map[string]interface{}{
@@ -74,7 +74,7 @@ func (p *PaymentEventPublisher) PublishPaymentRefunded(payment *domain.Payment,
 
 func (p *PaymentEventPublisher) PublishPaymentFailed(orderID, userID string, amount float64, reason string) error {
 	event := models.Event{
-		ID:     generateEventID(),
+		ID:     messaging.GenerateEventID(),
 		Type:   "payment.failed",
 		Source: "payment-service",
 		Data: map[string]interface{}{
@@ -89,7 +89,3 @@ func (p *PaymentEventPublisher) PublishPaymentFailed(orderID, userID string, amo
 
 	return p.natsClient.Publish("payment.failed", event)
 }
-
-func generateEventID() string {
-	return time.Now().Format("20060102150405") + "-" + "payment"
-}
@@ -57,6 +57,25 @@ func (r *MongoPaymentRepository) GetByOrderID(orderID string) (*domain.Payment,
 	return &payment, nil
 }
 
+func (r *MongoPaymentRepository) GetByOrderIDs(orderIDs []string) ([]*domain.Payment, error) {
+	cursor, err := r.collection.Find(context.Background(), bson.M{"order_id": bson.M{"$in": orderIDs}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var payments []*domain.Payment
+	for cursor.Next(context.Background()) {
+		var payment domain.Payment
+		if err := cursor.Decode(&payment); err != nil {
+			return nil, err
+		}
+		payments = append(payments, &payment)
+	}
+
+	return payments, nil
+}
+
 func (r *MongoPaymentRepository) Update(id string, payment *domain.Payment) error {
 	objectID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
@@ -87,13 +106,21 @@ func (r *MongoPaymentRepository) UpdateStatus(id string, status domain.PaymentSt
 	return err
 }
 
+func (r *MongoPaymentRepository) GetByUserID(userID string, limit, offset int) ([]*domain.Payment, error) {
+	return r.find(bson.M{"user_id": userID}, limit, offset)
+}
+
 func (r *MongoPaymentRepository) List(limit, offset int) ([]*domain.Payment, error) {
+	return r.find(bson.M{}, limit, offset)
+}
+
+func (r *MongoPaymentRepository) find(filter bson.M, limit, offset int) ([]*domain.Payment, error) {
 	opts := options.Find().
 		SetLimit(int64(limit)).
 		SetSkip(int64(offset)).
 		SetSort(bson.M{"created_at": -1})
 
-	cursor, err := r.collection.Find(context.Background(), bson.M{}, opts)
+	cursor, err := r.collection.Find(context.Background(), filter, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -2,15 +2,22 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/kaleabAlemayehu/eagle-commerce/payment-ms/internal/application/dto"
 	"github.com/kaleabAlemayehu/eagle-commerce/payment-ms/internal/domain"
+	sharedMiddleware "github.com/kaleabAlemayehu/eagle-commerce/shared/middleware"
 	"github.com/kaleabAlemayehu/eagle-commerce/shared/utils"
 )
 
+// maxBatchSize caps the number of orders looked up by a single order_ids query
+const maxBatchSize = 100
+
 type PaymentHandler struct {
 	paymentService domain.PaymentService
 }
@@ -27,13 +34,14 @@ func (h *PaymentHandler) HandleWebhook(w http.ResponseWriter, r *http.Request) {
 }
 
 // @Summary Process a payment
-// @Description Process payment for an order
+// @Description Process payment for an order of the authenticated user, staff may name another user
 // @Tags payments
 // @Accept json
 // @Produce json
 // @Param payment body dto.ProcessPaymentRequest true "Payment data"
 // @Success 201 {object} dto.Response
 // @Failure 400 {object} dto.Response
+// @Failure 403 {object} dto.Response
 // @Router /payments [post]
 func (h *PaymentHandler) ProcessPayment(w http.ResponseWriter, r *http.Request) {
 	var req dto.ProcessPaymentRequest
@@ -42,9 +50,19 @@ func (h *PaymentHandler) ProcessPayment(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	userID, err := sharedMiddleware.ResolveOwner(r.Context(), req.UserID, sharedMiddleware.PermissionPaymentsWrite)
+	if err != nil {
+		if errors.Is(err, sharedMiddleware.ErrOwnerRequired) {
+			h.sendErrorResponse(w, http.StatusBadRequest, "user_id is required")
+			return
+		}
+		h.sendErrorResponse(w, http.StatusForbidden, "Not allowed to pay for other users")
+		return
+	}
+
 	payment := &domain.Payment{
 		OrderID:  req.OrderID,
-		UserID:   req.UserID,
+		UserID:   userID,
 		Amount:   req.Amount,
 		Currency: req.Currency,
 		Method:   domain.PaymentMethod(req.Method),
@@ -76,7 +94,7 @@ func (h *PaymentHandler) ProcessPayment(w http.ResponseWriter, r *http.Request)
 }
 
 // @Summary Get payment by ID
-// @Description Get payment details by ID
+// @Description Get payment details by ID, payments of other users are only found by staff
 // @Tags payments
 // @Produce json
 // @Param id path string true "Payment ID"
@@ -87,7 +105,7 @@ func (h *PaymentHandler) GetPayment(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 
 	payment, err := h.paymentService.GetPayment(id)
-	if err != nil {
+	if err != nil || !sharedMiddleware.CanAccess(r.Context(), payment.UserID, sharedMiddleware.PermissionPaymentsRead) {
 		h.sendErrorResponse(w, http.StatusNotFound, "Payment not found")
 		return
 	}
@@ -109,7 +127,7 @@ func (h *PaymentHandler) GetPayment(w http.ResponseWriter, r *http.Request) {
 }
 
 // @Summary Get payment by order ID
-// @Description Get payment details by order ID
+// @Description Get payment details by order ID, payments of other users are only found by staff
 // @Tags payments
 // @Produce json
 // @Param order_id path string true "Order ID"
@@ -120,7 +138,7 @@ func (h *PaymentHandler) GetPaymentByOrder(w http.ResponseWriter, r *http.Reques
 	orderID := chi.URLParam(r, "order_id")
 
 	payment, err := h.paymentService.GetPaymentByOrder(orderID)
-	if err != nil {
+	if err != nil || !sharedMiddleware.CanAccess(r.Context(), payment.UserID, sharedMiddleware.PermissionPaymentsRead) {
 		h.sendErrorResponse(w, http.StatusNotFound, "Payment not found")
 		return
 	}
@@ -150,6 +168,7 @@ func (h *PaymentHandler) GetPaymentByOrder(w http.ResponseWriter, r *http.Reques
 // @Param refund body dto.RefundPaymentRequest false "Refund details"
 // @Success 200 {object} dto.Response
 // @Failure 400 {object} dto.Response
+// @Failure 403 {object} dto.Response
 // @Router /payments/{id}/refund [post]
 func (h *PaymentHandler) RefundPayment(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
@@ -180,28 +199,90 @@ func (h *PaymentHandler) RefundPayment(w http.ResponseWriter, r *http.Request) {
 }
 
 // @Summary List payments
-// @Description Get paginated list of payments
+// @Description Get paginated list of payments of every user, or the payments of the given orders the caller may see
 // @Tags payments
 // @Produce json
 // @Param limit query int false "Limit" default(10)
 // @Param offset query int false "Offset" default(0)
+// @Param order_ids query string false "Comma separated order IDs to fetch the payments of in one call"
 // @Success 200 {object} dto.Response
+// @Failure 400 {object} dto.Response
+// @Failure 403 {object} dto.Response
 // @Router /payments [get]
 func (h *PaymentHandler) ListPayments(w http.ResponseWriter, r *http.Request) {
-	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
-	if limit == 0 {
-		limit = 10
-	}
+	limit, offset := pagination(r)
 
-	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	if orderIDs := r.URL.Query().Get("order_ids"); orderIDs != "" {
+		ids := strings.Split(orderIDs, ",")
+		if len(ids) > maxBatchSize {
+			h.sendErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("at most %d order ids can be requested at once", maxBatchSize))
+			return
+		}
+		payments, err := h.paymentService.GetPaymentsByOrders(ids)
+		if err != nil {
+			h.sendErrorResponse(w, http.StatusInternalServerError, err.Error())
+			return
+		}
 
+		// Payments of other users are left out like missing ones
+		visible := []*domain.Payment{}
+		for _, payment := range payments {
+			if sharedMiddleware.CanAccess(r.Context(), payment.UserID, sharedMiddleware.PermissionPaymentsRead) {
+				visible = append(visible, payment)
+			}
+		}
+		h.sendSuccessResponse(w, http.StatusOK, h.toPaymentListResponse(visible))
+		return
+	}
+
+	if !sharedMiddleware.Can(r.Context(), sharedMiddleware.PermissionPaymentsRead) {
+		h.sendErrorResponse(w, http.StatusForbidden, "Insufficient permissions")
+		return
+	}
 	payments, err := h.paymentService.ListPayments(limit, offset)
 	if err != nil {
 		h.sendErrorResponse(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	h.sendSuccessResponse(w, http.StatusOK, h.toPaymentListResponse(payments))
+}
+
+// @Summary Get my payments
+// @Description Get paginated list of the payments of the authenticated user
+// @Tags payments
+// @Produce json
+// @Param limit query int false "Limit" default(10)
+// @Param offset query int false "Offset" default(0)
+// @Success 200 {object} dto.Response
+// @Failure 401 {object} dto.Response
+// @Router /payments/me [get]
+func (h *PaymentHandler) GetMyPayments(w http.ResponseWriter, r *http.Request) {
+	claims, ok := sharedMiddleware.GetUserFromContext(r.Context())
+	if !ok {
+		h.sendErrorResponse(w, http.StatusUnauthorized, "User authentication required")
+		return
+	}
+	limit, offset := pagination(r)
+
+	payments, err := h.paymentService.GetPaymentsByUser(claims.UserID, limit, offset)
+	if err != nil {
+		h.sendErrorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	h.sendSuccessResponse(w, http.StatusOK, h.toPaymentListResponse(payments))
+}
 
-	var responses []dto.PaymentResponse
+func pagination(r *http.Request) (limit, offset int) {
+	limit, _ = strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit == 0 {
+		limit = 10
+	}
+	offset, _ = strconv.Atoi(r.URL.Query().Get("offset"))
+	return limit, offset
+}
+
+func (h *PaymentHandler) toPaymentListResponse(payments []*domain.Payment) []dto.PaymentResponse {
+	responses := []dto.PaymentResponse{}
 	for _, payment := range payments {
 		responses = append(responses, dto.PaymentResponse{
 			ID:            payment.ID.Hex(),
@@ -216,8 +297,7 @@ func (h *PaymentHandler) ListPayments(w http.ResponseWriter, r *http.Request) {
 			UpdatedAt:     payment.UpdatedAt,
 		})
 	}
-
-	h.sendSuccessResponse(w, http.StatusOK, responses)
+	return responses
 }
 
 func (h *PaymentHandler) sendSuccessResponse(w http.ResponseWriter, statusCode int, data interface{}) {
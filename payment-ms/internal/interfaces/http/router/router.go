@@ -11,7 +11,7 @@ import (
 	sharedMiddleware "github.com/kaleabAlemayehu/eagle-commerce/shared/middleware"
 )
 
-func NewRouter(paymentHandler *handler.PaymentHandler, auth *sharedMiddleware.Auth, logger *slog.Logger) *chi.Mux {
+func NewRouter(paymentHandler *handler.PaymentHandler, identity *sharedMiddleware.IdentitySigner, idempotency *sharedMiddleware.Idempotency, logger *slog.Logger) *chi.Mux {
 	r := chi.NewRouter()
 
 	// Middleware
@@ -28,15 +28,19 @@ func NewRouter(paymentHandler *handler.PaymentHandler, auth *sharedMiddleware.Au
 
 	// Routes
 	r.Route("/api/v1", func(r chi.Router) {
+		// Only requests signed by the gateway carry a user
+		r.Use(identity.Middleware())
+
 		r.Route("/payments", func(r chi.Router) {
 			// Protected routes
 			r.Group(func(r chi.Router) {
-				r.Use(auth.AuthMiddleware())
-				r.Post("/", paymentHandler.ProcessPayment)
+				r.Use(sharedMiddleware.RequireAuth)
+				r.With(idempotency.Middleware).Post("/", paymentHandler.ProcessPayment)
 				r.Get("/", paymentHandler.ListPayments)
+				r.Get("/me", paymentHandler.GetMyPayments)
 				r.Get("/{id}", paymentHandler.GetPayment)
 				r.Get("/order/{order_id}", paymentHandler.GetPaymentByOrder)
-				r.Post("/{id}/refund", paymentHandler.RefundPayment)
+				r.With(sharedMiddleware.RequirePermission(sharedMiddleware.PermissionPaymentsRefund), idempotency.Middleware).Post("/{id}/refund", paymentHandler.RefundPayment)
 			})
 
 			// Webhook routes (no auth required)
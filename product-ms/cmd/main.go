@@ -9,6 +9,7 @@ import (
 	"syscall"
 	"time"
 
+	_ "github.com/kaleabAlemayehu/eagle-commerce/product-ms/docs"
 	"github.com/kaleabAlemayehu/eagle-commerce/product-ms/internal/application/service"
 	messaging "github.com/kaleabAlemayehu/eagle-commerce/product-ms/internal/infrastructure/messaging"
 	"github.com/kaleabAlemayehu/eagle-commerce/product-ms/internal/infrastructure/repository"
@@ -16,8 +17,10 @@ import (
 	"github.com/kaleabAlemayehu/eagle-commerce/product-ms/internal/interfaces/http/router"
 	"github.com/kaleabAlemayehu/eagle-commerce/shared/config"
 	"github.com/kaleabAlemayehu/eagle-commerce/shared/database"
+	"github.com/kaleabAlemayehu/eagle-commerce/shared/discovery"
 	sharedLogger "github.com/kaleabAlemayehu/eagle-commerce/shared/logger"
 	sharedMessaging "github.com/kaleabAlemayehu/eagle-commerce/shared/messaging"
+	sharedMiddleware "github.com/kaleabAlemayehu/eagle-commerce/shared/middleware"
 )
 
 // @title Product Service API
@@ -56,13 +59,23 @@ func main() {
 	}
 
 	// Setup router
-	r := router.NewRouter(productHandler, logger)
+	identitySigner := sharedMiddleware.NewIdentitySigner(cfg.InternalSecret)
+	r := router.NewRouter(productHandler, identitySigner, logger)
 
 	port := "8082"
 	server := http.Server{
 		Addr:    ":" + port,
 		Handler: r,
 	}
+
+	// Announce this instance to the api-gateway
+	announcer := discovery.NewAnnouncer(natsClient, identitySigner, discovery.Instance{
+		Service: "product",
+		URL:     discovery.AdvertiseURL(cfg, port),
+		Version: cfg.Service.Version,
+	}, discovery.DefaultHeartbeatInterval)
+	announcer.Start()
+
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
 
@@ -77,6 +90,7 @@ func main() {
 	<-stop
 
 	logger.Info("Shutting down gracefully...")
+	announcer.Stop()
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 	defer cancel()
 	if err := server.Shutdown(ctx); err != nil {
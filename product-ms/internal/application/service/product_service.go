@@ -42,7 +42,7 @@ func (s *ProductServiceImpl) CreateProduct(ctx context.Context, product *domain.
 	}
 
 	// Publish event
-	if err := s.nats.PublishProductCreated(product); err != nil {
+	if err := s.nats.PublishProductCreated(newProduct); err != nil {
 		logger.Error("NATS Failed to Publish ProductCreated", "error", err)
 		return nil, err
 	}
@@ -65,6 +65,17 @@ func (s *ProductServiceImpl) GetProduct(ctx context.Context, id string) (*domain
 	return product, nil
 }
 
+func (s *ProductServiceImpl) GetProducts(ctx context.Context, ids []string) ([]*domain.Product, error) {
+	logger := logger.FromContext(ctx).With("Layer", "service", "method", "GetProducts", "count", len(ids))
+	products, err := s.repo.GetByIDs(ctx, ids)
+	if err != nil {
+		logger.Error("Failed to retrieve products from the repository", "error", err)
+		return nil, err
+	}
+	logger.Info("Products retrived successfully")
+	return products, nil
+}
+
 func (s *ProductServiceImpl) UpdateProduct(ctx context.Context, id string, product *domain.Product) (*domain.Product, error) {
 	if err := utils.ValidateStruct(product); err != nil {
 		return nil, err
@@ -76,7 +87,7 @@ func (s *ProductServiceImpl) UpdateProduct(ctx context.Context, id string, produ
 		return nil, err
 	}
 
-	if err := s.nats.PublishProductUpdated(product); err != nil {
+	if err := s.nats.PublishProductUpdated(updatedProduct); err != nil {
 
 		logger.Error("NATS Failed to Publish ProductUpdated", "error", err)
 		return nil, err
@@ -96,6 +107,11 @@ func (s *ProductServiceImpl) DeleteProduct(ctx context.Context, id string) error
 		logger.Error("Repository Failed to Delete Product", "error", err)
 		return err
 	}
+
+	if err := s.nats.PublishProductDeleted(id); err != nil {
+		logger.Error("NATS Failed to Publish ProductDeleted", "error", err)
+		return err
+	}
 	logger.Info("Product got deleted succefully")
 	return nil
 }
@@ -157,7 +173,7 @@ func (s *ProductServiceImpl) ReserveStock(ctx context.Context, id string, quanti
 		return err
 	}
 
-	if err := s.nats.PublishStockUpdated(id, n, quantity); err != nil {
+	if err := s.nats.PublishStockUpdated(id, n, n-quantity); err != nil {
 		logger.Error("NATS Failed to Publish StockUpdated", "error", err)
 		return err
 	}
@@ -183,7 +199,7 @@ func (s *ProductServiceImpl) RestoreStock(ctx context.Context, id string, quanti
 		return err
 	}
 
-	if err := s.nats.PublishStockUpdated(id, product.Stock, quantity); err != nil {
+	if err := s.nats.PublishStockUpdated(id, product.Stock, product.Stock+quantity); err != nil {
 		logger.Error("NATS Failed to Publish StockUpdated", "error", err)
 		return err
 	}
@@ -23,6 +23,7 @@ type Product struct {
 type ProductRepository interface {
 	Create(ctx context.Context, product *Product) (*Product, error)
 	GetByID(ctx context.Context, id string) (*Product, error)
+	GetByIDs(ctx context.Context, ids []string) ([]*Product, error)
 	Update(ctx context.Context, id string, product *Product) (*Product, error)
 	Delete(ctx context.Context, id string) error
 	List(ctx context.Context, limit, offset int, category string) ([]*Product, error)
@@ -33,6 +34,7 @@ type ProductRepository interface {
 type ProductService interface {
 	CreateProduct(ctx context.Context, product *Product) (*Product, error)
 	GetProduct(ctx context.Context, id string) (*Product, error)
+	GetProducts(ctx context.Context, ids []string) ([]*Product, error)
 	UpdateProduct(ctx context.Context, id string, product *Product) (*Product, error)
 	DeleteProduct(ctx context.Context, id string) error
 	ListProducts(ctx context.Context, limit, offset int, category string) ([]*Product, error)
@@ -84,6 +84,21 @@ func (p *ProductEventPublisher) PublishStockUpdated(productID string, oldStock,
 	return p.natsClient.Publish(models.ProductStockUpdatedEvent, event)
 }
 
+func (p *ProductEventPublisher) PublishProductDeleted(productID string) error {
+	event := models.Event{
+		ID:     messaging.GenerateEventID(),
+		Type:   models.ProductDeletedEvent,
+		Source: "product-service",
+		Data: map[string]interface{}{
+			"product_id": productID,
+			"deleted_at": time.Now(),
+		},
+		Timestamp: time.Now(),
+	}
+
+	return p.natsClient.Publish(models.ProductDeletedEvent, event)
+}
+
 type ProductEventHandler struct {
 	productService domain.ProductService
 	natsClient     *messaging.NATSClient
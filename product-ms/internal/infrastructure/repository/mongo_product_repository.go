@@ -58,6 +58,35 @@ func (r *MongoProductRepository) GetByID(ctx context.Context, id string) (*domai
 	return &product, nil
 }
 
+func (r *MongoProductRepository) GetByIDs(ctx context.Context, ids []string) ([]*domain.Product, error) {
+	objectIDs := make([]primitive.ObjectID, 0, len(ids))
+	for _, id := range ids {
+		objectID, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			// Unknown ids are simply missing from the result
+			continue
+		}
+		objectIDs = append(objectIDs, objectID)
+	}
+
+	cursor, err := r.collection.Find(ctx, bson.M{"_id": bson.M{"$in": objectIDs}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var products []*domain.Product
+	for cursor.Next(ctx) {
+		var product domain.Product
+		if err := cursor.Decode(&product); err != nil {
+			return nil, err
+		}
+		products = append(products, &product)
+	}
+
+	return products, nil
+}
+
 func (r *MongoProductRepository) Update(ctx context.Context, id string, product *domain.Product) (*domain.Product, error) {
 	objectID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
@@ -3,8 +3,10 @@ package handler
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/kaleabAlemayehu/eagle-commerce/product-ms/internal/application/dto"
@@ -14,6 +16,9 @@ import (
 	"github.com/kaleabAlemayehu/eagle-commerce/shared/utils"
 )
 
+// maxBatchSize caps the number of products fetched by a single ids lookup
+const maxBatchSize = 100
+
 type ProductHandler struct {
 	productService domain.ProductService
 }
@@ -32,6 +37,7 @@ func NewProductHandler(productService domain.ProductService) *ProductHandler {
 // @Param        product  body      dto.CreateProductRequest  true  "Product data"
 // @Success      201      {object}  dto.Response
 // @Failure      400      {object}  dto.Response
+// @Failure      403      {object}  dto.Response
 // @Failure      500      {object}  dto.Response
 // @Router       /products [post]
 func (h *ProductHandler) CreateProduct(w http.ResponseWriter, r *http.Request) {
@@ -103,10 +109,17 @@ func (h *ProductHandler) GetProduct(w http.ResponseWriter, r *http.Request) {
 // @Param        limit     query     int     false  "Limit"  default(10)
 // @Param        offset    query     int     false  "Offset"  default(0)
 // @Param        category  query     string  false  "Category filter"
+// @Param        ids       query     string  false  "Comma separated product IDs to fetch in one call"
 // @Success      200       {object}  dto.Response
+// @Failure      400       {object}  dto.Response
 // @Failure      500       {object}  dto.Response
 // @Router       /products [get]
 func (h *ProductHandler) ListProducts(w http.ResponseWriter, r *http.Request) {
+	if ids := r.URL.Query().Get("ids"); ids != "" {
+		h.getProducts(w, r, strings.Split(ids, ","))
+		return
+	}
+
 	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
 	if limit == 0 {
 		limit = 10
@@ -132,6 +145,29 @@ func (h *ProductHandler) ListProducts(w http.ResponseWriter, r *http.Request) {
 	utils.SendSuccessResponse(w, http.StatusOK, productsRes)
 }
 
+// getProducts answers batch lookups, products that don't exist are left out
+func (h *ProductHandler) getProducts(w http.ResponseWriter, r *http.Request, ids []string) {
+	if len(ids) > maxBatchSize {
+		utils.SendErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("at most %d ids can be requested at once", maxBatchSize))
+		return
+	}
+
+	products, err := h.productService.GetProducts(r.Context(), ids)
+	if err != nil {
+		logger := logger.FromContext(r.Context()).With("Layer", "Handler")
+		logger.Error("Internal server error in GetProducts", "error", err)
+		utils.SendErrorResponse(w, http.StatusInternalServerError, "internal server error occured")
+		return
+	}
+	productsList := h.toProductResponseList(products)
+	productsRes := dto.ProductListResponse{
+		Products: productsList,
+		Total:    len(productsList),
+	}
+
+	utils.SendSuccessResponse(w, http.StatusOK, productsRes)
+}
+
 // @Summary      Search products
 // @Description  Search products by name or description
 // @Tags         products
@@ -185,6 +221,7 @@ func (h *ProductHandler) SearchProducts(w http.ResponseWriter, r *http.Request)
 // @Param        product  body      dto.CreateProductRequest  true  "Product data"
 // @Success      200      {object}  dto.Response
 // @Failure      400      {object}  dto.Response
+// @Failure      403      {object}  dto.Response
 // @Failure      404      {object}  dto.Response
 // @Failure      500      {object}  dto.Response
 // @Router       /products/{id} [put]
@@ -232,6 +269,7 @@ func (h *ProductHandler) UpdateProduct(w http.ResponseWriter, r *http.Request) {
 // @Produce      json
 // @Param        id   path      string  true  "Product ID"
 // @Success      200  {object}  dto.Response
+// @Failure      403  {object}  dto.Response
 // @Failure      404  {object}  dto.Response
 // @Failure      500  {object}  dto.Response
 // @Router       /products/{id} [delete]
@@ -332,7 +370,7 @@ func (h *ProductHandler) ReserveStock(w http.ResponseWriter, r *http.Request) {
 
 func (h *ProductHandler) toProductResponse(p *domain.Product) dto.ProductResponse {
 	return dto.ProductResponse{
-		ID:          p.ID.String(), // Convert ObjectID to string
+		ID:          p.ID.Hex(),
 		Name:        p.Name,
 		Description: p.Description,
 		Price:       p.Price,
@@ -11,7 +11,7 @@ import (
 	sharedMiddleware "github.com/kaleabAlemayehu/eagle-commerce/shared/middleware"
 )
 
-func NewRouter(productHandler *handler.ProductHandler, logger *slog.Logger) *chi.Mux {
+func NewRouter(productHandler *handler.ProductHandler, identity *sharedMiddleware.IdentitySigner, logger *slog.Logger) *chi.Mux {
 	r := chi.NewRouter()
 
 	// Middleware
@@ -28,15 +28,24 @@ func NewRouter(productHandler *handler.ProductHandler, logger *slog.Logger) *chi
 
 	// Routes
 	r.Route("/api/v1", func(r chi.Router) {
+		// Only requests signed by the gateway carry a user
+		r.Use(identity.Middleware())
+
 		r.Route("/products", func(r chi.Router) {
-			r.Post("/", productHandler.CreateProduct)
+			r.Use(sharedMiddleware.RequireAuth)
 			r.Get("/", productHandler.ListProducts)
 			r.Get("/search", productHandler.SearchProducts)
 			r.Post("/check-stock", productHandler.CheckStock)
 			r.Post("/reserve-stock", productHandler.ReserveStock)
 			r.Get("/{id}", productHandler.GetProduct)
-			r.Put("/{id}", productHandler.UpdateProduct)
-			r.Delete("/{id}", productHandler.DeleteProduct)
+
+			// Catalog management
+			r.Group(func(r chi.Router) {
+				r.Use(sharedMiddleware.RequirePermission(sharedMiddleware.PermissionProductsWrite))
+				r.Post("/", productHandler.CreateProduct)
+				r.Put("/{id}", productHandler.UpdateProduct)
+				r.Delete("/{id}", productHandler.DeleteProduct)
+			})
 		})
 	})
 
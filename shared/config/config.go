@@ -1,20 +1,53 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"log"
+	"time"
 
 	"github.com/caarlos0/env/v11"
 )
 
+// minInternalSecretLen is the shortest secret accepted for signing identity
+// headers, 32 bytes for HMAC-SHA256
+const minInternalSecretLen = 32
+
 // Config holds all application configuration
 type Config struct {
-	MongoDB        MongoConfig   `envPrefix:"MONGODB_"`
-	NATS           NATSConfig    `envPrefix:"NATS_"`
-	Server         ServerConfig  `envPrefix:"SERVER_"`
-	Service        ServiceConfig `envPrefix:"SERVICE_"`
-	JWTSecret      string        `env:"JWT_SECRET" envDefault:"JxmnOYhSfqw-g9IkS489eaqZw9uVCzK5H912T9YezJ5MWCHPj4LHo4xOEQixZap38LcpBMuYNUBbgBAH0rTIZQ"`
-	Environment    string        `env:"ENVIRONMENT" envDefault:"development"`
-	AllowedOrigins []string      `env:"ALLOWED_ORIGINS" envDefault:"*" envSeparator:","`
+	MongoDB MongoConfig   `envPrefix:"MONGODB_"`
+	NATS    NATSConfig    `envPrefix:"NATS_"`
+	Server  ServerConfig  `envPrefix:"SERVER_"`
+	Service ServiceConfig `envPrefix:"SERVICE_"`
+	// InternalSecret signs the identity headers the gateway sends to services,
+	// it has no default in any environment
+	InternalSecret string   `env:"INTERNAL_SECRET"`
+	Environment    string   `env:"ENVIRONMENT" envDefault:"development"`
+	AllowedOrigins []string `env:"ALLOWED_ORIGINS" envDefault:"*" envSeparator:","`
+	// IdempotencyTTL is how long responses to requests with an
+	// Idempotency-Key are kept for retries
+	IdempotencyTTL time.Duration `env:"IDEMPOTENCY_TTL" envDefault:"24h"`
+	Tokens         TokenConfig   `envPrefix:"TOKEN_"`
+}
+
+// TokenConfig holds the lifetime of the tokens user-ms issues, how they are
+// signed and where revoked access tokens are shared between services
+type TokenConfig struct {
+	AccessTTL  time.Duration `env:"ACCESS_TTL" envDefault:"15m"`
+	RefreshTTL time.Duration `env:"REFRESH_TTL" envDefault:"720h"`
+	// DenylistBucket is the NATS key-value bucket holding revoked access
+	// tokens, NATS has to run with JetStream
+	DenylistBucket string `env:"DENYLIST_BUCKET" envDefault:"revoked_tokens"`
+	// SigningAlgorithm is RS256 or EdDSA, changing it rotates the signing key
+	SigningAlgorithm string `env:"SIGNING_ALG" envDefault:"EdDSA"`
+	// KeyRotation is how long a signing key signs tokens before the next
+	// one takes over
+	KeyRotation time.Duration `env:"KEY_ROTATION" envDefault:"720h"`
+	// KeyEncryptionKey seals the private signing keys in the database, the
+	// user service refuses to start without it
+	KeyEncryptionKey string `env:"KEY_ENCRYPTION_KEY"`
+	// JWKSURL is where services fetch the public keys of the user service
+	JWKSURL string `env:"JWKS_URL" envDefault:"http://localhost:8081/.well-known/jwks.json"`
 }
 
 // MongoConfig holds MongoDB config values
@@ -32,6 +65,9 @@ type NATSConfig struct {
 type ServerConfig struct {
 	Port string `env:"PORT" envDefault:"8080"`
 	Host string `env:"HOST" envDefault:"localhost"`
+	// AdvertiseURL is the address other components use to reach this
+	// instance. It defaults to http://HOST:PORT when empty.
+	AdvertiseURL string `env:"ADVERTISE_URL"`
 }
 
 // ServiceConfig holds service metadata
@@ -46,5 +82,20 @@ func Load() *Config {
 	if err := env.Parse(&cfg); err != nil {
 		log.Fatalf("Failed to parse environment variables: %v", err)
 	}
+	if err := cfg.validate(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
 	return &cfg
 }
+
+// validate refuses to run without the secrets every service needs, anyone
+// knowing a default could sign their own identity headers
+func (c *Config) validate() error {
+	if c.InternalSecret == "" {
+		return errors.New("INTERNAL_SECRET must be set")
+	}
+	if len(c.InternalSecret) < minInternalSecretLen {
+		return fmt.Errorf("INTERNAL_SECRET must be at least %d bytes", minInternalSecretLen)
+	}
+	return nil
+}
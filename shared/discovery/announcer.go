@@ -0,0 +1,119 @@
+package discovery
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+
+	"github.com/kaleabAlemayehu/eagle-commerce/shared/config"
+	"github.com/kaleabAlemayehu/eagle-commerce/shared/messaging"
+	"github.com/kaleabAlemayehu/eagle-commerce/shared/middleware"
+	"github.com/kaleabAlemayehu/eagle-commerce/shared/models"
+)
+
+const DefaultHeartbeatInterval = 10 * time.Second
+
+// Instance describes a running service instance as seen by the gateway
+type Instance struct {
+	ID      string
+	Service string
+	URL     string
+	Version string
+}
+
+// Announcer periodically publishes heartbeats so the api-gateway can keep
+// track of live instances without any hardcoded addresses. Heartbeats are
+// signed with the internal secret, the gateway ignores any other.
+type Announcer struct {
+	natsClient *messaging.NATSClient
+	signer     *middleware.IdentitySigner
+	instance   Instance
+	interval   time.Duration
+	stop       chan struct{}
+	once       sync.Once
+}
+
+func NewAnnouncer(natsClient *messaging.NATSClient, signer *middleware.IdentitySigner, instance Instance, interval time.Duration) *Announcer {
+	if instance.ID == "" {
+		instance.ID = uuid.NewString()
+	}
+	if interval <= 0 {
+		interval = DefaultHeartbeatInterval
+	}
+	return &Announcer{
+		natsClient: natsClient,
+		signer:     signer,
+		instance:   instance,
+		interval:   interval,
+		stop:       make(chan struct{}),
+	}
+}
+
+// AdvertiseURL returns the URL other components should use to reach a
+// service listening on the given port.
+func AdvertiseURL(cfg *config.Config, port string) string {
+	if cfg.Server.AdvertiseURL != "" {
+		return cfg.Server.AdvertiseURL
+	}
+	return fmt.Sprintf("http://%s:%s", cfg.Server.Host, port)
+}
+
+func (a *Announcer) Start() {
+	go func() {
+		ticker := time.NewTicker(a.interval)
+		defer ticker.Stop()
+
+		a.publish(models.ServiceHeartbeatEvent)
+		for {
+			select {
+			case <-ticker.C:
+				a.publish(models.ServiceHeartbeatEvent)
+			case <-a.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop halts the heartbeats and tells the gateway to drop this instance
+// right away instead of waiting for it to expire.
+func (a *Announcer) Stop() {
+	a.once.Do(func() {
+		close(a.stop)
+		a.publish(models.ServiceDeregisteredEvent)
+	})
+}
+
+func (a *Announcer) publish(eventType string) {
+	event := models.Event{
+		ID:     messaging.GenerateEventID(),
+		Type:   eventType,
+		Source: a.instance.Service + "-service",
+		Data: map[string]interface{}{
+			"instance_id":      a.instance.ID,
+			"service":          a.instance.Service,
+			"url":              a.instance.URL,
+			"version":          a.instance.Version,
+			"interval_seconds": a.interval.Seconds(),
+		},
+		Timestamp: time.Now(),
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Error marshaling %s for %s: %v", eventType, a.instance.Service, err)
+		return
+	}
+	msg := nats.NewMsg(eventType)
+	msg.Data = data
+	a.signer.SignMessage(msg, &middleware.Identity{})
+
+	if err := a.natsClient.PublishMsg(msg); err != nil {
+		log.Printf("Error publishing %s for %s: %v", eventType, a.instance.Service, err)
+	}
+}
@@ -2,6 +2,7 @@ package messaging
 
 import (
 	"encoding/json"
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
@@ -35,6 +36,11 @@ func (n *NATSClient) Subscribe(subject string, handler func([]byte)) (*nats.Subs
 	})
 }
 
+// SubscribeMsg hands the handler whole messages, along with their headers
+func (n *NATSClient) SubscribeMsg(subject string, handler func(msg *nats.Msg)) (*nats.Subscription, error) {
+	return n.conn.Subscribe(subject, handler)
+}
+
 func (n *NATSClient) SubscribeToRequest(subject string, handler func(msg *nats.Msg)) (*nats.Subscription, error) {
 	return n.conn.Subscribe(subject, handler)
 }
@@ -47,6 +53,55 @@ func (n *NATSClient) Request(subject string, data any, timeout time.Duration) (*
 	return n.conn.Request(subject, payload, timeout)
 }
 
+// PublishMsg publishes a message as is, along with its headers
+func (n *NATSClient) PublishMsg(msg *nats.Msg) error {
+	return n.conn.PublishMsg(msg)
+}
+
+// RequestMsg sends a request as is, along with its headers
+func (n *NATSClient) RequestMsg(msg *nats.Msg, timeout time.Duration) (*nats.Msg, error) {
+	return n.conn.RequestMsg(msg, timeout)
+}
+
+// KeyValue binds to a JetStream key-value bucket, creating it when missing
+// and applying ttl when it changed. The server has to run with JetStream
+// enabled.
+func (n *NATSClient) KeyValue(bucket string, ttl time.Duration) (nats.KeyValue, error) {
+	js, err := n.conn.JetStream()
+	if err != nil {
+		return nil, err
+	}
+
+	kv, err := js.KeyValue(bucket)
+	if errors.Is(err, nats.ErrBucketNotFound) {
+		return js.CreateKeyValue(&nats.KeyValueConfig{Bucket: bucket, TTL: ttl})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := kv.Status()
+	if err != nil {
+		return nil, err
+	}
+	if status.TTL() != ttl {
+		// The TTL of a bucket is the max age of the stream behind it
+		info, err := js.StreamInfo("KV_" + bucket)
+		if err != nil {
+			return nil, err
+		}
+		config := info.Config
+		config.MaxAge = ttl
+		if ttl > 0 {
+			config.Duplicates = min(config.Duplicates, ttl)
+		}
+		if _, err := js.UpdateStream(&config); err != nil {
+			return nil, err
+		}
+	}
+	return kv, nil
+}
+
 func (n *NATSClient) Close() {
 	n.conn.Close()
 }
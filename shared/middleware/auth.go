@@ -3,27 +3,64 @@ package middleware
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
+// DefaultAccessTokenTTL is how long generated tokens are valid by default
+const DefaultAccessTokenTTL = 15 * time.Minute
+
+var (
+	ErrTokenRevoked = errors.New("token revoked")
+	ErrNoSigner     = errors.New("no token signer configured")
+)
+
+// Auth verifies access tokens with the public keys of keys. Only the user
+// service holds a signer to generate them.
 type Auth struct {
-	jwtSecret []byte
+	keys      KeySet
+	signer    TokenSigner
+	accessTTL time.Duration
+	denylist  *Denylist
 }
 
-func NewAuth(secret string) *Auth {
+func NewAuth(keys KeySet) *Auth {
 	return &Auth{
-		jwtSecret: []byte(secret),
+		keys:      keys,
+		accessTTL: DefaultAccessTokenTTL,
 	}
 }
 
+// WithSigner lets GenerateJWT sign tokens with the keys of signer
+func (a *Auth) WithSigner(signer TokenSigner) *Auth {
+	a.signer = signer
+	return a
+}
+
+// WithAccessTokenTTL sets how long generated tokens are valid
+func (a *Auth) WithAccessTokenTTL(ttl time.Duration) *Auth {
+	a.accessTTL = ttl
+	return a
+}
+
+// WithDenylist rejects the tokens revoked in denylist
+func (a *Auth) WithDenylist(denylist *Denylist) *Auth {
+	a.denylist = denylist
+	return a
+}
+
 type Claims struct {
-	UserID string `json:"user_id"`
-	Email  string `json:"email"`
+	UserID string   `json:"user_id"`
+	Email  string   `json:"email"`
+	Roles  []string `json:"roles,omitempty"`
+	// EmailVerified is false until the user confirmed owning Email
+	EmailVerified bool `json:"email_verified"`
 	jwt.RegisteredClaims
 }
 
@@ -31,34 +68,57 @@ type contextKey string
 
 const UserContextKey contextKey = "user"
 
-func (a *Auth) GenerateJWT(userID, email string) (string, error) {
-	claims := Claims{
-		UserID: userID,
-		Email:  email,
+// GenerateJWT returns a signed access token and its claims, the token ID
+// (jti) is what revoking it refers to
+func (a *Auth) GenerateJWT(userID, email string, roles []string, emailVerified bool) (string, *Claims, error) {
+	if a.signer == nil {
+		return "", nil, ErrNoSigner
+	}
+	key, err := a.signer.SigningKey()
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now()
+	claims := &Claims{
+		UserID:        userID,
+		Email:         email,
+		Roles:         roles,
+		EmailVerified: emailVerified,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ID:        uuid.NewString(),
+			ExpiresAt: jwt.NewNumericDate(now.Add(a.accessTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
 			Subject:   userID,
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(a.jwtSecret)
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	signed, err := token.SignedString(key.Key)
+	if err != nil {
+		return "", nil, err
+	}
+	return signed, claims, nil
 }
 
 func (a *Auth) ValidateJWT(tokenString string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		keyID, _ := token.Header["kid"].(string)
+		if keyID == "" {
+			return nil, ErrUnknownSigningKey
 		}
-		return a.jwtSecret, nil
-	})
+		return a.keys.PublicKey(keyID)
+	}, jwt.WithValidMethods(signingAlgorithms))
 
 	if err != nil {
 		return nil, err
 	}
 
 	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
+		if claims.ID != "" && a.denylist != nil && a.denylist.Revoked(claims.ID) {
+			return nil, ErrTokenRevoked
+		}
 		return claims, nil
 	}
 
@@ -99,8 +159,16 @@ func GetUserFromContext(ctx context.Context) (*Claims, bool) {
 }
 
 func sendUnauthorized(w http.ResponseWriter, message string) {
+	sendError(w, http.StatusUnauthorized, message)
+}
+
+func sendForbidden(w http.ResponseWriter, message string) {
+	sendError(w, http.StatusForbidden, message)
+}
+
+func sendError(w http.ResponseWriter, status int, message string) {
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusUnauthorized)
+	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success": false,
 		"error":   message,
@@ -0,0 +1,124 @@
+package middleware
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// denylistSweepInterval is how often revocations of expired tokens are
+// forgotten
+const denylistSweepInterval = time.Minute
+
+// Denylist holds the IDs of revoked access tokens until they expire. The
+// revocations live in a NATS key-value bucket every service watches, so a
+// token revoked by one service is rejected by all of them. The bucket TTL
+// has to cover the access token lifetime.
+type Denylist struct {
+	kv nats.KeyValue
+
+	mu      sync.RWMutex
+	revoked map[string]time.Time
+}
+
+func NewDenylist(kv nats.KeyValue) *Denylist {
+	return &Denylist{
+		kv:      kv,
+		revoked: make(map[string]time.Time),
+	}
+}
+
+// Start loads the revocations made so far and follows the new ones until ctx
+// is done
+func (d *Denylist) Start(ctx context.Context) error {
+	watcher, err := d.kv.WatchAll()
+	if err != nil {
+		return err
+	}
+
+	// The current values come first, a nil entry marks their end
+	for entry := range watcher.Updates() {
+		if entry == nil {
+			break
+		}
+		d.apply(entry)
+	}
+
+	go func() {
+		defer watcher.Stop()
+
+		sweep := time.NewTicker(denylistSweepInterval)
+		defer sweep.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case entry, ok := <-watcher.Updates():
+				if !ok {
+					return
+				}
+				if entry != nil {
+					d.apply(entry)
+				}
+			case now := <-sweep.C:
+				d.sweep(now)
+			}
+		}
+	}()
+	return nil
+}
+
+// Revoke denies the token with the given ID until it expires
+func (d *Denylist) Revoke(tokenID string, expiresAt time.Time) error {
+	if !time.Now().Before(expiresAt) {
+		return nil
+	}
+	d.add(tokenID, expiresAt)
+	_, err := d.kv.Put(tokenID, []byte(strconv.FormatInt(expiresAt.Unix(), 10)))
+	return err
+}
+
+// Revoked reports whether the token with the given ID was revoked
+func (d *Denylist) Revoked(tokenID string) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	expiresAt, revoked := d.revoked[tokenID]
+	return revoked && time.Now().Before(expiresAt)
+}
+
+func (d *Denylist) apply(entry nats.KeyValueEntry) {
+	if entry.Operation() != nats.KeyValuePut {
+		d.mu.Lock()
+		delete(d.revoked, entry.Key())
+		d.mu.Unlock()
+		return
+	}
+	expiresAt, err := strconv.ParseInt(string(entry.Value()), 10, 64)
+	if err != nil {
+		log.Printf("Ignoring invalid token revocation %s: %v", entry.Key(), err)
+		return
+	}
+	d.add(entry.Key(), time.Unix(expiresAt, 0))
+}
+
+func (d *Denylist) add(tokenID string, expiresAt time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.revoked[tokenID] = expiresAt
+}
+
+func (d *Denylist) sweep(now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for tokenID, expiresAt := range d.revoked {
+		if !now.Before(expiresAt) {
+			delete(d.revoked, tokenID)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	sharedLogger "github.com/kaleabAlemayehu/eagle-commerce/shared/logger"
+	"github.com/kaleabAlemayehu/eagle-commerce/shared/utils"
+)
+
+const (
+	HeaderIdempotencyKey      = "Idempotency-Key"
+	HeaderIdempotentReplayed  = "Idempotent-Replayed"
+	maxIdempotencyKeyLength   = 255
+	maxIdempotentRequestBytes = 1 << 20
+
+	// idempotencyLockTimeout is how long a key stays claimed by a request
+	// that never completes, before it can be used again
+	idempotencyLockTimeout = time.Minute
+)
+
+const (
+	idempotencyProcessing = "processing"
+	idempotencyCompleted  = "completed"
+)
+
+type idempotencyRecord struct {
+	ID          string    `bson:"_id"`
+	Fingerprint string    `bson:"fingerprint"`
+	Status      string    `bson:"status"`
+	StatusCode  int       `bson:"status_code,omitempty"`
+	ContentType string    `bson:"content_type,omitempty"`
+	Body        []byte    `bson:"body,omitempty"`
+	ExpiresAt   time.Time `bson:"expires_at"`
+}
+
+// Idempotency lets clients retry unsafe requests with an Idempotency-Key
+// header. The first response is stored in MongoDB for the TTL and returned
+// again to retries, a retry with a different request is rejected. Requests
+// without the header aren't affected.
+type Idempotency struct {
+	collection *mongo.Collection
+	ttl        time.Duration
+}
+
+func NewIdempotency(ctx context.Context, db *mongo.Database, ttl time.Duration) (*Idempotency, error) {
+	collection := db.Collection("idempotency_keys")
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Idempotency{collection: collection, ttl: ttl}, nil
+}
+
+// Middleware has to run after authentication, keys are scoped to the caller
+func (i *Idempotency) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(HeaderIdempotencyKey)
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			utils.SendErrorResponse(w, http.StatusBadRequest, "Idempotency-Key is too long")
+			return
+		}
+
+		logger := sharedLogger.FromContext(r.Context())
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentRequestBytes))
+		if err != nil {
+			utils.SendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		record := &idempotencyRecord{
+			ID:          idempotencyScope(r) + ":" + key,
+			Fingerprint: fingerprint(r, body),
+			Status:      idempotencyProcessing,
+			ExpiresAt:   time.Now().Add(idempotencyLockTimeout),
+		}
+		_, err = i.collection.InsertOne(r.Context(), record)
+		if mongo.IsDuplicateKeyError(err) {
+			i.replay(w, r, record)
+			return
+		}
+		if err != nil {
+			logger.Error("Failed to claim idempotency key", "error", err)
+			utils.SendErrorResponse(w, http.StatusInternalServerError, "Failed to process request")
+			return
+		}
+
+		recorder := &recordingWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		// The request may outlive the client, the outcome must be recorded anyway
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 5*time.Second)
+		defer cancel()
+
+		if recorder.statusCode >= http.StatusInternalServerError {
+			// Failures on our side are safe to retry
+			if _, err := i.collection.DeleteOne(ctx, bson.M{"_id": record.ID}); err != nil {
+				logger.Error("Failed to release idempotency key", "error", err)
+			}
+			return
+		}
+		_, err = i.collection.UpdateOne(ctx, bson.M{"_id": record.ID}, bson.M{"$set": bson.M{
+			"status":       idempotencyCompleted,
+			"status_code":  recorder.statusCode,
+			"content_type": recorder.Header().Get("Content-Type"),
+			"body":         recorder.body.Bytes(),
+			"expires_at":   time.Now().Add(i.ttl),
+		}})
+		if err != nil {
+			logger.Error("Failed to store idempotent response", "error", err)
+		}
+	})
+}
+
+// replay answers a request whose key was already used
+func (i *Idempotency) replay(w http.ResponseWriter, r *http.Request, request *idempotencyRecord) {
+	var stored idempotencyRecord
+	err := i.collection.FindOne(r.Context(), bson.M{"_id": request.ID}).Decode(&stored)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// Released or expired in the meantime
+		w.Header().Set("Retry-After", "1")
+		utils.SendErrorResponse(w, http.StatusConflict, "A request with this Idempotency-Key is in progress")
+		return
+	}
+	if err != nil {
+		sharedLogger.FromContext(r.Context()).Error("Failed to load idempotency key", "error", err)
+		utils.SendErrorResponse(w, http.StatusInternalServerError, "Failed to process request")
+		return
+	}
+
+	if stored.Fingerprint != request.Fingerprint {
+		utils.SendErrorResponse(w, http.StatusUnprocessableEntity, "Idempotency-Key was already used for a different request")
+		return
+	}
+	if stored.Status != idempotencyCompleted {
+		w.Header().Set("Retry-After", "1")
+		utils.SendErrorResponse(w, http.StatusConflict, "A request with this Idempotency-Key is in progress")
+		return
+	}
+
+	if stored.ContentType != "" {
+		w.Header().Set("Content-Type", stored.ContentType)
+	}
+	w.Header().Set(HeaderIdempotentReplayed, "true")
+	w.WriteHeader(stored.StatusCode)
+	w.Write(stored.Body)
+}
+
+// idempotencyScope keeps callers from replaying each other's responses
+func idempotencyScope(r *http.Request) string {
+	if claims, ok := GetUserFromContext(r.Context()); ok {
+		return "user:" + claims.UserID
+	}
+	if identity, ok := GetIdentityFromContext(r.Context()); ok && identity.APIKeyID != "" {
+		return "key:" + identity.APIKeyID
+	}
+	return "anonymous"
+}
+
+func fingerprint(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// recordingWriter keeps a copy of the response it writes
+type recordingWriter struct {
+	http.ResponseWriter
+	statusCode  int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (rw *recordingWriter) WriteHeader(code int) {
+	if !rw.wroteHeader {
+		rw.statusCode = code
+		rw.wroteHeader = true
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *recordingWriter) Write(b []byte) (int, error) {
+	rw.wroteHeader = true
+	rw.body.Write(b)
+	return rw.ResponseWriter.Write(b)
+}
@@ -0,0 +1,281 @@
+package middleware
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/nats-io/nats.go"
+)
+
+// Identity headers the API Gateway sets on every request it forwards
+const (
+	HeaderUserID            = "X-User-Id"
+	HeaderUserEmail         = "X-User-Email"
+	HeaderUserRoles         = "X-User-Roles"
+	HeaderUserVerified      = "X-User-Email-Verified"
+	HeaderAPIKeyID          = "X-Api-Key-Id"
+	HeaderAPIKeyScopes      = "X-Api-Key-Scopes"
+	HeaderRequestID         = "X-Request-Id"
+	HeaderClientIP          = "X-Client-Ip"
+	HeaderIdentityTimestamp = "X-Identity-Timestamp"
+	HeaderIdentitySignature = "X-Identity-Signature"
+)
+
+var identityHeaders = []string{
+	HeaderUserID,
+	HeaderUserEmail,
+	HeaderUserRoles,
+	HeaderUserVerified,
+	HeaderAPIKeyID,
+	HeaderAPIKeyScopes,
+	HeaderClientIP,
+	HeaderIdentityTimestamp,
+	HeaderIdentitySignature,
+}
+
+// DefaultIdentityMaxAge is how old a signed identity may be when it arrives
+const DefaultIdentityMaxAge = time.Minute
+
+// messageMethod takes the place of the HTTP method in the signature of NATS
+// messages, so a signed message can't pass for a request
+const messageMethod = "NATS"
+
+var (
+	ErrIdentityMissing   = errors.New("identity headers missing")
+	ErrIdentityExpired   = errors.New("identity headers expired")
+	ErrIdentitySignature = errors.New("invalid identity signature")
+)
+
+// Identity is who a request was made by, as established by the gateway.
+// Machine clients are identified by an API key instead of a user.
+type Identity struct {
+	UserID    string
+	Email     string
+	Roles     []string
+	Verified  bool
+	APIKeyID  string
+	Scopes    []string
+	RequestID string
+	ClientIP  string
+}
+
+const IdentityContextKey contextKey = "identity"
+
+func WithIdentity(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, IdentityContextKey, identity)
+}
+
+func GetIdentityFromContext(ctx context.Context) (*Identity, bool) {
+	identity, ok := ctx.Value(IdentityContextKey).(*Identity)
+	return identity, ok
+}
+
+// IdentitySigner signs identity headers at the gateway and verifies them in
+// the services, with a secret shared between them. The signature covers the
+// method and path so the headers can't be replayed against another endpoint.
+type IdentitySigner struct {
+	secret []byte
+	maxAge time.Duration
+}
+
+func NewIdentitySigner(secret string) *IdentitySigner {
+	return &IdentitySigner{
+		secret: []byte(secret),
+		maxAge: DefaultIdentityMaxAge,
+	}
+}
+
+// StripIdentity removes identity headers, so clients can't spoof them
+func StripIdentity(h http.Header) {
+	for _, header := range identityHeaders {
+		h.Del(header)
+	}
+}
+
+// Sign replaces the identity headers of an outgoing request
+func (s *IdentitySigner) Sign(req *http.Request, identity *Identity) {
+	s.sign(req.Header, req.Method, req.URL.Path, identity)
+}
+
+// Verify checks the identity headers of an incoming request
+func (s *IdentitySigner) Verify(r *http.Request) (*Identity, error) {
+	return s.verify(r.Header, r.Method, r.URL.Path)
+}
+
+// SignMessage sets signed identity headers on a NATS message, services send
+// it as themselves with an empty identity. The signature covers the subject
+// and the data, so neither can be changed.
+func (s *IdentitySigner) SignMessage(msg *nats.Msg, identity *Identity) {
+	if msg.Header == nil {
+		msg.Header = nats.Header{}
+	}
+	s.sign(http.Header(msg.Header), messageMethod, messagePath(msg), identity)
+}
+
+// VerifyMessage checks the identity headers of a NATS message, which only a
+// holder of the secret can have signed
+func (s *IdentitySigner) VerifyMessage(msg *nats.Msg) (*Identity, error) {
+	return s.verify(http.Header(msg.Header), messageMethod, messagePath(msg))
+}
+
+// messagePath takes the place of the path of a request in the signature of
+// NATS messages, the subject along with a digest of the data
+func messagePath(msg *nats.Msg) string {
+	digest := sha256.Sum256(msg.Data)
+	return msg.Subject + "\n" + hex.EncodeToString(digest[:])
+}
+
+func (s *IdentitySigner) sign(header http.Header, method, path string, identity *Identity) {
+	StripIdentity(header)
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	if identity.UserID != "" {
+		header.Set(HeaderUserID, identity.UserID)
+		header.Set(HeaderUserEmail, identity.Email)
+		header.Set(HeaderUserRoles, strings.Join(identity.Roles, ","))
+		header.Set(HeaderUserVerified, strconv.FormatBool(identity.Verified))
+	}
+	if identity.APIKeyID != "" {
+		header.Set(HeaderAPIKeyID, identity.APIKeyID)
+		header.Set(HeaderAPIKeyScopes, strings.Join(identity.Scopes, ","))
+	}
+	if identity.RequestID != "" {
+		header.Set(HeaderRequestID, identity.RequestID)
+	}
+	header.Set(HeaderClientIP, identity.ClientIP)
+	header.Set(HeaderIdentityTimestamp, timestamp)
+	header.Set(HeaderIdentitySignature, s.signature(method, path, identity, timestamp))
+}
+
+func (s *IdentitySigner) verify(header http.Header, method, path string) (*Identity, error) {
+	signature := header.Get(HeaderIdentitySignature)
+	if signature == "" {
+		return nil, ErrIdentityMissing
+	}
+
+	timestamp := header.Get(HeaderIdentityTimestamp)
+	signedAt, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, ErrIdentitySignature
+	}
+	if age := time.Since(time.Unix(signedAt, 0)); age > s.maxAge || age < -s.maxAge {
+		return nil, ErrIdentityExpired
+	}
+
+	identity := &Identity{
+		UserID:    header.Get(HeaderUserID),
+		Email:     header.Get(HeaderUserEmail),
+		APIKeyID:  header.Get(HeaderAPIKeyID),
+		RequestID: header.Get(HeaderRequestID),
+		ClientIP:  header.Get(HeaderClientIP),
+	}
+	identity.Verified, _ = strconv.ParseBool(header.Get(HeaderUserVerified))
+	if roles := header.Get(HeaderUserRoles); roles != "" {
+		identity.Roles = strings.Split(roles, ",")
+	}
+	if scopes := header.Get(HeaderAPIKeyScopes); scopes != "" {
+		identity.Scopes = strings.Split(scopes, ",")
+	}
+
+	expected := s.signature(method, path, identity, timestamp)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return nil, ErrIdentitySignature
+	}
+	return identity, nil
+}
+
+func (s *IdentitySigner) signature(method, path string, identity *Identity, timestamp string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	for _, part := range []string{
+		"v2",
+		method,
+		path,
+		identity.UserID,
+		identity.Email,
+		strings.Join(identity.Roles, ","),
+		strconv.FormatBool(identity.Verified),
+		identity.APIKeyID,
+		strings.Join(identity.Scopes, ","),
+		identity.RequestID,
+		identity.ClientIP,
+		timestamp,
+	} {
+		mac.Write([]byte(part))
+		mac.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Middleware trusts the user of a request only when the gateway signed it.
+// Requests without a signature go through anonymously, requests with an
+// invalid one are rejected.
+func (s *IdentitySigner) Middleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			identity, err := s.Verify(r)
+			if errors.Is(err, ErrIdentityMissing) {
+				StripIdentity(r.Header)
+				next.ServeHTTP(w, r)
+				return
+			}
+			if err != nil {
+				sendUnauthorized(w, "Invalid identity")
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(ContextWithIdentity(r.Context(), identity)))
+		})
+	}
+}
+
+// ContextWithIdentity stores a verified identity in the context along with
+// the claims of its user, the way the permission checks expect them
+func ContextWithIdentity(ctx context.Context, identity *Identity) context.Context {
+	ctx = WithIdentity(ctx, identity)
+	if identity.UserID != "" {
+		ctx = context.WithValue(ctx, UserContextKey, &Claims{
+			UserID:        identity.UserID,
+			Email:         identity.Email,
+			Roles:         identity.Roles,
+			EmailVerified: identity.Verified,
+			RegisteredClaims: jwt.RegisteredClaims{
+				Subject: identity.UserID,
+			},
+		})
+	}
+	return ctx
+}
+
+// RequireAuth rejects requests that carry neither an authenticated user nor
+// an API key. The gateway already checked the scopes of the key.
+func RequireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, isUser := GetUserFromContext(r.Context())
+		identity, ok := GetIdentityFromContext(r.Context())
+		if !isUser && !(ok && identity.APIKeyID != "") {
+			sendUnauthorized(w, "Authentication required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireVerifiedEmail rejects users who haven't verified their email yet.
+// API keys act for users the platform already trusts and go through.
+func RequireVerifiedEmail(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if claims, ok := GetUserFromContext(r.Context()); ok && !claims.EmailVerified {
+			sendForbidden(w, "Email verification required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
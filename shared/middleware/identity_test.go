@@ -0,0 +1,275 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+func testIdentity() *Identity {
+	return &Identity{
+		UserID:    "64f1c2a9e4b0a1b2c3d4e5f6",
+		Email:     "ada@example.com",
+		Roles:     []string{RoleCustomer, RoleStaff},
+		Verified:  true,
+		RequestID: "gateway/abc-000001",
+		ClientIP:  "203.0.113.7",
+	}
+}
+
+func signedRequest(t *testing.T, signer *IdentitySigner, method, path string, identity *Identity) *http.Request {
+	t.Helper()
+	req := httptest.NewRequest(method, path, nil)
+	signer.Sign(req, identity)
+	return req
+}
+
+func TestIdentitySignerRoundTrip(t *testing.T) {
+	signer := NewIdentitySigner(testSecret)
+	tests := []struct {
+		name     string
+		identity *Identity
+	}{
+		{name: "user", identity: testIdentity()},
+		{name: "api key", identity: &Identity{APIKeyID: "64f1c2a9e4b0a1b2c3d4e5f7", Scopes: []string{"orders:read", "orders:write"}, ClientIP: "203.0.113.8"}},
+		{name: "anonymous", identity: &Identity{ClientIP: "203.0.113.9"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := signedRequest(t, signer, http.MethodPost, "/api/v1/orders", tt.identity)
+			got, err := signer.Verify(req)
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.identity) {
+				t.Fatalf("got %+v, want %+v", got, tt.identity)
+			}
+		})
+	}
+}
+
+func TestIdentitySignerRejectsTamperedHeaders(t *testing.T) {
+	signer := NewIdentitySigner(testSecret)
+	tests := []struct {
+		header string
+		value  string
+	}{
+		{HeaderUserID, "64f1c2a9e4b0a1b2c3d4e5f0"},
+		{HeaderUserEmail, "mallory@example.com"},
+		{HeaderUserRoles, RoleAdmin},
+		{HeaderUserVerified, "false"},
+		{HeaderAPIKeyID, "64f1c2a9e4b0a1b2c3d4e5f7"},
+		{HeaderAPIKeyScopes, "orders:write"},
+		{HeaderRequestID, "gateway/abc-000002"},
+		{HeaderClientIP, "198.51.100.1"},
+		{HeaderIdentityTimestamp, strconv.FormatInt(time.Now().Unix()-1, 10)},
+		{HeaderIdentitySignature, "00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			req := signedRequest(t, signer, http.MethodGet, "/api/v1/orders/me", testIdentity())
+			req.Header.Set(tt.header, tt.value)
+			if _, err := signer.Verify(req); !errors.Is(err, ErrIdentitySignature) {
+				t.Fatalf("got %v, want %v", err, ErrIdentitySignature)
+			}
+		})
+	}
+}
+
+func TestIdentitySignerRejectsOtherEndpoints(t *testing.T) {
+	signer := NewIdentitySigner(testSecret)
+	tests := []struct {
+		name   string
+		method string
+		path   string
+	}{
+		{name: "other method", method: http.MethodDelete, path: "/api/v1/orders/1"},
+		{name: "other path", method: http.MethodGet, path: "/api/v1/orders/2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signed := signedRequest(t, signer, http.MethodGet, "/api/v1/orders/1", testIdentity())
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header = signed.Header.Clone()
+			if _, err := signer.Verify(req); !errors.Is(err, ErrIdentitySignature) {
+				t.Fatalf("got %v, want %v", err, ErrIdentitySignature)
+			}
+		})
+	}
+}
+
+func TestIdentitySignerRejectsOtherSecret(t *testing.T) {
+	req := signedRequest(t, NewIdentitySigner(testSecret), http.MethodGet, "/api/v1/payments/me", testIdentity())
+	if _, err := NewIdentitySigner("fedcba9876543210fedcba9876543210").Verify(req); !errors.Is(err, ErrIdentitySignature) {
+		t.Fatalf("got %v, want %v", err, ErrIdentitySignature)
+	}
+}
+
+func TestIdentitySignerExpiry(t *testing.T) {
+	tests := []struct {
+		name string
+		age  time.Duration
+		want error
+	}{
+		{name: "fresh", age: 0, want: nil},
+		{name: "within the max age", age: DefaultIdentityMaxAge - 5*time.Second, want: nil},
+		{name: "expired", age: DefaultIdentityMaxAge + 5*time.Second, want: ErrIdentityExpired},
+		{name: "from the future", age: -DefaultIdentityMaxAge - 5*time.Second, want: ErrIdentityExpired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signer := NewIdentitySigner(testSecret)
+			identity := testIdentity()
+			// Sign the way the gateway would have at the time
+			timestamp := strconv.FormatInt(time.Now().Add(-tt.age).Unix(), 10)
+			req := signedRequest(t, signer, http.MethodGet, "/api/v1/orders/me", identity)
+			req.Header.Set(HeaderIdentityTimestamp, timestamp)
+			req.Header.Set(HeaderIdentitySignature, signer.signature(req.Method, req.URL.Path, identity, timestamp))
+
+			if _, err := signer.Verify(req); !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestIdentitySignerMissing(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/orders/me", nil)
+	req.Header.Set(HeaderUserID, "64f1c2a9e4b0a1b2c3d4e5f6")
+	if _, err := NewIdentitySigner(testSecret).Verify(req); !errors.Is(err, ErrIdentityMissing) {
+		t.Fatalf("got %v, want %v", err, ErrIdentityMissing)
+	}
+}
+
+func TestIdentitySignerMiddleware(t *testing.T) {
+	signer := NewIdentitySigner(testSecret)
+	tests := []struct {
+		name       string
+		request    func() *http.Request
+		wantStatus int
+		wantUser   string
+	}{
+		{
+			name: "signed",
+			request: func() *http.Request {
+				return signedRequest(t, signer, http.MethodGet, "/api/v1/orders/me", testIdentity())
+			},
+			wantStatus: http.StatusOK,
+			wantUser:   testIdentity().UserID,
+		},
+		{
+			name: "spoofed headers without a signature are stripped",
+			request: func() *http.Request {
+				req := httptest.NewRequest(http.MethodGet, "/api/v1/orders/me", nil)
+				req.Header.Set(HeaderUserID, "64f1c2a9e4b0a1b2c3d4e5f6")
+				req.Header.Set(HeaderUserRoles, RoleAdmin)
+				req.Header.Set(HeaderClientIP, "127.0.0.1")
+				return req
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "spoofed headers with a forged signature are rejected",
+			request: func() *http.Request {
+				req := signedRequest(t, signer, http.MethodGet, "/api/v1/orders/me", testIdentity())
+				req.Header.Set(HeaderUserRoles, RoleAdmin)
+				return req
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen *http.Request
+			handler := signer.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = r
+			}))
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, tt.request())
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			claims, ok := GetUserFromContext(seen.Context())
+			if tt.wantUser == "" {
+				if ok {
+					t.Fatalf("spoofed headers made a user %s", claims.UserID)
+				}
+				for _, header := range identityHeaders {
+					if value := seen.Header.Get(header); value != "" {
+						t.Fatalf("spoofed %s: %s reached the handler", header, value)
+					}
+				}
+				return
+			}
+			if !ok || claims.UserID != tt.wantUser {
+				t.Fatalf("got user %v, want %s", claims, tt.wantUser)
+			}
+		})
+	}
+}
+
+func TestRequireAuthNeedsSignedIdentity(t *testing.T) {
+	signer := NewIdentitySigner(testSecret)
+	handler := signer.Middleware()(RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+	spoofed := httptest.NewRequest(http.MethodGet, "/api/v1/payments/me", nil)
+	spoofed.Header.Set(HeaderUserID, "64f1c2a9e4b0a1b2c3d4e5f6")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, spoofed)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("unsigned request: status %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, signedRequest(t, signer, http.MethodGet, "/api/v1/payments/me", testIdentity()))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("signed request: status %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestIdentitySignerMessages(t *testing.T) {
+	signer := NewIdentitySigner(testSecret)
+	sign := func() *nats.Msg {
+		msg := nats.NewMsg("user.address.resolve")
+		msg.Data = []byte(`{"user_id":"64f1c2a9e4b0a1b2c3d4e5f6"}`)
+		signer.SignMessage(msg, testIdentity())
+		return msg
+	}
+
+	if _, err := signer.VerifyMessage(sign()); err != nil {
+		t.Fatalf("signed message: %v", err)
+	}
+
+	tampered := sign()
+	tampered.Data = []byte(`{"user_id":"64f1c2a9e4b0a1b2c3d4e5f0"}`)
+	if _, err := signer.VerifyMessage(tampered); !errors.Is(err, ErrIdentitySignature) {
+		t.Fatalf("tampered data: got %v, want %v", err, ErrIdentitySignature)
+	}
+
+	redirected := sign()
+	redirected.Subject = "service.heartbeat"
+	if _, err := signer.VerifyMessage(redirected); !errors.Is(err, ErrIdentitySignature) {
+		t.Fatalf("other subject: got %v, want %v", err, ErrIdentitySignature)
+	}
+
+	if _, err := signer.VerifyMessage(nats.NewMsg("user.address.resolve")); !errors.Is(err, ErrIdentityMissing) {
+		t.Fatalf("unsigned message: got %v, want %v", err, ErrIdentityMissing)
+	}
+}
@@ -0,0 +1,251 @@
+package middleware
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Algorithms access tokens can be signed with
+const (
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+var signingAlgorithms = []string{AlgorithmRS256, AlgorithmEdDSA}
+
+const (
+	// jwksMaxAge is how long fetched keys are used before the key set is
+	// fetched again
+	jwksMaxAge = 5 * time.Minute
+	// jwksMinRefreshInterval keeps tokens with unknown key IDs from making
+	// a RemoteKeySet fetch the key set on every request
+	jwksMinRefreshInterval = 10 * time.Second
+	jwksFetchTimeout       = 5 * time.Second
+	rsaKeyBits             = 2048
+)
+
+var (
+	ErrUnknownSigningKey    = errors.New("unknown signing key")
+	ErrUnsupportedAlgorithm = errors.New("unsupported signing algorithm")
+)
+
+// SigningKey is the private key tokens are signed with, ID is the kid header
+// of the tokens
+type SigningKey struct {
+	ID     string
+	Method jwt.SigningMethod
+	Key    crypto.Signer
+}
+
+// TokenSigner hands out the key to sign tokens with
+type TokenSigner interface {
+	SigningKey() (*SigningKey, error)
+}
+
+// KeySet finds the public key a token was signed with by its key ID
+type KeySet interface {
+	PublicKey(keyID string) (crypto.PublicKey, error)
+}
+
+// GenerateSigningKey returns a new private key for algorithm
+func GenerateSigningKey(algorithm string) (crypto.Signer, error) {
+	switch algorithm {
+	case AlgorithmEdDSA:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	case AlgorithmRS256:
+		return rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	}
+	return nil, ErrUnsupportedAlgorithm
+}
+
+// JWK is a public key as published in a JSON Web Key Set
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use,omitempty"`
+	Algorithm string `json:"alg,omitempty"`
+	// Curve and X hold Ed25519 keys
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+	// N and E hold RSA keys
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewJWK describes the public key of a signing key
+func NewJWK(keyID string, key crypto.PublicKey) (JWK, error) {
+	switch key := key.(type) {
+	case ed25519.PublicKey:
+		return JWK{
+			KeyType:   "OKP",
+			KeyID:     keyID,
+			Use:       "sig",
+			Algorithm: AlgorithmEdDSA,
+			Curve:     "Ed25519",
+			X:         base64.RawURLEncoding.EncodeToString(key),
+		}, nil
+	case *rsa.PublicKey:
+		return JWK{
+			KeyType:   "RSA",
+			KeyID:     keyID,
+			Use:       "sig",
+			Algorithm: AlgorithmRS256,
+			N:         base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}, nil
+	}
+	return JWK{}, fmt.Errorf("unsupported key type %T", key)
+}
+
+// PublicKey decodes the key
+func (k JWK) PublicKey() (crypto.PublicKey, error) {
+	switch {
+	case k.KeyType == "OKP" && k.Curve == "Ed25519":
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key %s", k.KeyID)
+		}
+		return ed25519.PublicKey(x), nil
+	case k.KeyType == "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA key %s", k.KeyID)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("invalid RSA key %s", k.KeyID)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %s", k.KeyType)
+}
+
+// RemoteKeySet is a key set published at a URL, by the user service or an
+// OpenID Connect provider, fetched again when it gets old or a token names a
+// key it doesn't have yet. Known keys keep working while the key set can't
+// be fetched.
+type RemoteKeySet struct {
+	url    string
+	client *http.Client
+
+	// fetchMu lets one request fetch the key set while the others wait
+	fetchMu sync.Mutex
+
+	mu          sync.RWMutex
+	keys        map[string]crypto.PublicKey
+	fetchedAt   time.Time
+	attemptedAt time.Time
+}
+
+func NewRemoteKeySet(url string) *RemoteKeySet {
+	return &RemoteKeySet{
+		url:    url,
+		client: &http.Client{Timeout: jwksFetchTimeout},
+		keys:   make(map[string]crypto.PublicKey),
+	}
+}
+
+func (s *RemoteKeySet) PublicKey(keyID string) (crypto.PublicKey, error) {
+	key, known, fresh := s.lookup(keyID)
+	if known && fresh {
+		return key, nil
+	}
+
+	if err := s.refresh(); err != nil {
+		if known {
+			return key, nil
+		}
+		return nil, err
+	}
+	if key, known, _ = s.lookup(keyID); !known {
+		return nil, ErrUnknownSigningKey
+	}
+	return key, nil
+}
+
+func (s *RemoteKeySet) lookup(keyID string) (key crypto.PublicKey, known, fresh bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	key, known = s.keys[keyID]
+	return key, known, time.Since(s.fetchedAt) < jwksMaxAge
+}
+
+func (s *RemoteKeySet) refresh() error {
+	s.fetchMu.Lock()
+	defer s.fetchMu.Unlock()
+
+	s.mu.Lock()
+	if time.Since(s.attemptedAt) < jwksMinRefreshInterval {
+		s.mu.Unlock()
+		return nil
+	}
+	s.attemptedAt = time.Now()
+	s.mu.Unlock()
+
+	keys, err := s.fetch()
+	if err != nil {
+		log.Printf("Failed to fetch signing keys from %s: %v", s.url, err)
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = keys
+	s.fetchedAt = time.Now()
+	return nil
+}
+
+func (s *RemoteKeySet) fetch() (map[string]crypto.PublicKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), jwksFetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	var set JWKSet
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.PublicKey()
+		if err != nil {
+			log.Printf("Ignoring signing key: %v", err)
+			continue
+		}
+		keys[jwk.KeyID] = key
+	}
+	return keys, nil
+}
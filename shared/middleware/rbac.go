@@ -0,0 +1,152 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+)
+
+// Roles a user can hold, users without any are customers
+const (
+	RoleCustomer = "customer"
+	RoleMerchant = "merchant"
+	RoleStaff    = "staff"
+	RoleAdmin    = "admin"
+)
+
+var Roles = []string{RoleCustomer, RoleMerchant, RoleStaff, RoleAdmin}
+
+// Permissions guard the endpoints beyond what every user may do, like acting
+// on resources of other users. API keys hold a permission through the scope
+// of the same name.
+const (
+	PermissionUsersRead      = "users:read"
+	PermissionUsersWrite     = "users:write"
+	PermissionRolesManage    = "roles:manage"
+	PermissionProductsWrite  = "products:write"
+	PermissionOrdersRead     = "orders:read"
+	PermissionOrdersWrite    = "orders:write"
+	PermissionOrdersManage   = "orders:manage"
+	PermissionPaymentsRead   = "payments:read"
+	PermissionPaymentsWrite  = "payments:write"
+	PermissionPaymentsRefund = "payments:refund"
+)
+
+var (
+	ErrForbidden = errors.New("insufficient permissions")
+	// ErrOwnerRequired is returned when an API key acts without naming the
+	// user it acts for
+	ErrOwnerRequired = errors.New("owner required")
+)
+
+var rolePermissions = map[string][]string{
+	RoleCustomer: {},
+	RoleMerchant: {PermissionProductsWrite},
+	RoleStaff: {
+		PermissionUsersRead,
+		PermissionProductsWrite,
+		PermissionOrdersRead,
+		PermissionOrdersWrite,
+		PermissionOrdersManage,
+		PermissionPaymentsRead,
+		PermissionPaymentsWrite,
+		PermissionPaymentsRefund,
+	},
+	RoleAdmin: {
+		PermissionUsersRead,
+		PermissionUsersWrite,
+		PermissionRolesManage,
+		PermissionProductsWrite,
+		PermissionOrdersRead,
+		PermissionOrdersWrite,
+		PermissionOrdersManage,
+		PermissionPaymentsRead,
+		PermissionPaymentsWrite,
+		PermissionPaymentsRefund,
+	},
+}
+
+// IsRole reports whether role is one of Roles
+func IsRole(role string) bool {
+	return slices.Contains(Roles, role)
+}
+
+// HasPermission reports whether any of roles grants permission
+func HasPermission(roles []string, permission string) bool {
+	for _, role := range roles {
+		if slices.Contains(rolePermissions[role], permission) {
+			return true
+		}
+	}
+	return false
+}
+
+// Can reports whether the caller holds permission, through the roles of its
+// user or the scopes of its API key
+func Can(ctx context.Context, permission string) bool {
+	if claims, ok := GetUserFromContext(ctx); ok {
+		return HasPermission(claims.Roles, permission)
+	}
+	identity, ok := GetIdentityFromContext(ctx)
+	return ok && identity.APIKeyID != "" && slices.Contains(identity.Scopes, permission)
+}
+
+// CanAccess reports whether the caller may act on a resource of ownerID,
+// which takes being its owner or holding permission
+func CanAccess(ctx context.Context, ownerID, permission string) bool {
+	if claims, ok := GetUserFromContext(ctx); ok && ownerID != "" && claims.UserID == ownerID {
+		return true
+	}
+	return Can(ctx, permission)
+}
+
+// ResolveOwner returns the user the caller acts for when creating a resource.
+// Users act for themselves unless they hold permission, API keys for the
+// requested user.
+func ResolveOwner(ctx context.Context, requested, permission string) (string, error) {
+	if claims, ok := GetUserFromContext(ctx); ok {
+		if requested == "" || requested == claims.UserID {
+			return claims.UserID, nil
+		}
+		if !HasPermission(claims.Roles, permission) {
+			return "", ErrForbidden
+		}
+		return requested, nil
+	}
+	if !Can(ctx, permission) {
+		return "", ErrForbidden
+	}
+	if requested == "" {
+		return "", ErrOwnerRequired
+	}
+	return requested, nil
+}
+
+// RequirePermission lets through users whose roles grant permission and API
+// keys holding it as a scope
+func RequirePermission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if claims, ok := GetUserFromContext(r.Context()); ok {
+				if !HasPermission(claims.Roles, permission) {
+					sendForbidden(w, "Insufficient permissions")
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			identity, ok := GetIdentityFromContext(r.Context())
+			if !ok || identity.APIKeyID == "" {
+				sendUnauthorized(w, "Authentication required")
+				return
+			}
+			if !slices.Contains(identity.Scopes, permission) {
+				sendForbidden(w, "Insufficient permissions")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -15,9 +15,16 @@ const (
 	UserCreatedEvent         = "user.created"
 	UserDeletedEvent         = "user.deleted"
 	UserUpdatedEvent         = "user.updated"
+	UserPasswordResetEvent   = "user.password_reset_requested"
+	UserVerificationEvent    = "user.verification_requested"
+	UserLoginFailedEvent     = "user.login_failed"
+	UserLockedEvent          = "user.locked"
+	UserIdentityLinkedEvent  = "user.identity_linked"
+	UserAddressResolveEvent  = "user.address.resolve"
 	ProductCreatedEvent      = "product.created"
 	ProductUpdatedEvent      = "product.updated"
 	ProductStockUpdatedEvent = "product.stock.updated"
+	ProductDeletedEvent      = "product.deleted"
 	OrderCreatedEvent        = "order.created"
 	OrderCancelledEvent      = "order.cancelled"
 	OrderUpdatedEvent        = "order.updated"
@@ -26,4 +33,6 @@ const (
 	StockCheckEvent          = "stock.check"
 	StockReserveEvent        = "stock.reserve"
 	StockCheckResponseEvent  = "stock.check.response"
+	ServiceHeartbeatEvent    = "service.heartbeat"
+	ServiceDeregisteredEvent = "service.deregistered"
 )
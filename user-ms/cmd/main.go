@@ -10,13 +10,18 @@ import (
 	"syscall"
 	"time"
 
+	_ "github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/docs"
 	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/application/service"
+	userConfig "github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/config"
 	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/infrastructure/messaging"
+	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/infrastructure/oidc"
 	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/infrastructure/repository"
 	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/interfaces/http/handler"
 	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/interfaces/http/router"
+	addressMessaging "github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/interfaces/messaging"
 	"github.com/kaleabAlemayehu/eagle-commerce/shared/config"
 	"github.com/kaleabAlemayehu/eagle-commerce/shared/database"
+	"github.com/kaleabAlemayehu/eagle-commerce/shared/discovery"
 	sharedMessaging "github.com/kaleabAlemayehu/eagle-commerce/shared/messaging"
 	sharedMiddleware "github.com/kaleabAlemayehu/eagle-commerce/shared/middleware"
 )
@@ -28,6 +33,7 @@ import (
 // @BasePath /api/v1
 func main() {
 	cfg := config.Load()
+	userCfg := userConfig.Load()
 
 	// Connect to MongoDB
 	db, err := database.NewMongoDB(cfg.MongoDB.URI, cfg.MongoDB.Database)
@@ -45,14 +51,82 @@ func main() {
 	// listening for the incoming events from other services
 	messaging.NewUserEventHandler(natsClient).StartListening()
 
+	// Revoked access tokens, shared with every service
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	denylistKV, err := natsClient.KeyValue(cfg.Tokens.DenylistBucket, cfg.Tokens.AccessTTL)
+	if err != nil {
+		log.Fatal("Failed to open token denylist:", err)
+	}
+	denylist := sharedMiddleware.NewDenylist(denylistKV)
+	if err := denylist.Start(ctx); err != nil {
+		log.Fatal("Failed to load token denylist:", err)
+	}
+
 	// Initialize dependencies
 	userRepo := repository.NewMongoUserRepository(db.Database)
-	auth := sharedMiddleware.NewAuth(cfg.JWTSecret)
-	userService := service.NewUserService(userRepo, nats, auth)
+	refreshTokenRepo, err := repository.NewMongoRefreshTokenRepository(ctx, db.Database)
+	if err != nil {
+		log.Fatal("Failed to create refresh token store:", err)
+	}
+	passwordResetRepo, err := repository.NewMongoPasswordResetRepository(ctx, db.Database)
+	if err != nil {
+		log.Fatal("Failed to create password reset token store:", err)
+	}
+	verificationRepo, err := repository.NewMongoVerificationRepository(ctx, db.Database)
+	if err != nil {
+		log.Fatal("Failed to create verification token store:", err)
+	}
+	loginAttemptRepo, err := repository.NewMongoLoginAttemptRepository(ctx, db.Database)
+	if err != nil {
+		log.Fatal("Failed to create login attempt store:", err)
+	}
+	loginChallengeRepo, err := repository.NewMongoLoginChallengeRepository(ctx, db.Database)
+	if err != nil {
+		log.Fatal("Failed to create login challenge store:", err)
+	}
+	oidcStateRepo, err := repository.NewMongoOIDCStateRepository(ctx, db.Database)
+	if err != nil {
+		log.Fatal("Failed to create OIDC state store:", err)
+	}
+	addressRepo, err := repository.NewMongoAddressRepository(ctx, db.Database)
+	if err != nil {
+		log.Fatal("Failed to create address book:", err)
+	}
+	providers, err := oidc.NewProviders(userCfg.OIDC.Providers)
+	if err != nil {
+		log.Fatal("Invalid OIDC provider config:", err)
+	}
+	signingKeyRepo, err := repository.NewMongoSigningKeyRepository(ctx, db.Database)
+	if err != nil {
+		log.Fatal("Failed to create signing key store:", err)
+	}
+	signingKeys, err := service.NewSigningKeys(signingKeyRepo, cfg.Tokens.SigningAlgorithm, cfg.Tokens.KeyRotation, cfg.Tokens.AccessTTL, cfg.Tokens.KeyEncryptionKey)
+	if err != nil {
+		log.Fatal("Invalid token signing config:", err)
+	}
+	if err := signingKeys.Start(ctx); err != nil {
+		log.Fatal("Failed to load signing keys:", err)
+	}
+	auth := sharedMiddleware.NewAuth(signingKeys).WithSigner(signingKeys).WithAccessTokenTTL(cfg.Tokens.AccessTTL).WithDenylist(denylist)
+	userService := service.NewUserService(userRepo, refreshTokenRepo, passwordResetRepo, verificationRepo, loginAttemptRepo, loginChallengeRepo, oidcStateRepo, addressRepo, providers, nats, auth, denylist, cfg.Tokens.RefreshTTL, userCfg)
 	userHandler := handler.NewUserHandler(userService)
+	jwksHandler := handler.NewJWKSHandler(signingKeys)
+
+	// Answer the address lookups of order-ms
+	identitySigner := sharedMiddleware.NewIdentitySigner(cfg.InternalSecret)
+	if err := addressMessaging.NewAddressHandler(userService, natsClient, identitySigner).StartListening(); err != nil {
+		log.Fatal("Failed to listen for address requests:", err)
+	}
+
+	if userCfg.BootstrapAdminEmail != "" {
+		if err := userService.GrantAdmin(ctx, userCfg.BootstrapAdminEmail); err != nil {
+			log.Printf("Failed to make %s an admin: %v", userCfg.BootstrapAdminEmail, err)
+		}
+	}
 
 	// Setup router
-	r := router.NewRouter(userHandler, auth)
+	r := router.NewRouter(userHandler, jwksHandler, identitySigner)
 
 	// Start server
 	port := "8081"
@@ -60,19 +134,30 @@ func main() {
 		Addr:    ":" + port,
 		Handler: r,
 	}
+
+	// Announce this instance to the api-gateway
+	announcer := discovery.NewAnnouncer(natsClient, identitySigner, discovery.Instance{
+		Service: "user",
+		URL:     discovery.AdvertiseURL(cfg, port),
+		Version: cfg.Service.Version,
+	}, discovery.DefaultHeartbeatInterval)
+	announcer.Start()
+
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
 	go func() {
 		log.Printf("User service starting on port %s\n", port)
-		if err := server.ListenAndServe(); err != nil && errors.Is(err, http.ErrServerClosed) {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			log.Fatalf("ListenAndServe Error: %v ", err)
 		}
 	}()
 	<-stop
 	log.Println("Shutting down gracefully...")
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-	defer cancel()
-	if err := server.Shutdown(ctx); err != nil {
+	announcer.Stop()
+	cancel()
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer shutdownCancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
 		log.Printf("HTTP server Shutdown error: %v", err)
 	}
 	natsClient.Close()
@@ -27,9 +27,17 @@ type UserResponse struct {
 	Email     string      `json:"email"`
 	FirstName string      `json:"first_name"`
 	LastName  string      `json:"last_name"`
+	Roles     []string    `json:"roles"`
 	Address   *AddressDTO `json:"address,omitempty"`
 	CreatedAt time.Time   `json:"created_at"`
 	UpdatedAt time.Time   `json:"updated_at"`
+	// EmailVerified is false until the user verified their email, orders
+	// need a verified email
+	EmailVerified     bool `json:"email_verified"`
+	TwoFactorEnabled  bool `json:"two_factor_enabled"`
+	TwoFactorRequired bool `json:"two_factor_required"`
+	// Providers are the OpenID Connect providers the user logs in with
+	Providers []string `json:"providers,omitempty"`
 }
 
 type AddressDTO struct {
@@ -40,6 +48,34 @@ type AddressDTO struct {
 	Country string `json:"country"`
 }
 
+type SavedAddressRequest struct {
+	// Label tells the addresses apart, like home or work
+	Label   string `json:"label" validate:"required,max=50"`
+	Street  string `json:"street" validate:"required"`
+	City    string `json:"city" validate:"required"`
+	State   string `json:"state" validate:"required"`
+	ZipCode string `json:"zip_code" validate:"required"`
+	Country string `json:"country" validate:"required"`
+	// Flagging an address as a default takes the flag from the user's other
+	// addresses
+	DefaultShipping bool `json:"default_shipping"`
+	DefaultBilling  bool `json:"default_billing"`
+}
+
+type SavedAddressResponse struct {
+	ID              string    `json:"id"`
+	Label           string    `json:"label"`
+	Street          string    `json:"street"`
+	City            string    `json:"city"`
+	State           string    `json:"state"`
+	ZipCode         string    `json:"zip_code"`
+	Country         string    `json:"country"`
+	DefaultShipping bool      `json:"default_shipping"`
+	DefaultBilling  bool      `json:"default_billing"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
 type LoginRequest struct {
 	Email    string `json:"email" validate:"required,email"`
 	Password string `json:"password" validate:"required"`
@@ -48,6 +84,57 @@ type LoginRequest struct {
 type AuthResponse struct {
 	User  *UserResponse `json:"user"`
 	Token string        `json:"token"`
+	// RefreshToken trades for new tokens once at /users/refresh
+	RefreshToken string `json:"refresh_token"`
+	// ExpiresAt is when Token expires
+	ExpiresAt time.Time `json:"expires_at"`
+	// RecoveryCodes are shown once, when a second factor was enrolled while
+	// logging in
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
+
+// TwoFactorChallengeResponse answers a valid password when the login needs
+// a second factor, ChallengeToken trades for tokens at /users/login/two-factor
+type TwoFactorChallengeResponse struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	ChallengeToken    string `json:"challenge_token"`
+	// EnrollmentRequired is set when a second factor has to be enrolled at
+	// /users/login/two-factor/enroll first
+	EnrollmentRequired bool      `json:"enrollment_required"`
+	ExpiresAt          time.Time `json:"expires_at"`
+}
+
+type LoginProviderResponse struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+}
+
+type OIDCAuthorizeRequest struct {
+	// RedirectURI is the page the provider sends the user back to, one of
+	// the redirect URIs configured for it. Defaults to the first.
+	RedirectURI string `json:"redirect_uri,omitempty"`
+}
+
+// OIDCAuthorizeResponse is where to send the user to log in with a provider.
+// The provider sends them back with the state and a code, to present at
+// /users/login/oidc/{provider}/callback.
+type OIDCAuthorizeResponse struct {
+	AuthorizationURL string    `json:"authorization_url"`
+	State            string    `json:"state"`
+	ExpiresAt        time.Time `json:"expires_at"`
+}
+
+type OIDCCallbackRequest struct {
+	State string `json:"state" validate:"required"`
+	Code  string `json:"code" validate:"required"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
 }
 
 type UserListResponse struct {
@@ -59,3 +146,42 @@ type ChangePasswordRequest struct {
 	CurrentPassword string `json:"current_password" validate:"required"`
 	NewPassword     string `json:"new_password" validate:"required,min=6"`
 }
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required,min=6"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	// Code is a TOTP code or a recovery code
+	Code string `json:"code" validate:"required"`
+}
+
+type TwoFactorEnrollRequest struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+}
+
+type TwoFactorEnrollmentResponse struct {
+	Secret string `json:"secret"`
+	// ProvisioningURI is the otpauth:// URI authenticator apps scan as a
+	// QR code
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+type TwoFactorCodeRequest struct {
+	// Code is a TOTP code, or a recovery code where one is accepted
+	Code string `json:"code" validate:"required"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/domain"
+	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/infrastructure/repository"
+)
+
+// maxAddresses is how many addresses the address book of a user holds
+const maxAddresses = 20
+
+var (
+	ErrAddressNotFound = errors.New("address not found")
+	ErrAddressBookFull = errors.New("address book full")
+)
+
+func (s *UserServiceImpl) ListAddresses(ctx context.Context, userID string) ([]*domain.SavedAddress, error) {
+	return s.addresses.List(ctx, userID)
+}
+
+func (s *UserServiceImpl) GetAddress(ctx context.Context, userID, id string) (*domain.SavedAddress, error) {
+	address, err := s.addresses.Get(ctx, userID, id)
+	if errors.Is(err, repository.ErrorAddressNotFound) {
+		return nil, ErrAddressNotFound
+	}
+	return address, err
+}
+
+func (s *UserServiceImpl) AddAddress(ctx context.Context, userID string, address *domain.SavedAddress) (*domain.SavedAddress, error) {
+	count, err := s.addresses.Count(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if count >= maxAddresses {
+		return nil, ErrAddressBookFull
+	}
+	if count == 0 {
+		address.DefaultShipping = true
+		address.DefaultBilling = true
+	}
+
+	address.UserID = userID
+	if err := s.addresses.Create(ctx, address); err != nil {
+		return nil, err
+	}
+	return address, nil
+}
+
+func (s *UserServiceImpl) UpdateAddress(ctx context.Context, userID, id string, address *domain.SavedAddress) (*domain.SavedAddress, error) {
+	existing, err := s.GetAddress(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	address.ID = existing.ID
+	address.UserID = userID
+	updated, err := s.addresses.Update(ctx, address)
+	if errors.Is(err, repository.ErrorAddressNotFound) {
+		return nil, ErrAddressNotFound
+	}
+	return updated, err
+}
+
+// DeleteAddress removes an address, the oldest remaining address becomes the
+// default in its place
+func (s *UserServiceImpl) DeleteAddress(ctx context.Context, userID, id string) error {
+	err := s.addresses.Delete(ctx, userID, id)
+	if errors.Is(err, repository.ErrorAddressNotFound) {
+		return ErrAddressNotFound
+	}
+	return err
+}
+
+func (s *UserServiceImpl) ResolveShippingAddress(ctx context.Context, userID, id string) (*domain.SavedAddress, error) {
+	if id != "" {
+		return s.GetAddress(ctx, userID, id)
+	}
+	address, err := s.addresses.GetDefaultShipping(ctx, userID)
+	if errors.Is(err, repository.ErrorAddressNotFound) {
+		return nil, ErrAddressNotFound
+	}
+	return address, err
+}
@@ -0,0 +1,209 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	argon "github.com/alexedwards/argon2id"
+
+	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/domain"
+	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/infrastructure/repository"
+)
+
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// Scopes of a lockout
+const (
+	LockoutAccount = "account"
+	LockoutIP      = "ip"
+)
+
+// LoginThrottledError is returned for logins attempted before RetryAfter
+// has passed, because of earlier failures or a lockout
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+	// Locked is set when the account or client IP is locked out, rather
+	// than waiting out a delay
+	Locked bool
+}
+
+func (e *LoginThrottledError) Error() string {
+	if e.Locked {
+		return fmt.Sprintf("login locked out, retry after %s", e.RetryAfter)
+	}
+	return fmt.Sprintf("too many failed logins, retry after %s", e.RetryAfter)
+}
+
+// dummyHash is compared with the passwords of unknown emails, so that they
+// take as long to fail as wrong passwords
+var dummyHash = sync.OnceValue(func() string {
+	hash, err := argon.CreateHash("dummy-password", argon.DefaultParams)
+	if err != nil {
+		log.Printf("Failed to create dummy password hash: %v", err)
+	}
+	return hash
+})
+
+func (s *UserServiceImpl) AuthenticateUser(ctx context.Context, email, password, clientIP string) (*domain.LoginResult, error) {
+	accountKey, ipKey := loginKeys(email, clientIP)
+	// Unknown emails are throttled like any other, so that the responses
+	// don't tell them apart
+	if err := s.checkLogin(ctx, accountKey, ipKey); err != nil {
+		return nil, err
+	}
+
+	user, err := s.repo.GetByEmail(ctx, email)
+	if err != nil && !errors.Is(err, repository.ErrorUserNotFound) {
+		return nil, err
+	}
+	hash := dummyHash()
+	if user != nil {
+		hash = user.Password
+	}
+	match, err := argon.ComparePasswordAndHash(password, hash)
+	if err != nil || !match || user == nil {
+		var userID string
+		if user != nil {
+			userID = user.ID.Hex()
+		}
+		if err := s.recordLoginFailure(ctx, email, userID, clientIP); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidCredentials
+	}
+
+	// The failures are kept until the second factor is presented too
+	if user.TwoFactorEnabled() || s.twoFactorRequired(user) {
+		challenge, err := s.createChallenge(ctx, user)
+		if err != nil {
+			return nil, err
+		}
+		return &domain.LoginResult{Challenge: challenge}, nil
+	}
+
+	// Failures from the client IP are kept, a credential stuffer getting
+	// some passwords right shouldn't start over
+	if err := s.attempts.Reset(ctx, accountKey); err != nil {
+		return nil, err
+	}
+	tokens, err := s.issueTokens(ctx, user, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.LoginResult{User: user, Tokens: tokens}, nil
+}
+
+func (s *UserServiceImpl) UnlockUser(ctx context.Context, id string) (*domain.User, error) {
+	user, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	accountKey, _ := loginKeys(user.Email, "")
+	if err := s.attempts.Reset(ctx, accountKey); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// checkLogin returns a LoginThrottledError when the account or client IP is
+// locked out, or the account has to wait after its last failure
+func (s *UserServiceImpl) checkLogin(ctx context.Context, accountKey, ipKey string) error {
+	now := time.Now()
+	account, err := s.attempts.Get(ctx, accountKey)
+	if err != nil {
+		return err
+	}
+	if account.LockedUntil != nil && now.Before(*account.LockedUntil) {
+		return &LoginThrottledError{RetryAfter: account.LockedUntil.Sub(now), Locked: true}
+	}
+	if delay := s.loginDelay(account.Failures); delay > 0 {
+		if retryAt := account.LastFailureAt.Add(delay); now.Before(retryAt) {
+			return &LoginThrottledError{RetryAfter: retryAt.Sub(now)}
+		}
+	}
+
+	if ipKey == "" {
+		return nil
+	}
+	ip, err := s.attempts.Get(ctx, ipKey)
+	if err != nil {
+		return err
+	}
+	if ip.LockedUntil != nil && now.Before(*ip.LockedUntil) {
+		return &LoginThrottledError{RetryAfter: ip.LockedUntil.Sub(now), Locked: true}
+	}
+	return nil
+}
+
+// loginDelay is how long an account waits after its last failure, doubling
+// with every failure past DelayAfter
+func (s *UserServiceImpl) loginDelay(failures int) time.Duration {
+	excess := failures - s.cfg.Login.DelayAfter
+	if excess < 0 || s.cfg.Login.BaseDelay <= 0 {
+		return 0
+	}
+	delay := s.cfg.Login.BaseDelay
+	for i := 0; i < excess && delay < s.cfg.Login.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, s.cfg.Login.MaxDelay)
+}
+
+// recordLoginFailure counts a failure for the account and the client IP and
+// locks out the ones reaching their threshold
+func (s *UserServiceImpl) recordLoginFailure(ctx context.Context, email, userID, clientIP string) error {
+	accountKey, ipKey := loginKeys(email, clientIP)
+	now := time.Now()
+	expiresAt := now.Add(s.cfg.Login.Window)
+
+	account, err := s.attempts.RecordFailure(ctx, accountKey, now, expiresAt)
+	if err != nil {
+		return err
+	}
+	if err := s.nats.PublishLoginFailed(email, userID, clientIP, account.Failures); err != nil {
+		log.Printf("Failed to publish failed login: %v", err)
+	}
+	if err := s.lockIfDue(ctx, LockoutAccount, accountKey, account.Failures, s.cfg.Login.LockoutThreshold, email, userID, clientIP); err != nil {
+		return err
+	}
+
+	if ipKey == "" {
+		return nil
+	}
+	ip, err := s.attempts.RecordFailure(ctx, ipKey, now, expiresAt)
+	if err != nil {
+		return err
+	}
+	return s.lockIfDue(ctx, LockoutIP, ipKey, ip.Failures, s.cfg.Login.IPLockoutThreshold, email, userID, clientIP)
+}
+
+func (s *UserServiceImpl) lockIfDue(ctx context.Context, scope, key string, failures, threshold int, email, userID, clientIP string) error {
+	if threshold <= 0 || failures < threshold {
+		return nil
+	}
+	lockedUntil := time.Now().Add(s.cfg.Login.LockoutDuration)
+	if err := s.attempts.Lock(ctx, key, lockedUntil); err != nil {
+		return err
+	}
+	log.Printf("Locked out %s logins for %s until %s", scope, key, lockedUntil.Format(time.RFC3339))
+	if err := s.nats.PublishUserLocked(scope, email, userID, clientIP, lockedUntil); err != nil {
+		log.Printf("Failed to publish lockout: %v", err)
+	}
+	return nil
+}
+
+// loginKeys returns the keys the attempts for an email and a client IP are
+// counted under, the IP key is empty without a client IP
+func loginKeys(email, clientIP string) (accountKey, ipKey string) {
+	accountKey = "account:" + strings.ToLower(strings.TrimSpace(email))
+	if clientIP != "" {
+		ipKey = "ip:" + clientIP
+	}
+	return accountKey, ipKey
+}
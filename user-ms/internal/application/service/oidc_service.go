@@ -0,0 +1,202 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"slices"
+	"time"
+
+	argon "github.com/alexedwards/argon2id"
+
+	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/domain"
+	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/infrastructure/oidc"
+	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/infrastructure/repository"
+	sharedMiddlware "github.com/kaleabAlemayehu/eagle-commerce/shared/middleware"
+)
+
+var (
+	ErrUnknownProvider    = errors.New("unknown login provider")
+	ErrInvalidRedirectURI = errors.New("redirect URI not allowed")
+	ErrInvalidOIDCLogin   = errors.New("invalid or expired external login")
+	// ErrEmailNotVerified is returned when a provider doesn't vouch for the
+	// email of an identity that isn't linked yet
+	ErrEmailNotVerified = errors.New("email not verified by the provider")
+	// ErrUserNotVerified is returned when the email of an identity belongs to
+	// a user who hasn't verified it, the identity is linked once they do
+	ErrUserNotVerified = errors.New("user with the email not verified")
+)
+
+func (s *UserServiceImpl) LoginProviders() []domain.LoginProvider {
+	providers := make([]domain.LoginProvider, 0, len(s.providers.List()))
+	for _, provider := range s.providers.List() {
+		providers = append(providers, domain.LoginProvider{
+			Name:        provider.Name(),
+			DisplayName: provider.DisplayName(),
+		})
+	}
+	return providers
+}
+
+func (s *UserServiceImpl) StartOIDCLogin(ctx context.Context, providerName, redirectURI string) (*domain.OIDCAuthorization, error) {
+	provider, ok := s.providers.Get(providerName)
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	if redirectURI == "" {
+		redirectURI = provider.RedirectURIs()[0]
+	}
+	if !slices.Contains(provider.RedirectURIs(), redirectURI) {
+		return nil, ErrInvalidRedirectURI
+	}
+
+	var secrets [3]string
+	for i := range secrets {
+		secret, err := generateToken()
+		if err != nil {
+			return nil, err
+		}
+		secrets[i] = secret
+	}
+	state, nonce, codeVerifier := secrets[0], secrets[1], secrets[2]
+
+	authURL, err := provider.AuthCodeURL(ctx, state, nonce, codeVerifier, redirectURI)
+	if err != nil {
+		return nil, err
+	}
+	expiresAt := time.Now().Add(s.cfg.OIDC.StateTTL)
+	err = s.oidcStates.Create(ctx, &domain.OIDCState{
+		Provider:     provider.Name(),
+		Hash:         hashToken(state),
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		RedirectURI:  redirectURI,
+		ExpiresAt:    expiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &domain.OIDCAuthorization{URL: authURL, State: state, ExpiresAt: expiresAt}, nil
+}
+
+func (s *UserServiceImpl) CompleteOIDCLogin(ctx context.Context, providerName, state, code string) (*domain.LoginResult, error) {
+	provider, ok := s.providers.Get(providerName)
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	started, err := s.oidcStates.Use(ctx, hashToken(state), time.Now())
+	if err != nil {
+		if errors.Is(err, repository.ErrorOIDCStateInvalid) {
+			return nil, ErrInvalidOIDCLogin
+		}
+		return nil, err
+	}
+	if started.Provider != provider.Name() {
+		return nil, ErrInvalidOIDCLogin
+	}
+
+	identity, err := provider.Exchange(ctx, code, started.CodeVerifier, started.RedirectURI, started.Nonce)
+	if err != nil {
+		if errors.Is(err, oidc.ErrCodeRejected) || errors.Is(err, oidc.ErrInvalidIDToken) {
+			log.Printf("Rejected login with %s: %v", provider.Name(), err)
+			return nil, ErrInvalidOIDCLogin
+		}
+		return nil, err
+	}
+	user, err := s.externalUser(ctx, provider.Name(), identity)
+	if err != nil {
+		return nil, err
+	}
+
+	// The provider stands in for the password, not for the second factor
+	if user.TwoFactorEnabled() || s.twoFactorRequired(user) {
+		challenge, err := s.createChallenge(ctx, user)
+		if err != nil {
+			return nil, err
+		}
+		return &domain.LoginResult{Challenge: challenge}, nil
+	}
+	tokens, err := s.issueTokens(ctx, user, "")
+	if err != nil {
+		return nil, err
+	}
+	return &domain.LoginResult{User: user, Tokens: tokens}, nil
+}
+
+// externalUser returns the user an identity is linked to. An identity seen
+// for the first time is linked to the user with its email, or a new user is
+// created, as long as the provider verified the email. Only users who
+// verified the email too are linked to, whoever signed up with it may be
+// waiting on the verification email right now.
+func (s *UserServiceImpl) externalUser(ctx context.Context, provider string, identity *oidc.Identity) (*domain.User, error) {
+	user, err := s.repo.GetByIdentity(ctx, provider, identity.Subject)
+	if err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, repository.ErrorUserNotFound) {
+		return nil, err
+	}
+	if identity.Email == "" || !identity.EmailVerified {
+		return nil, ErrEmailNotVerified
+	}
+
+	user, err = s.repo.GetByEmail(ctx, identity.Email)
+	if errors.Is(err, repository.ErrorUserNotFound) {
+		return s.createExternalUser(ctx, provider, identity)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !user.EmailVerified() {
+		return nil, ErrUserNotVerified
+	}
+	linked, err := s.repo.LinkIdentity(ctx, user.ID.Hex(), domain.ExternalIdentity{
+		Provider: provider,
+		Subject:  identity.Subject,
+		LinkedAt: time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.nats.PublishIdentityLinked(linked, provider); err != nil {
+		log.Printf("Failed to publish linked identity: %v", err)
+	}
+	return linked, nil
+}
+
+func (s *UserServiceImpl) createExternalUser(ctx context.Context, provider string, identity *oidc.Identity) (*domain.User, error) {
+	// The user logs in through the provider, until they reset the password
+	password, err := unusablePassword()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	user, err := s.repo.Create(ctx, &domain.User{
+		Email:      identity.Email,
+		Password:   password,
+		FirstName:  identity.FirstName,
+		LastName:   identity.LastName,
+		Roles:      []string{sharedMiddlware.RoleCustomer},
+		Status:     domain.UserStatusActive,
+		VerifiedAt: &now,
+		Identities: []domain.ExternalIdentity{{
+			Provider: provider,
+			Subject:  identity.Subject,
+			LinkedAt: now,
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, s.nats.PublishUserCreated(user)
+}
+
+// unusablePassword hashes a random password nobody knows
+func unusablePassword() (string, error) {
+	password, err := generateToken()
+	if err != nil {
+		return "", err
+	}
+	return argon.CreateHash(password, argon.DefaultParams)
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/domain"
+	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/infrastructure/messaging"
+	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/infrastructure/oidc"
+	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/infrastructure/repository"
+	sharedMessaging "github.com/kaleabAlemayehu/eagle-commerce/shared/messaging"
+)
+
+func (r *memoryUsers) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
+	for _, user := range r.users {
+		if user.Email == email {
+			copied := *user
+			return &copied, nil
+		}
+	}
+	return nil, repository.ErrorUserNotFound
+}
+
+func (r *memoryUsers) GetByIdentity(ctx context.Context, provider, subject string) (*domain.User, error) {
+	for _, user := range r.users {
+		for _, identity := range user.Identities {
+			if identity.Provider == provider && identity.Subject == subject {
+				copied := *user
+				return &copied, nil
+			}
+		}
+	}
+	return nil, repository.ErrorUserNotFound
+}
+
+func (r *memoryUsers) LinkIdentity(ctx context.Context, id string, identity domain.ExternalIdentity) (*domain.User, error) {
+	user, ok := r.users[id]
+	if !ok {
+		return nil, repository.ErrorUserNotFound
+	}
+	user.Identities = append(user.Identities, identity)
+	copied := *user
+	return &copied, nil
+}
+
+func TestExternalUserLinksVerifiedEmailsOnly(t *testing.T) {
+	verifiedAt := time.Now()
+	tests := []struct {
+		name       string
+		identity   oidc.Identity
+		user       domain.User
+		wantErr    error
+		wantLinked bool
+	}{
+		{
+			name:       "verified email of verified user",
+			identity:   oidc.Identity{Subject: "new", Email: "jane@example.com", EmailVerified: true},
+			user:       domain.User{Email: "jane@example.com", Status: domain.UserStatusActive, VerifiedAt: &verifiedAt},
+			wantLinked: true,
+		},
+		{
+			name:     "verified email of unverified user",
+			identity: oidc.Identity{Subject: "new", Email: "jane@example.com", EmailVerified: true},
+			user:     domain.User{Email: "jane@example.com", Status: domain.UserStatusUnverified},
+			wantErr:  ErrUserNotVerified,
+		},
+		{
+			name:     "unverified email of verified user",
+			identity: oidc.Identity{Subject: "new", Email: "jane@example.com"},
+			user:     domain.User{Email: "jane@example.com", Status: domain.UserStatusActive, VerifiedAt: &verifiedAt},
+			wantErr:  ErrEmailNotVerified,
+		},
+		{
+			name:     "no email",
+			identity: oidc.Identity{Subject: "new", EmailVerified: true},
+			user:     domain.User{Email: "jane@example.com", Status: domain.UserStatusActive, VerifiedAt: &verifiedAt},
+			wantErr:  ErrEmailNotVerified,
+		},
+		{
+			// Linked identities log in whatever the provider says now
+			name:       "linked identity",
+			identity:   oidc.Identity{Subject: "linked", Email: "other@example.com"},
+			user:       domain.User{Email: "jane@example.com", Status: domain.UserStatusUnverified},
+			wantLinked: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := tt.user
+			user.ID = primitive.NewObjectID()
+			user.Password = "hash"
+			user.Identities = []domain.ExternalIdentity{{Provider: "mock", Subject: "linked"}}
+			s := &UserServiceImpl{
+				repo: &memoryUsers{users: map[string]*domain.User{user.ID.Hex(): &user}},
+				// Publishing fails without a connection, which is only logged
+				nats: messaging.NewUserEventPublisher(&sharedMessaging.NATSClient{}),
+			}
+
+			got, err := s.externalUser(context.Background(), "mock", &tt.identity)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+			if user.Password != "hash" || user.Status != tt.user.Status {
+				t.Fatal("existing user taken over")
+			}
+			linked := false
+			for _, identity := range user.Identities {
+				linked = linked || identity.Subject == tt.identity.Subject
+			}
+			if linked != tt.wantLinked {
+				t.Fatalf("got linked %v, want %v", linked, tt.wantLinked)
+			}
+			if tt.wantLinked && got.ID != user.ID {
+				t.Fatalf("got user %s, want %s", got.ID.Hex(), user.ID.Hex())
+			}
+		})
+	}
+}
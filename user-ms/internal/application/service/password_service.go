@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	argon "github.com/alexedwards/argon2id"
+
+	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/domain"
+	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/infrastructure/repository"
+)
+
+var (
+	ErrInvalidPassword   = errors.New("invalid current password")
+	ErrInvalidResetToken = errors.New("invalid password reset token")
+)
+
+func (s *UserServiceImpl) ChangePassword(ctx context.Context, id, currentPassword, newPassword string) (*domain.User, *domain.TokenPair, error) {
+	user, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	match, err := argon.ComparePasswordAndHash(currentPassword, user.Password)
+	if err != nil || !match {
+		return nil, nil, ErrInvalidPassword
+	}
+
+	if err := s.setPassword(ctx, id, newPassword); err != nil {
+		return nil, nil, err
+	}
+	// The session changing the password carries on with new tokens
+	tokens, err := s.issueTokens(ctx, user, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	return user, tokens, nil
+}
+
+func (s *UserServiceImpl) RequestPasswordReset(ctx context.Context, email string) error {
+	user, err := s.repo.GetByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, repository.ErrorUserNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	resetToken, err := generateToken()
+	if err != nil {
+		return err
+	}
+	expiresAt := time.Now().Add(s.cfg.PasswordResetTTL)
+	err = s.resets.Create(ctx, &domain.PasswordResetToken{
+		UserID:    user.ID.Hex(),
+		Hash:      hashToken(resetToken),
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return err
+	}
+	return s.nats.PublishPasswordResetRequested(user, resetToken, expiresAt)
+}
+
+func (s *UserServiceImpl) ResetPassword(ctx context.Context, resetToken, newPassword string) error {
+	token, err := s.resets.Use(ctx, hashToken(resetToken), time.Now())
+	if err != nil {
+		if errors.Is(err, repository.ErrorResetTokenInvalid) {
+			return ErrInvalidResetToken
+		}
+		return err
+	}
+	if err := s.setPassword(ctx, token.UserID, newPassword); err != nil {
+		if errors.Is(err, repository.ErrorUserNotFound) {
+			return ErrInvalidResetToken
+		}
+		return err
+	}
+	return nil
+}
+
+// setPassword stores the hash of password, then ends every session of the
+// user and drops the reset tokens still outstanding
+func (s *UserServiceImpl) setPassword(ctx context.Context, id, password string) error {
+	hashedPassword, err := argon.CreateHash(password, argon.DefaultParams)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.UpdatePassword(ctx, id, hashedPassword); err != nil {
+		return err
+	}
+	if err := s.revokeSessions(ctx, id); err != nil {
+		return err
+	}
+	return s.resets.DeleteByUser(ctx, id)
+}
@@ -0,0 +1,348 @@
+package service
+
+import (
+	"context"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+
+	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/domain"
+	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/infrastructure/repository"
+	sharedMiddleware "github.com/kaleabAlemayehu/eagle-commerce/shared/middleware"
+)
+
+const (
+	// keySyncInterval is how often keys are rotated when due and reloaded,
+	// picking up the keys other instances created
+	keySyncInterval = time.Minute
+	// keyActivationDelay is how long a new key is published before it
+	// signs, so every instance and verifier knows it by then
+	keyActivationDelay = 5 * time.Minute
+	// keyReloadMinInterval keeps tokens with unknown key IDs from reloading
+	// the keys on every request
+	keyReloadMinInterval = 10 * time.Second
+	// minKeyEncryptionKeyLen is how long the key encryption key has to be
+	minKeyEncryptionKeyLen = 32
+)
+
+// signingKey is a decoded domain.SigningKey
+type signingKey struct {
+	id        string
+	method    jwt.SigningMethod
+	key       crypto.Signer
+	activeAt  time.Time
+	expiresAt *time.Time
+}
+
+// SigningKeys signs access tokens and publishes the public keys to verify
+// them. The keys are shared by the instances through the repository, a new
+// one is created every rotation and the retired ones stay published until
+// the tokens they signed have expired. The private keys are stored sealed
+// with AES-GCM under the key encryption key.
+type SigningKeys struct {
+	repo      domain.SigningKeyRepository
+	aead      cipher.AEAD
+	algorithm string
+	rotation  time.Duration
+	accessTTL time.Duration
+
+	// syncMu keeps one sync or reload running at a time
+	syncMu sync.Mutex
+
+	mu       sync.RWMutex
+	keys     []*signingKey
+	loadedAt time.Time
+}
+
+func NewSigningKeys(repo domain.SigningKeyRepository, algorithm string, rotation, accessTTL time.Duration, encryptionKey string) (*SigningKeys, error) {
+	if !slices.Contains([]string{sharedMiddleware.AlgorithmRS256, sharedMiddleware.AlgorithmEdDSA}, algorithm) {
+		return nil, fmt.Errorf("%w: %s", sharedMiddleware.ErrUnsupportedAlgorithm, algorithm)
+	}
+	if rotation <= keyActivationDelay {
+		return nil, fmt.Errorf("key rotation must be longer than %s", keyActivationDelay)
+	}
+	if len(encryptionKey) < minKeyEncryptionKeyLen {
+		return nil, fmt.Errorf("key encryption key must be at least %d bytes", minKeyEncryptionKeyLen)
+	}
+	sealingKey := sha256.Sum256([]byte(encryptionKey))
+	block, err := aes.NewCipher(sealingKey[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &SigningKeys{
+		repo:      repo,
+		aead:      aead,
+		algorithm: algorithm,
+		rotation:  rotation,
+		accessTTL: accessTTL,
+	}, nil
+}
+
+// Start makes sure there's a signing key and keeps the keys in sync until
+// ctx is done
+func (s *SigningKeys) Start(ctx context.Context) error {
+	if err := s.sync(ctx); err != nil {
+		return err
+	}
+
+	go func() {
+		ticker := time.NewTicker(keySyncInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := s.sync(ctx); err != nil {
+					log.Printf("Failed to sync signing keys: %v", err)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// SigningKey returns the newest active key
+func (s *SigningKeys) SigningKey() (*sharedMiddleware.SigningKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	for i := len(s.keys) - 1; i >= 0; i-- {
+		if key := s.keys[i]; !key.activeAt.After(now) {
+			return &sharedMiddleware.SigningKey{ID: key.id, Method: key.method, Key: key.key}, nil
+		}
+	}
+	return nil, fmt.Errorf("no active signing key")
+}
+
+// PublicKey verifies the tokens of this service, keys created by another
+// instance moments ago are loaded on demand
+func (s *SigningKeys) PublicKey(keyID string) (crypto.PublicKey, error) {
+	if key, ok := s.find(keyID); ok {
+		return key, nil
+	}
+
+	s.mu.RLock()
+	recent := time.Since(s.loadedAt) < keyReloadMinInterval
+	s.mu.RUnlock()
+	if !recent {
+		s.syncMu.Lock()
+		err := s.load(context.Background())
+		s.syncMu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if key, ok := s.find(keyID); ok {
+		return key, nil
+	}
+	return nil, sharedMiddleware.ErrUnknownSigningKey
+}
+
+// JWKS returns the public keys of the unexpired keys, including the ones
+// about to activate
+func (s *SigningKeys) JWKS() sharedMiddleware.JWKSet {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	set := sharedMiddleware.JWKSet{Keys: []sharedMiddleware.JWK{}}
+	for _, key := range s.keys {
+		if key.expiresAt != nil && !time.Now().Before(*key.expiresAt) {
+			continue
+		}
+		jwk, err := sharedMiddleware.NewJWK(key.id, key.key.Public())
+		if err != nil {
+			log.Printf("Failed to publish signing key %s: %v", key.id, err)
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+func (s *SigningKeys) find(keyID string) (crypto.PublicKey, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, key := range s.keys {
+		if key.id == keyID {
+			return key.key.Public(), true
+		}
+	}
+	return nil, false
+}
+
+// sync creates the next key when the newest one is due for rotation, uses
+// another algorithm or can't be opened with the key encryption key, retires
+// the older keys and loads them
+func (s *SigningKeys) sync(ctx context.Context) error {
+	s.syncMu.Lock()
+	defer s.syncMu.Unlock()
+
+	keys, err := s.repo.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	var newest *domain.SigningKey
+	if len(keys) > 0 {
+		newest = keys[len(keys)-1]
+	}
+	// The next key is created ahead of the rotation, to be published by
+	// the time it activates
+	if newest == nil || newest.Algorithm != s.algorithm || !s.sealed(newest) || time.Since(newest.ActiveAt) >= s.rotation-keyActivationDelay {
+		activeAt := time.Now().Add(keyActivationDelay)
+		previousKeyID := ""
+		if newest == nil {
+			activeAt = time.Now()
+		} else {
+			previousKeyID = newest.KeyID
+			// A key sealed under another key encryption key can't sign
+			if newest.Encrypted && !s.sealed(newest) {
+				activeAt = time.Now()
+			}
+		}
+
+		created, err := s.create(ctx, previousKeyID, activeAt)
+		switch {
+		case errors.Is(err, repository.ErrorSigningKeyExists):
+			// Another instance rotated first, its key is the newest
+			if keys, err = s.repo.List(ctx); err != nil {
+				return err
+			}
+			if len(keys) == 0 {
+				return fmt.Errorf("no signing key after rotation")
+			}
+			newest = keys[len(keys)-1]
+		case err != nil:
+			return err
+		default:
+			newest = created
+			log.Printf("Created %s signing key %s, active from %s", newest.Algorithm, newest.KeyID, newest.ActiveAt.Format(time.RFC3339))
+		}
+	}
+
+	// Tokens signed by the older keys expire at most an access token
+	// lifetime after the newest key takes over. Only one instance creates
+	// each key, so they all agree on the newest one.
+	if err := s.repo.RetireOthers(ctx, newest.ID, newest.ActiveAt.Add(s.accessTTL)); err != nil {
+		return err
+	}
+	return s.load(ctx)
+}
+
+func (s *SigningKeys) create(ctx context.Context, previousKeyID string, activeAt time.Time) (*domain.SigningKey, error) {
+	privateKey, err := sharedMiddleware.GenerateSigningKey(s.algorithm)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	key := &domain.SigningKey{
+		KeyID:         uuid.NewString(),
+		Algorithm:     s.algorithm,
+		PreviousKeyID: previousKeyID,
+		Encrypted:     true,
+		ActiveAt:      activeAt,
+	}
+	key.PrivateKey, err = s.seal(key.KeyID, der)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.Create(ctx, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// load replaces the keys with the ones of the repository, callers hold
+// syncMu
+func (s *SigningKeys) load(ctx context.Context) error {
+	stored, err := s.repo.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]*signingKey, 0, len(stored))
+	for _, key := range stored {
+		der := key.PrivateKey
+		if key.Encrypted {
+			der, err = s.open(key.KeyID, key.PrivateKey)
+			if err != nil {
+				log.Printf("Ignoring signing key %s: %v", key.KeyID, err)
+				continue
+			}
+		}
+		privateKey, err := x509.ParsePKCS8PrivateKey(der)
+		if err != nil {
+			log.Printf("Ignoring signing key %s: %v", key.KeyID, err)
+			continue
+		}
+		signer, ok := privateKey.(crypto.Signer)
+		method := jwt.GetSigningMethod(key.Algorithm)
+		if !ok || method == nil {
+			log.Printf("Ignoring signing key %s: unsupported %s key", key.KeyID, key.Algorithm)
+			continue
+		}
+		keys = append(keys, &signingKey{
+			id:        key.KeyID,
+			method:    method,
+			key:       signer,
+			activeAt:  key.ActiveAt,
+			expiresAt: key.ExpiresAt,
+		})
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = keys
+	s.loadedAt = time.Now()
+	return nil
+}
+
+// seal encrypts a private key, bound to its key ID. The nonce goes first.
+func (s *SigningKeys) seal(keyID string, der []byte) ([]byte, error) {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return s.aead.Seal(nonce, nonce, der, []byte(keyID)), nil
+}
+
+// sealed reports whether key is stored encrypted under the key encryption
+// key. Keys of earlier versions are stored in clear.
+func (s *SigningKeys) sealed(key *domain.SigningKey) bool {
+	if !key.Encrypted {
+		return false
+	}
+	_, err := s.open(key.KeyID, key.PrivateKey)
+	return err == nil
+}
+
+// open decrypts a private key sealed by seal
+func (s *SigningKeys) open(keyID string, sealed []byte) ([]byte, error) {
+	if len(sealed) < s.aead.NonceSize() {
+		return nil, errors.New("sealed signing key too short")
+	}
+	nonce, ciphertext := sealed[:s.aead.NonceSize()], sealed[s.aead.NonceSize():]
+	return s.aead.Open(nil, nonce, ciphertext, []byte(keyID))
+}
@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/domain"
+	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/infrastructure/repository"
+	sharedMiddleware "github.com/kaleabAlemayehu/eagle-commerce/shared/middleware"
+)
+
+var ErrInvalidRefreshToken = errors.New("invalid refresh token")
+
+func (s *UserServiceImpl) RefreshTokens(ctx context.Context, refreshToken string) (*domain.User, *domain.TokenPair, error) {
+	token, err := s.tokens.GetByHash(ctx, hashToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, repository.ErrorRefreshTokenNotFound) {
+			return nil, nil, ErrInvalidRefreshToken
+		}
+		return nil, nil, err
+	}
+	if token.RevokedAt != nil || !time.Now().Before(token.ExpiresAt) {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	// A rotated token is only ever presented again by someone who copied it,
+	// the whole family is compromised
+	err = s.tokens.Rotate(ctx, token.ID, time.Now())
+	if errors.Is(err, repository.ErrorRefreshTokenUsed) {
+		log.Printf("Refresh token reused, revoking token family %s of user %s", token.Family, token.UserID)
+		if err := s.revokeFamily(ctx, token.Family); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	user, err := s.repo.GetByID(ctx, token.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrorUserNotFound) {
+			return nil, nil, ErrInvalidRefreshToken
+		}
+		return nil, nil, err
+	}
+	tokens, err := s.issueTokens(ctx, user, token.Family)
+	if err != nil {
+		return nil, nil, err
+	}
+	return user, tokens, nil
+}
+
+func (s *UserServiceImpl) Logout(ctx context.Context, refreshToken, accessToken string) error {
+	if refreshToken != "" {
+		token, err := s.tokens.GetByHash(ctx, hashToken(refreshToken))
+		if err != nil && !errors.Is(err, repository.ErrorRefreshTokenNotFound) {
+			return err
+		}
+		if token != nil {
+			if err := s.revokeFamily(ctx, token.Family); err != nil {
+				return err
+			}
+		}
+	}
+
+	// An expired or already revoked access token needs no revoking
+	if accessToken != "" {
+		if claims, err := s.auth.ValidateJWT(accessToken); err == nil && claims.ID != "" {
+			return s.denylist.Revoke(claims.ID, claims.ExpiresAt.Time)
+		}
+	}
+	return nil
+}
+
+// issueTokens returns an access token and a refresh token in family, a new
+// family is started when it's empty
+func (s *UserServiceImpl) issueTokens(ctx context.Context, user *domain.User, family string) (*domain.TokenPair, error) {
+	// Users created before roles existed are customers
+	roles := user.Roles
+	if len(roles) == 0 {
+		roles = []string{sharedMiddleware.RoleCustomer}
+	}
+	accessToken, claims, err := s.auth.GenerateJWT(user.ID.Hex(), user.Email, roles, user.EmailVerified())
+	if err != nil {
+		return nil, errors.New("unable to generate JWT")
+	}
+
+	refreshToken, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+	if family == "" {
+		family = uuid.NewString()
+	}
+	err = s.tokens.Create(ctx, &domain.RefreshToken{
+		UserID:          user.ID.Hex(),
+		Family:          family,
+		Hash:            hashToken(refreshToken),
+		AccessTokenID:   claims.ID,
+		AccessExpiresAt: claims.ExpiresAt.Time,
+		ExpiresAt:       time.Now().Add(s.refreshTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresAt:    claims.ExpiresAt.Time,
+	}, nil
+}
+
+// revokeFamily revokes the refresh tokens of a family along with the access
+// tokens issued with them
+func (s *UserServiceImpl) revokeFamily(ctx context.Context, family string) error {
+	tokens, err := s.tokens.RevokeFamily(ctx, family, time.Now())
+	if err != nil {
+		return err
+	}
+	return s.denyAccessTokens(tokens)
+}
+
+// revokeSessions revokes every refresh token of a user along with the access
+// tokens issued with them
+func (s *UserServiceImpl) revokeSessions(ctx context.Context, userID string) error {
+	tokens, err := s.tokens.RevokeUser(ctx, userID, time.Now())
+	if err != nil {
+		return err
+	}
+	return s.denyAccessTokens(tokens)
+}
+
+func (s *UserServiceImpl) denyAccessTokens(tokens []*domain.RefreshToken) error {
+	for _, token := range tokens {
+		if err := s.denylist.Revoke(token.AccessTokenID, token.AccessExpiresAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// generateToken returns a random token for refresh, password reset and
+// verification tokens
+func generateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
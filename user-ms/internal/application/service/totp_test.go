@@ -0,0 +1,116 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 seed of the RFC 6238 test vectors
+var rfc6238Secret = base32NoPadding.EncodeToString([]byte("12345678901234567890"))
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	// The RFC lists 8 digit codes, the last 6 of them are the 6 digit ones
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+	key := []byte("12345678901234567890")
+	for _, tt := range tests {
+		counter := tt.unix / int64(totpPeriod.Seconds())
+		want := tt.want[len(tt.want)-totpDigits:]
+		if got := totpCode(key, counter); got != want {
+			t.Errorf("T=%d: got %s, want %s", tt.unix, got, want)
+		}
+		got, ok := verifyTOTP(rfc6238Secret, want, time.Unix(tt.unix, 0))
+		if !ok || got != counter {
+			t.Errorf("T=%d: verify got %d %v, want %d true", tt.unix, got, ok, counter)
+		}
+	}
+}
+
+func TestVerifyTOTPSkew(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := now.Unix() / int64(totpPeriod.Seconds())
+	key, _ := base32NoPadding.DecodeString(rfc6238Secret)
+
+	tests := []struct {
+		name  string
+		steps int64
+		want  bool
+	}{
+		{"two steps behind", -2, false},
+		{"one step behind", -1, true},
+		{"current step", 0, true},
+		{"one step ahead", 1, true},
+		{"two steps ahead", 2, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counter, ok := verifyTOTP(rfc6238Secret, totpCode(key, current+tt.steps), now)
+			if ok != tt.want {
+				t.Fatalf("got %v, want %v", ok, tt.want)
+			}
+			if ok && counter != current+tt.steps {
+				t.Fatalf("got counter %d, want %d", counter, current+tt.steps)
+			}
+		})
+	}
+}
+
+func TestVerifyTOTPRejectsMalformed(t *testing.T) {
+	now := time.Unix(59, 0)
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+	}{
+		{"eight digits", rfc6238Secret, "94287082"},
+		{"five digits", rfc6238Secret, "28708"},
+		{"wrong code", rfc6238Secret, "287083"},
+		{"invalid secret", "not base32!", "287082"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := verifyTOTP(tt.secret, tt.code, now); ok {
+				t.Fatal("code accepted")
+			}
+		})
+	}
+	if _, ok := verifyTOTP(strings.ToLower(rfc6238Secret), "287082", now); !ok {
+		t.Fatal("lowercase secret rejected")
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := generateRecoveryCodes()
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if len(codes) != recoveryCodeCount {
+		t.Fatalf("got %d codes, want %d", len(codes), recoveryCodeCount)
+	}
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Fatalf("got code %q, want xxxxx-xxxxx", code)
+		}
+		if seen[code] {
+			t.Fatalf("code %q generated twice", code)
+		}
+		seen[code] = true
+	}
+
+	for _, typed := range []string{"4KQ2M-X7HTA", " 4kq2mx7hta ", "4kq2m-x7hta"} {
+		if got := normalizeRecoveryCode(typed); got != "4kq2mx7hta" {
+			t.Errorf("normalize %q: got %q, want 4kq2mx7hta", typed, got)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/domain"
+	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/infrastructure/repository"
+	sharedMiddlware "github.com/kaleabAlemayehu/eagle-commerce/shared/middleware"
+)
+
+// maxChallengeFailures wrong codes void a login challenge, the password has
+// to be presented again
+const maxChallengeFailures = 5
+
+var (
+	ErrInvalidChallenge     = errors.New("invalid login challenge")
+	ErrInvalidTwoFactorCode = errors.New("invalid two-factor code")
+	ErrTwoFactorEnabled     = errors.New("two-factor authentication already enabled")
+	ErrTwoFactorNotEnrolled = errors.New("two-factor authentication not enrolled")
+	ErrTwoFactorRequired    = errors.New("two-factor authentication required")
+)
+
+func (s *UserServiceImpl) VerifyTwoFactorLogin(ctx context.Context, challengeToken, code, clientIP string) (*domain.LoginResult, error) {
+	challenge, user, err := s.getChallenge(ctx, challengeToken)
+	if err != nil {
+		return nil, err
+	}
+	accountKey, ipKey := loginKeys(user.Email, clientIP)
+	if err := s.checkLogin(ctx, accountKey, ipKey); err != nil {
+		return nil, err
+	}
+
+	var recoveryCodes []string
+	switch {
+	case user.TwoFactorEnabled():
+		err = s.verifySecondFactor(ctx, user, code)
+	case user.TwoFactor != nil:
+		// The second factor was enrolled with this challenge
+		recoveryCodes, err = s.confirmTwoFactor(ctx, user, code)
+	default:
+		err = ErrTwoFactorNotEnrolled
+	}
+	if errors.Is(err, ErrInvalidTwoFactorCode) {
+		failures, recordErr := s.challenges.RecordFailure(ctx, challenge.ID)
+		if errors.Is(recordErr, repository.ErrorLoginChallengeNotFound) {
+			return nil, ErrInvalidChallenge
+		}
+		if recordErr != nil {
+			return nil, recordErr
+		}
+		if failures >= maxChallengeFailures {
+			if err := s.challenges.Delete(ctx, challenge.ID); err != nil {
+				return nil, err
+			}
+		}
+		if err := s.recordLoginFailure(ctx, user.Email, user.ID.Hex(), clientIP); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidTwoFactorCode
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.challenges.Delete(ctx, challenge.ID); err != nil {
+		return nil, err
+	}
+	if err := s.attempts.Reset(ctx, accountKey); err != nil {
+		return nil, err
+	}
+	tokens, err := s.issueTokens(ctx, user, "")
+	if err != nil {
+		return nil, err
+	}
+	return &domain.LoginResult{User: user, Tokens: tokens, RecoveryCodes: recoveryCodes}, nil
+}
+
+func (s *UserServiceImpl) EnrollTwoFactorLogin(ctx context.Context, challengeToken string) (*domain.TwoFactorEnrollment, error) {
+	_, user, err := s.getChallenge(ctx, challengeToken)
+	if err != nil {
+		return nil, err
+	}
+	return s.startTwoFactor(ctx, user)
+}
+
+func (s *UserServiceImpl) StartTwoFactor(ctx context.Context, id string) (*domain.TwoFactorEnrollment, error) {
+	user, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.startTwoFactor(ctx, user)
+}
+
+func (s *UserServiceImpl) ConfirmTwoFactor(ctx context.Context, id, code string) ([]string, error) {
+	user, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.confirmTwoFactor(ctx, user, code)
+}
+
+func (s *UserServiceImpl) DisableTwoFactor(ctx context.Context, id, code string) error {
+	user, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !user.TwoFactorEnabled() {
+		return ErrTwoFactorNotEnrolled
+	}
+	if s.twoFactorRequired(user) {
+		return ErrTwoFactorRequired
+	}
+	if err := s.verifySecondFactor(ctx, user, code); err != nil {
+		return err
+	}
+	return s.repo.SetTwoFactor(ctx, id, nil)
+}
+
+func (s *UserServiceImpl) RequireTwoFactor(ctx context.Context, id string, required bool) (*domain.User, error) {
+	user, err := s.repo.SetTwoFactorRequired(ctx, id, required)
+	if err != nil {
+		return nil, err
+	}
+	// Sessions started with the password alone don't outlive the requirement
+	if required && !user.TwoFactorEnabled() {
+		if err := s.revokeSessions(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+// twoFactorRequired reports whether user can only log in with a second
+// factor, because an admin said so or through one of their roles
+func (s *UserServiceImpl) twoFactorRequired(user *domain.User) bool {
+	if user.TwoFactorRequired {
+		return true
+	}
+	roles := user.Roles
+	if len(roles) == 0 {
+		roles = []string{sharedMiddlware.RoleCustomer}
+	}
+	for _, role := range roles {
+		if slices.Contains(s.cfg.TwoFactor.RequiredRoles, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// createChallenge starts the second step of a login
+func (s *UserServiceImpl) createChallenge(ctx context.Context, user *domain.User) (*domain.TwoFactorChallenge, error) {
+	token, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+	expiresAt := time.Now().Add(s.cfg.TwoFactor.ChallengeTTL)
+	err = s.challenges.Create(ctx, &domain.LoginChallenge{
+		UserID:    user.ID.Hex(),
+		Hash:      hashToken(token),
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &domain.TwoFactorChallenge{
+		Token:              token,
+		ExpiresAt:          expiresAt,
+		EnrollmentRequired: !user.TwoFactorEnabled(),
+	}, nil
+}
+
+func (s *UserServiceImpl) getChallenge(ctx context.Context, challengeToken string) (*domain.LoginChallenge, *domain.User, error) {
+	challenge, err := s.challenges.Get(ctx, hashToken(challengeToken))
+	if err != nil {
+		if errors.Is(err, repository.ErrorLoginChallengeNotFound) {
+			return nil, nil, ErrInvalidChallenge
+		}
+		return nil, nil, err
+	}
+	user, err := s.repo.GetByID(ctx, challenge.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrorUserNotFound) {
+			return nil, nil, ErrInvalidChallenge
+		}
+		return nil, nil, err
+	}
+	return challenge, user, nil
+}
+
+// startTwoFactor replaces a pending second factor with a new secret, an
+// enabled one has to be disabled first
+func (s *UserServiceImpl) startTwoFactor(ctx context.Context, user *domain.User) (*domain.TwoFactorEnrollment, error) {
+	if user.TwoFactorEnabled() {
+		return nil, ErrTwoFactorEnabled
+	}
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.SetTwoFactor(ctx, user.ID.Hex(), &domain.TwoFactor{Secret: secret}); err != nil {
+		return nil, err
+	}
+	return &domain.TwoFactorEnrollment{
+		Secret: secret,
+		URI:    totpURI(s.cfg.TwoFactor.Issuer, user.Email, secret),
+	}, nil
+}
+
+// confirmTwoFactor enables the pending second factor of user when code is
+// valid for it and returns new recovery codes
+func (s *UserServiceImpl) confirmTwoFactor(ctx context.Context, user *domain.User, code string) ([]string, error) {
+	if user.TwoFactorEnabled() {
+		return nil, ErrTwoFactorEnabled
+	}
+	if user.TwoFactor == nil {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+	counter, ok := verifyTOTP(user.TwoFactor.Secret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	codes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = hashToken(normalizeRecoveryCode(code))
+	}
+	confirmedAt := time.Now()
+	err = s.repo.SetTwoFactor(ctx, user.ID.Hex(), &domain.TwoFactor{
+		Secret:        user.TwoFactor.Secret,
+		ConfirmedAt:   &confirmedAt,
+		RecoveryCodes: hashes,
+		LastCounter:   counter,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// verifySecondFactor accepts a TOTP code not used before or an unused
+// recovery code
+func (s *UserServiceImpl) verifySecondFactor(ctx context.Context, user *domain.User, code string) error {
+	if counter, ok := verifyTOTP(user.TwoFactor.Secret, code, time.Now()); ok {
+		err := s.repo.UseTOTPCounter(ctx, user.ID.Hex(), counter)
+		if errors.Is(err, repository.ErrorTOTPCodeUsed) {
+			return ErrInvalidTwoFactorCode
+		}
+		return err
+	}
+
+	err := s.repo.UseRecoveryCode(ctx, user.ID.Hex(), hashToken(normalizeRecoveryCode(code)))
+	if errors.Is(err, repository.ErrorRecoveryCodeInvalid) {
+		return ErrInvalidTwoFactorCode
+	}
+	return err
+}
@@ -0,0 +1,209 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/config"
+	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/domain"
+	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/infrastructure/repository"
+)
+
+// memoryUsers keeps the second factors of users the way the MongoDB
+// repository does, the methods the tests don't use aren't implemented
+type memoryUsers struct {
+	domain.UserRepository
+	users map[string]*domain.User
+}
+
+func (r *memoryUsers) GetByID(ctx context.Context, id string) (*domain.User, error) {
+	user, ok := r.users[id]
+	if !ok {
+		return nil, repository.ErrorUserNotFound
+	}
+	copied := *user
+	return &copied, nil
+}
+
+func (r *memoryUsers) SetTwoFactor(ctx context.Context, id string, twoFactor *domain.TwoFactor) error {
+	r.users[id].TwoFactor = twoFactor
+	return nil
+}
+
+func (r *memoryUsers) UseTOTPCounter(ctx context.Context, id string, counter int64) error {
+	twoFactor := r.users[id].TwoFactor
+	if twoFactor == nil || twoFactor.ConfirmedAt == nil || twoFactor.LastCounter >= counter {
+		return repository.ErrorTOTPCodeUsed
+	}
+	twoFactor.LastCounter = counter
+	return nil
+}
+
+func (r *memoryUsers) UseRecoveryCode(ctx context.Context, id, hash string) error {
+	twoFactor := r.users[id].TwoFactor
+	if twoFactor == nil {
+		return repository.ErrorRecoveryCodeInvalid
+	}
+	i := slices.Index(twoFactor.RecoveryCodes, hash)
+	if i < 0 {
+		return repository.ErrorRecoveryCodeInvalid
+	}
+	twoFactor.RecoveryCodes = slices.Delete(twoFactor.RecoveryCodes, i, i+1)
+	return nil
+}
+
+type memoryChallenges struct {
+	domain.LoginChallengeRepository
+	challenges []*domain.LoginChallenge
+}
+
+func (r *memoryChallenges) Create(ctx context.Context, challenge *domain.LoginChallenge) error {
+	challenge.ID = primitive.NewObjectID()
+	challenge.CreatedAt = time.Now()
+	r.challenges = append(r.challenges, challenge)
+	return nil
+}
+
+func (r *memoryChallenges) Get(ctx context.Context, hash string) (*domain.LoginChallenge, error) {
+	for _, challenge := range r.challenges {
+		if challenge.Hash == hash && challenge.ExpiresAt.After(time.Now()) {
+			return challenge, nil
+		}
+	}
+	return nil, repository.ErrorLoginChallengeNotFound
+}
+
+func testTwoFactorService(t *testing.T, challengeTTL time.Duration) (*UserServiceImpl, *domain.User) {
+	t.Helper()
+	user := &domain.User{ID: primitive.NewObjectID(), Email: "jane@example.com"}
+	cfg := &config.Config{}
+	cfg.TwoFactor.Issuer = "Eagle Commerce"
+	cfg.TwoFactor.ChallengeTTL = challengeTTL
+	return &UserServiceImpl{
+		repo:       &memoryUsers{users: map[string]*domain.User{user.ID.Hex(): user}},
+		challenges: &memoryChallenges{},
+		cfg:        cfg,
+	}, user
+}
+
+// currentTOTP is the code an authenticator app shows for secret now
+func currentTOTP(t *testing.T, secret string) string {
+	t.Helper()
+	key, err := base32NoPadding.DecodeString(secret)
+	if err != nil {
+		t.Fatalf("decode secret: %v", err)
+	}
+	return totpCode(key, time.Now().Unix()/int64(totpPeriod.Seconds()))
+}
+
+// enrollTwoFactor enables a second factor for user and returns its secret
+// and recovery codes
+func enrollTwoFactor(t *testing.T, s *UserServiceImpl, user *domain.User) (string, []string) {
+	t.Helper()
+	ctx := context.Background()
+	enrollment, err := s.StartTwoFactor(ctx, user.ID.Hex())
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	codes, err := s.ConfirmTwoFactor(ctx, user.ID.Hex(), currentTOTP(t, enrollment.Secret))
+	if err != nil {
+		t.Fatalf("confirm: %v", err)
+	}
+	return enrollment.Secret, codes
+}
+
+func TestConfirmTwoFactorRejectsWrongCode(t *testing.T) {
+	s, user := testTwoFactorService(t, time.Minute)
+	ctx := context.Background()
+	enrollment, err := s.StartTwoFactor(ctx, user.ID.Hex())
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	// A code of the secret, but from well outside the skew window
+	key, _ := base32NoPadding.DecodeString(enrollment.Secret)
+	stale := totpCode(key, time.Now().Unix()/int64(totpPeriod.Seconds())-5)
+	if _, err := s.ConfirmTwoFactor(ctx, user.ID.Hex(), stale); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Fatalf("got %v, want %v", err, ErrInvalidTwoFactorCode)
+	}
+	if user.TwoFactorEnabled() {
+		t.Fatal("second factor enabled with a wrong code")
+	}
+}
+
+func TestVerifySecondFactorUsesTOTPCodeOnce(t *testing.T) {
+	s, user := testTwoFactorService(t, time.Minute)
+	ctx := context.Background()
+	secret, _ := enrollTwoFactor(t, s, user)
+
+	// The code confirming the second factor can't log in as well
+	if err := s.verifySecondFactor(ctx, user, currentTOTP(t, secret)); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Fatalf("got %v, want %v", err, ErrInvalidTwoFactorCode)
+	}
+}
+
+func TestVerifySecondFactorUsesRecoveryCodeOnce(t *testing.T) {
+	s, user := testTwoFactorService(t, time.Minute)
+	ctx := context.Background()
+	_, codes := enrollTwoFactor(t, s, user)
+
+	if len(user.TwoFactor.RecoveryCodes) != recoveryCodeCount {
+		t.Fatalf("got %d stored codes, want %d", len(user.TwoFactor.RecoveryCodes), recoveryCodeCount)
+	}
+	for _, stored := range user.TwoFactor.RecoveryCodes {
+		if slices.Contains(codes, stored) {
+			t.Fatal("recovery code stored in plain text")
+		}
+	}
+
+	tests := []struct {
+		name string
+		code string
+		want error
+	}{
+		{"first use", codes[0], nil},
+		{"second use", codes[0], ErrInvalidTwoFactorCode},
+		{"typed without dash", normalizeRecoveryCode(codes[1]), nil},
+		{"unknown code", "aaaaa-aaaaa", ErrInvalidTwoFactorCode},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := s.verifySecondFactor(ctx, user, tt.code); !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+	if got := len(user.TwoFactor.RecoveryCodes); got != recoveryCodeCount-2 {
+		t.Fatalf("got %d codes left, want %d", got, recoveryCodeCount-2)
+	}
+}
+
+func TestLoginChallengeExpires(t *testing.T) {
+	tests := []struct {
+		name string
+		ttl  time.Duration
+		want error
+	}{
+		{"unexpired", time.Minute, nil},
+		{"expired", -time.Second, ErrInvalidChallenge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, user := testTwoFactorService(t, tt.ttl)
+			challenge, err := s.createChallenge(context.Background(), user)
+			if err != nil {
+				t.Fatalf("create challenge: %v", err)
+			}
+			if !challenge.EnrollmentRequired {
+				t.Fatal("enrollment not required without a second factor")
+			}
+			if _, err := s.EnrollTwoFactorLogin(context.Background(), challenge.Token); !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
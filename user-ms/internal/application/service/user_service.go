@@ -3,80 +3,128 @@ package service
 import (
 	"context"
 	"errors"
+	"log"
+	"slices"
+	"time"
 
 	argon "github.com/alexedwards/argon2id"
+	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/config"
 	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/domain"
 	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/infrastructure/messaging"
+	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/infrastructure/oidc"
 	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/infrastructure/repository"
 	sharedMiddlware "github.com/kaleabAlemayehu/eagle-commerce/shared/middleware"
 	"github.com/kaleabAlemayehu/eagle-commerce/shared/utils"
 )
 
 type UserServiceImpl struct {
-	repo domain.UserRepository
-	nats *messaging.UserEventPublisher
-	auth *sharedMiddlware.Auth
+	repo          domain.UserRepository
+	tokens        domain.RefreshTokenRepository
+	resets        domain.PasswordResetTokenRepository
+	verifications domain.VerificationTokenRepository
+	attempts      domain.LoginAttemptRepository
+	challenges    domain.LoginChallengeRepository
+	oidcStates    domain.OIDCStateRepository
+	addresses     domain.AddressRepository
+	providers     *oidc.Providers
+	nats          *messaging.UserEventPublisher
+	auth          *sharedMiddlware.Auth
+	denylist      *sharedMiddlware.Denylist
+	refreshTTL    time.Duration
+	cfg           *config.Config
 }
 
-func NewUserService(repo domain.UserRepository, nats *messaging.UserEventPublisher, auth *sharedMiddlware.Auth) domain.UserService {
+func NewUserService(repo domain.UserRepository, tokens domain.RefreshTokenRepository, resets domain.PasswordResetTokenRepository, verifications domain.VerificationTokenRepository, attempts domain.LoginAttemptRepository, challenges domain.LoginChallengeRepository, oidcStates domain.OIDCStateRepository, addresses domain.AddressRepository, providers *oidc.Providers, nats *messaging.UserEventPublisher, auth *sharedMiddlware.Auth, denylist *sharedMiddlware.Denylist, refreshTTL time.Duration, cfg *config.Config) domain.UserService {
 	return &UserServiceImpl{
-		repo: repo,
-		nats: nats,
-		auth: auth,
+		repo:          repo,
+		tokens:        tokens,
+		resets:        resets,
+		verifications: verifications,
+		attempts:      attempts,
+		challenges:    challenges,
+		oidcStates:    oidcStates,
+		addresses:     addresses,
+		providers:     providers,
+		nats:          nats,
+		auth:          auth,
+		denylist:      denylist,
+		refreshTTL:    refreshTTL,
+		cfg:           cfg,
 	}
 }
 
-func (s *UserServiceImpl) RegisterUser(ctx context.Context, user *domain.User) (*domain.User, string, error) {
+func (s *UserServiceImpl) RegisterUser(ctx context.Context, user *domain.User) (*domain.User, *domain.TokenPair, error) {
 	// Validate user data
 	if err := utils.ValidateStruct(user); err != nil {
-		return nil, "", err
+		return nil, nil, err
 	}
 
 	// Check if user already exists
 	existingUser, err := s.repo.GetByEmail(ctx, user.Email)
 	if err != nil {
 		if !errors.Is(err, repository.ErrorUserNotFound) {
-			return nil, "", err
+			return nil, nil, err
 		}
 	}
 	if existingUser != nil {
-		return nil, "", errors.New("user already exists")
+		return nil, nil, errors.New("user already exists")
 	}
 
 	// Hash password
 	hashedPassword, err := argon.CreateHash(user.Password, argon.DefaultParams)
 	if err != nil {
-		return nil, "", err
+		return nil, nil, err
 	}
 	user.Password = string(hashedPassword)
+	user.Roles = []string{sharedMiddlware.RoleCustomer}
+	user.Status = domain.UserStatusUnverified
 
 	// Create user
 	newUser, err := s.repo.Create(ctx, user)
 	if err != nil {
-		return nil, "", err
+		return nil, nil, err
 	}
 
-	// create token
-	token, err := s.auth.GenerateJWT(newUser.ID.String(), user.Email)
+	// create tokens
+	tokens, err := s.issueTokens(ctx, newUser, "")
 	if err != nil {
-		return nil, "", errors.New("unable to generate JWT")
+		return nil, nil, err
+	}
+
+	// The user can ask for another token when this one gets lost
+	if err := s.sendVerification(ctx, newUser); err != nil {
+		log.Printf("Failed to send verification token to user %s: %v", newUser.ID.Hex(), err)
 	}
 
 	// Publish event
-	return newUser, token, s.nats.PublishUserCreated(user)
+	return newUser, tokens, s.nats.PublishUserCreated(user)
 }
 
 func (s *UserServiceImpl) GetUser(ctx context.Context, id string) (*domain.User, error) {
 	return s.repo.GetByID(ctx, id)
 }
 
+// UpdateUser changes the profile fields set in user, the others are kept
 func (s *UserServiceImpl) UpdateUser(ctx context.Context, id string, user *domain.User) (*domain.User, error) {
+	existingUser, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if user.FirstName != "" {
+		existingUser.FirstName = user.FirstName
+	}
+	if user.LastName != "" {
+		existingUser.LastName = user.LastName
+	}
+	if user.Address != (domain.Address{}) {
+		existingUser.Address = user.Address
+	}
 
-	if err := utils.ValidateStruct(user); err != nil {
+	if err := utils.ValidateStruct(existingUser); err != nil {
 		return nil, err
 	}
 
-	updatedUser, err := s.repo.Update(ctx, id, user)
+	updatedUser, err := s.repo.Update(ctx, id, existingUser)
 	if err != nil {
 		return nil, err
 	}
@@ -87,6 +135,9 @@ func (s *UserServiceImpl) DeleteUser(ctx context.Context, id string) error {
 	if err := s.repo.Delete(ctx, id); err != nil {
 		return err
 	}
+	if err := s.addresses.DeleteByUser(ctx, id); err != nil {
+		return err
+	}
 	return s.nats.PublishUserDeleted(id)
 }
 
@@ -94,19 +145,43 @@ func (s *UserServiceImpl) ListUsers(ctx context.Context, limit, offset int) ([]*
 	return s.repo.List(ctx, limit, offset)
 }
 
-func (s *UserServiceImpl) AuthenticateUser(ctx context.Context, email, password string) (*domain.User, string, error) {
-	user, err := s.repo.GetByEmail(ctx, email)
+var ErrUnknownRole = errors.New("unknown role")
+
+func (s *UserServiceImpl) GrantRole(ctx context.Context, id, role string) (*domain.User, error) {
+	if !sharedMiddlware.IsRole(role) {
+		return nil, ErrUnknownRole
+	}
+	return s.repo.AddRole(ctx, id, role)
+}
+
+// RevokeRole ends the sessions of the user, the tokens issued before carry
+// the role
+func (s *UserServiceImpl) RevokeRole(ctx context.Context, id, role string) (*domain.User, error) {
+	if !sharedMiddlware.IsRole(role) {
+		return nil, ErrUnknownRole
+	}
+	user, err := s.repo.GetByID(ctx, id)
 	if err != nil {
-		return nil, "", errors.New("invalid credentials")
+		return nil, err
 	}
-	match, err := argon.ComparePasswordAndHash(user.Password, password)
-	if err != nil || !match {
-		return nil, "", errors.New("invalid credentials")
+	if !slices.Contains(user.Roles, role) {
+		return user, nil
 	}
-	token, err := s.auth.GenerateJWT(user.ID.String(), user.Email)
+	user, err = s.repo.RemoveRole(ctx, id, role)
 	if err != nil {
-		return nil, "", errors.New("unable to generate JWT")
+		return nil, err
 	}
+	if err := s.revokeSessions(ctx, id); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
 
-	return user, token, nil
+func (s *UserServiceImpl) GrantAdmin(ctx context.Context, email string) error {
+	user, err := s.repo.GetByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+	_, err = s.repo.AddRole(ctx, user.ID.Hex(), sharedMiddlware.RoleAdmin)
+	return err
 }
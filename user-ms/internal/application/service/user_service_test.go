@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/domain"
+	sharedMiddlware "github.com/kaleabAlemayehu/eagle-commerce/shared/middleware"
+)
+
+func (r *memoryUsers) RemoveRole(ctx context.Context, id, role string) (*domain.User, error) {
+	user := r.users[id]
+	user.Roles = slices.DeleteFunc(user.Roles, func(held string) bool { return held == role })
+	copied := *user
+	return &copied, nil
+}
+
+type memoryRefreshTokens struct {
+	domain.RefreshTokenRepository
+	tokens []*domain.RefreshToken
+}
+
+func (r *memoryRefreshTokens) RevokeUser(ctx context.Context, userID string, at time.Time) ([]*domain.RefreshToken, error) {
+	var revoked []*domain.RefreshToken
+	for _, token := range r.tokens {
+		if token.UserID == userID && token.RevokedAt == nil {
+			token.RevokedAt = &at
+			revoked = append(revoked, token)
+		}
+	}
+	return revoked, nil
+}
+
+// memoryKV is the bucket of a denylist, the methods the tests don't use
+// aren't implemented
+type memoryKV struct {
+	nats.KeyValue
+	keys []string
+}
+
+func (kv *memoryKV) Put(key string, value []byte) (uint64, error) {
+	kv.keys = append(kv.keys, key)
+	return uint64(len(kv.keys)), nil
+}
+
+func TestRevokeRoleEndsSessions(t *testing.T) {
+	tests := []struct {
+		name        string
+		role        string
+		wantRevoked bool
+	}{
+		{"held role", sharedMiddlware.RoleStaff, true},
+		{"role not held", sharedMiddlware.RoleAdmin, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := &domain.User{ID: primitive.NewObjectID(), Roles: []string{sharedMiddlware.RoleCustomer, sharedMiddlware.RoleStaff}}
+			accessExpiresAt := time.Now().Add(15 * time.Minute)
+			tokens := &memoryRefreshTokens{tokens: []*domain.RefreshToken{
+				{UserID: user.ID.Hex(), Family: "laptop", AccessTokenID: "laptop-jti", AccessExpiresAt: accessExpiresAt},
+				{UserID: user.ID.Hex(), Family: "phone", AccessTokenID: "phone-jti", AccessExpiresAt: accessExpiresAt},
+				{UserID: "someone else", Family: "other", AccessTokenID: "other-jti", AccessExpiresAt: accessExpiresAt},
+			}}
+			kv := &memoryKV{}
+			s := &UserServiceImpl{
+				repo:     &memoryUsers{users: map[string]*domain.User{user.ID.Hex(): user}},
+				tokens:   tokens,
+				denylist: sharedMiddlware.NewDenylist(kv),
+			}
+
+			got, err := s.RevokeRole(context.Background(), user.ID.Hex(), tt.role)
+			if err != nil {
+				t.Fatalf("revoke role: %v", err)
+			}
+			if slices.Contains(got.Roles, tt.role) {
+				t.Fatalf("got roles %v, want %s revoked", got.Roles, tt.role)
+			}
+
+			for _, token := range tokens.tokens {
+				want := tt.wantRevoked && token.UserID == user.ID.Hex()
+				if revoked := token.RevokedAt != nil; revoked != want {
+					t.Errorf("refresh token of %s: got revoked %v, want %v", token.Family, revoked, want)
+				}
+				if denied := s.denylist.Revoked(token.AccessTokenID); denied != want {
+					t.Errorf("access token of %s: got denied %v, want %v", token.Family, denied, want)
+				}
+			}
+		})
+	}
+}
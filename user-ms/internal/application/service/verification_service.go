@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/domain"
+	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/infrastructure/repository"
+)
+
+var (
+	ErrInvalidVerificationToken = errors.New("invalid verification token")
+	ErrAlreadyVerified          = errors.New("email already verified")
+	ErrVerificationThrottled    = errors.New("verification token sent recently")
+)
+
+// VerifyEmail only hands out tokens to a session of the user, the
+// verification token doesn't stand in for the password or second factor
+func (s *UserServiceImpl) VerifyEmail(ctx context.Context, verificationToken, sessionUserID string) (*domain.User, *domain.TokenPair, error) {
+	token, err := s.verifications.Use(ctx, hashToken(verificationToken), time.Now())
+	if err != nil {
+		if errors.Is(err, repository.ErrorVerificationTokenInvalid) {
+			return nil, nil, ErrInvalidVerificationToken
+		}
+		return nil, nil, err
+	}
+
+	user, err := s.repo.Verify(ctx, token.UserID, time.Now())
+	if err != nil {
+		if errors.Is(err, repository.ErrorUserNotFound) {
+			return nil, nil, ErrInvalidVerificationToken
+		}
+		return nil, nil, err
+	}
+	if err := s.verifications.DeleteByUser(ctx, token.UserID); err != nil {
+		return nil, nil, err
+	}
+	if err := s.nats.PublishUserUpdated(user); err != nil {
+		return nil, nil, err
+	}
+
+	// The session's access token still says the email isn't verified
+	if sessionUserID != user.ID.Hex() {
+		return user, nil, nil
+	}
+	tokens, err := s.issueTokens(ctx, user, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	return user, tokens, nil
+}
+
+func (s *UserServiceImpl) ResendVerification(ctx context.Context, id string) error {
+	user, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if user.EmailVerified() {
+		return ErrAlreadyVerified
+	}
+
+	latest, err := s.verifications.Latest(ctx, id)
+	if err != nil && !errors.Is(err, repository.ErrorVerificationTokenNotFound) {
+		return err
+	}
+	if latest != nil && time.Since(latest.CreatedAt) < s.cfg.VerificationResendInterval {
+		return ErrVerificationThrottled
+	}
+	return s.sendVerification(ctx, user)
+}
+
+// sendVerification creates a verification token and publishes it for
+// delivery to the user
+func (s *UserServiceImpl) sendVerification(ctx context.Context, user *domain.User) error {
+	verificationToken, err := generateToken()
+	if err != nil {
+		return err
+	}
+	expiresAt := time.Now().Add(s.cfg.VerificationTTL)
+	err = s.verifications.Create(ctx, &domain.VerificationToken{
+		UserID:    user.ID.Hex(),
+		Hash:      hashToken(verificationToken),
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return err
+	}
+	return s.nats.PublishVerificationRequested(user, verificationToken, expiresAt)
+}
@@ -0,0 +1,89 @@
+package config
+
+import (
+	"log"
+	"time"
+
+	"github.com/caarlos0/env/v11"
+)
+
+// Config holds user-ms specific configuration
+type Config struct {
+	// BootstrapAdminEmail is made an admin at startup, so that someone can
+	// grant the other roles
+	BootstrapAdminEmail string `env:"BOOTSTRAP_ADMIN_EMAIL"`
+	// PasswordResetTTL is how long a password reset token can be used
+	PasswordResetTTL time.Duration `env:"PASSWORD_RESET_TTL" envDefault:"1h"`
+	// VerificationTTL is how long an email verification token can be used
+	VerificationTTL time.Duration `env:"VERIFICATION_TTL" envDefault:"24h"`
+	// VerificationResendInterval is how long a user waits before another
+	// verification token is sent
+	VerificationResendInterval time.Duration `env:"VERIFICATION_RESEND_INTERVAL" envDefault:"1m"`
+
+	Login     LoginConfig     `envPrefix:"LOGIN_"`
+	TwoFactor TwoFactorConfig `envPrefix:"TWO_FACTOR_"`
+	OIDC      OIDCConfig      `envPrefix:"OIDC_"`
+}
+
+// OIDCConfig sets up logging in with external OpenID Connect providers
+type OIDCConfig struct {
+	// StateTTL is how long a login waits for the provider to redirect back
+	StateTTL time.Duration `env:"STATE_TTL" envDefault:"10m"`
+	// Providers are numbered from 0, as OIDC_PROVIDERS_0_NAME and so on
+	Providers []OIDCProviderConfig `envPrefix:"PROVIDERS"`
+}
+
+// OIDCProviderConfig is a provider users can log in with, registered with
+// it as a client using the authorization code flow
+type OIDCProviderConfig struct {
+	// Name identifies the provider in URLs, like google
+	Name        string `env:"NAME"`
+	DisplayName string `env:"DISPLAY_NAME"`
+	// Issuer is where the discovery document of the provider is found
+	Issuer       string `env:"ISSUER"`
+	ClientID     string `env:"CLIENT_ID"`
+	ClientSecret string `env:"CLIENT_SECRET"`
+	// RedirectURIs are the frontend pages the provider may send users back
+	// to, each has to be registered with the provider too
+	RedirectURIs []string `env:"REDIRECT_URIS" envSeparator:","`
+	Scopes       []string `env:"SCOPES" envSeparator:"," envDefault:"openid,email,profile"`
+	// TrustEmail takes the emails of the provider as verified when its ID
+	// tokens don't say, for corporate providers that own their domains
+	TrustEmail bool `env:"TRUST_EMAIL"`
+}
+
+// TwoFactorConfig sets up TOTP second factors
+type TwoFactorConfig struct {
+	// Issuer names the platform in authenticator apps
+	Issuer string `env:"ISSUER" envDefault:"Eagle Commerce"`
+	// RequiredRoles have to log in with a second factor, on top of the
+	// users admins required it for
+	RequiredRoles []string `env:"REQUIRED_ROLES" envSeparator:","`
+	// ChallengeTTL is how long a login waits for the second factor
+	ChallengeTTL time.Duration `env:"CHALLENGE_TTL" envDefault:"5m"`
+}
+
+// LoginConfig throttles failed logins per account and per client IP
+type LoginConfig struct {
+	// DelayAfter failures for an account, each further attempt has to wait
+	// a delay doubling from BaseDelay up to MaxDelay
+	DelayAfter int           `env:"DELAY_AFTER" envDefault:"3"`
+	BaseDelay  time.Duration `env:"BASE_DELAY" envDefault:"1s"`
+	MaxDelay   time.Duration `env:"MAX_DELAY" envDefault:"1m"`
+	// LockoutThreshold failures lock an account out for LockoutDuration,
+	// IPLockoutThreshold failures across accounts lock out a client IP
+	LockoutThreshold   int           `env:"LOCKOUT_THRESHOLD" envDefault:"10"`
+	IPLockoutThreshold int           `env:"IP_LOCKOUT_THRESHOLD" envDefault:"50"`
+	LockoutDuration    time.Duration `env:"LOCKOUT_DURATION" envDefault:"15m"`
+	// Window is how long failures are remembered after the last one
+	Window time.Duration `env:"WINDOW" envDefault:"15m"`
+}
+
+// Load reads the user service environment variables into Config
+func Load() *Config {
+	var cfg Config
+	if err := env.Parse(&cfg); err != nil {
+		log.Fatalf("Failed to parse user service environment variables: %v", err)
+	}
+	return &cfg
+}
@@ -7,15 +7,64 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Statuses of a user, users without one were created before emails were
+// verified and count as active
+const (
+	UserStatusUnverified = "unverified"
+	UserStatusActive     = "active"
+)
+
 type User struct {
 	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
 	Email     string             `json:"email" bson:"email" validate:"required,email"`
 	Password  string             `json:"-" bson:"password" validate:"required,min=6"`
 	FirstName string             `json:"first_name" bson:"first_name" validate:"required"`
 	LastName  string             `json:"last_name" bson:"last_name" validate:"required"`
+	Roles     []string           `json:"roles" bson:"roles,omitempty"`
+	Status    string             `json:"status" bson:"status,omitempty"`
 	Address   Address            `json:"address" bson:"address"`
 	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
 	UpdatedAt time.Time          `json:"updated_at" bson:"updated_at"`
+	// VerifiedAt is when the user verified their email
+	VerifiedAt *time.Time `json:"verified_at,omitempty" bson:"verified_at,omitempty"`
+	TwoFactor  *TwoFactor `json:"-" bson:"two_factor,omitempty"`
+	// TwoFactorRequired is set by admins, the user can't log in without a
+	// second factor
+	TwoFactorRequired bool `json:"two_factor_required" bson:"two_factor_required,omitempty"`
+	// Identities are the accounts at OpenID Connect providers the user logs
+	// in with
+	Identities []ExternalIdentity `json:"identities,omitempty" bson:"identities,omitempty"`
+}
+
+// ExternalIdentity links a user to their account at an OpenID Connect
+// provider, Subject is the account's ID at the provider
+type ExternalIdentity struct {
+	Provider string    `json:"provider" bson:"provider"`
+	Subject  string    `json:"-" bson:"subject"`
+	LinkedAt time.Time `json:"linked_at" bson:"linked_at"`
+}
+
+// TwoFactor is the TOTP second factor of a user, pending until confirmed
+// with a first code
+type TwoFactor struct {
+	// Secret is the base32 encoded TOTP key
+	Secret      string     `bson:"secret"`
+	ConfirmedAt *time.Time `bson:"confirmed_at,omitempty"`
+	// RecoveryCodes are the SHA-256 hashes of the unused recovery codes
+	RecoveryCodes []string `bson:"recovery_codes,omitempty"`
+	// LastCounter is the time step of the last accepted code, codes can't
+	// be used twice
+	LastCounter int64 `bson:"last_counter,omitempty"`
+}
+
+// TwoFactorEnabled reports whether the user confirmed a second factor
+func (u *User) TwoFactorEnabled() bool {
+	return u.TwoFactor != nil && u.TwoFactor.ConfirmedAt != nil
+}
+
+// EmailVerified reports whether the user confirmed owning their email
+func (u *User) EmailVerified() bool {
+	return u.Status != UserStatusUnverified
 }
 
 type Address struct {
@@ -26,6 +75,170 @@ type Address struct {
 	Country string `json:"country" bson:"country"`
 }
 
+// SavedAddress is an entry in the address book of a user. Orders that don't
+// name an address ship to the default shipping one.
+type SavedAddress struct {
+	ID     primitive.ObjectID `bson:"_id,omitempty"`
+	UserID string             `bson:"user_id"`
+	// Label tells the addresses of a user apart, like home or work
+	Label   string  `bson:"label"`
+	Address Address `bson:"address"`
+	// A user has at most one default of each kind
+	DefaultShipping bool      `bson:"default_shipping"`
+	DefaultBilling  bool      `bson:"default_billing"`
+	CreatedAt       time.Time `bson:"created_at"`
+	UpdatedAt       time.Time `bson:"updated_at"`
+}
+
+// RefreshToken trades for new tokens once. Every refresh rotates it for a
+// new one in the same family, the tokens descending from one login, so that
+// a rotated token coming back gives away a stolen family.
+type RefreshToken struct {
+	ID     primitive.ObjectID `bson:"_id,omitempty"`
+	UserID string             `bson:"user_id"`
+	Family string             `bson:"family"`
+	// Hash is the SHA-256 of the token, the token itself isn't stored
+	Hash string `bson:"hash"`
+	// AccessTokenID is the jti of the access token issued along
+	AccessTokenID   string     `bson:"access_token_id"`
+	AccessExpiresAt time.Time  `bson:"access_expires_at"`
+	ExpiresAt       time.Time  `bson:"expires_at"`
+	CreatedAt       time.Time  `bson:"created_at"`
+	RotatedAt       *time.Time `bson:"rotated_at,omitempty"`
+	RevokedAt       *time.Time `bson:"revoked_at,omitempty"`
+}
+
+// PasswordResetToken lets a user who forgot their password set a new one,
+// once
+type PasswordResetToken struct {
+	ID     primitive.ObjectID `bson:"_id,omitempty"`
+	UserID string             `bson:"user_id"`
+	// Hash is the SHA-256 of the token, the token itself is only sent to
+	// the user
+	Hash      string     `bson:"hash"`
+	ExpiresAt time.Time  `bson:"expires_at"`
+	CreatedAt time.Time  `bson:"created_at"`
+	UsedAt    *time.Time `bson:"used_at,omitempty"`
+}
+
+// VerificationToken confirms a user owns their email, tokens sent before
+// the latest one keep working until they expire
+type VerificationToken struct {
+	ID     primitive.ObjectID `bson:"_id,omitempty"`
+	UserID string             `bson:"user_id"`
+	// Hash is the SHA-256 of the token, the token itself is only sent to
+	// the user
+	Hash      string    `bson:"hash"`
+	ExpiresAt time.Time `bson:"expires_at"`
+	CreatedAt time.Time `bson:"created_at"`
+}
+
+// LoginAttempts counts the failed logins for an account or a client IP,
+// they're forgotten once ExpiresAt passes without another failure
+type LoginAttempts struct {
+	ID primitive.ObjectID `bson:"_id,omitempty"`
+	// Key is the email or client IP the logins were attempted for
+	Key           string     `bson:"key"`
+	Failures      int        `bson:"failures"`
+	LastFailureAt time.Time  `bson:"last_failure_at"`
+	LockedUntil   *time.Time `bson:"locked_until,omitempty"`
+	ExpiresAt     time.Time  `bson:"expires_at"`
+}
+
+// LoginChallenge is handed out when a password login needs a second factor,
+// trading for tokens along with a TOTP or recovery code
+type LoginChallenge struct {
+	ID     primitive.ObjectID `bson:"_id,omitempty"`
+	UserID string             `bson:"user_id"`
+	// Hash is the SHA-256 of the challenge token
+	Hash string `bson:"hash"`
+	// Failures counts the wrong codes presented with the challenge
+	Failures  int       `bson:"failures"`
+	ExpiresAt time.Time `bson:"expires_at"`
+	CreatedAt time.Time `bson:"created_at"`
+}
+
+// OIDCState is a login started with an OpenID Connect provider, waiting for
+// the provider to send the user back with the state parameter
+type OIDCState struct {
+	ID       primitive.ObjectID `bson:"_id,omitempty"`
+	Provider string             `bson:"provider"`
+	// Hash is the SHA-256 of the state parameter
+	Hash  string `bson:"hash"`
+	Nonce string `bson:"nonce"`
+	// CodeVerifier is the PKCE secret the authorization code is redeemed
+	// with
+	CodeVerifier string    `bson:"code_verifier"`
+	RedirectURI  string    `bson:"redirect_uri"`
+	ExpiresAt    time.Time `bson:"expires_at"`
+	CreatedAt    time.Time `bson:"created_at"`
+}
+
+// LoginProvider is an OpenID Connect provider users can log in with
+type LoginProvider struct {
+	Name        string
+	DisplayName string
+}
+
+// OIDCAuthorization is where a user is sent to log in with a provider, the
+// provider sends them back with State and a code
+type OIDCAuthorization struct {
+	URL       string
+	State     string
+	ExpiresAt time.Time
+}
+
+// TwoFactorChallenge is the challenge of a login waiting for a second factor,
+// EnrollmentRequired is set when the user has to enroll one first
+type TwoFactorChallenge struct {
+	Token              string
+	ExpiresAt          time.Time
+	EnrollmentRequired bool
+}
+
+// TwoFactorEnrollment is what an authenticator app is set up with
+type TwoFactorEnrollment struct {
+	Secret string
+	// URI is the otpauth:// provisioning URI, usually shown as a QR code
+	URI string
+}
+
+// LoginResult is what a login step hands out, Tokens or a Challenge for the
+// second factor. RecoveryCodes are set once, when enrolling while logging in.
+type LoginResult struct {
+	User          *User
+	Tokens        *TokenPair
+	Challenge     *TwoFactorChallenge
+	RecoveryCodes []string
+}
+
+// TokenPair is what a login or refresh hands out
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	// ExpiresAt is when the access token expires
+	ExpiresAt time.Time
+}
+
+// SigningKey signs access tokens from ActiveAt until a newer key activates,
+// then stays published until the tokens it signed have expired
+type SigningKey struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	KeyID     string             `bson:"kid"`
+	Algorithm string             `bson:"algorithm"`
+	// PreviousKeyID is the key this one took over from, empty for the
+	// first key. Only one key takes over from each.
+	PreviousKeyID string `bson:"previous_kid"`
+	// PrivateKey is PKCS #8 encoded, sealed with the key encryption key
+	// when Encrypted is set
+	PrivateKey []byte    `bson:"private_key"`
+	Encrypted  bool      `bson:"encrypted"`
+	ActiveAt   time.Time `bson:"active_at"`
+	// ExpiresAt is set once the key is retired
+	ExpiresAt *time.Time `bson:"expires_at,omitempty"`
+	CreatedAt time.Time  `bson:"created_at"`
+}
+
 type UserRepository interface {
 	Create(ctx context.Context, user *User) (*User, error)
 	GetByID(ctx context.Context, id string) (*User, error)
@@ -33,13 +246,182 @@ type UserRepository interface {
 	Update(ctx context.Context, id string, user *User) (*User, error)
 	Delete(ctx context.Context, id string) error
 	List(ctx context.Context, limit, offset int) ([]*User, error)
+	UpdatePassword(ctx context.Context, id, passwordHash string) error
+	// Verify makes an unverified user active
+	Verify(ctx context.Context, id string, at time.Time) (*User, error)
+	// SetTwoFactor replaces the second factor of a user, nil removes it
+	SetTwoFactor(ctx context.Context, id string, twoFactor *TwoFactor) error
+	// UseTOTPCounter accepts a code of the time step counter, once and in
+	// order
+	UseTOTPCounter(ctx context.Context, id string, counter int64) error
+	// UseRecoveryCode removes an unused recovery code, once
+	UseRecoveryCode(ctx context.Context, id, hash string) error
+	SetTwoFactorRequired(ctx context.Context, id string, required bool) (*User, error)
+	// GetByIdentity returns the user an external identity is linked to
+	GetByIdentity(ctx context.Context, provider, subject string) (*User, error)
+	LinkIdentity(ctx context.Context, id string, identity ExternalIdentity) (*User, error)
+	AddRole(ctx context.Context, id, role string) (*User, error)
+	RemoveRole(ctx context.Context, id, role string) (*User, error)
+}
+
+type RefreshTokenRepository interface {
+	Create(ctx context.Context, token *RefreshToken) error
+	GetByHash(ctx context.Context, hash string) (*RefreshToken, error)
+	// Rotate marks the token used, once
+	Rotate(ctx context.Context, id primitive.ObjectID, at time.Time) error
+	// RevokeFamily revokes every token of a family and returns them
+	RevokeFamily(ctx context.Context, family string, at time.Time) ([]*RefreshToken, error)
+	// RevokeUser revokes every token of a user and returns them
+	RevokeUser(ctx context.Context, userID string, at time.Time) ([]*RefreshToken, error)
+}
+
+type PasswordResetTokenRepository interface {
+	Create(ctx context.Context, token *PasswordResetToken) error
+	// Use marks an unused and unexpired token used, once
+	Use(ctx context.Context, hash string, at time.Time) (*PasswordResetToken, error)
+	// DeleteByUser drops the outstanding tokens of a user
+	DeleteByUser(ctx context.Context, userID string) error
+}
+
+type VerificationTokenRepository interface {
+	Create(ctx context.Context, token *VerificationToken) error
+	// Use deletes an unexpired token and returns it, once
+	Use(ctx context.Context, hash string, at time.Time) (*VerificationToken, error)
+	// Latest returns the newest token of a user
+	Latest(ctx context.Context, userID string) (*VerificationToken, error)
+	// DeleteByUser drops the outstanding tokens of a user
+	DeleteByUser(ctx context.Context, userID string) error
+}
+
+type LoginAttemptRepository interface {
+	// Get returns the unexpired attempts for key, with no failures when
+	// there are none
+	Get(ctx context.Context, key string) (*LoginAttempts, error)
+	// RecordFailure counts a failure for key and returns the attempts
+	RecordFailure(ctx context.Context, key string, at, expiresAt time.Time) (*LoginAttempts, error)
+	// Lock locks key out until the given time, starting the count over
+	Lock(ctx context.Context, key string, until time.Time) error
+	// Reset forgets the attempts for key
+	Reset(ctx context.Context, key string) error
+}
+
+type LoginChallengeRepository interface {
+	Create(ctx context.Context, challenge *LoginChallenge) error
+	// Get returns an unexpired challenge
+	Get(ctx context.Context, hash string) (*LoginChallenge, error)
+	// RecordFailure counts a wrong code and returns the failures so far
+	RecordFailure(ctx context.Context, id primitive.ObjectID) (int, error)
+	Delete(ctx context.Context, id primitive.ObjectID) error
+}
+
+type OIDCStateRepository interface {
+	Create(ctx context.Context, state *OIDCState) error
+	// Use deletes an unexpired state and returns it, once
+	Use(ctx context.Context, hash string, at time.Time) (*OIDCState, error)
+}
+
+type AddressRepository interface {
+	// Create adds an address, taking over the defaults it's flagged for
+	Create(ctx context.Context, address *SavedAddress) error
+	Get(ctx context.Context, userID, id string) (*SavedAddress, error)
+	// GetDefaultShipping returns the default shipping address of a user
+	GetDefaultShipping(ctx context.Context, userID string) (*SavedAddress, error)
+	// List returns the addresses of a user, oldest first
+	List(ctx context.Context, userID string) ([]*SavedAddress, error)
+	Count(ctx context.Context, userID string) (int64, error)
+	// Update replaces an address, taking over the defaults it's flagged for
+	Update(ctx context.Context, address *SavedAddress) (*SavedAddress, error)
+	// Delete removes an address, the oldest remaining address takes over the
+	// defaults it held
+	Delete(ctx context.Context, userID, id string) error
+	// DeleteByUser drops the address book of a user
+	DeleteByUser(ctx context.Context, userID string) error
+}
+
+type SigningKeyRepository interface {
+	// Create adds a key unless another already took over from the same
+	// previous key
+	Create(ctx context.Context, key *SigningKey) error
+	// List returns the unexpired keys, oldest ActiveAt first
+	List(ctx context.Context) ([]*SigningKey, error)
+	// RetireOthers sets the expiry of every unretired key but current
+	RetireOthers(ctx context.Context, current primitive.ObjectID, expiresAt time.Time) error
 }
 
 type UserService interface {
-	RegisterUser(ctx context.Context, user *User) (*User, string, error)
+	RegisterUser(ctx context.Context, user *User) (*User, *TokenPair, error)
 	GetUser(ctx context.Context, id string) (*User, error)
 	UpdateUser(ctx context.Context, id string, user *User) (*User, error)
 	DeleteUser(ctx context.Context, id string) error
 	ListUsers(ctx context.Context, limit, offset int) ([]*User, error)
-	AuthenticateUser(ctx context.Context, email, password string) (*User, string, error)
+	// AuthenticateUser checks the credentials of a login from clientIP,
+	// failed logins slow down and lock out the account and the client IP.
+	// Users with a second factor get a challenge instead of tokens.
+	AuthenticateUser(ctx context.Context, email, password, clientIP string) (*LoginResult, error)
+	// VerifyTwoFactorLogin trades a login challenge and a TOTP or recovery
+	// code for tokens, enabling the second factor enrolled with the
+	// challenge
+	VerifyTwoFactorLogin(ctx context.Context, challengeToken, code, clientIP string) (*LoginResult, error)
+	// EnrollTwoFactorLogin starts the enrollment of a user who has to use a
+	// second factor to log in
+	EnrollTwoFactorLogin(ctx context.Context, challengeToken string) (*TwoFactorEnrollment, error)
+	// StartTwoFactor starts the enrollment of a second factor, it's enabled
+	// by ConfirmTwoFactor
+	StartTwoFactor(ctx context.Context, id string) (*TwoFactorEnrollment, error)
+	// ConfirmTwoFactor enables the pending second factor with a first code
+	// and returns the recovery codes
+	ConfirmTwoFactor(ctx context.Context, id, code string) ([]string, error)
+	// DisableTwoFactor removes the second factor with a TOTP or recovery
+	// code, unless the user is required to use one
+	DisableTwoFactor(ctx context.Context, id, code string) error
+	// RequireTwoFactor sets whether a user has to log in with a second
+	// factor, requiring it ends the sessions of the user
+	RequireTwoFactor(ctx context.Context, id string, required bool) (*User, error)
+	// LoginProviders lists the OpenID Connect providers users can log in
+	// with
+	LoginProviders() []LoginProvider
+	// StartOIDCLogin returns where to send a user logging in with provider,
+	// who's sent back to redirectURI
+	StartOIDCLogin(ctx context.Context, provider, redirectURI string) (*OIDCAuthorization, error)
+	// CompleteOIDCLogin trades the state and code a provider sent the user
+	// back with for tokens, linking the provider's identity to the user with
+	// its verified email or creating one. Users with a second factor get a
+	// challenge instead of tokens.
+	CompleteOIDCLogin(ctx context.Context, provider, state, code string) (*LoginResult, error)
+	// UnlockUser forgets the failed logins for a user, lifting a lockout
+	UnlockUser(ctx context.Context, id string) (*User, error)
+	RefreshTokens(ctx context.Context, refreshToken string) (*User, *TokenPair, error)
+	// Logout revokes the family of refreshToken and accessToken, either may
+	// be empty
+	Logout(ctx context.Context, refreshToken, accessToken string) error
+	GrantRole(ctx context.Context, id, role string) (*User, error)
+	RevokeRole(ctx context.Context, id, role string) (*User, error)
+	// ChangePassword replaces the password of a user who knows the current
+	// one, ending every session for a new one
+	ChangePassword(ctx context.Context, id, currentPassword, newPassword string) (*User, *TokenPair, error)
+	// RequestPasswordReset sends a reset token to the user with email, if
+	// there's one
+	RequestPasswordReset(ctx context.Context, email string) error
+	// ResetPassword sets a new password with a reset token, ending every
+	// session
+	ResetPassword(ctx context.Context, resetToken, newPassword string) error
+	// VerifyEmail activates the user a verification token was sent to. New
+	// tokens are returned when sessionUserID, the user logged in with the
+	// request, is the one verified.
+	VerifyEmail(ctx context.Context, verificationToken, sessionUserID string) (*User, *TokenPair, error)
+	// ResendVerification sends a new verification token to an unverified
+	// user, at most once per resend interval
+	ResendVerification(ctx context.Context, id string) error
+	ListAddresses(ctx context.Context, userID string) ([]*SavedAddress, error)
+	GetAddress(ctx context.Context, userID, id string) (*SavedAddress, error)
+	// AddAddress adds to the address book of a user, the first address
+	// becomes the default for shipping and billing
+	AddAddress(ctx context.Context, userID string, address *SavedAddress) (*SavedAddress, error)
+	UpdateAddress(ctx context.Context, userID, id string, address *SavedAddress) (*SavedAddress, error)
+	DeleteAddress(ctx context.Context, userID, id string) error
+	// ResolveShippingAddress returns the address an order of a user ships
+	// to, the default shipping address when id is empty
+	ResolveShippingAddress(ctx context.Context, userID, id string) (*SavedAddress, error)
+	// GrantAdmin makes the user with email an admin, if there's one
+	GrantAdmin(ctx context.Context, email string) error
 }
@@ -71,6 +71,104 @@ func (p *UserEventPublisher) PublishUserDeleted(userID string) error {
 	return p.natsClient.Publish(models.UserDeletedEvent, event)
 }
 
+// PublishPasswordResetRequested hands the reset token to whoever delivers it
+// to the user
+func (p *UserEventPublisher) PublishPasswordResetRequested(user *domain.User, resetToken string, expiresAt time.Time) error {
+	event := models.Event{
+		ID:     messaging.GenerateEventID(),
+		Type:   models.UserPasswordResetEvent,
+		Source: "user-service",
+		Data: map[string]interface{}{
+			"user_id":     user.ID.Hex(),
+			"email":       user.Email,
+			"first_name":  user.FirstName,
+			"reset_token": resetToken,
+			"expires_at":  expiresAt,
+		},
+		Timestamp: time.Now(),
+	}
+
+	return p.natsClient.Publish(models.UserPasswordResetEvent, event)
+}
+
+// PublishVerificationRequested hands the verification token to whoever
+// delivers it to the user
+func (p *UserEventPublisher) PublishVerificationRequested(user *domain.User, verificationToken string, expiresAt time.Time) error {
+	event := models.Event{
+		ID:     messaging.GenerateEventID(),
+		Type:   models.UserVerificationEvent,
+		Source: "user-service",
+		Data: map[string]interface{}{
+			"user_id":            user.ID.Hex(),
+			"email":              user.Email,
+			"first_name":         user.FirstName,
+			"verification_token": verificationToken,
+			"expires_at":         expiresAt,
+		},
+		Timestamp: time.Now(),
+	}
+
+	return p.natsClient.Publish(models.UserVerificationEvent, event)
+}
+
+// PublishLoginFailed reports a failed login for email, userID is empty when
+// no user has that email
+func (p *UserEventPublisher) PublishLoginFailed(email, userID, clientIP string, failures int) error {
+	event := models.Event{
+		ID:     messaging.GenerateEventID(),
+		Type:   models.UserLoginFailedEvent,
+		Source: "user-service",
+		Data: map[string]interface{}{
+			"user_id":   userID,
+			"email":     email,
+			"client_ip": clientIP,
+			"failures":  failures,
+		},
+		Timestamp: time.Now(),
+	}
+
+	return p.natsClient.Publish(models.UserLoginFailedEvent, event)
+}
+
+// PublishUserLocked reports a lockout, scope is account when the logins for
+// email are locked out and ip when the ones from clientIP are
+func (p *UserEventPublisher) PublishUserLocked(scope, email, userID, clientIP string, lockedUntil time.Time) error {
+	event := models.Event{
+		ID:     messaging.GenerateEventID(),
+		Type:   models.UserLockedEvent,
+		Source: "user-service",
+		Data: map[string]interface{}{
+			"scope":        scope,
+			"user_id":      userID,
+			"email":        email,
+			"client_ip":    clientIP,
+			"locked_until": lockedUntil,
+		},
+		Timestamp: time.Now(),
+	}
+
+	return p.natsClient.Publish(models.UserLockedEvent, event)
+}
+
+// PublishIdentityLinked reports that logging in with provider now gets into
+// an existing user, for the user to be told
+func (p *UserEventPublisher) PublishIdentityLinked(user *domain.User, provider string) error {
+	event := models.Event{
+		ID:     messaging.GenerateEventID(),
+		Type:   models.UserIdentityLinkedEvent,
+		Source: "user-service",
+		Data: map[string]interface{}{
+			"user_id":    user.ID.Hex(),
+			"email":      user.Email,
+			"first_name": user.FirstName,
+			"provider":   provider,
+		},
+		Timestamp: time.Now(),
+	}
+
+	return p.natsClient.Publish(models.UserIdentityLinkedEvent, event)
+}
+
 type UserEventHandler struct {
 	natsClient *messaging.NATSClient
 }
@@ -0,0 +1,332 @@
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/config"
+	sharedMiddleware "github.com/kaleabAlemayehu/eagle-commerce/shared/middleware"
+)
+
+const (
+	requestTimeout = 10 * time.Second
+	// clockSkew is how far the clock of a provider may be off from ours
+	clockSkew = time.Minute
+)
+
+var (
+	// ErrProviderUnavailable wraps the failures to reach a provider, or
+	// responses that make no sense
+	ErrProviderUnavailable = errors.New("identity provider unavailable")
+	// ErrCodeRejected is returned when the provider won't redeem the
+	// authorization code, because it's expired, used or made up
+	ErrCodeRejected   = errors.New("authorization code rejected")
+	ErrInvalidIDToken = errors.New("invalid id token")
+)
+
+// Identity is who the ID token of a provider vouches for
+type Identity struct {
+	// Subject is the ID of the account at the provider
+	Subject       string
+	Email         string
+	EmailVerified bool
+	FirstName     string
+	LastName      string
+}
+
+// metadata is the part of the discovery document of a provider we use
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider is an OpenID Connect provider we're a client of. Its discovery
+// document is fetched on first use, and again after failing.
+type Provider struct {
+	cfg    config.OIDCProviderConfig
+	client *http.Client
+
+	mu       sync.Mutex
+	metadata *metadata
+	keys     *sharedMiddleware.RemoteKeySet
+}
+
+func NewProvider(cfg config.OIDCProviderConfig) (*Provider, error) {
+	switch {
+	case cfg.Name == "":
+		return nil, errors.New("provider name required")
+	case cfg.Issuer == "":
+		return nil, fmt.Errorf("issuer of provider %s required", cfg.Name)
+	case cfg.ClientID == "":
+		return nil, fmt.Errorf("client ID of provider %s required", cfg.Name)
+	case len(cfg.RedirectURIs) == 0:
+		return nil, fmt.Errorf("redirect URIs of provider %s required", cfg.Name)
+	}
+	if cfg.DisplayName == "" {
+		cfg.DisplayName = cfg.Name
+	}
+	return &Provider{
+		cfg:    cfg,
+		client: &http.Client{Timeout: requestTimeout},
+	}, nil
+}
+
+func (p *Provider) Name() string {
+	return p.cfg.Name
+}
+
+func (p *Provider) DisplayName() string {
+	return p.cfg.DisplayName
+}
+
+// RedirectURIs are the pages the provider may send users back to, the
+// first is the default
+func (p *Provider) RedirectURIs() []string {
+	return p.cfg.RedirectURIs
+}
+
+// AuthCodeURL is where to send a user to log in, the code the provider sends
+// them back to redirectURI with is redeemed with codeVerifier
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeVerifier, redirectURI string) (string, error) {
+	md, _, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	challenge := sha256.Sum256([]byte(codeVerifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {redirectURI},
+		"scope":                 {strings.Join(p.cfg.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	endpoint, err := url.Parse(md.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrProviderUnavailable, err)
+	}
+	// Keep the parameters the endpoint comes with
+	existing := endpoint.Query()
+	for key, values := range query {
+		existing[key] = values
+	}
+	endpoint.RawQuery = existing.Encode()
+	return endpoint.String(), nil
+}
+
+// Exchange redeems an authorization code and returns the identity in the ID
+// token, which has to carry nonce
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, redirectURI, nonce string) (*Identity, error) {
+	md, keys, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"client_id":     {p.cfg.ClientID},
+		"code_verifier": {codeVerifier},
+	}
+	if p.cfg.ClientSecret != "" {
+		form.Set("client_secret", p.cfg.ClientSecret)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, md.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrProviderUnavailable, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrProviderUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil && resp.StatusCode == http.StatusOK {
+		return nil, fmt.Errorf("%w: %v", ErrProviderUnavailable, err)
+	}
+	switch {
+	case resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnauthorized:
+		return nil, fmt.Errorf("%w: %s %s", ErrCodeRejected, body.Error, body.ErrorDescription)
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("%w: token endpoint answered %d", ErrProviderUnavailable, resp.StatusCode)
+	case body.IDToken == "":
+		return nil, fmt.Errorf("%w: no id token", ErrProviderUnavailable)
+	}
+	return p.verify(body.IDToken, md.Issuer, keys, nonce)
+}
+
+// idTokenClaims are the claims of an ID token we use, with email_verified
+// sent as a string by some providers
+type idTokenClaims struct {
+	Nonce           string    `json:"nonce"`
+	AuthorizedParty string    `json:"azp"`
+	Email           string    `json:"email"`
+	EmailVerified   claimBool `json:"email_verified"`
+	GivenName       string    `json:"given_name"`
+	FamilyName      string    `json:"family_name"`
+	Name            string    `json:"name"`
+	jwt.RegisteredClaims
+}
+
+type claimBool struct {
+	Set   bool
+	Value bool
+}
+
+func (b *claimBool) UnmarshalJSON(data []byte) error {
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	switch value := value.(type) {
+	case bool:
+		*b = claimBool{Set: true, Value: value}
+	case string:
+		*b = claimBool{Set: true, Value: value == "true"}
+	}
+	return nil
+}
+
+func (p *Provider) verify(rawToken, issuer string, keys *sharedMiddleware.RemoteKeySet, nonce string) (*Identity, error) {
+	var claims idTokenClaims
+	_, err := jwt.ParseWithClaims(rawToken, &claims, func(token *jwt.Token) (interface{}, error) {
+		keyID, _ := token.Header["kid"].(string)
+		return keys.PublicKey(keyID)
+	},
+		jwt.WithValidMethods([]string{sharedMiddleware.AlgorithmRS256, sharedMiddleware.AlgorithmEdDSA}),
+		jwt.WithIssuer(issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(clockSkew),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+	switch {
+	case claims.Subject == "":
+		return nil, fmt.Errorf("%w: no subject", ErrInvalidIDToken)
+	case claims.Nonce != nonce:
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	case len(claims.Audience) > 1 && claims.AuthorizedParty != p.cfg.ClientID:
+		return nil, fmt.Errorf("%w: issued to %s", ErrInvalidIDToken, claims.AuthorizedParty)
+	}
+
+	identity := &Identity{
+		Subject:       claims.Subject,
+		Email:         strings.TrimSpace(claims.Email),
+		EmailVerified: claims.EmailVerified.Value || (!claims.EmailVerified.Set && p.cfg.TrustEmail),
+		FirstName:     claims.GivenName,
+		LastName:      claims.FamilyName,
+	}
+	if identity.FirstName == "" && identity.LastName == "" {
+		identity.FirstName, identity.LastName, _ = strings.Cut(strings.TrimSpace(claims.Name), " ")
+	}
+	return identity, nil
+}
+
+// discover returns the metadata and key set of the provider, fetching its
+// discovery document the first time
+func (p *Provider) discover(ctx context.Context) (*metadata, *sharedMiddleware.RemoteKeySet, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.metadata != nil {
+		return p.metadata, p.keys, nil
+	}
+
+	md, err := p.fetchMetadata(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrProviderUnavailable, err)
+	}
+	p.metadata = md
+	p.keys = sharedMiddleware.NewRemoteKeySet(md.JWKSURI)
+	return p.metadata, p.keys, nil
+}
+
+func (p *Provider) fetchMetadata(ctx context.Context) (*metadata, error) {
+	discoveryURL := strings.TrimSuffix(p.cfg.Issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, discoveryURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d from %s", resp.StatusCode, discoveryURL)
+	}
+
+	var md metadata
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&md); err != nil {
+		return nil, err
+	}
+	// The document can't speak for another issuer than the one it was
+	// fetched from
+	if md.Issuer != p.cfg.Issuer {
+		return nil, fmt.Errorf("discovery document of %s is for issuer %s", p.cfg.Issuer, md.Issuer)
+	}
+	if md.AuthorizationEndpoint == "" || md.TokenEndpoint == "" || md.JWKSURI == "" {
+		return nil, fmt.Errorf("incomplete discovery document at %s", discoveryURL)
+	}
+	return &md, nil
+}
+
+// Providers are the configured providers, in the order they were configured
+type Providers struct {
+	list []*Provider
+}
+
+func NewProviders(cfgs []config.OIDCProviderConfig) (*Providers, error) {
+	providers := &Providers{}
+	for _, cfg := range cfgs {
+		provider, err := NewProvider(cfg)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := providers.Get(provider.Name()); ok {
+			return nil, fmt.Errorf("provider %s configured twice", provider.Name())
+		}
+		providers.list = append(providers.list, provider)
+	}
+	return providers, nil
+}
+
+func (ps *Providers) Get(name string) (*Provider, bool) {
+	for _, provider := range ps.list {
+		if provider.Name() == name {
+			return provider, true
+		}
+	}
+	return nil, false
+}
+
+func (ps *Providers) List() []*Provider {
+	return ps.list
+}
@@ -0,0 +1,303 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/config"
+	sharedMiddleware "github.com/kaleabAlemayehu/eagle-commerce/shared/middleware"
+)
+
+const (
+	testClientID    = "eagle-commerce"
+	testRedirectURI = "https://shop.example.com/login/callback"
+	testKeyID       = "idp-key"
+)
+
+// authorization is what the mock IdP remembers of a login until its code is
+// redeemed
+type authorization struct {
+	challenge   string
+	redirectURI string
+	nonce       string
+}
+
+// mockIdP is an OpenID Connect provider serving discovery, JWKS and a token
+// endpoint that checks PKCE, its ID tokens carry the claims of the test
+type mockIdP struct {
+	server *httptest.Server
+	key    ed25519.PrivateKey
+
+	mu             sync.Mutex
+	authorizations map[string]authorization
+	// claims changes the claims of the next ID tokens
+	claims func(jwt.MapClaims)
+	// signingKey signs the ID tokens in place of key when set
+	signingKey ed25519.PrivateKey
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	idp := &mockIdP{key: key, authorizations: map[string]authorization{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(metadata{
+			Issuer:                idp.server.URL,
+			AuthorizationEndpoint: idp.server.URL + "/authorize?prompt=login",
+			TokenEndpoint:         idp.server.URL + "/token",
+			JWKSURI:               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		jwk, _ := sharedMiddleware.NewJWK(testKeyID, idp.key.Public())
+		json.NewEncoder(w).Encode(sharedMiddleware.JWKSet{Keys: []sharedMiddleware.JWK{jwk}})
+	})
+	mux.HandleFunc("POST /token", idp.token)
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+// authorize logs a user in at the authorization URL and returns the code
+// they're sent back with
+func (idp *mockIdP) authorize(t *testing.T, authURL string) string {
+	t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("parse authorization URL: %v", err)
+	}
+	query := u.Query()
+	for key, want := range map[string]string{
+		"response_type":         "code",
+		"client_id":             testClientID,
+		"redirect_uri":          testRedirectURI,
+		"code_challenge_method": "S256",
+		"prompt":                "login",
+	} {
+		if got := query.Get(key); got != want {
+			t.Fatalf("got %s %q, want %q", key, got, want)
+		}
+	}
+
+	code := rand.Text()
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.authorizations[code] = authorization{
+		challenge:   query.Get("code_challenge"),
+		redirectURI: query.Get("redirect_uri"),
+		nonce:       query.Get("nonce"),
+	}
+	return code
+}
+
+func (idp *mockIdP) token(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	idp.mu.Lock()
+	auth, ok := idp.authorizations[r.PostForm.Get("code")]
+	delete(idp.authorizations, r.PostForm.Get("code"))
+	claimsFunc, signingKey := idp.claims, idp.signingKey
+	idp.mu.Unlock()
+
+	verifier := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	switch {
+	case !ok,
+		r.PostForm.Get("client_id") != testClientID,
+		r.PostForm.Get("redirect_uri") != auth.redirectURI,
+		base64.RawURLEncoding.EncodeToString(verifier[:]) != auth.challenge:
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            idp.server.URL,
+		"sub":            "248289761001",
+		"aud":            testClientID,
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"iat":            now.Unix(),
+		"nonce":          auth.nonce,
+		"email":          "jane@example.com",
+		"email_verified": true,
+		"given_name":     "Jane",
+		"family_name":    "Doe",
+	}
+	if claimsFunc != nil {
+		claimsFunc(claims)
+	}
+	if signingKey == nil {
+		signingKey = idp.key
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	token.Header["kid"] = testKeyID
+	idToken, _ := token.SignedString(signingKey)
+	json.NewEncoder(w).Encode(map[string]string{"id_token": idToken, "token_type": "Bearer"})
+}
+
+func testProvider(t *testing.T, idp *mockIdP, trustEmail bool) *Provider {
+	t.Helper()
+	provider, err := NewProvider(config.OIDCProviderConfig{
+		Name:         "mock",
+		Issuer:       idp.server.URL,
+		ClientID:     testClientID,
+		RedirectURIs: []string{testRedirectURI},
+		Scopes:       []string{"openid", "email"},
+		TrustEmail:   trustEmail,
+	})
+	if err != nil {
+		t.Fatalf("create provider: %v", err)
+	}
+	return provider
+}
+
+// login runs the authorization code flow against idp, redeeming the code
+// with codeVerifier
+func login(t *testing.T, provider *Provider, idp *mockIdP, codeVerifier string) (*Identity, error) {
+	t.Helper()
+	ctx := context.Background()
+	authURL, err := provider.AuthCodeURL(ctx, "state", "nonce", "verifier", testRedirectURI)
+	if err != nil {
+		t.Fatalf("authorization URL: %v", err)
+	}
+	code := idp.authorize(t, authURL)
+	return provider.Exchange(ctx, code, codeVerifier, testRedirectURI, "nonce")
+}
+
+func TestExchangeChecksPKCE(t *testing.T) {
+	idp := newMockIdP(t)
+	provider := testProvider(t, idp, false)
+
+	if _, err := login(t, provider, idp, "other verifier"); !errors.Is(err, ErrCodeRejected) {
+		t.Fatalf("got %v, want %v", err, ErrCodeRejected)
+	}
+	identity, err := login(t, provider, idp, "verifier")
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	want := Identity{Subject: "248289761001", Email: "jane@example.com", EmailVerified: true, FirstName: "Jane", LastName: "Doe"}
+	if *identity != want {
+		t.Fatalf("got %+v, want %+v", *identity, want)
+	}
+}
+
+func TestExchangeRejectsInvalidIDTokens(t *testing.T) {
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	tests := []struct {
+		name   string
+		claims func(jwt.MapClaims)
+		key    ed25519.PrivateKey
+		want   error
+	}{
+		{"valid", func(jwt.MapClaims) {}, nil, nil},
+		{"other nonce", func(c jwt.MapClaims) { c["nonce"] = "replayed" }, nil, ErrInvalidIDToken},
+		{"no nonce", func(c jwt.MapClaims) { delete(c, "nonce") }, nil, ErrInvalidIDToken},
+		{"other issuer", func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }, nil, ErrInvalidIDToken},
+		{"other audience", func(c jwt.MapClaims) { c["aud"] = "other-client" }, nil, ErrInvalidIDToken},
+		{"audiences with azp", func(c jwt.MapClaims) {
+			c["aud"] = []string{testClientID, "other-client"}
+			c["azp"] = testClientID
+		}, nil, nil},
+		{"audiences with other azp", func(c jwt.MapClaims) {
+			c["aud"] = []string{testClientID, "other-client"}
+			c["azp"] = "other-client"
+		}, nil, ErrInvalidIDToken},
+		{"audiences without azp", func(c jwt.MapClaims) {
+			c["aud"] = []string{testClientID, "other-client"}
+		}, nil, ErrInvalidIDToken},
+		{"expired within clock skew", func(c jwt.MapClaims) {
+			c["exp"] = time.Now().Add(-clockSkew / 2).Unix()
+		}, nil, nil},
+		{"expired", func(c jwt.MapClaims) {
+			c["exp"] = time.Now().Add(-2 * clockSkew).Unix()
+		}, nil, ErrInvalidIDToken},
+		{"no expiry", func(c jwt.MapClaims) { delete(c, "exp") }, nil, ErrInvalidIDToken},
+		{"issued in the future", func(c jwt.MapClaims) {
+			c["iat"] = time.Now().Add(2 * clockSkew).Unix()
+		}, nil, ErrInvalidIDToken},
+		{"no subject", func(c jwt.MapClaims) { delete(c, "sub") }, nil, ErrInvalidIDToken},
+		{"other key", func(jwt.MapClaims) {}, otherKey, ErrInvalidIDToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := newMockIdP(t)
+			idp.claims, idp.signingKey = tt.claims, tt.key
+			_, err := login(t, testProvider(t, idp, false), idp, "verifier")
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestExchangeEmailVerified(t *testing.T) {
+	tests := []struct {
+		name       string
+		verified   any
+		trustEmail bool
+		want       bool
+	}{
+		{"true", true, false, true},
+		{"false", false, false, false},
+		{"string true", "true", false, true},
+		{"string false", "false", false, false},
+		{"missing", nil, false, false},
+		{"missing from trusted provider", nil, true, true},
+		{"false from trusted provider", false, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := newMockIdP(t)
+			idp.claims = func(c jwt.MapClaims) {
+				c["email_verified"] = tt.verified
+				if tt.verified == nil {
+					delete(c, "email_verified")
+				}
+			}
+			identity, err := login(t, testProvider(t, idp, tt.trustEmail), idp, "verifier")
+			if err != nil {
+				t.Fatalf("login: %v", err)
+			}
+			if identity.EmailVerified != tt.want {
+				t.Fatalf("got %v, want %v", identity.EmailVerified, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiscoveryRejectsOtherIssuer(t *testing.T) {
+	idp := newMockIdP(t)
+	provider, err := NewProvider(config.OIDCProviderConfig{
+		Name:         "mock",
+		Issuer:       idp.server.URL + "/",
+		ClientID:     testClientID,
+		RedirectURIs: []string{testRedirectURI},
+	})
+	if err != nil {
+		t.Fatalf("create provider: %v", err)
+	}
+	_, err = provider.AuthCodeURL(context.Background(), "state", "nonce", "verifier", testRedirectURI)
+	if !errors.Is(err, ErrProviderUnavailable) {
+		t.Fatalf("got %v, want %v", err, ErrProviderUnavailable)
+	}
+}
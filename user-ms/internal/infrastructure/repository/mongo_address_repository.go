@@ -0,0 +1,247 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/domain"
+)
+
+var ErrorAddressNotFound = errors.New("address not found")
+
+// defaultWriteAttempts bounds how often a write taking a default is tried.
+// It loses the default at most once to each concurrent write, so three
+// requests racing for the defaults of a user all go through.
+const defaultWriteAttempts = 3
+
+type MongoAddressRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMongoAddressRepository(ctx context.Context, db *mongo.Database) (*MongoAddressRepository, error) {
+	collection := db.Collection("addresses")
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: 1}},
+		},
+		// One default of each kind per user
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "default_shipping", Value: 1}},
+			Options: options.Index().SetUnique(true).
+				SetPartialFilterExpression(bson.M{"default_shipping": true}),
+		},
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "default_billing", Value: 1}},
+			Options: options.Index().SetUnique(true).
+				SetPartialFilterExpression(bson.M{"default_billing": true}),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &MongoAddressRepository{collection: collection}, nil
+}
+
+func (r *MongoAddressRepository) Create(ctx context.Context, address *domain.SavedAddress) error {
+	address.ID = primitive.NewObjectID()
+	address.CreatedAt = time.Now()
+	address.UpdatedAt = time.Now()
+	return r.withDefaults(ctx, address, func() error {
+		_, err := r.collection.InsertOne(ctx, address)
+		return err
+	})
+}
+
+func (r *MongoAddressRepository) Get(ctx context.Context, userID, id string) (*domain.SavedAddress, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrorAddressNotFound
+	}
+	return r.findOne(ctx, bson.M{"_id": objectID, "user_id": userID})
+}
+
+func (r *MongoAddressRepository) GetDefaultShipping(ctx context.Context, userID string) (*domain.SavedAddress, error) {
+	return r.findOne(ctx, bson.M{"user_id": userID, "default_shipping": true})
+}
+
+func (r *MongoAddressRepository) List(ctx context.Context, userID string) ([]*domain.SavedAddress, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	cursor, err := r.collection.Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	addresses := []*domain.SavedAddress{}
+	for cursor.Next(ctx) {
+		var address domain.SavedAddress
+		if err := cursor.Decode(&address); err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, &address)
+	}
+	return addresses, cursor.Err()
+}
+
+func (r *MongoAddressRepository) Count(ctx context.Context, userID string) (int64, error) {
+	return r.collection.CountDocuments(ctx, bson.M{"user_id": userID})
+}
+
+func (r *MongoAddressRepository) Update(ctx context.Context, address *domain.SavedAddress) (*domain.SavedAddress, error) {
+	update := bson.M{"$set": bson.M{
+		"label":            address.Label,
+		"address":          address.Address,
+		"default_shipping": address.DefaultShipping,
+		"default_billing":  address.DefaultBilling,
+		"updated_at":       time.Now(),
+	}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var updated domain.SavedAddress
+	err := r.withDefaults(ctx, address, func() error {
+		return r.collection.FindOneAndUpdate(ctx, bson.M{"_id": address.ID, "user_id": address.UserID}, update, opts).Decode(&updated)
+	})
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrorAddressNotFound
+		}
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// Delete removes an address, the oldest of the remaining addresses takes
+// over the defaults it held
+func (r *MongoAddressRepository) Delete(ctx context.Context, userID, id string) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrorAddressNotFound
+	}
+	var deleted domain.SavedAddress
+	err = r.collection.FindOneAndDelete(ctx, bson.M{"_id": objectID, "user_id": userID}).Decode(&deleted)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return ErrorAddressNotFound
+		}
+		return err
+	}
+
+	if deleted.DefaultShipping {
+		if err := r.promoteDefault(ctx, userID, "default_shipping"); err != nil {
+			return err
+		}
+	}
+	if deleted.DefaultBilling {
+		if err := r.promoteDefault(ctx, userID, "default_billing"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *MongoAddressRepository) DeleteByUser(ctx context.Context, userID string) error {
+	_, err := r.collection.DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
+
+// withDefaults runs write once the defaults address is flagged for are taken
+// from the other addresses of its user. A write losing a default to a
+// concurrent one is tried again, the addresses that held the defaults get
+// them back when it fails.
+func (r *MongoAddressRepository) withDefaults(ctx context.Context, address *domain.SavedAddress, write func() error) error {
+	var err error
+	for range defaultWriteAttempts {
+		var holders map[string]primitive.ObjectID
+		holders, err = r.clearDefaults(ctx, address)
+		if err != nil {
+			return err
+		}
+		if err = write(); err == nil {
+			return nil
+		}
+		if restoreErr := r.restoreDefaults(ctx, address.UserID, holders); restoreErr != nil {
+			return errors.Join(err, restoreErr)
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// clearDefaults takes the defaults address is flagged for from the other
+// addresses of its user and returns the ones that held them, by field
+func (r *MongoAddressRepository) clearDefaults(ctx context.Context, address *domain.SavedAddress) (map[string]primitive.ObjectID, error) {
+	var fields []string
+	if address.DefaultShipping {
+		fields = append(fields, "default_shipping")
+	}
+	if address.DefaultBilling {
+		fields = append(fields, "default_billing")
+	}
+
+	holders := map[string]primitive.ObjectID{}
+	opts := options.FindOneAndUpdate().SetProjection(bson.M{"_id": 1})
+	for _, field := range fields {
+		var holder domain.SavedAddress
+		err := r.collection.FindOneAndUpdate(ctx,
+			bson.M{"user_id": address.UserID, "_id": bson.M{"$ne": address.ID}, field: true},
+			bson.M{"$set": bson.M{field: false}},
+			opts,
+		).Decode(&holder)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			continue
+		}
+		if err != nil {
+			return nil, errors.Join(err, r.restoreDefaults(ctx, address.UserID, holders))
+		}
+		holders[field] = holder.ID
+	}
+	return holders, nil
+}
+
+// restoreDefaults gives the defaults back to the addresses that held them,
+// unless another address took them in the meantime
+func (r *MongoAddressRepository) restoreDefaults(ctx context.Context, userID string, holders map[string]primitive.ObjectID) error {
+	for field, id := range holders {
+		_, err := r.collection.UpdateOne(ctx,
+			bson.M{"_id": id, "user_id": userID},
+			bson.M{"$set": bson.M{field: true}},
+		)
+		if err != nil && !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// promoteDefault flags the oldest address of a user for the default field.
+// An address that took the default in the meantime keeps it.
+func (r *MongoAddressRepository) promoteDefault(ctx context.Context, userID, field string) error {
+	opts := options.FindOneAndUpdate().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}})
+	err := r.collection.FindOneAndUpdate(ctx,
+		bson.M{"user_id": userID},
+		bson.M{"$set": bson.M{field: true, "updated_at": time.Now()}},
+		opts,
+	).Err()
+	if errors.Is(err, mongo.ErrNoDocuments) || mongo.IsDuplicateKeyError(err) {
+		return nil
+	}
+	return err
+}
+
+func (r *MongoAddressRepository) findOne(ctx context.Context, filter bson.M) (*domain.SavedAddress, error) {
+	var address domain.SavedAddress
+	if err := r.collection.FindOne(ctx, filter).Decode(&address); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrorAddressNotFound
+		}
+		return nil, err
+	}
+	return &address, nil
+}
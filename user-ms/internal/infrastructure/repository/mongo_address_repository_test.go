@@ -0,0 +1,183 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/domain"
+	"github.com/kaleabAlemayehu/eagle-commerce/shared/database"
+)
+
+// testDatabase connects to the MongoDB in MONGODB_TEST_URI, the test gets a
+// database of its own that is dropped afterwards
+func testDatabase(t *testing.T) *mongo.Database {
+	t.Helper()
+	uri := os.Getenv("MONGODB_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGODB_TEST_URI not set")
+	}
+	db, err := database.NewMongoDB(uri, "user_ms_test_"+primitive.NewObjectID().Hex())
+	if err != nil {
+		t.Fatalf("connect to MongoDB: %v", err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		db.Database.Drop(ctx)
+		db.Close()
+	})
+	return db.Database
+}
+
+func testAddressRepository(t *testing.T) *MongoAddressRepository {
+	t.Helper()
+	repo, err := NewMongoAddressRepository(context.Background(), testDatabase(t))
+	if err != nil {
+		t.Fatalf("create repository: %v", err)
+	}
+	return repo
+}
+
+func TestDeletePromotesOldestAddressToDefaults(t *testing.T) {
+	repo := testAddressRepository(t)
+	ctx := context.Background()
+	userID := primitive.NewObjectID().Hex()
+
+	addresses := []*domain.SavedAddress{
+		{UserID: userID, Label: "home", DefaultShipping: true, DefaultBilling: true},
+		{UserID: userID, Label: "work"},
+		{UserID: userID, Label: "cabin"},
+	}
+	for _, address := range addresses {
+		if err := repo.Create(ctx, address); err != nil {
+			t.Fatalf("create %s: %v", address.Label, err)
+		}
+	}
+
+	if err := repo.Delete(ctx, userID, addresses[2].ID.Hex()); err != nil {
+		t.Fatalf("delete cabin: %v", err)
+	}
+	home, err := repo.Get(ctx, userID, addresses[0].ID.Hex())
+	if err != nil {
+		t.Fatalf("get home: %v", err)
+	}
+	if !home.DefaultShipping || !home.DefaultBilling {
+		t.Fatalf("deleting a non-default address moved the defaults from home")
+	}
+
+	if err := repo.Delete(ctx, userID, addresses[0].ID.Hex()); err != nil {
+		t.Fatalf("delete home: %v", err)
+	}
+	work, err := repo.Get(ctx, userID, addresses[1].ID.Hex())
+	if err != nil {
+		t.Fatalf("get work: %v", err)
+	}
+	if !work.DefaultShipping || !work.DefaultBilling {
+		t.Fatalf("work isn't the default after deleting home: shipping=%v billing=%v", work.DefaultShipping, work.DefaultBilling)
+	}
+
+	if err := repo.Delete(ctx, userID, addresses[1].ID.Hex()); err != nil {
+		t.Fatalf("delete the last address: %v", err)
+	}
+	if _, err := repo.GetDefaultShipping(ctx, userID); !errors.Is(err, ErrorAddressNotFound) {
+		t.Fatalf("default shipping after deleting every address: got %v, want %v", err, ErrorAddressNotFound)
+	}
+}
+
+func TestConcurrentDefaultsKeepOneDefault(t *testing.T) {
+	repo := testAddressRepository(t)
+	ctx := context.Background()
+	userID := primitive.NewObjectID().Hex()
+
+	addresses := make([]*domain.SavedAddress, 3)
+	for i := range addresses {
+		addresses[i] = &domain.SavedAddress{UserID: userID, Label: fmt.Sprint("address ", i), DefaultShipping: i == 0, DefaultBilling: i == 0}
+		if err := repo.Create(ctx, addresses[i]); err != nil {
+			t.Fatalf("create %s: %v", addresses[i].Label, err)
+		}
+	}
+
+	// Two addresses and a new one ask for the defaults at once, each write
+	// loses them at most once to each of the others
+	writes := []func() error{
+		func() error {
+			return repo.Create(ctx, &domain.SavedAddress{UserID: userID, Label: "new", DefaultShipping: true, DefaultBilling: true})
+		},
+	}
+	for _, address := range addresses[1:] {
+		update := *address
+		update.DefaultShipping, update.DefaultBilling = true, true
+		writes = append(writes, func() error {
+			_, err := repo.Update(ctx, &update)
+			return err
+		})
+	}
+	for range 20 {
+		var wg sync.WaitGroup
+		errs := make(chan error, len(writes))
+		for _, write := range writes {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs <- write()
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			if err != nil {
+				t.Fatalf("concurrent default: %v", err)
+			}
+		}
+	}
+
+	all, err := repo.List(ctx, userID)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	shipping, billing := 0, 0
+	for _, address := range all {
+		if address.DefaultShipping {
+			shipping++
+		}
+		if address.DefaultBilling {
+			billing++
+		}
+	}
+	if shipping != 1 || billing != 1 {
+		t.Fatalf("got %d shipping and %d billing defaults, want 1 each", shipping, billing)
+	}
+}
+
+func TestFailedWriteKeepsDefaults(t *testing.T) {
+	repo := testAddressRepository(t)
+	ctx := context.Background()
+	userID := primitive.NewObjectID().Hex()
+
+	home := &domain.SavedAddress{UserID: userID, Label: "home", DefaultShipping: true, DefaultBilling: true}
+	if err := repo.Create(ctx, home); err != nil {
+		t.Fatalf("create home: %v", err)
+	}
+
+	// The defaults are cleared before the update finds no address to take
+	// them
+	missing := &domain.SavedAddress{ID: primitive.NewObjectID(), UserID: userID, Label: "gone", DefaultShipping: true, DefaultBilling: true}
+	if _, err := repo.Update(ctx, missing); !errors.Is(err, ErrorAddressNotFound) {
+		t.Fatalf("got %v, want %v", err, ErrorAddressNotFound)
+	}
+	got, err := repo.Get(ctx, userID, home.ID.Hex())
+	if err != nil {
+		t.Fatalf("get home: %v", err)
+	}
+	if !got.DefaultShipping || !got.DefaultBilling {
+		t.Fatalf("home lost its defaults: shipping=%v billing=%v", got.DefaultShipping, got.DefaultBilling)
+	}
+}
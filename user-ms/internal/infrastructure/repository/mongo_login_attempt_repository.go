@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/domain"
+)
+
+type MongoLoginAttemptRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMongoLoginAttemptRepository(ctx context.Context, db *mongo.Database) (*MongoLoginAttemptRepository, error) {
+	collection := db.Collection("login_attempts")
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "key", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &MongoLoginAttemptRepository{collection: collection}, nil
+}
+
+func (r *MongoLoginAttemptRepository) Get(ctx context.Context, key string) (*domain.LoginAttempts, error) {
+	var attempts domain.LoginAttempts
+	err := r.collection.FindOne(ctx, bson.M{
+		"key":        key,
+		"expires_at": bson.M{"$gt": time.Now()},
+	}).Decode(&attempts)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return &domain.LoginAttempts{Key: key}, nil
+		}
+		return nil, err
+	}
+	return &attempts, nil
+}
+
+// RecordFailure starts the count over when the attempts expired but the TTL
+// monitor hasn't removed them yet
+func (r *MongoLoginAttemptRepository) RecordFailure(ctx context.Context, key string, at, expiresAt time.Time) (*domain.LoginAttempts, error) {
+	unexpired := bson.M{"$gt": bson.A{"$expires_at", at}}
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"failures": bson.M{"$cond": bson.A{
+				unexpired,
+				bson.M{"$add": bson.A{"$failures", 1}},
+				1,
+			}},
+			"locked_until": bson.M{"$cond": bson.A{unexpired, "$locked_until", "$$REMOVE"}},
+			// A lockout outlasting the window keeps the attempts alive
+			"expires_at": bson.M{"$cond": bson.A{
+				bson.M{"$and": bson.A{unexpired, bson.M{"$gt": bson.A{"$expires_at", expiresAt}}}},
+				"$expires_at",
+				expiresAt,
+			}},
+			"last_failure_at": at,
+		}}},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	var attempts domain.LoginAttempts
+	if err := r.collection.FindOneAndUpdate(ctx, bson.M{"key": key}, update, opts).Decode(&attempts); err != nil {
+		return nil, err
+	}
+	return &attempts, nil
+}
+
+func (r *MongoLoginAttemptRepository) Lock(ctx context.Context, key string, until time.Time) error {
+	_, err := r.collection.UpdateOne(ctx,
+		bson.M{"key": key},
+		bson.M{"$set": bson.M{
+			"failures":     0,
+			"locked_until": until,
+			"expires_at":   until,
+		}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+func (r *MongoLoginAttemptRepository) Reset(ctx context.Context, key string) error {
+	_, err := r.collection.DeleteOne(ctx, bson.M{"key": key})
+	return err
+}
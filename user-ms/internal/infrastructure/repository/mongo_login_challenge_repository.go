@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/domain"
+)
+
+var ErrorLoginChallengeNotFound = errors.New("login challenge not found")
+
+type MongoLoginChallengeRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMongoLoginChallengeRepository(ctx context.Context, db *mongo.Database) (*MongoLoginChallengeRepository, error) {
+	collection := db.Collection("login_challenges")
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "hash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &MongoLoginChallengeRepository{collection: collection}, nil
+}
+
+func (r *MongoLoginChallengeRepository) Create(ctx context.Context, challenge *domain.LoginChallenge) error {
+	challenge.ID = primitive.NewObjectID()
+	challenge.CreatedAt = time.Now()
+	_, err := r.collection.InsertOne(ctx, challenge)
+	return err
+}
+
+func (r *MongoLoginChallengeRepository) Get(ctx context.Context, hash string) (*domain.LoginChallenge, error) {
+	var challenge domain.LoginChallenge
+	err := r.collection.FindOne(ctx, bson.M{
+		"hash":       hash,
+		"expires_at": bson.M{"$gt": time.Now()},
+	}).Decode(&challenge)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrorLoginChallengeNotFound
+		}
+		return nil, err
+	}
+	return &challenge, nil
+}
+
+func (r *MongoLoginChallengeRepository) RecordFailure(ctx context.Context, id primitive.ObjectID) (int, error) {
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var challenge domain.LoginChallenge
+	err := r.collection.FindOneAndUpdate(ctx, bson.M{"_id": id}, bson.M{"$inc": bson.M{"failures": 1}}, opts).Decode(&challenge)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return 0, ErrorLoginChallengeNotFound
+		}
+		return 0, err
+	}
+	return challenge.Failures, nil
+}
+
+func (r *MongoLoginChallengeRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	_, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
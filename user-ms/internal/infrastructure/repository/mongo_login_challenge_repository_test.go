@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/domain"
+)
+
+func TestLoginChallengeExpires(t *testing.T) {
+	repo, err := NewMongoLoginChallengeRepository(context.Background(), testDatabase(t))
+	if err != nil {
+		t.Fatalf("create repository: %v", err)
+	}
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		expiresIn time.Duration
+		want      error
+	}{
+		{"unexpired", time.Minute, nil},
+		{"expired", -time.Second, ErrorLoginChallengeNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := repo.Create(ctx, &domain.LoginChallenge{
+				UserID:    "user",
+				Hash:      tt.name,
+				ExpiresAt: time.Now().Add(tt.expiresIn),
+			})
+			if err != nil {
+				t.Fatalf("create: %v", err)
+			}
+			if _, err := repo.Get(ctx, tt.name); !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoginChallengeCountsFailures(t *testing.T) {
+	repo, err := NewMongoLoginChallengeRepository(context.Background(), testDatabase(t))
+	if err != nil {
+		t.Fatalf("create repository: %v", err)
+	}
+	ctx := context.Background()
+	challenge := &domain.LoginChallenge{UserID: "user", Hash: "hash", ExpiresAt: time.Now().Add(time.Minute)}
+	if err := repo.Create(ctx, challenge); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	for want := 1; want <= 3; want++ {
+		failures, err := repo.RecordFailure(ctx, challenge.ID)
+		if err != nil {
+			t.Fatalf("record failure: %v", err)
+		}
+		if failures != want {
+			t.Fatalf("got %d failures, want %d", failures, want)
+		}
+	}
+
+	if err := repo.Delete(ctx, challenge.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := repo.RecordFailure(ctx, challenge.ID); !errors.Is(err, ErrorLoginChallengeNotFound) {
+		t.Fatalf("got %v, want %v", err, ErrorLoginChallengeNotFound)
+	}
+}
@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/domain"
+)
+
+// ErrorOIDCStateInvalid is returned for unknown, expired and used states
+// alike
+var ErrorOIDCStateInvalid = errors.New("invalid oidc state")
+
+type MongoOIDCStateRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMongoOIDCStateRepository(ctx context.Context, db *mongo.Database) (*MongoOIDCStateRepository, error) {
+	collection := db.Collection("oidc_states")
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "hash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &MongoOIDCStateRepository{collection: collection}, nil
+}
+
+func (r *MongoOIDCStateRepository) Create(ctx context.Context, state *domain.OIDCState) error {
+	state.ID = primitive.NewObjectID()
+	state.CreatedAt = time.Now()
+	_, err := r.collection.InsertOne(ctx, state)
+	return err
+}
+
+// Use only succeeds for the first of concurrent callbacks with a state
+func (r *MongoOIDCStateRepository) Use(ctx context.Context, hash string, at time.Time) (*domain.OIDCState, error) {
+	var state domain.OIDCState
+	err := r.collection.FindOneAndDelete(ctx, bson.M{
+		"hash":       hash,
+		"expires_at": bson.M{"$gt": at},
+	}).Decode(&state)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrorOIDCStateInvalid
+		}
+		return nil, err
+	}
+	return &state, nil
+}
@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/domain"
+)
+
+// ErrorResetTokenInvalid is returned for unknown, expired and used reset
+// tokens alike
+var ErrorResetTokenInvalid = errors.New("invalid password reset token")
+
+type MongoPasswordResetRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMongoPasswordResetRepository(ctx context.Context, db *mongo.Database) (*MongoPasswordResetRepository, error) {
+	collection := db.Collection("password_reset_tokens")
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "hash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}},
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &MongoPasswordResetRepository{collection: collection}, nil
+}
+
+func (r *MongoPasswordResetRepository) Create(ctx context.Context, token *domain.PasswordResetToken) error {
+	token.ID = primitive.NewObjectID()
+	token.CreatedAt = time.Now()
+	_, err := r.collection.InsertOne(ctx, token)
+	return err
+}
+
+// Use only succeeds for the first of concurrent resets with a token
+func (r *MongoPasswordResetRepository) Use(ctx context.Context, hash string, at time.Time) (*domain.PasswordResetToken, error) {
+	var token domain.PasswordResetToken
+	err := r.collection.FindOneAndUpdate(ctx,
+		bson.M{
+			"hash":       hash,
+			"used_at":    bson.M{"$exists": false},
+			"expires_at": bson.M{"$gt": at},
+		},
+		bson.M{"$set": bson.M{"used_at": at}},
+	).Decode(&token)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrorResetTokenInvalid
+		}
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (r *MongoPasswordResetRepository) DeleteByUser(ctx context.Context, userID string) error {
+	_, err := r.collection.DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
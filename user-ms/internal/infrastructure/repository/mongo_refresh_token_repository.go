@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/domain"
+)
+
+var (
+	ErrorRefreshTokenNotFound = errors.New("refresh token not found")
+	// ErrorRefreshTokenUsed is returned when rotating a token that was
+	// already rotated or revoked
+	ErrorRefreshTokenUsed = errors.New("refresh token already used")
+)
+
+type MongoRefreshTokenRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMongoRefreshTokenRepository(ctx context.Context, db *mongo.Database) (*MongoRefreshTokenRepository, error) {
+	collection := db.Collection("refresh_tokens")
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "hash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "family", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}},
+		},
+		{
+			// Rotated tokens are kept until they expire to catch their reuse
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &MongoRefreshTokenRepository{collection: collection}, nil
+}
+
+func (r *MongoRefreshTokenRepository) Create(ctx context.Context, token *domain.RefreshToken) error {
+	token.ID = primitive.NewObjectID()
+	token.CreatedAt = time.Now()
+	_, err := r.collection.InsertOne(ctx, token)
+	return err
+}
+
+func (r *MongoRefreshTokenRepository) GetByHash(ctx context.Context, hash string) (*domain.RefreshToken, error) {
+	var token domain.RefreshToken
+	err := r.collection.FindOne(ctx, bson.M{"hash": hash}).Decode(&token)
+	if err != nil {
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, err
+		}
+		return nil, ErrorRefreshTokenNotFound
+	}
+	return &token, nil
+}
+
+// Rotate only succeeds for the first of concurrent refreshes with a token
+func (r *MongoRefreshTokenRepository) Rotate(ctx context.Context, id primitive.ObjectID, at time.Time) error {
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{
+			"_id":        id,
+			"rotated_at": bson.M{"$exists": false},
+			"revoked_at": bson.M{"$exists": false},
+		},
+		bson.M{"$set": bson.M{"rotated_at": at}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount == 0 {
+		return ErrorRefreshTokenUsed
+	}
+	return nil
+}
+
+func (r *MongoRefreshTokenRepository) RevokeFamily(ctx context.Context, family string, at time.Time) ([]*domain.RefreshToken, error) {
+	return r.revoke(ctx, bson.M{"family": family}, at)
+}
+
+func (r *MongoRefreshTokenRepository) RevokeUser(ctx context.Context, userID string, at time.Time) ([]*domain.RefreshToken, error) {
+	return r.revoke(ctx, bson.M{"user_id": userID}, at)
+}
+
+func (r *MongoRefreshTokenRepository) revoke(ctx context.Context, filter bson.M, at time.Time) ([]*domain.RefreshToken, error) {
+	filter["revoked_at"] = bson.M{"$exists": false}
+	cursor, err := r.collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var tokens []*domain.RefreshToken
+	if err := cursor.All(ctx, &tokens); err != nil {
+		return nil, err
+	}
+
+	if _, err := r.collection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"revoked_at": at}}); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
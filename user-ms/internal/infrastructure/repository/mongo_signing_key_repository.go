@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/domain"
+)
+
+// ErrorSigningKeyExists is returned when another instance already rotated
+// the previous key
+var ErrorSigningKeyExists = errors.New("signing key already rotated")
+
+type MongoSigningKeyRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMongoSigningKeyRepository(ctx context.Context, db *mongo.Database) (*MongoSigningKeyRepository, error) {
+	collection := db.Collection("signing_keys")
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "kid", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			// Instances rotating at once create a single next key
+			Keys: bson.D{{Key: "previous_kid", Value: 1}},
+			Options: options.Index().SetUnique(true).
+				SetPartialFilterExpression(bson.M{"previous_kid": bson.M{"$exists": true}}),
+		},
+		{
+			// Retired keys are dropped once their tokens expired
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &MongoSigningKeyRepository{collection: collection}, nil
+}
+
+func (r *MongoSigningKeyRepository) Create(ctx context.Context, key *domain.SigningKey) error {
+	key.ID = primitive.NewObjectID()
+	key.CreatedAt = time.Now()
+	_, err := r.collection.InsertOne(ctx, key)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrorSigningKeyExists
+	}
+	return err
+}
+
+func (r *MongoSigningKeyRepository) List(ctx context.Context) ([]*domain.SigningKey, error) {
+	// The TTL monitor only runs every minute
+	filter := bson.M{"$or": bson.A{
+		bson.M{"expires_at": bson.M{"$exists": false}},
+		bson.M{"expires_at": bson.M{"$gt": time.Now()}},
+	}}
+	opts := options.Find().SetSort(bson.D{{Key: "active_at", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var keys []*domain.SigningKey
+	if err := cursor.All(ctx, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (r *MongoSigningKeyRepository) RetireOthers(ctx context.Context, current primitive.ObjectID, expiresAt time.Time) error {
+	_, err := r.collection.UpdateMany(ctx,
+		bson.M{
+			"_id":        bson.M{"$ne": current},
+			"expires_at": bson.M{"$exists": false},
+		},
+		bson.M{"$set": bson.M{"expires_at": expiresAt}},
+	)
+	return err
+}
@@ -15,6 +15,10 @@ import (
 
 var (
 	ErrorUserNotFound = errors.New("user not found")
+	// ErrorTOTPCodeUsed is returned for codes of a time step no later than
+	// the last accepted one
+	ErrorTOTPCodeUsed        = errors.New("totp code already used")
+	ErrorRecoveryCodeInvalid = errors.New("invalid recovery code")
 )
 
 type MongoUserRepository struct {
@@ -66,21 +70,65 @@ func (r *MongoUserRepository) GetByEmail(ctx context.Context, email string) (*do
 	return &user, nil
 }
 
+func (r *MongoUserRepository) GetByIdentity(ctx context.Context, provider, subject string) (*domain.User, error) {
+	var user domain.User
+	err := r.collection.FindOne(ctx, bson.M{"identities": bson.M{"$elemMatch": bson.M{
+		"provider": provider,
+		"subject":  subject,
+	}}}).Decode(&user)
+	if err != nil {
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, err
+		}
+		return nil, ErrorUserNotFound
+	}
+
+	return &user, nil
+}
+
+// Update saves the profile of a user, its email, password and roles are left
+// as they are
 func (r *MongoUserRepository) Update(ctx context.Context, id string, user *domain.User) (*domain.User, error) {
 	objectID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		return nil, err
+		return nil, ErrorUserNotFound
 	}
 
-	user.UpdatedAt = time.Now()
-	update := bson.M{"$set": user}
+	update := bson.M{"$set": bson.M{
+		"first_name": user.FirstName,
+		"last_name":  user.LastName,
+		"address":    user.Address,
+		"updated_at": time.Now(),
+	}}
 	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
-	var updatedUser *domain.User
-	if err := r.collection.FindOneAndUpdate(ctx, bson.M{"_id": objectID}, update, opts).Decode(updatedUser); err != nil {
+	var updatedUser domain.User
+	if err := r.collection.FindOneAndUpdate(ctx, bson.M{"_id": objectID}, update, opts).Decode(&updatedUser); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrorUserNotFound
+		}
 		return nil, err
 	}
 
-	return updatedUser, nil
+	return &updatedUser, nil
+}
+
+func (r *MongoUserRepository) UpdatePassword(ctx context.Context, id, passwordHash string) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrorUserNotFound
+	}
+
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": objectID},
+		bson.M{"$set": bson.M{"password": passwordHash, "updated_at": time.Now()}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrorUserNotFound
+	}
+	return nil
 }
 
 func (r *MongoUserRepository) Delete(ctx context.Context, id string) error {
@@ -112,3 +160,103 @@ func (r *MongoUserRepository) List(ctx context.Context, limit, offset int) ([]*d
 
 	return users, nil
 }
+
+func (r *MongoUserRepository) AddRole(ctx context.Context, id, role string) (*domain.User, error) {
+	return r.findAndUpdate(ctx, id, bson.M{"$addToSet": bson.M{"roles": role}})
+}
+
+func (r *MongoUserRepository) RemoveRole(ctx context.Context, id, role string) (*domain.User, error) {
+	return r.findAndUpdate(ctx, id, bson.M{"$pull": bson.M{"roles": role}})
+}
+
+func (r *MongoUserRepository) Verify(ctx context.Context, id string, at time.Time) (*domain.User, error) {
+	return r.findAndUpdate(ctx, id, bson.M{"$set": bson.M{
+		"status":      domain.UserStatusActive,
+		"verified_at": at,
+	}})
+}
+
+func (r *MongoUserRepository) SetTwoFactor(ctx context.Context, id string, twoFactor *domain.TwoFactor) error {
+	update := bson.M{"$set": bson.M{"two_factor": twoFactor, "updated_at": time.Now()}}
+	if twoFactor == nil {
+		update = bson.M{
+			"$unset": bson.M{"two_factor": ""},
+			"$set":   bson.M{"updated_at": time.Now()},
+		}
+	}
+	return r.updateOne(ctx, id, nil, update, ErrorUserNotFound)
+}
+
+// UseTOTPCounter only succeeds for the first of concurrent logins with a code
+func (r *MongoUserRepository) UseTOTPCounter(ctx context.Context, id string, counter int64) error {
+	return r.updateOne(ctx, id,
+		bson.M{
+			"two_factor.confirmed_at": bson.M{"$exists": true},
+			"two_factor.last_counter": bson.M{"$not": bson.M{"$gte": counter}},
+		},
+		bson.M{"$set": bson.M{"two_factor.last_counter": counter}},
+		ErrorTOTPCodeUsed,
+	)
+}
+
+func (r *MongoUserRepository) UseRecoveryCode(ctx context.Context, id, hash string) error {
+	return r.updateOne(ctx, id,
+		bson.M{"two_factor.recovery_codes": hash},
+		bson.M{"$pull": bson.M{"two_factor.recovery_codes": hash}},
+		ErrorRecoveryCodeInvalid,
+	)
+}
+
+func (r *MongoUserRepository) SetTwoFactorRequired(ctx context.Context, id string, required bool) (*domain.User, error) {
+	return r.findAndUpdate(ctx, id, bson.M{"$set": bson.M{"two_factor_required": required}})
+}
+
+func (r *MongoUserRepository) LinkIdentity(ctx context.Context, id string, identity domain.ExternalIdentity) (*domain.User, error) {
+	return r.findAndUpdate(ctx, id, bson.M{"$push": bson.M{"identities": identity}})
+}
+
+// updateOne applies update to a user matching filter, unmatched is returned
+// when there's none
+func (r *MongoUserRepository) updateOne(ctx context.Context, id string, filter, update bson.M, unmatched error) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrorUserNotFound
+	}
+	if filter == nil {
+		filter = bson.M{}
+	}
+	filter["_id"] = objectID
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return unmatched
+	}
+	return nil
+}
+
+// findAndUpdate applies update to a user and returns the result
+func (r *MongoUserRepository) findAndUpdate(ctx context.Context, id string, update bson.M) (*domain.User, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrorUserNotFound
+	}
+
+	set, ok := update["$set"].(bson.M)
+	if !ok {
+		set = bson.M{}
+		update["$set"] = set
+	}
+	set["updated_at"] = time.Now()
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var user domain.User
+	if err := r.collection.FindOneAndUpdate(ctx, bson.M{"_id": objectID}, update, opts).Decode(&user); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrorUserNotFound
+		}
+		return nil, err
+	}
+	return &user, nil
+}
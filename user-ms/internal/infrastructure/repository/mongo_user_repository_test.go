@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/domain"
+)
+
+func testUserWithTwoFactor(t *testing.T, repo *MongoUserRepository, recoveryCodes ...string) *domain.User {
+	t.Helper()
+	confirmedAt := time.Now()
+	user, err := repo.Create(context.Background(), &domain.User{
+		Email: "jane@example.com",
+		TwoFactor: &domain.TwoFactor{
+			Secret:        "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ",
+			ConfirmedAt:   &confirmedAt,
+			RecoveryCodes: recoveryCodes,
+			LastCounter:   100,
+		},
+	})
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return user
+}
+
+func TestUseTOTPCounterOnceAndInOrder(t *testing.T) {
+	repo := NewMongoUserRepository(testDatabase(t))
+	ctx := context.Background()
+	id := testUserWithTwoFactor(t, repo).ID.Hex()
+
+	tests := []struct {
+		name    string
+		counter int64
+		want    error
+	}{
+		{"last accepted step", 100, ErrorTOTPCodeUsed},
+		{"earlier step", 99, ErrorTOTPCodeUsed},
+		{"next step", 101, nil},
+		{"next step again", 101, ErrorTOTPCodeUsed},
+		{"skipped step", 103, nil},
+		{"step skipped over", 102, ErrorTOTPCodeUsed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := repo.UseTOTPCounter(ctx, id, tt.counter); !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestUseRecoveryCodeOnce(t *testing.T) {
+	repo := NewMongoUserRepository(testDatabase(t))
+	ctx := context.Background()
+	id := testUserWithTwoFactor(t, repo, "first", "second").ID.Hex()
+
+	tests := []struct {
+		name string
+		hash string
+		want error
+	}{
+		{"first use", "first", nil},
+		{"second use", "first", ErrorRecoveryCodeInvalid},
+		{"unknown code", "third", ErrorRecoveryCodeInvalid},
+		{"other code", "second", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := repo.UseRecoveryCode(ctx, id, tt.hash); !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	user, err := repo.GetByID(ctx, id)
+	if err != nil {
+		t.Fatalf("get user: %v", err)
+	}
+	if len(user.TwoFactor.RecoveryCodes) != 0 {
+		t.Fatalf("got codes %v left, want none", user.TwoFactor.RecoveryCodes)
+	}
+}
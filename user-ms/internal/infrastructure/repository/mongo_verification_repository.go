@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/domain"
+)
+
+var (
+	// ErrorVerificationTokenInvalid is returned for unknown, expired and
+	// used verification tokens alike
+	ErrorVerificationTokenInvalid  = errors.New("invalid verification token")
+	ErrorVerificationTokenNotFound = errors.New("verification token not found")
+)
+
+type MongoVerificationRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMongoVerificationRepository(ctx context.Context, db *mongo.Database) (*MongoVerificationRepository, error) {
+	collection := db.Collection("verification_tokens")
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "hash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}},
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &MongoVerificationRepository{collection: collection}, nil
+}
+
+func (r *MongoVerificationRepository) Create(ctx context.Context, token *domain.VerificationToken) error {
+	token.ID = primitive.NewObjectID()
+	token.CreatedAt = time.Now()
+	_, err := r.collection.InsertOne(ctx, token)
+	return err
+}
+
+// Use only succeeds for the first of concurrent verifications with a token
+func (r *MongoVerificationRepository) Use(ctx context.Context, hash string, at time.Time) (*domain.VerificationToken, error) {
+	var token domain.VerificationToken
+	err := r.collection.FindOneAndDelete(ctx, bson.M{
+		"hash":       hash,
+		"expires_at": bson.M{"$gt": at},
+	}).Decode(&token)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrorVerificationTokenInvalid
+		}
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (r *MongoVerificationRepository) Latest(ctx context.Context, userID string) (*domain.VerificationToken, error) {
+	var token domain.VerificationToken
+	opts := options.FindOne().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	if err := r.collection.FindOne(ctx, bson.M{"user_id": userID}, opts).Decode(&token); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrorVerificationTokenNotFound
+		}
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (r *MongoVerificationRepository) DeleteByUser(ctx context.Context, userID string) error {
+	_, err := r.collection.DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
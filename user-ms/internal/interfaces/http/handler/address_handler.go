@@ -0,0 +1,203 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/application/dto"
+	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/application/service"
+	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/domain"
+	sharedMiddleware "github.com/kaleabAlemayehu/eagle-commerce/shared/middleware"
+	"github.com/kaleabAlemayehu/eagle-commerce/shared/utils"
+)
+
+// @Summary List my addresses
+// @Description List the address book of the authenticated user, oldest first
+// @Tags addresses
+// @Produce json
+// @Success 200 {object} dto.Response
+// @Failure 401 {object} dto.Response
+// @Router /users/me/addresses [get]
+func (h *UserHandler) ListAddresses(w http.ResponseWriter, r *http.Request) {
+	claims, ok := sharedMiddleware.GetUserFromContext(r.Context())
+	if !ok {
+		utils.SendErrorResponse(w, http.StatusUnauthorized, "User authentication required")
+		return
+	}
+
+	addresses, err := h.userService.ListAddresses(r.Context(), claims.UserID)
+	if err != nil {
+		h.sendAddressError(w, err)
+		return
+	}
+	res := make([]dto.SavedAddressResponse, len(addresses))
+	for i, address := range addresses {
+		res[i] = *toSavedAddressResponse(address)
+	}
+	utils.SendSuccessResponse(w, http.StatusOK, res)
+}
+
+// @Summary Add an address
+// @Description Add an address to the address book of the authenticated user. The first address becomes the default for shipping and billing, flagging another as a default takes the flag over.
+// @Tags addresses
+// @Accept json
+// @Produce json
+// @Param address body dto.SavedAddressRequest true "Address"
+// @Success 201 {object} dto.Response
+// @Failure 400 {object} dto.Response
+// @Failure 401 {object} dto.Response
+// @Failure 409 {object} dto.Response
+// @Router /users/me/addresses [post]
+func (h *UserHandler) AddAddress(w http.ResponseWriter, r *http.Request) {
+	claims, ok := sharedMiddleware.GetUserFromContext(r.Context())
+	if !ok {
+		utils.SendErrorResponse(w, http.StatusUnauthorized, "User authentication required")
+		return
+	}
+	address, ok := decodeSavedAddress(w, r)
+	if !ok {
+		return
+	}
+
+	created, err := h.userService.AddAddress(r.Context(), claims.UserID, address)
+	if err != nil {
+		h.sendAddressError(w, err)
+		return
+	}
+	utils.SendSuccessResponse(w, http.StatusCreated, toSavedAddressResponse(created))
+}
+
+// @Summary Get my address
+// @Description Get an address from the address book of the authenticated user
+// @Tags addresses
+// @Produce json
+// @Param addressID path string true "Address ID"
+// @Success 200 {object} dto.Response
+// @Failure 401 {object} dto.Response
+// @Failure 404 {object} dto.Response
+// @Router /users/me/addresses/{addressID} [get]
+func (h *UserHandler) GetAddress(w http.ResponseWriter, r *http.Request) {
+	claims, ok := sharedMiddleware.GetUserFromContext(r.Context())
+	if !ok {
+		utils.SendErrorResponse(w, http.StatusUnauthorized, "User authentication required")
+		return
+	}
+
+	address, err := h.userService.GetAddress(r.Context(), claims.UserID, chi.URLParam(r, "addressID"))
+	if err != nil {
+		h.sendAddressError(w, err)
+		return
+	}
+	utils.SendSuccessResponse(w, http.StatusOK, toSavedAddressResponse(address))
+}
+
+// @Summary Update my address
+// @Description Replace an address in the address book of the authenticated user, flagging it as a default takes the flag over
+// @Tags addresses
+// @Accept json
+// @Produce json
+// @Param addressID path string true "Address ID"
+// @Param address body dto.SavedAddressRequest true "Address"
+// @Success 200 {object} dto.Response
+// @Failure 400 {object} dto.Response
+// @Failure 401 {object} dto.Response
+// @Failure 404 {object} dto.Response
+// @Router /users/me/addresses/{addressID} [put]
+func (h *UserHandler) UpdateAddress(w http.ResponseWriter, r *http.Request) {
+	claims, ok := sharedMiddleware.GetUserFromContext(r.Context())
+	if !ok {
+		utils.SendErrorResponse(w, http.StatusUnauthorized, "User authentication required")
+		return
+	}
+	address, ok := decodeSavedAddress(w, r)
+	if !ok {
+		return
+	}
+
+	updated, err := h.userService.UpdateAddress(r.Context(), claims.UserID, chi.URLParam(r, "addressID"), address)
+	if err != nil {
+		h.sendAddressError(w, err)
+		return
+	}
+	utils.SendSuccessResponse(w, http.StatusOK, toSavedAddressResponse(updated))
+}
+
+// @Summary Delete my address
+// @Description Remove an address from the address book of the authenticated user, orders keep the copy they were placed with
+// @Tags addresses
+// @Produce json
+// @Param addressID path string true "Address ID"
+// @Success 200 {object} dto.Response
+// @Failure 401 {object} dto.Response
+// @Failure 404 {object} dto.Response
+// @Router /users/me/addresses/{addressID} [delete]
+func (h *UserHandler) DeleteAddress(w http.ResponseWriter, r *http.Request) {
+	claims, ok := sharedMiddleware.GetUserFromContext(r.Context())
+	if !ok {
+		utils.SendErrorResponse(w, http.StatusUnauthorized, "User authentication required")
+		return
+	}
+
+	if err := h.userService.DeleteAddress(r.Context(), claims.UserID, chi.URLParam(r, "addressID")); err != nil {
+		h.sendAddressError(w, err)
+		return
+	}
+	utils.SendSuccessResponse(w, http.StatusOK, "Address deleted")
+}
+
+func (h *UserHandler) sendAddressError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrAddressNotFound):
+		utils.SendErrorResponse(w, http.StatusNotFound, "Address not found")
+	case errors.Is(err, service.ErrAddressBookFull):
+		utils.SendErrorResponse(w, http.StatusConflict, "Address book full, delete an address first")
+	default:
+		log.Printf("Failed to update address book: %v", err)
+		utils.SendErrorResponse(w, http.StatusInternalServerError, "Failed to update address book")
+	}
+}
+
+// decodeSavedAddress reads and validates the address of a request, sending
+// the error response when it's invalid
+func decodeSavedAddress(w http.ResponseWriter, r *http.Request) (*domain.SavedAddress, bool) {
+	var req dto.SavedAddressRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.SendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return nil, false
+	}
+	if err := utils.ValidateStruct(req); err != nil {
+		utils.SendValidationErrorResponse(w, utils.GetValidationErrors(err))
+		return nil, false
+	}
+	return &domain.SavedAddress{
+		Label: req.Label,
+		Address: domain.Address{
+			Street:  req.Street,
+			City:    req.City,
+			State:   req.State,
+			ZipCode: req.ZipCode,
+			Country: req.Country,
+		},
+		DefaultShipping: req.DefaultShipping,
+		DefaultBilling:  req.DefaultBilling,
+	}, true
+}
+
+func toSavedAddressResponse(address *domain.SavedAddress) *dto.SavedAddressResponse {
+	return &dto.SavedAddressResponse{
+		ID:              address.ID.Hex(),
+		Label:           address.Label,
+		Street:          address.Address.Street,
+		City:            address.Address.City,
+		State:           address.Address.State,
+		ZipCode:         address.Address.ZipCode,
+		Country:         address.Address.Country,
+		DefaultShipping: address.DefaultShipping,
+		DefaultBilling:  address.DefaultBilling,
+		CreatedAt:       address.CreatedAt,
+		UpdatedAt:       address.UpdatedAt,
+	}
+}
@@ -0,0 +1,28 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/application/service"
+)
+
+type JWKSHandler struct {
+	keys *service.SigningKeys
+}
+
+func NewJWKSHandler(keys *service.SigningKeys) *JWKSHandler {
+	return &JWKSHandler{
+		keys: keys,
+	}
+}
+
+// GetJWKS serves the public keys access tokens are signed with as a JSON Web
+// Key Set, tokens name their key in the kid header. It lives outside the
+// API base path, where verifiers look for it.
+func (h *JWKSHandler) GetJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	// Verifiers refetch the keys every five minutes anyway
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(h.keys.JWKS())
+}
@@ -1,17 +1,33 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"math"
+	"net"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/application/dto"
+	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/application/service"
 	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/domain"
+	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/infrastructure/oidc"
+	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/infrastructure/repository"
+	sharedMiddleware "github.com/kaleabAlemayehu/eagle-commerce/shared/middleware"
 	"github.com/kaleabAlemayehu/eagle-commerce/shared/utils"
 )
 
+// passwordResetTimeout bounds the password reset requests running after
+// the response was sent
+const passwordResetTimeout = 10 * time.Second
+
 type UserHandler struct {
 	userService domain.UserService
 }
@@ -23,14 +39,14 @@ func NewUserHandler(userService domain.UserService) *UserHandler {
 }
 
 // @Summary Create a new user
-// @Description Create a new user with email and password
+// @Description Create an unverified user with email and password, a verification token is sent through the user.verification_requested event
 // @Tags users
 // @Accept json
 // @Produce json
 // @Param user body dto.CreateUserRequest true "User data"
 // @Success 201 {object} dto.Response
 // @Failure 400 {object} dto.Response
-// @Router /signup [post]
+// @Router /users/signup [post]
 func (h *UserHandler) RegisterUser(w http.ResponseWriter, r *http.Request) {
 	var req dto.CreateUserRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -45,7 +61,7 @@ func (h *UserHandler) RegisterUser(w http.ResponseWriter, r *http.Request) {
 		LastName:  req.LastName,
 	}
 
-	newUser, token, err := h.userService.RegisterUser(r.Context(), user)
+	newUser, tokens, err := h.userService.RegisterUser(r.Context(), user)
 	if err != nil {
 		if validationErrors := utils.GetValidationErrors(err); len(validationErrors) > 0 {
 			utils.SendValidationErrorResponse(w, validationErrors)
@@ -55,24 +71,45 @@ func (h *UserHandler) RegisterUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	registerRes := dto.AuthResponse{
-		User:  h.toUserResponse(newUser),
-		Token: token,
+	utils.SendSuccessResponse(w, http.StatusCreated, h.toAuthResponse(newUser, tokens))
+}
+
+// @Summary Get my profile
+// @Description Get the details of the authenticated user
+// @Tags users
+// @Produce json
+// @Success 200 {object} dto.Response
+// @Failure 401 {object} dto.Response
+// @Failure 404 {object} dto.Response
+// @Router /users/me [get]
+func (h *UserHandler) GetMe(w http.ResponseWriter, r *http.Request) {
+	claims, ok := sharedMiddleware.GetUserFromContext(r.Context())
+	if !ok {
+		utils.SendErrorResponse(w, http.StatusUnauthorized, "User authentication required")
+		return
 	}
-	utils.SendSuccessResponse(w, http.StatusCreated, registerRes)
+	h.sendUser(w, r, claims.UserID)
 }
 
 // @Summary Get user by ID
-// @Description Get user details by ID
+// @Description Get user details by ID, only staff may get other users
 // @Tags users
 // @Produce json
 // @Param id path string true "User ID"
 // @Success 200 {object} dto.Response
+// @Failure 403 {object} dto.Response
 // @Failure 404 {object} dto.Response
 // @Router /users/{id} [get]
 func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
+	if !sharedMiddleware.CanAccess(r.Context(), id, sharedMiddleware.PermissionUsersRead) {
+		utils.SendErrorResponse(w, http.StatusForbidden, "Not allowed to view other users")
+		return
+	}
+	h.sendUser(w, r, id)
+}
 
+func (h *UserHandler) sendUser(w http.ResponseWriter, r *http.Request, id string) {
 	user, err := h.userService.GetUser(r.Context(), id)
 	if err != nil {
 		utils.SendErrorResponse(w, http.StatusNotFound, "User not found")
@@ -90,6 +127,7 @@ func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
 // @Param limit query int false "Limit" default(10)
 // @Param offset query int false "Offset" default(0)
 // @Success 200 {object} dto.Response
+// @Failure 403 {object} dto.Response
 // @Router /users [get]
 func (h *UserHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
 	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
@@ -112,17 +150,48 @@ func (h *UserHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
 	utils.SendSuccessResponse(w, http.StatusOK, userListRes)
 }
 
+// @Summary Update my profile
+// @Description Update the details of the authenticated user, fields left out are kept
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param user body dto.UpdateUserRequest true "User details"
+// @Success 200 {object} dto.Response
+// @Failure 400 {object} dto.Response
+// @Failure 401 {object} dto.Response
+// @Failure 404 {object} dto.Response
+// @Router /users/me [put]
+func (h *UserHandler) UpdateMe(w http.ResponseWriter, r *http.Request) {
+	claims, ok := sharedMiddleware.GetUserFromContext(r.Context())
+	if !ok {
+		utils.SendErrorResponse(w, http.StatusUnauthorized, "User authentication required")
+		return
+	}
+	h.updateUser(w, r, claims.UserID)
+}
+
 // @Summary Put user by ID
-// @Description Update user details by ID
+// @Description Update user details by ID, fields left out are kept. Only admins may update other users.
 // @Tags users
+// @Accept json
 // @Produce json
 // @Param id path string true "User ID"
-// @Success 201 {object} dto.Response
+// @Param user body dto.UpdateUserRequest true "User details"
+// @Success 200 {object} dto.Response
 // @Failure 400 {object} dto.Response
+// @Failure 403 {object} dto.Response
 // @Failure 404 {object} dto.Response
 // @Router /users/{id} [put]
 func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
+	if !sharedMiddleware.CanAccess(r.Context(), id, sharedMiddleware.PermissionUsersWrite) {
+		utils.SendErrorResponse(w, http.StatusForbidden, "Not allowed to update other users")
+		return
+	}
+	h.updateUser(w, r, id)
+}
+
+func (h *UserHandler) updateUser(w http.ResponseWriter, r *http.Request, id string) {
 	var req dto.UpdateUserRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		utils.SendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
@@ -131,18 +200,23 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	user := &domain.User{
 		FirstName: req.FirstName,
 		LastName:  req.LastName,
-		Address: domain.Address{
+	}
+	if req.Address != nil {
+		user.Address = domain.Address{
 			Street:  req.Address.Street,
 			City:    req.Address.City,
 			State:   req.Address.State,
 			ZipCode: req.Address.ZipCode,
 			Country: req.Address.Country,
-		},
-		UpdatedAt: time.Now(),
+		}
 	}
 
 	updatedUser, err := h.userService.UpdateUser(r.Context(), id, user)
 	if err != nil {
+		if validationErrors := utils.GetValidationErrors(err); len(validationErrors) > 0 {
+			utils.SendValidationErrorResponse(w, validationErrors)
+			return
+		}
 		utils.SendErrorResponse(w, http.StatusNotFound, "User not found")
 		return
 	}
@@ -157,6 +231,7 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 // @Produce json
 // @Param id path string true "User ID"
 // @Success 200 {object} dto.Response
+// @Failure 403 {object} dto.Response
 // @Failure 404 {object} dto.Response
 // @Router /users/{id} [delete]
 func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
@@ -169,12 +244,15 @@ func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 }
 
 // @Summary Login user
-// @Description Login user
+// @Description Login user. Users with a second factor get a challenge token instead, to present with a code at /users/login/two-factor. Failed logins for an account make the following ones wait a growing delay and lock the account out past a threshold, failed logins from a client IP lock it out too.
 // @Tags users
+// @Accept json
 // @Produce json
+// @Param credentials body dto.LoginRequest true "Email and password"
 // @Success 200 {object} dto.Response
 // @Failure 400 {object} dto.Response
 // @Failure 401 {object} dto.Response
+// @Failure 429 {object} dto.Response
 // @Router /users/login [post]
 func (h *UserHandler) LoginUser(w http.ResponseWriter, r *http.Request) {
 	var req dto.LoginRequest
@@ -182,24 +260,727 @@ func (h *UserHandler) LoginUser(w http.ResponseWriter, r *http.Request) {
 		utils.SendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
-	user, token, err := h.userService.AuthenticateUser(r.Context(), req.Email, req.Password)
+	result, err := h.userService.AuthenticateUser(r.Context(), req.Email, req.Password, clientIP(r))
 	if err != nil {
+		h.sendLoginError(w, err)
+		return
+	}
+
+	h.sendLoginResult(w, result)
+}
+
+// @Summary List login providers
+// @Description List the OpenID Connect providers users can log in with
+// @Tags users
+// @Produce json
+// @Success 200 {object} dto.Response
+// @Router /users/login/oidc/providers [get]
+func (h *UserHandler) ListLoginProviders(w http.ResponseWriter, r *http.Request) {
+	providers := h.userService.LoginProviders()
+	res := make([]dto.LoginProviderResponse, len(providers))
+	for i, provider := range providers {
+		res[i] = dto.LoginProviderResponse{Name: provider.Name, DisplayName: provider.DisplayName}
+	}
+	utils.SendSuccessResponse(w, http.StatusOK, res)
+}
+
+// @Summary Start a login with a provider
+// @Description Start logging in with an OpenID Connect provider using the authorization code flow with PKCE. Send the user to the authorization URL, the provider sends them back to the redirect URI with the state and a code for /users/login/oidc/{provider}/callback.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param provider path string true "Provider name"
+// @Param request body dto.OIDCAuthorizeRequest false "Redirect URI"
+// @Success 200 {object} dto.Response
+// @Failure 400 {object} dto.Response
+// @Failure 404 {object} dto.Response
+// @Failure 502 {object} dto.Response
+// @Router /users/login/oidc/{provider}/authorize [post]
+func (h *UserHandler) StartOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	var req dto.OIDCAuthorizeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		utils.SendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	authorization, err := h.userService.StartOIDCLogin(r.Context(), chi.URLParam(r, "provider"), req.RedirectURI)
+	if err != nil {
+		h.sendOIDCError(w, err)
+		return
+	}
+	utils.SendSuccessResponse(w, http.StatusOK, &dto.OIDCAuthorizeResponse{
+		AuthorizationURL: authorization.URL,
+		State:            authorization.State,
+		ExpiresAt:        authorization.ExpiresAt,
+	})
+}
+
+// @Summary Complete a login with a provider
+// @Description Trade the state and code the provider sent the user back with for tokens. The first login links the provider's identity to the user with the same email, or creates one, when the provider verified the email. A user with the email who hasn't verified it has to do so before the identity can be linked. Users with a second factor get a challenge token instead, like at /users/login.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param provider path string true "Provider name"
+// @Param request body dto.OIDCCallbackRequest true "State and authorization code"
+// @Success 200 {object} dto.Response
+// @Failure 400 {object} dto.Response
+// @Failure 401 {object} dto.Response
+// @Failure 403 {object} dto.Response
+// @Failure 404 {object} dto.Response
+// @Failure 409 {object} dto.Response
+// @Failure 502 {object} dto.Response
+// @Router /users/login/oidc/{provider}/callback [post]
+func (h *UserHandler) CompleteOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	var req dto.OIDCCallbackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.SendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := utils.ValidateStruct(req); err != nil {
+		utils.SendValidationErrorResponse(w, utils.GetValidationErrors(err))
+		return
+	}
+
+	result, err := h.userService.CompleteOIDCLogin(r.Context(), chi.URLParam(r, "provider"), req.State, req.Code)
+	if err != nil {
+		h.sendOIDCError(w, err)
+		return
+	}
+	h.sendLoginResult(w, result)
+}
+
+func (h *UserHandler) sendOIDCError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrUnknownProvider):
+		utils.SendErrorResponse(w, http.StatusNotFound, "Unknown login provider")
+	case errors.Is(err, service.ErrInvalidRedirectURI):
+		utils.SendErrorResponse(w, http.StatusBadRequest, "Redirect URI not allowed")
+	case errors.Is(err, service.ErrInvalidOIDCLogin):
+		utils.SendErrorResponse(w, http.StatusUnauthorized, "Invalid or expired login")
+	case errors.Is(err, service.ErrEmailNotVerified):
+		utils.SendErrorResponse(w, http.StatusForbidden, "The provider didn't verify the email")
+	case errors.Is(err, service.ErrUserNotVerified):
+		utils.SendErrorResponse(w, http.StatusConflict, "Verify the email of your account before logging in with the provider")
+	case errors.Is(err, oidc.ErrProviderUnavailable):
+		log.Printf("Failed to reach login provider: %v", err)
+		utils.SendErrorResponse(w, http.StatusBadGateway, "Login provider unavailable")
+	default:
+		log.Printf("Failed to log in with provider: %v", err)
+		utils.SendErrorResponse(w, http.StatusInternalServerError, "Failed to log in")
+	}
+}
+
+// sendLoginResult sends the tokens of a login, or the challenge when it
+// needs a second factor
+func (h *UserHandler) sendLoginResult(w http.ResponseWriter, result *domain.LoginResult) {
+	if result.Challenge != nil {
+		utils.SendSuccessResponse(w, http.StatusOK, &dto.TwoFactorChallengeResponse{
+			TwoFactorRequired:  true,
+			ChallengeToken:     result.Challenge.Token,
+			EnrollmentRequired: result.Challenge.EnrollmentRequired,
+			ExpiresAt:          result.Challenge.ExpiresAt,
+		})
+		return
+	}
+	utils.SendSuccessResponse(w, http.StatusOK, h.toAuthResponse(result.User, result.Tokens))
+}
+
+// @Summary Login with a second factor
+// @Description Trade the challenge token of a login and a TOTP or recovery code for tokens. A challenge takes a few wrong codes before the password has to be presented again. After enrolling at /users/login/two-factor/enroll, the first code enables the second factor and the response carries the recovery codes.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body dto.TwoFactorLoginRequest true "Challenge token and code"
+// @Success 200 {object} dto.Response
+// @Failure 400 {object} dto.Response
+// @Failure 401 {object} dto.Response
+// @Failure 429 {object} dto.Response
+// @Router /users/login/two-factor [post]
+func (h *UserHandler) VerifyTwoFactorLogin(w http.ResponseWriter, r *http.Request) {
+	var req dto.TwoFactorLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.SendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := utils.ValidateStruct(req); err != nil {
+		utils.SendValidationErrorResponse(w, utils.GetValidationErrors(err))
+		return
+	}
+
+	result, err := h.userService.VerifyTwoFactorLogin(r.Context(), req.ChallengeToken, req.Code, clientIP(r))
+	if err != nil {
+		h.sendLoginError(w, err)
+		return
+	}
+	res := h.toAuthResponse(result.User, result.Tokens)
+	res.RecoveryCodes = result.RecoveryCodes
+	utils.SendSuccessResponse(w, http.StatusOK, res)
+}
+
+// @Summary Enroll a second factor while logging in
+// @Description Start the enrollment of a user who has to log in with a second factor but has none, with the challenge token of the login. The first code at /users/login/two-factor enables it.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body dto.TwoFactorEnrollRequest true "Challenge token"
+// @Success 200 {object} dto.Response
+// @Failure 400 {object} dto.Response
+// @Failure 401 {object} dto.Response
+// @Failure 409 {object} dto.Response
+// @Router /users/login/two-factor/enroll [post]
+func (h *UserHandler) EnrollTwoFactorLogin(w http.ResponseWriter, r *http.Request) {
+	var req dto.TwoFactorEnrollRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.SendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := utils.ValidateStruct(req); err != nil {
+		utils.SendValidationErrorResponse(w, utils.GetValidationErrors(err))
+		return
+	}
+
+	enrollment, err := h.userService.EnrollTwoFactorLogin(r.Context(), req.ChallengeToken)
+	if err != nil {
+		h.sendTwoFactorError(w, err)
+		return
+	}
+	utils.SendSuccessResponse(w, http.StatusOK, toEnrollmentResponse(enrollment))
+}
+
+func (h *UserHandler) sendLoginError(w http.ResponseWriter, err error) {
+	var throttled *service.LoginThrottledError
+	switch {
+	case errors.As(err, &throttled):
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+		message := "Too many failed logins, try again later"
+		if throttled.Locked {
+			message = "Login temporarily locked after too many failed attempts"
+		}
+		utils.SendErrorResponse(w, http.StatusTooManyRequests, message)
+	case errors.Is(err, service.ErrInvalidCredentials):
 		utils.SendErrorResponse(w, http.StatusUnauthorized, "Unauthorized user")
+	case errors.Is(err, service.ErrInvalidChallenge):
+		utils.SendErrorResponse(w, http.StatusUnauthorized, "Invalid or expired login challenge")
+	case errors.Is(err, service.ErrInvalidTwoFactorCode):
+		utils.SendErrorResponse(w, http.StatusUnauthorized, "Invalid two-factor code")
+	case errors.Is(err, service.ErrTwoFactorNotEnrolled):
+		utils.SendErrorResponse(w, http.StatusBadRequest, "Enroll a second factor first")
+	default:
+		log.Printf("Failed to log in: %v", err)
+		utils.SendErrorResponse(w, http.StatusInternalServerError, "Failed to log in")
+	}
+}
+
+// @Summary Refresh tokens
+// @Description Trade a refresh token for a new access token and refresh token. A refresh token works once, reusing one revokes every token descending from the same login.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body dto.RefreshRequest true "Refresh token"
+// @Success 200 {object} dto.Response
+// @Failure 400 {object} dto.Response
+// @Failure 401 {object} dto.Response
+// @Router /users/refresh [post]
+func (h *UserHandler) RefreshTokens(w http.ResponseWriter, r *http.Request) {
+	var req dto.RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.SendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := utils.ValidateStruct(req); err != nil {
+		utils.SendValidationErrorResponse(w, utils.GetValidationErrors(err))
+		return
+	}
+
+	user, tokens, err := h.userService.RefreshTokens(r.Context(), req.RefreshToken)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidRefreshToken) {
+			utils.SendErrorResponse(w, http.StatusUnauthorized, "Invalid refresh token")
+			return
+		}
+		utils.SendErrorResponse(w, http.StatusInternalServerError, "Failed to refresh tokens")
+		return
+	}
+
+	utils.SendSuccessResponse(w, http.StatusOK, h.toAuthResponse(user, tokens))
+}
+
+// @Summary Logout user
+// @Description Revoke the refresh token with every token descending from the same login, and the access token of the Authorization header
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body dto.LogoutRequest false "Refresh token"
+// @Success 200 {object} dto.Response
+// @Failure 400 {object} dto.Response
+// @Router /users/logout [post]
+func (h *UserHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	var req dto.LogoutRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.SendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+	accessToken, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found {
+		accessToken = ""
+	}
+	if req.RefreshToken == "" && accessToken == "" {
+		utils.SendErrorResponse(w, http.StatusBadRequest, "A refresh token or bearer token is required")
+		return
+	}
+
+	if err := h.userService.Logout(r.Context(), req.RefreshToken, accessToken); err != nil {
+		utils.SendErrorResponse(w, http.StatusInternalServerError, "Failed to logout")
+		return
+	}
+	utils.SendSuccessResponse(w, http.StatusOK, "Logged out")
+}
+
+// @Summary Change password
+// @Description Change the password of the authenticated user. Every session of the user ends, the response holds new tokens for this one.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body dto.ChangePasswordRequest true "Current and new password"
+// @Success 200 {object} dto.Response
+// @Failure 400 {object} dto.Response
+// @Failure 401 {object} dto.Response
+// @Router /users/me/password [put]
+func (h *UserHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	claims, ok := sharedMiddleware.GetUserFromContext(r.Context())
+	if !ok {
+		utils.SendErrorResponse(w, http.StatusUnauthorized, "User authentication required")
+		return
+	}
+	var req dto.ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.SendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := utils.ValidateStruct(req); err != nil {
+		utils.SendValidationErrorResponse(w, utils.GetValidationErrors(err))
+		return
+	}
+
+	user, tokens, err := h.userService.ChangePassword(r.Context(), claims.UserID, req.CurrentPassword, req.NewPassword)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidPassword):
+			utils.SendErrorResponse(w, http.StatusBadRequest, "Current password is incorrect")
+		case errors.Is(err, repository.ErrorUserNotFound):
+			utils.SendErrorResponse(w, http.StatusUnauthorized, "User not found")
+		default:
+			utils.SendErrorResponse(w, http.StatusInternalServerError, "Failed to change password")
+		}
+		return
+	}
+	utils.SendSuccessResponse(w, http.StatusOK, h.toAuthResponse(user, tokens))
+}
+
+// @Summary Forgot password
+// @Description Send a password reset token to the email through the user.password_reset_requested event. The response is the same whether the email is registered or not.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body dto.ForgotPasswordRequest true "Email"
+// @Success 202 {object} dto.Response
+// @Failure 400 {object} dto.Response
+// @Router /users/password/forgot [post]
+func (h *UserHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req dto.ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.SendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := utils.ValidateStruct(req); err != nil {
+		utils.SendValidationErrorResponse(w, utils.GetValidationErrors(err))
+		return
+	}
+
+	// Answering before the lookup keeps the response time from telling
+	// registered emails apart
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), passwordResetTimeout)
+	go func() {
+		defer cancel()
+		if err := h.userService.RequestPasswordReset(ctx, req.Email); err != nil {
+			log.Printf("Failed to request password reset: %v", err)
+		}
+	}()
+	utils.SendSuccessResponse(w, http.StatusAccepted, "If the email is registered, a password reset token is on its way")
+}
+
+// @Summary Reset password
+// @Description Set a new password with a reset token. A token works once and every session of the user ends.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body dto.ResetPasswordRequest true "Reset token and new password"
+// @Success 200 {object} dto.Response
+// @Failure 400 {object} dto.Response
+// @Router /users/password/reset [post]
+func (h *UserHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req dto.ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.SendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := utils.ValidateStruct(req); err != nil {
+		utils.SendValidationErrorResponse(w, utils.GetValidationErrors(err))
+		return
+	}
+
+	if err := h.userService.ResetPassword(r.Context(), req.Token, req.NewPassword); err != nil {
+		if errors.Is(err, service.ErrInvalidResetToken) {
+			utils.SendErrorResponse(w, http.StatusBadRequest, "Invalid or expired reset token")
+			return
+		}
+		utils.SendErrorResponse(w, http.StatusInternalServerError, "Failed to reset password")
+		return
+	}
+	utils.SendSuccessResponse(w, http.StatusOK, "Password reset, please log in")
+}
+
+// @Summary Verify email
+// @Description Verify the email of a user with the token sent through the user.verification_requested event. Sent with the user's access token, the response holds new tokens carrying the verified email, needed to place orders. Otherwise it holds the user, who gets such tokens at the next refresh or login.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body dto.VerifyEmailRequest true "Verification token"
+// @Success 200 {object} dto.Response
+// @Failure 400 {object} dto.Response
+// @Router /users/verify [post]
+func (h *UserHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req dto.VerifyEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.SendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := utils.ValidateStruct(req); err != nil {
+		utils.SendValidationErrorResponse(w, utils.GetValidationErrors(err))
 		return
 	}
 
-	loginRes := dto.AuthResponse{
-		User: h.toUserResponse(user), Token: token,
+	var sessionUserID string
+	if claims, ok := sharedMiddleware.GetUserFromContext(r.Context()); ok {
+		sessionUserID = claims.UserID
+	}
+	user, tokens, err := h.userService.VerifyEmail(r.Context(), req.Token, sessionUserID)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidVerificationToken) {
+			utils.SendErrorResponse(w, http.StatusBadRequest, "Invalid or expired verification token")
+			return
+		}
+		utils.SendErrorResponse(w, http.StatusInternalServerError, "Failed to verify email")
+		return
+	}
+	if tokens != nil {
+		utils.SendSuccessResponse(w, http.StatusOK, h.toAuthResponse(user, tokens))
+		return
+	}
+	utils.SendSuccessResponse(w, http.StatusOK, h.toUserResponse(user))
+}
+
+// @Summary Resend verification
+// @Description Send a new verification token to the authenticated user, at most once per VERIFICATION_RESEND_INTERVAL
+// @Tags users
+// @Produce json
+// @Success 202 {object} dto.Response
+// @Failure 401 {object} dto.Response
+// @Failure 409 {object} dto.Response
+// @Failure 429 {object} dto.Response
+// @Router /users/verify/resend [post]
+func (h *UserHandler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	claims, ok := sharedMiddleware.GetUserFromContext(r.Context())
+	if !ok {
+		utils.SendErrorResponse(w, http.StatusUnauthorized, "User authentication required")
+		return
+	}
+
+	if err := h.userService.ResendVerification(r.Context(), claims.UserID); err != nil {
+		switch {
+		case errors.Is(err, service.ErrAlreadyVerified):
+			utils.SendErrorResponse(w, http.StatusConflict, "Email already verified")
+		case errors.Is(err, service.ErrVerificationThrottled):
+			utils.SendErrorResponse(w, http.StatusTooManyRequests, "A verification token was sent recently, try again later")
+		case errors.Is(err, repository.ErrorUserNotFound):
+			utils.SendErrorResponse(w, http.StatusUnauthorized, "User not found")
+		default:
+			utils.SendErrorResponse(w, http.StatusInternalServerError, "Failed to send verification token")
+		}
+		return
+	}
+	utils.SendSuccessResponse(w, http.StatusAccepted, "A verification token is on its way")
+}
+
+// @Summary Start two-factor enrollment
+// @Description Generate a TOTP secret for the authenticated user, to add to an authenticator app. It's enabled once confirmed with a first code.
+// @Tags users
+// @Produce json
+// @Success 200 {object} dto.Response
+// @Failure 401 {object} dto.Response
+// @Failure 409 {object} dto.Response
+// @Router /users/me/two-factor [post]
+func (h *UserHandler) StartTwoFactor(w http.ResponseWriter, r *http.Request) {
+	claims, ok := sharedMiddleware.GetUserFromContext(r.Context())
+	if !ok {
+		utils.SendErrorResponse(w, http.StatusUnauthorized, "User authentication required")
+		return
+	}
+
+	enrollment, err := h.userService.StartTwoFactor(r.Context(), claims.UserID)
+	if err != nil {
+		h.sendTwoFactorError(w, err)
+		return
+	}
+	utils.SendSuccessResponse(w, http.StatusOK, toEnrollmentResponse(enrollment))
+}
+
+// @Summary Confirm two-factor enrollment
+// @Description Enable the pending second factor of the authenticated user with a first TOTP code. The response carries the recovery codes, shown only this once.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body dto.TwoFactorCodeRequest true "TOTP code"
+// @Success 200 {object} dto.Response
+// @Failure 400 {object} dto.Response
+// @Failure 401 {object} dto.Response
+// @Failure 409 {object} dto.Response
+// @Router /users/me/two-factor/confirm [post]
+func (h *UserHandler) ConfirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	claims, ok := sharedMiddleware.GetUserFromContext(r.Context())
+	if !ok {
+		utils.SendErrorResponse(w, http.StatusUnauthorized, "User authentication required")
+		return
+	}
+	var req dto.TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.SendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := utils.ValidateStruct(req); err != nil {
+		utils.SendValidationErrorResponse(w, utils.GetValidationErrors(err))
+		return
+	}
+
+	codes, err := h.userService.ConfirmTwoFactor(r.Context(), claims.UserID, req.Code)
+	if err != nil {
+		h.sendTwoFactorError(w, err)
+		return
+	}
+	utils.SendSuccessResponse(w, http.StatusOK, &dto.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// @Summary Disable two-factor authentication
+// @Description Remove the second factor of the authenticated user with a TOTP or recovery code, unless the user is required to use one
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body dto.TwoFactorCodeRequest true "TOTP or recovery code"
+// @Success 200 {object} dto.Response
+// @Failure 400 {object} dto.Response
+// @Failure 401 {object} dto.Response
+// @Failure 403 {object} dto.Response
+// @Router /users/me/two-factor [delete]
+func (h *UserHandler) DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	claims, ok := sharedMiddleware.GetUserFromContext(r.Context())
+	if !ok {
+		utils.SendErrorResponse(w, http.StatusUnauthorized, "User authentication required")
+		return
+	}
+	var req dto.TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.SendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := utils.ValidateStruct(req); err != nil {
+		utils.SendValidationErrorResponse(w, utils.GetValidationErrors(err))
+		return
+	}
+
+	if err := h.userService.DisableTwoFactor(r.Context(), claims.UserID, req.Code); err != nil {
+		h.sendTwoFactorError(w, err)
+		return
+	}
+	utils.SendSuccessResponse(w, http.StatusOK, "Two-factor authentication disabled")
+}
+
+// @Summary Require two-factor authentication
+// @Description Require a user to log in with a second factor, ending the sessions of a user without one. Requires the users:write permission.
+// @Tags users
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} dto.Response
+// @Failure 403 {object} dto.Response
+// @Failure 404 {object} dto.Response
+// @Router /users/{id}/two-factor/required [put]
+func (h *UserHandler) RequireTwoFactor(w http.ResponseWriter, r *http.Request) {
+	h.setTwoFactorRequired(w, r, true)
+}
+
+// @Summary Stop requiring two-factor authentication
+// @Description Let a user log in without a second factor again, unless one of their roles requires it. Requires the users:write permission.
+// @Tags users
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} dto.Response
+// @Failure 403 {object} dto.Response
+// @Failure 404 {object} dto.Response
+// @Router /users/{id}/two-factor/required [delete]
+func (h *UserHandler) UnrequireTwoFactor(w http.ResponseWriter, r *http.Request) {
+	h.setTwoFactorRequired(w, r, false)
+}
+
+func (h *UserHandler) setTwoFactorRequired(w http.ResponseWriter, r *http.Request, required bool) {
+	user, err := h.userService.RequireTwoFactor(r.Context(), chi.URLParam(r, "id"), required)
+	if err != nil {
+		if errors.Is(err, repository.ErrorUserNotFound) {
+			utils.SendErrorResponse(w, http.StatusNotFound, "User not found")
+			return
+		}
+		utils.SendErrorResponse(w, http.StatusInternalServerError, "Failed to update two-factor requirement")
+		return
+	}
+	utils.SendSuccessResponse(w, http.StatusOK, h.toUserResponse(user))
+}
+
+func (h *UserHandler) sendTwoFactorError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidChallenge):
+		utils.SendErrorResponse(w, http.StatusUnauthorized, "Invalid or expired login challenge")
+	case errors.Is(err, service.ErrInvalidTwoFactorCode):
+		utils.SendErrorResponse(w, http.StatusBadRequest, "Invalid two-factor code")
+	case errors.Is(err, service.ErrTwoFactorEnabled):
+		utils.SendErrorResponse(w, http.StatusConflict, "Two-factor authentication already enabled")
+	case errors.Is(err, service.ErrTwoFactorNotEnrolled):
+		utils.SendErrorResponse(w, http.StatusBadRequest, "Two-factor authentication not enrolled")
+	case errors.Is(err, service.ErrTwoFactorRequired):
+		utils.SendErrorResponse(w, http.StatusForbidden, "Two-factor authentication is required for this user")
+	case errors.Is(err, repository.ErrorUserNotFound):
+		utils.SendErrorResponse(w, http.StatusUnauthorized, "User not found")
+	default:
+		log.Printf("Failed to update two-factor authentication: %v", err)
+		utils.SendErrorResponse(w, http.StatusInternalServerError, "Failed to update two-factor authentication")
+	}
+}
+
+func toEnrollmentResponse(enrollment *domain.TwoFactorEnrollment) *dto.TwoFactorEnrollmentResponse {
+	return &dto.TwoFactorEnrollmentResponse{
+		Secret:          enrollment.Secret,
+		ProvisioningURI: enrollment.URI,
+	}
+}
+
+// @Summary Grant a role
+// @Description Grant a role (customer, merchant, staff or admin) to a user, it applies to the tokens issued from then on. Requires the roles:manage permission.
+// @Tags users
+// @Produce json
+// @Param id path string true "User ID"
+// @Param role path string true "Role"
+// @Success 200 {object} dto.Response
+// @Failure 400 {object} dto.Response
+// @Failure 403 {object} dto.Response
+// @Failure 404 {object} dto.Response
+// @Router /users/{id}/roles/{role} [put]
+func (h *UserHandler) GrantRole(w http.ResponseWriter, r *http.Request) {
+	user, err := h.userService.GrantRole(r.Context(), chi.URLParam(r, "id"), chi.URLParam(r, "role"))
+	if err != nil {
+		h.sendRoleError(w, err)
+		return
+	}
+	utils.SendSuccessResponse(w, http.StatusOK, h.toUserResponse(user))
+}
+
+// @Summary Revoke a role
+// @Description Revoke a role from a user, ending their sessions so they log in again without it. Admins can't revoke their own admin role. Requires the roles:manage permission.
+// @Tags users
+// @Produce json
+// @Param id path string true "User ID"
+// @Param role path string true "Role"
+// @Success 200 {object} dto.Response
+// @Failure 400 {object} dto.Response
+// @Failure 403 {object} dto.Response
+// @Failure 404 {object} dto.Response
+// @Router /users/{id}/roles/{role} [delete]
+func (h *UserHandler) RevokeRole(w http.ResponseWriter, r *http.Request) {
+	id, role := chi.URLParam(r, "id"), chi.URLParam(r, "role")
+	// Keep admins from locking everyone out
+	if claims, ok := sharedMiddleware.GetUserFromContext(r.Context()); ok && claims.UserID == id && role == sharedMiddleware.RoleAdmin {
+		utils.SendErrorResponse(w, http.StatusBadRequest, "You can't revoke your own admin role")
+		return
+	}
+
+	user, err := h.userService.RevokeRole(r.Context(), id, role)
+	if err != nil {
+		h.sendRoleError(w, err)
+		return
+	}
+	utils.SendSuccessResponse(w, http.StatusOK, h.toUserResponse(user))
+}
+
+// @Summary Unlock a user
+// @Description Forget the failed logins for a user, lifting a lockout of the account. Requires the users:write permission.
+// @Tags users
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} dto.Response
+// @Failure 403 {object} dto.Response
+// @Failure 404 {object} dto.Response
+// @Router /users/{id}/unlock [post]
+func (h *UserHandler) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	user, err := h.userService.UnlockUser(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		if errors.Is(err, repository.ErrorUserNotFound) {
+			utils.SendErrorResponse(w, http.StatusNotFound, "User not found")
+			return
+		}
+		utils.SendErrorResponse(w, http.StatusInternalServerError, "Failed to unlock user")
+		return
+	}
+	utils.SendSuccessResponse(w, http.StatusOK, h.toUserResponse(user))
+}
+
+func (h *UserHandler) sendRoleError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrUnknownRole):
+		utils.SendErrorResponse(w, http.StatusBadRequest, "Unknown role")
+	case errors.Is(err, repository.ErrorUserNotFound):
+		utils.SendErrorResponse(w, http.StatusNotFound, "User not found")
+	default:
+		utils.SendErrorResponse(w, http.StatusInternalServerError, "Failed to update roles")
+	}
+}
+
+// clientIP is the client address established by the gateway, or the peer
+// address of requests made directly
+func clientIP(r *http.Request) string {
+	if identity, ok := sharedMiddleware.GetIdentityFromContext(r.Context()); ok && identity.ClientIP != "" {
+		return identity.ClientIP
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func (h *UserHandler) toAuthResponse(u *domain.User, tokens *domain.TokenPair) *dto.AuthResponse {
+	return &dto.AuthResponse{
+		User:         h.toUserResponse(u),
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresAt:    tokens.ExpiresAt,
 	}
-	utils.SendSuccessResponse(w, http.StatusOK, loginRes)
 }
 
 func (h *UserHandler) toUserResponse(u *domain.User) *dto.UserResponse {
 	return &dto.UserResponse{
-		ID:        u.ID.String(),
+		ID:        u.ID.Hex(),
 		Email:     u.Email,
 		FirstName: u.FirstName,
 		LastName:  u.LastName,
+		Roles:     u.Roles,
 		Address: &dto.AddressDTO{
 			Street:  u.Address.Street,
 			City:    u.Address.City,
@@ -207,9 +988,23 @@ func (h *UserHandler) toUserResponse(u *domain.User) *dto.UserResponse {
 			ZipCode: u.Address.ZipCode,
 			Country: u.Address.Country,
 		},
-		CreatedAt: u.CreatedAt,
-		UpdatedAt: u.UpdatedAt,
+		CreatedAt:         u.CreatedAt,
+		UpdatedAt:         u.UpdatedAt,
+		EmailVerified:     u.EmailVerified(),
+		TwoFactorEnabled:  u.TwoFactorEnabled(),
+		TwoFactorRequired: u.TwoFactorRequired,
+		Providers:         providerNames(u.Identities),
+	}
+}
+
+func providerNames(identities []domain.ExternalIdentity) []string {
+	var names []string
+	for _, identity := range identities {
+		if !slices.Contains(names, identity.Provider) {
+			names = append(names, identity.Provider)
+		}
 	}
+	return names
 }
 func (h *UserHandler) toUserListResponse(users []*domain.User) []dto.UserResponse {
 	res := make([]dto.UserResponse, len(users))
@@ -10,7 +10,7 @@ import (
 	sharedMiddleware "github.com/kaleabAlemayehu/eagle-commerce/shared/middleware"
 )
 
-func NewRouter(userHandler *handler.UserHandler, auth *sharedMiddleware.Auth) *chi.Mux {
+func NewRouter(userHandler *handler.UserHandler, jwksHandler *handler.JWKSHandler, identity *sharedMiddleware.IdentitySigner) *chi.Mux {
 	r := chi.NewRouter()
 
 	// Middleware
@@ -24,18 +24,56 @@ func NewRouter(userHandler *handler.UserHandler, auth *sharedMiddleware.Auth) *c
 		httpSwagger.URL("/swagger/doc.json"),
 	))
 
+	// Public keys of the access tokens
+	r.Get("/.well-known/jwks.json", jwksHandler.GetJWKS)
+
 	// Routes
 	r.Route("/api/v1", func(r chi.Router) {
+		// Only requests signed by the gateway carry a user
+		r.Use(identity.Middleware())
+
 		r.Route("/users", func(r chi.Router) {
 			r.Post("/login", userHandler.LoginUser)
+			r.Post("/login/two-factor", userHandler.VerifyTwoFactorLogin)
+			r.Post("/login/two-factor/enroll", userHandler.EnrollTwoFactorLogin)
+			r.Get("/login/oidc/providers", userHandler.ListLoginProviders)
+			r.Post("/login/oidc/{provider}/authorize", userHandler.StartOIDCLogin)
+			r.Post("/login/oidc/{provider}/callback", userHandler.CompleteOIDCLogin)
 			r.Post("/signup", userHandler.RegisterUser)
+			r.Post("/refresh", userHandler.RefreshTokens)
+			r.Post("/logout", userHandler.Logout)
+			r.Post("/password/forgot", userHandler.ForgotPassword)
+			r.Post("/password/reset", userHandler.ResetPassword)
+			r.Post("/verify", userHandler.VerifyEmail)
 			// Protected routes (with auth)
 			r.Group(func(r chi.Router) {
-				r.Use(auth.AuthMiddleware())
-				r.Get("/", userHandler.ListUsers)
+				r.Use(sharedMiddleware.RequireAuth)
+				r.With(sharedMiddleware.RequirePermission(sharedMiddleware.PermissionUsersRead)).Get("/", userHandler.ListUsers)
+				r.Get("/me", userHandler.GetMe)
+				r.Put("/me", userHandler.UpdateMe)
+				r.Put("/me/password", userHandler.ChangePassword)
+				r.Post("/verify/resend", userHandler.ResendVerification)
+				r.Post("/me/two-factor", userHandler.StartTwoFactor)
+				r.Post("/me/two-factor/confirm", userHandler.ConfirmTwoFactor)
+				r.Delete("/me/two-factor", userHandler.DisableTwoFactor)
+				r.Get("/me/addresses", userHandler.ListAddresses)
+				r.Post("/me/addresses", userHandler.AddAddress)
+				r.Get("/me/addresses/{addressID}", userHandler.GetAddress)
+				r.Put("/me/addresses/{addressID}", userHandler.UpdateAddress)
+				r.Delete("/me/addresses/{addressID}", userHandler.DeleteAddress)
 				r.Get("/{id}", userHandler.GetUser)
 				r.Put("/{id}", userHandler.UpdateUser)
-				r.Delete("/{id}", userHandler.DeleteUser)
+				r.With(sharedMiddleware.RequirePermission(sharedMiddleware.PermissionUsersWrite)).Delete("/{id}", userHandler.DeleteUser)
+				r.With(sharedMiddleware.RequirePermission(sharedMiddleware.PermissionUsersWrite)).Post("/{id}/unlock", userHandler.UnlockUser)
+				r.With(sharedMiddleware.RequirePermission(sharedMiddleware.PermissionUsersWrite)).Put("/{id}/two-factor/required", userHandler.RequireTwoFactor)
+				r.With(sharedMiddleware.RequirePermission(sharedMiddleware.PermissionUsersWrite)).Delete("/{id}/two-factor/required", userHandler.UnrequireTwoFactor)
+
+				// Role management
+				r.Group(func(r chi.Router) {
+					r.Use(sharedMiddleware.RequirePermission(sharedMiddleware.PermissionRolesManage))
+					r.Put("/{id}/roles/{role}", userHandler.GrantRole)
+					r.Delete("/{id}/roles/{role}", userHandler.RevokeRole)
+				})
 			})
 		})
 	})
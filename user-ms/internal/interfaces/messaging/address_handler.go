@@ -0,0 +1,103 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/application/service"
+	"github.com/kaleabAlemayehu/eagle-commerce/services/user-ms/internal/domain"
+	"github.com/kaleabAlemayehu/eagle-commerce/shared/messaging"
+	sharedMiddlware "github.com/kaleabAlemayehu/eagle-commerce/shared/middleware"
+	"github.com/kaleabAlemayehu/eagle-commerce/shared/models"
+)
+
+// AddressHandler answers the address lookups of other services, order-ms
+// resolves the address_id of an order through it. Requests carry the signed
+// identity of the caller, the same one the gateway sends over HTTP.
+type AddressHandler struct {
+	userService domain.UserService
+	natsClient  *messaging.NATSClient
+	signer      *sharedMiddlware.IdentitySigner
+}
+
+func NewAddressHandler(userService domain.UserService, natsClient *messaging.NATSClient, signer *sharedMiddlware.IdentitySigner) *AddressHandler {
+	return &AddressHandler{
+		userService: userService,
+		natsClient:  natsClient,
+		signer:      signer,
+	}
+}
+
+func (h *AddressHandler) StartListening() error {
+	_, err := h.natsClient.SubscribeToRequest(models.UserAddressResolveEvent, h.handleAddressResolve)
+	return err
+}
+
+// addressResolveResponse carries the address, or why there is none
+type addressResolveResponse struct {
+	Address  *domain.Address `json:"address,omitempty"`
+	Error    string          `json:"error,omitempty"`
+	NotFound bool            `json:"not_found,omitempty"`
+}
+
+// handleAddressResolve looks up an address in the address book of a user,
+// their default shipping address when no address_id is sent. Only the user
+// and callers who may place orders for them get an answer.
+func (h *AddressHandler) handleAddressResolve(msg *nats.Msg) {
+	identity, err := h.signer.VerifyMessage(msg)
+	if err != nil {
+		log.Printf("Rejected user.address.resolve request: %v", err)
+		respond(msg, addressResolveResponse{Error: "invalid identity"})
+		return
+	}
+
+	var request struct {
+		UserID    string `json:"user_id"`
+		AddressID string `json:"address_id"`
+	}
+	if err := json.Unmarshal(msg.Data, &request); err != nil {
+		log.Printf("Error unmarshaling user.address.resolve request: %v", err)
+		respond(msg, addressResolveResponse{Error: "invalid address request"})
+		return
+	}
+	if request.UserID == "" {
+		respond(msg, addressResolveResponse{Error: "user_id is required"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ctx = sharedMiddlware.ContextWithIdentity(ctx, identity)
+	if !sharedMiddlware.CanAccess(ctx, request.UserID, sharedMiddlware.PermissionOrdersWrite) {
+		respond(msg, addressResolveResponse{Error: sharedMiddlware.ErrForbidden.Error()})
+		return
+	}
+
+	address, err := h.userService.ResolveShippingAddress(ctx, request.UserID, request.AddressID)
+	if err != nil {
+		if errors.Is(err, service.ErrAddressNotFound) {
+			respond(msg, addressResolveResponse{Error: err.Error(), NotFound: true})
+			return
+		}
+		log.Printf("Error resolving address: %v", err)
+		respond(msg, addressResolveResponse{Error: "failed to resolve address"})
+		return
+	}
+	respond(msg, addressResolveResponse{Address: &address.Address})
+}
+
+func respond(msg *nats.Msg, response addressResolveResponse) {
+	respBytes, err := json.Marshal(response)
+	if err != nil {
+		log.Printf("Error marshaling user.address.resolve response: %v", err)
+		return
+	}
+	if err := msg.Respond(respBytes); err != nil {
+		log.Printf("Error responding to user.address.resolve request: %v", err)
+	}
+}